@@ -34,6 +34,14 @@ func (m *MockORM) DB() *sql.DB {
 	return m.db
 }
 
+func (m *MockORM) WithContext(ctx context.Context) gor.ORM {
+	return m
+}
+
+func (m *MockORM) Using(name string) gor.ORM {
+	return m
+}
+
 func (m *MockORM) Migrate(ctx context.Context) error {
 	return nil
 }
@@ -46,6 +54,14 @@ func (m *MockORM) MigrationStatus(ctx context.Context) ([]gor.Migration, error)
 	return nil, nil
 }
 
+func (m *MockORM) DumpSchema(w io.Writer) error {
+	return nil
+}
+
+func (m *MockORM) LoadSchema(r io.Reader) error {
+	return nil
+}
+
 func (m *MockORM) Register(models ...interface{}) error {
 	return nil
 }
@@ -10,11 +10,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cuemby/gor/pkg/gor"
 )
 
 // ContextKey is a type for context keys to avoid collisions
@@ -620,9 +623,10 @@ func (a *Authenticator) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Add user to context
+		// Add user to context, and attribute the request's changes to it
 		ctx := context.WithValue(r.Context(), UserContextKey, user)
 		ctx = context.WithValue(ctx, SessionContextKey, session)
+		ctx = gor.WithActor(ctx, strconv.FormatInt(user.ID, 10))
 
 		// Call next handler
 		next.ServeHTTP(w, r.WithContext(ctx))
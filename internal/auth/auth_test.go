@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -11,6 +12,8 @@ import (
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cuemby/gor/pkg/gor"
 )
 
 // Helper function to create a test authenticator with in-memory SQLite
@@ -678,6 +681,9 @@ func TestAuthenticator_Middleware(t *testing.T) {
 			if contextSession.Token != session.Token {
 				t.Errorf("Context session token = %v, want %v", contextSession.Token, session.Token)
 			}
+			if actor := gor.ActorFrom(r.Context()); actor != fmt.Sprint(user.ID) {
+				t.Errorf("ActorFrom() = %q, want the user's ID", actor)
+			}
 
 			w.WriteHeader(http.StatusOK)
 			_, _ = w.Write([]byte("authorized"))
@@ -61,16 +61,23 @@ func (c *ConsoleCommand) Run(args []string) error {
 	return nil
 }
 
-// MigrateCommand runs database migrations
-type MigrateCommand struct{}
+// MigrateCommand runs database migrations and the other database tasks.
+// The application registers the models, migrations and seeds, so the
+// tasks run inside it, through the db subcommand of its main.go.
+type MigrateCommand struct {
+	// runTask runs a db task in the application
+	runTask func(args ...string) error
+}
 
 func NewMigrateCommand() *MigrateCommand {
-	return &MigrateCommand{}
+	return &MigrateCommand{runTask: runAppTask}
 }
 
 func (c *MigrateCommand) Name() string        { return "migrate" }
 func (c *MigrateCommand) Description() string { return "Run database migrations" }
-func (c *MigrateCommand) Usage() string       { return "gor db migrate [up|down|status]" }
+func (c *MigrateCommand) Usage() string {
+	return "gor db migrate [up|down [steps]|status|diff <name>|reencrypt|schema:dump|schema:load|seed|reset]"
+}
 
 func (c *MigrateCommand) Run(args []string) error {
 	action := "up"
@@ -81,19 +88,37 @@ func (c *MigrateCommand) Run(args []string) error {
 	switch action {
 	case "up":
 		fmt.Println("↑️ Running migrations...")
-		fmt.Println("✓ All migrations completed")
 	case "down":
 		fmt.Println("↓️ Rolling back last migration...")
-		fmt.Println("✓ Rollback completed")
 	case "status":
-		fmt.Println("📄 Migration Status:")
-		fmt.Println("  20240101000001_create_users.go [applied]")
-		fmt.Println("  20240102000001_add_email_to_users.go [pending]")
+	case "diff":
+		fmt.Println("🔍 Comparing registered models with the database schema...")
+	case "reencrypt":
+		fmt.Println("🔐 Re-encrypting attributes with the newest key...")
+	case "schema:dump":
+		fmt.Println("📝 Dumping the database schema to db/schema.sql...")
+	case "schema:load":
+		fmt.Println("📥 Loading the database schema from db/schema.sql...")
+	case "seed":
+		fmt.Println("🌱 Seeding the database...")
+	case "reset":
+		fmt.Println("♻️ Resetting the database from db/schema.sql and seeding it...")
 	default:
 		return fmt.Errorf("unknown action: %s", action)
 	}
 
-	return nil
+	if len(args) == 0 {
+		args = []string{action}
+	}
+	return c.runTask(args...)
+}
+
+// runAppTask runs `go run . db <args>` in the application's directory
+func runAppTask(args ...string) error {
+	cmd := exec.Command("go", append([]string{"run", ".", "db"}, args...)...) // #nosec G204 - The action is checked against the known tasks
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
 }
 
 // RoutesCommand displays all routes
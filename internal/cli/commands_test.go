@@ -1,10 +1,15 @@
 package cli
 
 import (
+	"context"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/cuemby/gor/internal/orm"
+	"github.com/cuemby/gor/pkg/gor"
 )
 
 func captureOutput(f func()) string {
@@ -21,6 +26,42 @@ func captureOutput(f func()) string {
 	return string(out)
 }
 
+// appTasks returns a runner of db tasks that runs them in-process, as the
+// db subcommand of a generated application does, in a temporary
+// application with two SQL migrations
+func appTasks(tb testing.TB) func(args ...string) error {
+	dir := tb.TempDir()
+	oldDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = os.Chdir(oldDir) })
+
+	migrations := map[string]string{
+		"20240101000001_create_users.sql":       "-- +up\nCREATE TABLE users (id INTEGER PRIMARY KEY);\n-- +down\nDROP TABLE users;\n",
+		"20240102000001_add_email_to_users.sql": "-- +up\nALTER TABLE users ADD COLUMN email TEXT;\n-- +down\nALTER TABLE users DROP COLUMN email;\n",
+	}
+	if err := os.MkdirAll(orm.DefaultMigrationsDir, 0755); err != nil {
+		tb.Fatal(err)
+	}
+	for name, content := range migrations {
+		if err := os.WriteFile(filepath.Join(orm.DefaultMigrationsDir, name), []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	config := gor.DatabaseConfig{Driver: "sqlite3", Database: filepath.Join(dir, "development.db")}
+	db := orm.NewORM(config)
+	if err := db.Connect(context.Background(), config); err != nil {
+		tb.Fatalf("Failed to connect to database: %v", err)
+	}
+	tb.Cleanup(func() { _ = db.Close() })
+
+	return func(args ...string) error {
+		return orm.RunTask(context.Background(), db, args, os.Stdout)
+	}
+}
+
 func TestServerCommand(t *testing.T) {
 	cmd := NewServerCommand()
 
@@ -81,6 +122,7 @@ func TestConsoleCommand(t *testing.T) {
 
 func TestMigrateCommand(t *testing.T) {
 	cmd := NewMigrateCommand()
+	cmd.runTask = appTasks(t)
 
 	t.Run("Properties", func(t *testing.T) {
 		if cmd.Name() != "migrate" {
@@ -137,11 +179,11 @@ func TestMigrateCommand(t *testing.T) {
 		if !strings.Contains(output, "Migration Status") {
 			t.Error("Output should contain 'Migration Status'")
 		}
-		if !strings.Contains(output, "applied") {
-			t.Error("Output should show applied migrations")
+		if !strings.Contains(output, "20240101000001_create_users [applied]") {
+			t.Errorf("Output should show the applied migration, got %q", output)
 		}
-		if !strings.Contains(output, "pending") {
-			t.Error("Output should show pending migrations")
+		if !strings.Contains(output, "20240102000001_add_email_to_users [pending]") {
+			t.Errorf("Output should show the rolled back migration as pending, got %q", output)
 		}
 	})
 
@@ -339,6 +381,7 @@ func BenchmarkServerCommand_Run(b *testing.B) {
 
 func BenchmarkMigrateCommand_Run(b *testing.B) {
 	cmd := NewMigrateCommand()
+	cmd.runTask = appTasks(b)
 
 	// Redirect output to avoid console spam
 	old := os.Stdout
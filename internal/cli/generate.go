@@ -339,21 +339,12 @@ func (%s) TableName() string {
 	return "%ss"
 }
 
-// Validations
+// Validations run before create and update, after the validate tag rules
 func (m *%s) Validate() error {
 	// Add validations here
 	return nil
 }
-
-// Callbacks
-func (m *%s) BeforeCreate() error {
-	return m.Validate()
-}
-
-func (m *%s) BeforeUpdate() error {
-	return m.Validate()
-}
-`, name, name, fieldsStr, name, strings.ToLower(name), name, name, name)
+`, name, name, fieldsStr, name, strings.ToLower(name), name)
 }
 
 func (c *GenerateCommand) generateFullControllerContent(name, modelName string) string {
@@ -89,6 +89,7 @@ func (c *NewCommand) createDirectoryStructure(appPath string) error {
 		"config/locales",
 		"db/migrations",
 		"db/seeds",
+		"db/seeds/development",
 		"lib/tasks",
 		"log",
 		"public",
@@ -116,7 +117,7 @@ func (c *NewCommand) createDirectoryStructure(appPath string) error {
 func (c *NewCommand) generateFiles(appPath, appName string) error {
 	files := map[string]string{
 		"go.mod":                                    c.goModContent(appName),
-		"main.go":                                   c.mainGoContent(),
+		"main.go":                                   c.mainGoContent(appName),
 		"config/application.go":                     c.applicationContent(),
 		"config/database.yml":                       c.databaseYmlContent(),
 		"config/routes.go":                          c.routesContent(),
@@ -158,21 +159,32 @@ require (
 `, appName)
 }
 
-func (c *NewCommand) mainGoContent() string {
-	return `package main
+func (c *NewCommand) mainGoContent(appName string) string {
+	return fmt.Sprintf(`package main
 
 import (
+	"context"
 	"log"
 	"os"
 
-	"github.com/cuemby/gor/pkg/gor"
-	"./config"
+	"github.com/cuemby/gor/internal/orm"
+	"%[1]s/config"
+	_ "%[1]s/db/seeds"
 )
 
 func main() {
 	// Initialize application
 	app := config.NewApplication()
 
+	// gor db <task> runs database tasks, such as migrations and seeds,
+	// inside the application
+	if len(os.Args) > 1 && os.Args[1] == "db" {
+		if err := orm.RunTask(context.Background(), app.ORM(), os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Get port from environment or default
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -180,12 +192,12 @@ func main() {
 	}
 
 	// Start server
-	log.Printf("Starting Gor application on port %s", port)
+	log.Printf("Starting Gor application on port %%s", port)
 	if err := app.Start(":" + port); err != nil {
 		log.Fatal("Failed to start application:", err)
 	}
 }
-`
+`, appName)
 }
 
 func (c *NewCommand) applicationContent() string {
@@ -523,20 +535,33 @@ func (c *NewCommand) seedsContent() string {
 	return `package seeds
 
 import (
+	"context"
 	"log"
+
+	"github.com/cuemby/gor/internal/orm"
+	"github.com/cuemby/gor/pkg/gor"
 )
 
-// Run executes all seed data
-func Run() error {
+// Seeds run in name order on every ` + "`gor db seed`" + `, so they should be
+// idempotent. Register Go seeds here, with an environment to limit them to
+// it, or write YAML seeds in db/seeds/*.yml and db/seeds/<environment>/*.yml.
+func init() {
+	orm.RegisterSeed("", "001_admin_user", func(ctx context.Context, db gor.ORM) error {
+		// Example:
+		// admin := &models.User{Name: "Admin User"}
+		// _, err := orm.FindOrCreateBy(db, admin, map[string]interface{}{"email": "admin@example.com"})
+		// return err
+		return nil
+	})
+}
+
+// Run seeds the database with the seeds of env
+func Run(ctx context.Context, db gor.ORM, env string) error {
 	log.Println("Seeding database...")
 
-	// Add your seed data here
-	// Example:
-	// user := &models.User{
-	//     Name: "Admin User",
-	//     Email: "admin@example.com",
-	// }
-	// db.Create(user)
+	if err := orm.NewSeeder(db, env).Run(ctx); err != nil {
+		return err
+	}
 
 	log.Println("Database seeded successfully")
 	return nil
@@ -155,10 +155,16 @@ func TestNewCommand_ContentGenerators(t *testing.T) {
 	})
 
 	t.Run("mainGoContent", func(t *testing.T) {
-		content := cmd.mainGoContent()
+		content := cmd.mainGoContent("myapp")
 		if !strings.Contains(content, "func main()") {
 			t.Error("main.go should contain main function")
 		}
+		if !strings.Contains(content, `"myapp/config"`) || !strings.Contains(content, `_ "myapp/db/seeds"`) {
+			t.Error("main.go should import the application's config and seeds")
+		}
+		if !strings.Contains(content, `os.Args[1] == "db"`) || !strings.Contains(content, "orm.RunTask(context.Background(), app.ORM(), os.Args[2:], os.Stdout)") {
+			t.Error("main.go should run db tasks such as db seed inside the application")
+		}
 		if !strings.Contains(content, "app.Start") {
 			t.Error("main.go should start the application")
 		}
@@ -303,7 +309,7 @@ func TestNewCommand_ContentGenerators(t *testing.T) {
 
 	t.Run("seedsContent", func(t *testing.T) {
 		content := cmd.seedsContent()
-		if !strings.Contains(content, "func Run()") {
+		if !strings.Contains(content, "func Run(") || !strings.Contains(content, "orm.NewSeeder(db, env).Run(ctx)") {
 			t.Error("seeds.go should have Run function")
 		}
 		if !strings.Contains(content, "Seeding database") {
@@ -22,6 +22,17 @@ func (a *SQLiteAdapter) Connect(config gor.DatabaseConfig) (*sql.DB, error) {
 		dsn = ":memory:" // Default to in-memory database
 	}
 
+	// Transactions begin with BEGIN IMMEDIATE and so hold the write lock
+	// from the start: ForUpdate needs no upgrade, and a transaction that
+	// reads before it writes cannot fail with SQLITE_BUSY_SNAPSHOT
+	if !strings.Contains(dsn, "_txlock=") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + "_txlock=immediate"
+	}
+
 	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
@@ -80,54 +91,11 @@ func (a *SQLiteAdapter) Migrate(db *sql.DB, migrations []gor.Migration) error {
 }
 
 func (a *SQLiteAdapter) GenerateSQL(qb gor.QueryBuilder) (string, []interface{}, error) {
-	// This is a simplified implementation - would need to be expanded
-	gorQB := qb.(*QueryBuilder)
-
-	if gorQB.rawSQL != "" {
-		return gorQB.rawSQL, gorQB.rawArgs, nil
-	}
-
-	var sql strings.Builder
-	var args []interface{}
-
-	if gorQB.isCount {
-		sql.WriteString("SELECT COUNT(*) FROM ")
-	} else {
-		sql.WriteString("SELECT * FROM ")
-	}
-
-	sql.WriteString(gorQB.tableName)
-
-	// Add JOINs
-	for _, join := range gorQB.joins {
-		sql.WriteString(" ")
-		sql.WriteString(join)
-	}
-
-	// Add WHERE conditions
-	if len(gorQB.whereConditions) > 0 {
-		sql.WriteString(" WHERE ")
-		sql.WriteString(strings.Join(gorQB.whereConditions, " AND "))
-		args = append(args, gorQB.whereArgs...)
-	}
-
-	// Add ORDER BY
-	if len(gorQB.orderBy) > 0 {
-		sql.WriteString(" ORDER BY ")
-		sql.WriteString(strings.Join(gorQB.orderBy, ", "))
+	gorQB, ok := qb.(*QueryBuilder)
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported query builder %T", qb)
 	}
-
-	// Add LIMIT
-	if gorQB.limitValue != nil {
-		sql.WriteString(fmt.Sprintf(" LIMIT %d", *gorQB.limitValue))
-	}
-
-	// Add OFFSET
-	if gorQB.offsetValue != nil {
-		sql.WriteString(fmt.Sprintf(" OFFSET %d", *gorQB.offsetValue))
-	}
-
-	return sql.String(), args, nil
+	return buildSelectSQL(a, gorQB)
 }
 
 func (a *SQLiteAdapter) ColumnType(column gor.Column) string {
@@ -151,6 +119,8 @@ func (a *SQLiteAdapter) ColumnType(column gor.Column) string {
 		return "BLOB"
 	case "TIMESTAMP":
 		return "TIMESTAMP"
+	case "JSON":
+		return "TEXT"
 	default:
 		return "TEXT"
 	}
@@ -173,7 +143,11 @@ func (a *SQLiteAdapter) CreateTableSQL(tableName string, columns []gor.Column) s
 		def := fmt.Sprintf("%s %s", col.Name, a.ColumnType(col))
 
 		if col.PrimaryKey {
-			def += " PRIMARY KEY AUTOINCREMENT"
+			def += " PRIMARY KEY"
+			// SQLite only autoincrements integer keys
+			if a.ColumnType(col) == "INTEGER" {
+				def += " AUTOINCREMENT"
+			}
 		}
 
 		if !col.Nullable && !col.PrimaryKey {
@@ -247,66 +221,11 @@ func (a *PostgreSQLAdapter) Migrate(db *sql.DB, migrations []gor.Migration) erro
 }
 
 func (a *PostgreSQLAdapter) GenerateSQL(qb gor.QueryBuilder) (string, []interface{}, error) {
-	// Similar to SQLite but with PostgreSQL-specific syntax (e.g., $1, $2 instead of ?)
-	gorQB := qb.(*QueryBuilder)
-
-	if gorQB.rawSQL != "" {
-		return gorQB.rawSQL, gorQB.rawArgs, nil
-	}
-
-	var sql strings.Builder
-	var args []interface{}
-
-	if gorQB.isCount {
-		sql.WriteString("SELECT COUNT(*) FROM ")
-	} else {
-		sql.WriteString("SELECT * FROM ")
-	}
-
-	sql.WriteString(gorQB.tableName)
-
-	// Add JOINs
-	for _, join := range gorQB.joins {
-		sql.WriteString(" ")
-		sql.WriteString(join)
-	}
-
-	// Add WHERE conditions with PostgreSQL parameter style
-	if len(gorQB.whereConditions) > 0 {
-		sql.WriteString(" WHERE ")
-		// Convert ? placeholders to $1, $2, etc.
-		conditions := make([]string, len(gorQB.whereConditions))
-		paramIndex := 1
-		for i, condition := range gorQB.whereConditions {
-			// Simple replacement - would need more sophisticated parsing in production
-			placeholderCount := strings.Count(condition, "?")
-			for j := 0; j < placeholderCount; j++ {
-				condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", paramIndex), 1)
-				paramIndex++
-			}
-			conditions[i] = condition
-		}
-		sql.WriteString(strings.Join(conditions, " AND "))
-		args = append(args, gorQB.whereArgs...)
-	}
-
-	// Add ORDER BY
-	if len(gorQB.orderBy) > 0 {
-		sql.WriteString(" ORDER BY ")
-		sql.WriteString(strings.Join(gorQB.orderBy, ", "))
+	gorQB, ok := qb.(*QueryBuilder)
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported query builder %T", qb)
 	}
-
-	// Add LIMIT
-	if gorQB.limitValue != nil {
-		sql.WriteString(fmt.Sprintf(" LIMIT %d", *gorQB.limitValue))
-	}
-
-	// Add OFFSET
-	if gorQB.offsetValue != nil {
-		sql.WriteString(fmt.Sprintf(" OFFSET %d", *gorQB.offsetValue))
-	}
-
-	return sql.String(), args, nil
+	return buildSelectSQL(a, gorQB)
 }
 
 func (a *PostgreSQLAdapter) ColumnType(column gor.Column) string {
@@ -330,6 +249,8 @@ func (a *PostgreSQLAdapter) ColumnType(column gor.Column) string {
 		return "BYTEA"
 	case "TIMESTAMP":
 		return "TIMESTAMP"
+	case "JSON":
+		return "JSONB"
 	default:
 		return "TEXT"
 	}
@@ -425,54 +346,11 @@ func (a *MySQLAdapter) Migrate(db *sql.DB, migrations []gor.Migration) error {
 }
 
 func (a *MySQLAdapter) GenerateSQL(qb gor.QueryBuilder) (string, []interface{}, error) {
-	// Similar to SQLite implementation
-	gorQB := qb.(*QueryBuilder)
-
-	if gorQB.rawSQL != "" {
-		return gorQB.rawSQL, gorQB.rawArgs, nil
-	}
-
-	var sql strings.Builder
-	var args []interface{}
-
-	if gorQB.isCount {
-		sql.WriteString("SELECT COUNT(*) FROM ")
-	} else {
-		sql.WriteString("SELECT * FROM ")
-	}
-
-	sql.WriteString(gorQB.tableName)
-
-	// Add JOINs
-	for _, join := range gorQB.joins {
-		sql.WriteString(" ")
-		sql.WriteString(join)
-	}
-
-	// Add WHERE conditions
-	if len(gorQB.whereConditions) > 0 {
-		sql.WriteString(" WHERE ")
-		sql.WriteString(strings.Join(gorQB.whereConditions, " AND "))
-		args = append(args, gorQB.whereArgs...)
+	gorQB, ok := qb.(*QueryBuilder)
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported query builder %T", qb)
 	}
-
-	// Add ORDER BY
-	if len(gorQB.orderBy) > 0 {
-		sql.WriteString(" ORDER BY ")
-		sql.WriteString(strings.Join(gorQB.orderBy, ", "))
-	}
-
-	// Add LIMIT
-	if gorQB.limitValue != nil {
-		sql.WriteString(fmt.Sprintf(" LIMIT %d", *gorQB.limitValue))
-	}
-
-	// Add OFFSET
-	if gorQB.offsetValue != nil {
-		sql.WriteString(fmt.Sprintf(" OFFSET %d", *gorQB.offsetValue))
-	}
-
-	return sql.String(), args, nil
+	return buildSelectSQL(a, gorQB)
 }
 
 func (a *MySQLAdapter) ColumnType(column gor.Column) string {
@@ -496,6 +374,8 @@ func (a *MySQLAdapter) ColumnType(column gor.Column) string {
 		return "BLOB"
 	case "TIMESTAMP":
 		return "TIMESTAMP"
+	case "JSON":
+		return "JSON"
 	default:
 		return "TEXT"
 	}
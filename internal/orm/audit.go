@@ -0,0 +1,250 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// Events recorded in a Version
+const (
+	VersionCreate  = "create"
+	VersionUpdate  = "update"
+	VersionDestroy = "destroy"
+)
+
+// Version is one entry in the history of an audited model. Models opt in
+// by tagging a field, usually the embedded BaseModel, as audited:
+//
+//	type Invoice struct {
+//		gor.BaseModel `gor:"audited"`
+//		Total int64
+//	}
+//
+// Each Create, Update and Delete of the model then writes a row to the
+// versions table in the same transaction. Embed gor.Tracked as well so that
+// updates record only the columns that changed. Bulk inserts, updates and
+// deletes record a version for each row as well; audited rows are then
+// inserted one by one, so each version has the ID of its row.
+type Version struct {
+	ID       int64  `gor:"primary_key;auto_increment"`
+	ItemType string `gor:"not_null;index"`
+	ItemID   string `gor:"not_null;index"`
+	Event    string `gor:"not_null"`
+
+	// Changes maps each changed column to its old and new value, as JSON
+	Changes string
+
+	// Object holds the columns of the record before the event, as JSON;
+	// it is empty for creates
+	Object string
+
+	// Actor is who made the change and RequestID the request it was part of
+	Actor     string
+	RequestID string
+	CreatedAt time.Time `gor:"not_null"`
+
+	// keys decrypts the encrypted columns of Object
+	keys *keyring
+}
+
+// TableName returns the versions table
+func (v *Version) TableName() string { return "versions" }
+
+// ChangeSet returns the changes of the version. Values are decoded from
+// JSON, so numbers are float64 and times are strings.
+func (v *Version) ChangeSet() (map[string]gor.Change, error) {
+	var pairs map[string][2]interface{}
+	if err := json.Unmarshal([]byte(v.Changes), &pairs); err != nil {
+		return nil, fmt.Errorf("invalid changes in version %d: %w", v.ID, err)
+	}
+
+	changes := make(map[string]gor.Change, len(pairs))
+	for column, pair := range pairs {
+		changes[column] = gor.Change{Old: pair[0], New: pair[1]}
+	}
+	return changes, nil
+}
+
+// Reify loads into dest, a pointer to the audited model, the record as it
+// was before the version's event. Columns that no longer exist on the
+// model are ignored, and encrypted columns are decrypted with the keyring
+// of the database the version was loaded from by Versions.
+func (v *Version) Reify(dest interface{}) error {
+	if v.Object == "" {
+		return fmt.Errorf("%s version %d has no earlier state", v.Event, v.ID)
+	}
+
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("destination must be a pointer to a struct")
+	}
+
+	var columns map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(v.Object), &columns); err != nil {
+		return fmt.Errorf("invalid object in version %d: %w", v.ID, err)
+	}
+
+	schema := schemaOf(target.Type())
+	for column, raw := range columns {
+		field := schema.FieldByColumn(column)
+		if field == nil {
+			continue
+		}
+		// JSON columns were recorded as their encoding
+		if field.HasOption("json") {
+			var encoded *string
+			if err := json.Unmarshal(raw, &encoded); err == nil && encoded != nil {
+				raw = json.RawMessage(*encoded)
+			}
+		}
+		if err := json.Unmarshal(raw, target.Elem().FieldByIndex(field.Index).Addr().Interface()); err != nil {
+			return fmt.Errorf("cannot restore %s from version %d: %w", column, v.ID, err)
+		}
+	}
+	return decryptFields(v.keys, target.Elem())
+}
+
+// Versions returns the history of model, oldest first
+func Versions(store recordStore, model interface{}) ([]Version, error) {
+	var versions []Version
+	err := store.Query(&Version{}).
+		Where("item_type = ? AND item_id = ?", getTableName(reflect.TypeOf(model)), fmt.Sprint(getID(model))).
+		Order("id").
+		FindAll(&versions)
+
+	keys := storeKeyring(store)
+	for i := range versions {
+		versions[i].keys = keys
+	}
+	return versions, err
+}
+
+// Revert restores model to its state before version and saves it. A
+// destroyed record is created again with its old ID, unless it was only
+// soft-deleted. The revert is itself recorded as a new version.
+func Revert(store recordStore, version *Version, model interface{}) error {
+	if err := version.Reify(model); err != nil {
+		return err
+	}
+
+	if version.Event == VersionDestroy && softDeleteFieldOf(reflect.TypeOf(model)) == nil {
+		return store.Create(model)
+	}
+	return store.Update(model)
+}
+
+// WithActor returns a context whose audited changes are attributed to
+// actor. It is gor.WithActor, which authentication middleware calls with
+// the signed-in user; jobs and scripts call it themselves.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return gor.WithActor(ctx, actor)
+}
+
+// storedRow loads the stored row with the given ID when saving modelType
+// writes other rows, so its state before an update or delete can be
+// recorded and its counters moved. It returns nil for other models and
+// missing rows.
+func storedRow(ex executor, adapter gor.DatabaseAdapter, table string, modelType reflect.Type, id interface{}) (interface{}, error) {
+	if !savesAtomically(modelType) {
+		return nil, nil
+	}
+
+	before := reflect.New(indirectType(modelType)).Interface()
+	if err := findRecord(ex, adapter, table, id, before); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return before, nil
+}
+
+// recordVersion writes the version of an audited record for event, given
+// the record before and after it; before is nil for creates and after for
+// deletes
+func recordVersion(ex executor, adapter gor.DatabaseAdapter, table, event string, before, after interface{}) error {
+	model := after
+	if model == nil {
+		model = before
+	}
+	if model == nil || !schemaOf(reflect.TypeOf(model)).Audited {
+		return nil
+	}
+
+	changes := make(map[string][2]interface{})
+	var oldValues map[string]interface{}
+	if before != nil {
+		columns, values := modelValues(before, true)
+		oldValues = make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			oldValues[column] = values[i]
+			if after == nil {
+				changes[column] = [2]interface{}{values[i], nil}
+			}
+		}
+	}
+	if after != nil {
+		columns, values := modelValues(after, true)
+		for i, column := range columns {
+			old, ok := oldValues[column]
+			if ok && sameValue(old, values[i]) {
+				continue
+			}
+			changes[column] = [2]interface{}{old, values[i]}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	// Encrypted columns are kept encrypted in the history as well
+	for _, field := range schemaOf(reflect.TypeOf(model)).Encrypted {
+		var err error
+		if pair, ok := changes[field.Column]; ok {
+			for i := range pair {
+				if pair[i], err = encryptValue(keyringOf(ex), field, pair[i]); err != nil {
+					return fmt.Errorf("cannot record %s: %w", field.Column, err)
+				}
+			}
+			changes[field.Column] = pair
+		}
+		if old, ok := oldValues[field.Column]; ok {
+			if oldValues[field.Column], err = encryptValue(keyringOf(ex), field, old); err != nil {
+				return fmt.Errorf("cannot record %s: %w", field.Column, err)
+			}
+		}
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("cannot record changes of %s: %w", table, err)
+	}
+
+	ctx := contextOf(ex)
+	version := &Version{
+		ItemType:  table,
+		ItemID:    fmt.Sprint(getID(model)),
+		Event:     event,
+		Changes:   string(changesJSON),
+		Actor:     gor.ActorFrom(ctx),
+		RequestID: gor.RequestIDFrom(ctx),
+		CreatedAt: time.Now(),
+	}
+
+	if before != nil {
+		object, err := json.Marshal(oldValues)
+		if err != nil {
+			return fmt.Errorf("cannot record %s: %w", table, err)
+		}
+		version.Object = string(object)
+	}
+
+	return insertRecord(ex, adapter, version.TableName(), version)
+}
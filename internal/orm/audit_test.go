@@ -0,0 +1,216 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+	"github.com/cuemby/gor/pkg/middleware"
+)
+
+type AuditedInvoice struct {
+	gor.BaseModel `gor:"audited"`
+	gor.Tracked
+	Number string `gor:"not_null"`
+	Total  int64  `gor:"not_null"`
+}
+
+func (i *AuditedInvoice) TableName() string { return "audited_invoices" }
+
+func setupAuditORM(t *testing.T) gor.ORM {
+	orm := setupTestORM(t)
+	if err := orm.Register(&AuditedInvoice{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+	return orm
+}
+
+func versionEvents(t *testing.T, orm gor.ORM, model interface{}) []string {
+	t.Helper()
+	versions, err := Versions(orm, model)
+	if err != nil {
+		t.Fatalf("Versions() error = %v", err)
+	}
+	events := make([]string, len(versions))
+	for i, version := range versions {
+		events[i] = version.Event
+	}
+	return events
+}
+
+func TestAudit_RecordsVersions(t *testing.T) {
+	orm := setupAuditORM(t)
+	invoice := &AuditedInvoice{Number: "INV-1", Total: 100}
+
+	request := &gor.Context{Context: context.Background(), Request: httptest.NewRequest("POST", "/invoices", nil), Response: httptest.NewRecorder()}
+	request.Request.SetBasicAuth("ada", "secret")
+	auth := middleware.BasicAuth("invoices", map[string]string{"ada": "secret"})
+	handler := middleware.RequestID()(auth(func(ctx *gor.Context) error {
+		// The actor and request ID travel as context values, so they
+		// survive contexts derived from the request's
+		db := orm.WithContext(WithDatabaseSession(ctx))
+		if err := db.Create(invoice); err != nil {
+			return err
+		}
+		invoice.Total = 150
+		if err := db.Update(invoice); err != nil {
+			return err
+		}
+		return db.Delete(invoice)
+	}))
+	if err := handler(request); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+
+	versions, err := Versions(orm, invoice)
+	if err != nil {
+		t.Fatalf("Versions() error = %v", err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("Versions() = %d versions, want 3", len(versions))
+	}
+	for i, event := range []string{VersionCreate, VersionUpdate, VersionDestroy} {
+		version := versions[i]
+		if version.Event != event || version.Actor != "ada" || version.RequestID == "" || version.RequestID != versions[0].RequestID {
+			t.Errorf("version %d = %s by %q in request %q, want %s by ada in one request", i, version.Event, version.Actor, version.RequestID, event)
+		}
+	}
+
+	changes, err := versions[1].ChangeSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes["total"] != (gor.Change{Old: float64(100), New: float64(150)}) {
+		t.Errorf("update ChangeSet() = %v, want total and updated_at", changes)
+	}
+
+	var before AuditedInvoice
+	if err := versions[1].Reify(&before); err != nil {
+		t.Fatalf("Reify() error = %v", err)
+	}
+	if before.ID != invoice.ID || before.Number != "INV-1" || before.Total != 100 {
+		t.Errorf("Reify() = %+v, want the invoice before the update", before)
+	}
+	if err := versions[0].Reify(&before); err == nil {
+		t.Error("Reify() of a create version should fail")
+	}
+
+	// Reverting the delete brings the invoice back as it was
+	restored := &AuditedInvoice{}
+	if err := Revert(orm, &versions[2], restored); err != nil {
+		t.Fatalf("Revert() error = %v", err)
+	}
+	var found AuditedInvoice
+	if err := orm.Find(&found, invoice.ID); err != nil || found.Total != 150 {
+		t.Errorf("invoice after Revert() = %+v, %v; want total 150", found, err)
+	}
+	if events := versionEvents(t, orm, invoice); !reflect.DeepEqual(events, []string{"create", "update", "destroy", "create"}) {
+		t.Errorf("events after Revert() = %v", events)
+	}
+}
+
+func TestAudit_TablesAndTransactions(t *testing.T) {
+	orm := setupAuditORM(t)
+	ctx := WithActor(context.Background(), "billing-job")
+	invoices := orm.WithContext(ctx).Table("audited_invoices")
+
+	invoice := &AuditedInvoice{Number: "INV-2", Total: 10}
+	if err := invoices.Create(invoice); err != nil {
+		t.Fatalf("Table.Create() error = %v", err)
+	}
+	invoice.Total = 20
+	if err := invoices.Update(invoice); err != nil {
+		t.Fatalf("Table.Update() error = %v", err)
+	}
+
+	// An unchanged save records nothing
+	if err := orm.Update(invoice); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	errRollback := errors.New("rollback")
+	err := orm.Transaction(ctx, func(tx gor.Transaction) error {
+		invoice.Total = 30
+		if err := tx.Update(invoice); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	if err := invoices.Delete(invoice.ID); err != nil {
+		t.Fatalf("Table.Delete() error = %v", err)
+	}
+
+	versions, err := Versions(orm, invoice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	for _, version := range versions {
+		events = append(events, version.Event)
+		if version.Actor != "billing-job" {
+			t.Errorf("%s version Actor = %q, want billing-job", version.Event, version.Actor)
+		}
+	}
+	if !reflect.DeepEqual(events, []string{"create", "update", "destroy"}) {
+		t.Errorf("events = %v, want the rolled back update left out", events)
+	}
+
+	user := &TestUser{Name: "ada", Email: "ada@example.com"}
+	if err := orm.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	if events := versionEvents(t, orm, user); len(events) != 0 {
+		t.Errorf("models that are not audited got versions %v", events)
+	}
+}
+
+func TestAudit_BulkOperations(t *testing.T) {
+	orm := setupAuditORM(t)
+	invoices := orm.WithContext(WithActor(context.Background(), "import")).Table("audited_invoices")
+
+	batch := []AuditedInvoice{{Number: "INV-3", Total: 30}, {Number: "INV-4", Total: 40}}
+	if err := invoices.BulkInsert(batch); err != nil {
+		t.Fatalf("BulkInsert() error = %v", err)
+	}
+	if batch[0].ID == 0 || batch[1].ID == 0 {
+		t.Fatalf("BulkInsert() left IDs %d, %d; want the inserted rows' IDs", batch[0].ID, batch[1].ID)
+	}
+
+	batch[0].Total = 35
+	if err := invoices.BulkUpdate(batch); err != nil {
+		t.Fatalf("BulkUpdate() error = %v", err)
+	}
+	if err := invoices.BulkDelete([]uint{batch[0].ID, batch[1].ID}); err != nil {
+		t.Fatalf("BulkDelete() error = %v", err)
+	}
+
+	// The unchanged second invoice records no update
+	for i, want := range [][]string{{"create", "update", "destroy"}, {"create", "destroy"}} {
+		if events := versionEvents(t, orm, &batch[i]); !reflect.DeepEqual(events, want) {
+			t.Errorf("invoice %d events = %v, want %v", i, events, want)
+		}
+	}
+	versions, err := Versions(orm, &batch[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range versions {
+		if version.Actor != "import" {
+			t.Errorf("%s version Actor = %q, want import", version.Event, version.Actor)
+		}
+	}
+	changes, err := versions[1].ChangeSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes["total"] != (gor.Change{Old: float64(30), New: float64(35)}) {
+		t.Errorf("bulk update ChangeSet() = %v, want the total's change", changes)
+	}
+}
@@ -0,0 +1,148 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// sqlConn is the context-aware side of *sql.DB and *sql.Tx
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// contextExecutor runs every statement with its context, so cancellation
+// and deadlines reach the driver, tags the statement with the context's
+// query tags, reports it to the query observers and notes writes in the
+// context's database session
+type contextExecutor struct {
+	ctx  context.Context
+	conn sqlConn
+
+	// dialect explains slow statements and keys encrypts and decrypts the
+	// encrypted columns of the ORM the statements run for
+	dialect sqlDialect
+	keys    *keyring
+}
+
+// withContext binds ctx to a connection or transaction of the ORM whose
+// keyring is keys
+func withContext(ctx context.Context, conn sqlConn, adapter gor.DatabaseAdapter, keys *keyring) executor {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return contextExecutor{ctx: ctx, conn: conn, dialect: dialectFor(adapter), keys: keys}
+}
+
+// contextOf returns the context the statements of ex run with
+func contextOf(ex executor) context.Context {
+	if e, ok := ex.(contextExecutor); ok {
+		return e.ctx
+	}
+	return context.Background()
+}
+
+// keyringOf returns the keyring of the ORM the statements of ex run for
+func keyringOf(ex executor) *keyring {
+	if e, ok := ex.(contextExecutor); ok {
+		return e.keys
+	}
+	return nil
+}
+
+func (e contextExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	noteWrite(e.ctx, query)
+	if !instrumented(e.ctx) {
+		return e.conn.ExecContext(e.ctx, tagQuery(e.ctx, query), args...)
+	}
+
+	start := time.Now()
+	result, err := e.conn.ExecContext(e.ctx, tagQuery(e.ctx, query), args...)
+	rows := int64(-1)
+	if err == nil {
+		if affected, rowsErr := result.RowsAffected(); rowsErr == nil {
+			rows = affected
+		}
+	}
+	e.observe(query, args, start, rows, err, true)
+	return result, err
+}
+
+func (e contextExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	noteWrite(e.ctx, query)
+	if !instrumented(e.ctx) {
+		return e.conn.QueryContext(e.ctx, tagQuery(e.ctx, query), args...)
+	}
+
+	start := time.Now()
+	rows, err := e.conn.QueryContext(e.ctx, tagQuery(e.ctx, query), args...)
+	e.observe(query, args, start, -1, err, false)
+	return rows, err
+}
+
+func (e contextExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
+	noteWrite(e.ctx, query)
+	if !instrumented(e.ctx) {
+		return e.conn.QueryRowContext(e.ctx, tagQuery(e.ctx, query), args...)
+	}
+
+	start := time.Now()
+	row := e.conn.QueryRowContext(e.ctx, tagQuery(e.ctx, query), args...)
+	e.observe(query, args, start, -1, row.Err(), false)
+	return row
+}
+
+type queryTagsKey struct{}
+
+// WithQueryTags returns a context whose statements carry the tags, such as
+// a request ID or controller action, as a trailing SQL comment so they
+// appear in database query logs:
+//
+//	SELECT * FROM "users" /*request_id='abc123'*/
+//
+// Tags are merged with any already on ctx.
+func WithQueryTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string, len(tags))
+	for key, value := range QueryTags(ctx) {
+		merged[key] = value
+	}
+	for key, value := range tags {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, queryTagsKey{}, merged)
+}
+
+// QueryTags returns the query tags carried by ctx
+func QueryTags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(queryTagsKey{}).(map[string]string)
+	return tags
+}
+
+// tagQuery appends the context's query tags to a statement. Keys and
+// values are URL-encoded so they cannot end the comment.
+func tagQuery(ctx context.Context, query string) string {
+	tags := QueryTags(ctx)
+	if len(tags) == 0 {
+		return query
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = url.QueryEscape(key) + "='" + url.QueryEscape(tags[key]) + "'"
+	}
+
+	return query + " /*" + strings.Join(pairs, ",") + "*/"
+}
@@ -0,0 +1,87 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+func TestWithContext_CanceledContextStopsStatements(t *testing.T) {
+	orm := setupTestORM(t)
+	user := &TestUser{Name: "ada", Email: "ada@example.com"}
+	if err := orm.Create(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var found TestUser
+	if err := orm.WithContext(ctx).Find(&found, user.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("ORM.WithContext().Find() error = %v, want context.Canceled", err)
+	}
+	if err := orm.WithContext(ctx).Create(&TestUser{Name: "bob", Email: "bob@example.com"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ORM.WithContext().Create() error = %v, want context.Canceled", err)
+	}
+	if _, err := orm.Query(&TestUser{}).WithContext(ctx).Count(); !errors.Is(err, context.Canceled) {
+		t.Errorf("QueryBuilder.WithContext().Count() error = %v, want context.Canceled", err)
+	}
+	if err := orm.Table("users").WithContext(ctx).Find(user.ID, &found); !errors.Is(err, context.Canceled) {
+		t.Errorf("Table.WithContext().Find() error = %v, want context.Canceled", err)
+	}
+
+	// The original ORM keeps its own context
+	if err := orm.Find(&found, user.ID); err != nil {
+		t.Errorf("Find() after a canceled WithContext() error = %v", err)
+	}
+}
+
+func TestWithContext_TransactionViewSharesCallbacks(t *testing.T) {
+	orm := setupTestORM(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var committed bool
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		view := tx.WithContext(ctx)
+		view.AfterCommit(func() { committed = true })
+		if err := view.Create(&TestUser{Name: "ada", Email: "ada@example.com"}); err != nil {
+			return err
+		}
+
+		cancel()
+		if err := view.Create(&TestUser{Name: "bob", Email: "bob@example.com"}); !errors.Is(err, context.Canceled) {
+			t.Errorf("Create() with a canceled view error = %v, want context.Canceled", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+	if !committed {
+		t.Error("AfterCommit() registered on a context view did not run")
+	}
+	if count, _ := orm.Query(&TestUser{}).Count(); count != 1 {
+		t.Errorf("users after commit = %d, want 1", count)
+	}
+}
+
+func TestQueryTags(t *testing.T) {
+	ctx := WithQueryTags(context.Background(), map[string]string{"request_id": "abc123"})
+	ctx = WithQueryTags(ctx, map[string]string{"action": "users#index", "note": "*/ DROP"})
+
+	got := tagQuery(ctx, `SELECT * FROM "users"`)
+	want := `SELECT * FROM "users" /*action='users%23index',note='%2A%2F+DROP',request_id='abc123'*/`
+	if got != want {
+		t.Errorf("tagQuery() = %s, want %s", got, want)
+	}
+	if got := tagQuery(context.Background(), "SELECT 1"); got != "SELECT 1" {
+		t.Errorf("tagQuery() without tags = %s", got)
+	}
+
+	orm := setupTestORM(t)
+	if _, err := orm.WithContext(ctx).Query(&TestUser{}).Count(); err != nil {
+		t.Errorf("Count() with query tags error = %v", err)
+	}
+}
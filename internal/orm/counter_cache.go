@@ -0,0 +1,138 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// Counter caches keep a count of a model's rows on the parent each row
+// belongs to, so listing parents with their counts needs no COUNT query:
+//
+//	type Comment struct {
+//		PostID int64
+//		Post   *Post `gor:"belongs_to;counter_cache"`
+//	}
+//
+// Creating a comment increments posts.comments_count and deleting it, soft
+// deletes included, decrements it in the same transaction. Saving a
+// comment that moved to another post moves the count along. Bulk inserts,
+// updates and deletes keep the counts as well.
+
+// savesAtomically reports whether saving a model of modelType also writes
+// other rows, its version or its parents' counters, so the save has to
+// run in a transaction
+func savesAtomically(modelType reflect.Type) bool {
+	if modelType == nil {
+		return false
+	}
+	schema := schemaOf(modelType)
+	return schema.Audited || len(schema.CounterCaches) > 0
+}
+
+// counterTarget returns the parent table and key whose counter a record
+// counts towards through assoc. ok is false when the record has no parent.
+func counterTarget(record reflect.Value, assoc *association) (table string, key interface{}, ok bool, err error) {
+	schema := schemaOf(record.Type())
+	fkField := schema.FieldByColumn(assoc.foreignKey)
+	if fkField == nil {
+		return "", nil, false, fmt.Errorf("%s has no %s column", schema.Type.Name(), assoc.foreignKey)
+	}
+
+	fk := record.FieldByIndex(fkField.Index)
+	if fk.Kind() == reflect.Ptr {
+		if fk.IsNil() {
+			return "", nil, false, nil
+		}
+		fk = fk.Elem()
+	}
+	if fk.IsZero() {
+		return "", nil, false, nil
+	}
+
+	if !assoc.polymorphic {
+		return schemaOf(assoc.model).Table, fk.Interface(), true, nil
+	}
+
+	typeField := schema.FieldByColumn(assoc.typeColumn)
+	if typeField == nil {
+		return "", nil, false, fmt.Errorf("%s has no %s column", schema.Type.Name(), assoc.typeColumn)
+	}
+	table = record.FieldByIndex(typeField.Index).String()
+	if table == "" {
+		return "", nil, false, nil
+	}
+
+	// The table comes from the row, so only registered tables are trusted
+	if _, registered := modelTypeForTable(table); !registered {
+		return "", nil, false, fmt.Errorf("%s %q is not a registered model table", assoc.typeColumn, table)
+	}
+	return table, fk.Interface(), true, nil
+}
+
+// updateCounterCaches adds delta to the counters record keeps on its
+// parents. record is nil when there is nothing to count.
+func updateCounterCaches(ex executor, adapter gor.DatabaseAdapter, record interface{}, delta int) error {
+	if record == nil {
+		return nil
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(record))
+	for _, assoc := range schemaOf(v.Type()).CounterCaches {
+		if err := updateCounter(ex, adapter, v, assoc, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveCounterCaches moves the counts of a saved record whose parent
+// changed from its parent before the save to its new one
+func moveCounterCaches(ex executor, adapter gor.DatabaseAdapter, before, after interface{}) error {
+	if before == nil || after == nil {
+		return nil
+	}
+
+	old := reflect.Indirect(reflect.ValueOf(before))
+	current := reflect.Indirect(reflect.ValueOf(after))
+	for _, assoc := range schemaOf(current.Type()).CounterCaches {
+		oldTable, oldKey, _, err := counterTarget(old, assoc)
+		if err != nil {
+			return err
+		}
+		table, key, _, err := counterTarget(current, assoc)
+		if err != nil {
+			return err
+		}
+		if oldTable == table && keyOf(reflect.ValueOf(oldKey)) == keyOf(reflect.ValueOf(key)) {
+			continue
+		}
+
+		if err := updateCounter(ex, adapter, old, assoc, -1); err != nil {
+			return err
+		}
+		if err := updateCounter(ex, adapter, current, assoc, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateCounter adds delta to the counter record keeps through assoc
+func updateCounter(ex executor, adapter gor.DatabaseAdapter, record reflect.Value, assoc *association, delta int) error {
+	table, key, ok, err := counterTarget(record, assoc)
+	if err != nil || !ok {
+		return err
+	}
+
+	d := dialectFor(adapter)
+	column := d.QuoteIdentifier(assoc.counterCache)
+	query := fmt.Sprintf("UPDATE %s SET %s = COALESCE(%s, 0) + ? WHERE %s = ?", // #nosec G201 - Identifiers come from model metadata and registered tables
+		d.QuoteIdentifier(table), column, column, d.QuoteIdentifier(assoc.references))
+
+	if _, err := ex.Exec(rebind(d, query), delta, key); err != nil {
+		return fmt.Errorf("failed to update %s.%s: %w", table, assoc.counterCache, err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type PolyPost struct {
+	ID             int64         `gor:"primary_key;auto_increment"`
+	Title          string        `gor:"not_null"`
+	CommentsCount  int64         `gor:"not_null;default:0"`
+	PolyLikesCount int64         `gor:"not_null;default:0"`
+	Comments       []PolyComment `gor:"has_many;as:commentable"`
+}
+
+func (p *PolyPost) TableName() string { return "poly_posts" }
+
+type PolyPhoto struct {
+	ID            int64          `gor:"primary_key;auto_increment"`
+	URL           string         `gor:"not_null"`
+	CommentsCount int64          `gor:"not_null;default:0"`
+	Comments      []*PolyComment `gor:"has_many;as:commentable"`
+}
+
+func (p *PolyPhoto) TableName() string { return "poly_photos" }
+
+type PolyComment struct {
+	ID              int64       `gor:"primary_key;auto_increment"`
+	Body            string      `gor:"not_null"`
+	CommentableType string      `gor:"not_null"`
+	CommentableID   int64       `gor:"not_null"`
+	Commentable     interface{} `gor:"belongs_to;polymorphic;counter_cache:comments_count"`
+}
+
+func (c *PolyComment) TableName() string { return "poly_comments" }
+
+type PolyLike struct {
+	ID         int64     `gor:"primary_key;auto_increment"`
+	PolyPostID int64     `gor:"not_null"`
+	PolyPost   *PolyPost `gor:"belongs_to;counter_cache"`
+}
+
+func (l *PolyLike) TableName() string { return "poly_likes" }
+
+// setupPolymorphicORM returns the ORM with a post and a photo, which share
+// the same ID
+func setupPolymorphicORM(t *testing.T) (gor.ORM, *PolyPost, *PolyPhoto) {
+	orm := setupTestORM(t)
+	if err := orm.Register(&PolyPost{}, &PolyPhoto{}, &PolyComment{}, &PolyLike{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	post := &PolyPost{Title: "Launch"}
+	photo := &PolyPhoto{URL: "launch.png"}
+	for _, parent := range []interface{}{post, photo} {
+		if err := orm.Create(parent); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	return orm, post, photo
+}
+
+func commentsCount(t *testing.T, orm gor.ORM, parent interface{}) int64 {
+	t.Helper()
+	var count int64
+	query := "SELECT comments_count FROM " + getTableName(reflect.TypeOf(parent)) + " WHERE id = ?"
+	if err := orm.DB().QueryRow(query, getID(parent)).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestPolymorphic_PreloadsBothSides(t *testing.T) {
+	orm, post, photo := setupPolymorphicORM(t)
+
+	for _, comment := range []*PolyComment{
+		{Body: "Congrats", Commentable: post},
+		{Body: "Nice shot", Commentable: photo},
+		{Body: "Ship it", Commentable: post},
+	} {
+		if err := orm.Create(comment); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	var comments []PolyComment
+	if err := orm.Query(&PolyComment{}).Includes("Commentable").Order("id").FindAll(&comments); err != nil {
+		t.Fatalf("Includes(Commentable) error = %v", err)
+	}
+	if comments[0].CommentableType != "poly_posts" || comments[0].CommentableID != post.ID {
+		t.Errorf("Create() stored %s %d, want the post", comments[0].CommentableType, comments[0].CommentableID)
+	}
+	if parent, ok := comments[0].Commentable.(*PolyPost); !ok || parent.Title != "Launch" {
+		t.Errorf("Commentable = %#v, want the post", comments[0].Commentable)
+	}
+	if parent, ok := comments[1].Commentable.(*PolyPhoto); !ok || parent.URL != "launch.png" {
+		t.Errorf("Commentable = %#v, want the photo", comments[1].Commentable)
+	}
+
+	var posts []PolyPost
+	if err := orm.Query(&PolyPost{}).Includes("Comments").FindAll(&posts); err != nil {
+		t.Fatalf("Includes(Comments) error = %v", err)
+	}
+	if len(posts) != 1 || len(posts[0].Comments) != 2 {
+		t.Errorf("post comments = %+v, want only the post's two comments", posts)
+	}
+	var photos []PolyPhoto
+	if err := orm.Query(&PolyPhoto{}).Includes("Comments").FindAll(&photos); err != nil {
+		t.Fatalf("Includes(Comments) error = %v", err)
+	}
+	if len(photos) != 1 || len(photos[0].Comments) != 1 || photos[0].Comments[0].Body != "Nice shot" {
+		t.Errorf("photo comments = %+v, want the photo's comment", photos)
+	}
+}
+
+func TestCounterCache_FollowsCreatesAndDeletes(t *testing.T) {
+	orm, post, photo := setupPolymorphicORM(t)
+
+	first := &PolyComment{Body: "First", Commentable: post}
+	second := &PolyComment{Body: "Second", CommentableType: "poly_posts", CommentableID: post.ID}
+	for _, comment := range []*PolyComment{first, second} {
+		if err := orm.Create(comment); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	if count := commentsCount(t, orm, post); count != 2 {
+		t.Errorf("comments_count after creates = %d, want 2", count)
+	}
+
+	// Moving a comment moves its count
+	second.Commentable = photo
+	if err := orm.Update(second); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if posts, photos := commentsCount(t, orm, post), commentsCount(t, orm, photo); posts != 1 || photos != 1 {
+		t.Errorf("counts after move = %d and %d, want 1 and 1", posts, photos)
+	}
+
+	if err := orm.Delete(first); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := orm.Table("poly_comments").Delete(second.ID); err != nil {
+		t.Fatalf("Table.Delete() error = %v", err)
+	}
+	if posts, photos := commentsCount(t, orm, post), commentsCount(t, orm, photo); posts != 0 || photos != 0 {
+		t.Errorf("counts after deletes = %d and %d, want 0", posts, photos)
+	}
+
+	// Counters roll back with the transaction that changed them
+	errRollback := errors.New("rollback")
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		if err := tx.Create(&PolyComment{Body: "Draft", Commentable: post}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+	if count := commentsCount(t, orm, post); count != 0 {
+		t.Errorf("comments_count after rollback = %d, want 0", count)
+	}
+
+	// Counters default to the child table's name
+	if err := orm.Table("poly_likes").Create(&PolyLike{PolyPostID: post.ID}); err != nil {
+		t.Fatalf("Table.Create() error = %v", err)
+	}
+	var reloaded PolyPost
+	if err := orm.Find(&reloaded, post.ID); err != nil || reloaded.PolyLikesCount != 1 {
+		t.Errorf("poly_likes_count = %d, %v; want 1", reloaded.PolyLikesCount, err)
+	}
+
+	if err := orm.Create(&PolyComment{Body: "Spoofed", CommentableType: "users; --", CommentableID: 1}); err == nil {
+		t.Error("Create() with an unregistered commentable type should fail")
+	}
+}
+
+func TestCounterCache_FollowsBulkWrites(t *testing.T) {
+	orm, post, photo := setupPolymorphicORM(t)
+	comments := orm.Table("poly_comments")
+
+	batch := []PolyComment{
+		{Body: "First", Commentable: post},
+		{Body: "Second", Commentable: post},
+		{Body: "Third", Commentable: photo},
+	}
+	if err := comments.BulkInsert(batch); err != nil {
+		t.Fatalf("BulkInsert() error = %v", err)
+	}
+	if posts, photos := commentsCount(t, orm, post), commentsCount(t, orm, photo); posts != 2 || photos != 1 {
+		t.Errorf("counts after BulkInsert() = %d and %d, want 2 and 1", posts, photos)
+	}
+
+	var stored []PolyComment
+	if err := orm.Query(&PolyComment{}).Order("id").FindAll(&stored); err != nil {
+		t.Fatal(err)
+	}
+	stored[1].Commentable = photo
+	if err := comments.BulkUpdate(stored[1:2]); err != nil {
+		t.Fatalf("BulkUpdate() error = %v", err)
+	}
+	if posts, photos := commentsCount(t, orm, post), commentsCount(t, orm, photo); posts != 1 || photos != 2 {
+		t.Errorf("counts after BulkUpdate() = %d and %d, want 1 and 2", posts, photos)
+	}
+
+	if err := comments.BulkDelete([]int64{stored[0].ID, stored[2].ID}); err != nil {
+		t.Fatalf("BulkDelete() error = %v", err)
+	}
+	if posts, photos := commentsCount(t, orm, post), commentsCount(t, orm, photo); posts != 0 || photos != 1 {
+		t.Errorf("counts after BulkDelete() = %d and %d, want 0 and 1", posts, photos)
+	}
+}
@@ -0,0 +1,212 @@
+package orm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// sqlDialect describes the parts of SQL syntax that differ between
+// databases. Statements are composed with "?" placeholders and rewritten
+// for the dialect once complete.
+type sqlDialect interface {
+	// Placeholder returns the bind parameter for the nth (1-based) argument
+	Placeholder(n int) string
+	QuoteIdentifier(name string) string
+	LimitOffsetSQL(limit, offset *int) string
+
+	// SupportsReturning reports whether INSERT ... RETURNING is used to
+	// read generated keys instead of sql.Result.LastInsertId
+	SupportsReturning() bool
+
+	// UpsertSQL returns the clause appended to an INSERT so that rows
+	// conflicting on the given columns update the listed columns instead
+	UpsertSQL(conflict, updates []string) string
+
+	// UpsertReturning reports whether an upsert reads the IDs of the rows
+	// it wrote with RETURNING
+	UpsertReturning() bool
+
+	// MaxPlaceholders is the most bind parameters one statement may use
+	MaxPlaceholders() int
+
+	// LockSQL returns the clause appended to a SELECT to lock its rows
+	LockSQL(mode lockMode) string
+
+	// ExplainSQL returns the statement that shows the query plan of query
+	ExplainSQL(query string) string
+
+	// JSONExtractSQL returns the expression reading the value at a JSON
+	// path, such as $.theme, inside a JSON column
+	JSONExtractSQL(column, path string) string
+}
+
+var (
+	_ sqlDialect = (*SQLiteAdapter)(nil)
+	_ sqlDialect = (*PostgreSQLAdapter)(nil)
+	_ sqlDialect = (*MySQLAdapter)(nil)
+)
+
+// dialectFor returns the adapter's dialect, falling back to SQLite syntax
+// for adapters that do not describe one
+func dialectFor(adapter gor.DatabaseAdapter) sqlDialect {
+	if d, ok := adapter.(sqlDialect); ok {
+		return d
+	}
+	return &SQLiteAdapter{}
+}
+
+// SQLite
+
+func (a *SQLiteAdapter) Placeholder(n int) string { return "?" }
+
+func (a *SQLiteAdapter) QuoteIdentifier(name string) string {
+	return quoteWith(name, `"`)
+}
+
+func (a *SQLiteAdapter) LimitOffsetSQL(limit, offset *int) string {
+	// SQLite only accepts OFFSET after a LIMIT; -1 means no limit
+	if limit == nil && offset != nil {
+		return fmt.Sprintf(" LIMIT -1 OFFSET %d", *offset)
+	}
+	return standardLimitOffset(limit, offset)
+}
+
+func (a *SQLiteAdapter) SupportsReturning() bool { return false }
+
+func (a *SQLiteAdapter) UpsertSQL(conflict, updates []string) string {
+	return onConflictSQL(a, conflict, updates)
+}
+
+// PostgreSQL
+
+func (a *PostgreSQLAdapter) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+func (a *PostgreSQLAdapter) QuoteIdentifier(name string) string {
+	return quoteWith(name, `"`)
+}
+
+func (a *PostgreSQLAdapter) LimitOffsetSQL(limit, offset *int) string {
+	return standardLimitOffset(limit, offset)
+}
+
+func (a *PostgreSQLAdapter) SupportsReturning() bool { return true }
+
+func (a *PostgreSQLAdapter) UpsertSQL(conflict, updates []string) string {
+	return onConflictSQL(a, conflict, updates)
+}
+
+// MySQL
+
+func (a *MySQLAdapter) Placeholder(n int) string { return "?" }
+
+func (a *MySQLAdapter) QuoteIdentifier(name string) string {
+	return quoteWith(name, "`")
+}
+
+func (a *MySQLAdapter) LimitOffsetSQL(limit, offset *int) string {
+	// MySQL only accepts OFFSET after a LIMIT; use the largest row count
+	if limit == nil && offset != nil {
+		return fmt.Sprintf(" LIMIT 18446744073709551615 OFFSET %d", *offset)
+	}
+	return standardLimitOffset(limit, offset)
+}
+
+func (a *MySQLAdapter) SupportsReturning() bool { return false }
+
+func (a *MySQLAdapter) UpsertSQL(conflict, updates []string) string {
+	// MySQL resolves conflicts against every unique key, so the conflict
+	// columns are only needed for the no-op update
+	if len(updates) == 0 {
+		if len(conflict) == 0 {
+			return ""
+		}
+		column := a.QuoteIdentifier(conflict[0])
+		return fmt.Sprintf(" ON DUPLICATE KEY UPDATE %s = %s", column, column)
+	}
+
+	sets := make([]string, len(updates))
+	for i, column := range updates {
+		quoted := a.QuoteIdentifier(column)
+		sets[i] = fmt.Sprintf("%s = VALUES(%s)", quoted, quoted)
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+// Helpers
+
+// quoteWith quotes each part of a possibly table-qualified identifier,
+// leaving "*" and already-quoted parts alone
+func quoteWith(name, quote string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if part == "*" || strings.HasPrefix(part, quote) {
+			continue
+		}
+		parts[i] = quote + strings.ReplaceAll(part, quote, quote+quote) + quote
+	}
+	return strings.Join(parts, ".")
+}
+
+func standardLimitOffset(limit, offset *int) string {
+	var sql string
+	if limit != nil {
+		sql += fmt.Sprintf(" LIMIT %d", *limit)
+	}
+	if offset != nil {
+		sql += fmt.Sprintf(" OFFSET %d", *offset)
+	}
+	return sql
+}
+
+// onConflictSQL builds the ON CONFLICT clause shared by SQLite and PostgreSQL
+func onConflictSQL(d sqlDialect, conflict, updates []string) string {
+	quoted := make([]string, len(conflict))
+	for i, column := range conflict {
+		quoted[i] = d.QuoteIdentifier(column)
+	}
+
+	if len(updates) == 0 {
+		return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(quoted, ", "))
+	}
+
+	sets := make([]string, len(updates))
+	for i, column := range updates {
+		column = d.QuoteIdentifier(column)
+		sets[i] = fmt.Sprintf("%s = excluded.%s", column, column)
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quoted, ", "), strings.Join(sets, ", "))
+}
+
+// rebind rewrites the "?" placeholders in query into the dialect's bind
+// parameters. Question marks inside quoted strings and identifiers are
+// left untouched.
+func rebind(d sqlDialect, query string) string {
+	if d.Placeholder(1) == "?" || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var sql strings.Builder
+	sql.Grow(len(query) + 8)
+
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			n++
+			sql.WriteString(d.Placeholder(n))
+			continue
+		}
+		sql.WriteRune(r)
+	}
+
+	return sql.String()
+}
@@ -0,0 +1,188 @@
+package orm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type dialectGolden struct {
+	sqlite, postgres, mysql string
+}
+
+func (g dialectGolden) check(t *testing.T, name string, build func(d sqlDialect) string) {
+	t.Helper()
+
+	adapters := []struct {
+		name    string
+		dialect sqlDialect
+		want    string
+	}{
+		{"sqlite", &SQLiteAdapter{}, g.sqlite},
+		{"postgres", &PostgreSQLAdapter{}, g.postgres},
+		{"mysql", &MySQLAdapter{}, g.mysql},
+	}
+
+	for _, adapter := range adapters {
+		if got := build(adapter.dialect); got != adapter.want {
+			t.Errorf("%s (%s):\n got: %s\nwant: %s", name, adapter.name, got, adapter.want)
+		}
+	}
+}
+
+func goldenQuery(d sqlDialect, build func(qb *QueryBuilder)) string {
+	qb := NewQueryBuilder(&TestUser{}, nil, d.(gor.DatabaseAdapter)).(*QueryBuilder)
+	build(qb)
+
+	sql, _, err := d.(gor.DatabaseAdapter).GenerateSQL(qb)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return sql
+}
+
+func TestGenerateSQL_Select(t *testing.T) {
+	dialectGolden{
+		sqlite:   `SELECT * FROM "users" WHERE age > ? AND name = ? ORDER BY name ASC LIMIT 10 OFFSET 20`,
+		postgres: `SELECT * FROM "users" WHERE age > $1 AND name = $2 ORDER BY name ASC LIMIT 10 OFFSET 20`,
+		mysql:    "SELECT * FROM `users` WHERE age > ? AND name = ? ORDER BY name ASC LIMIT 10 OFFSET 20",
+	}.check(t, "select", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) {
+			qb.Where("age > ?", 18).Where("name = ?", "Ada").Order("name").Page(3, 10)
+		})
+	})
+
+	dialectGolden{
+		sqlite:   `SELECT * FROM "users" LIMIT -1 OFFSET 5`,
+		postgres: `SELECT * FROM "users" OFFSET 5`,
+		mysql:    "SELECT * FROM `users` LIMIT 18446744073709551615 OFFSET 5",
+	}.check(t, "offset without limit", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) { qb.Offset(5) })
+	})
+
+	dialectGolden{
+		sqlite:   `SELECT "users".* FROM "users" INNER JOIN posts ON posts.user_id = users.id WHERE posts.title = ?`,
+		postgres: `SELECT "users".* FROM "users" INNER JOIN posts ON posts.user_id = users.id WHERE posts.title = $1`,
+		mysql:    "SELECT `users`.* FROM `users` INNER JOIN posts ON posts.user_id = users.id WHERE posts.title = ?",
+	}.check(t, "join", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) {
+			qb.Joins("posts ON posts.user_id = users.id").Where("posts.title = ?", "Hi")
+		})
+	})
+
+	dialectGolden{
+		sqlite:   `SELECT COUNT(*) FROM "users" WHERE active = ?`,
+		postgres: `SELECT COUNT(*) FROM "users" WHERE active = $1`,
+		mysql:    "SELECT COUNT(*) FROM `users` WHERE active = ?",
+	}.check(t, "count", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) {
+			qb.Where("active = ?", true).Order("name").Limit(3)
+			qb.isCount = true
+		})
+	})
+}
+
+func TestGenerateSQL_Raw(t *testing.T) {
+	dialectGolden{
+		sqlite:   `SELECT * FROM users WHERE name = ? AND note <> 'why?'`,
+		postgres: `SELECT * FROM users WHERE name = $1 AND note <> 'why?'`,
+		mysql:    `SELECT * FROM users WHERE name = ? AND note <> 'why?'`,
+	}.check(t, "raw", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) {
+			qb.Raw("SELECT * FROM users WHERE name = ? AND note <> 'why?'", "Ada")
+		})
+	})
+}
+
+func TestBuildInsertSQL(t *testing.T) {
+	dialectGolden{
+		sqlite:   `INSERT INTO "users" ("name", "email") VALUES (?, ?)`,
+		postgres: `INSERT INTO "users" ("name", "email") VALUES ($1, $2) RETURNING "id"`,
+		mysql:    "INSERT INTO `users` (`name`, `email`) VALUES (?, ?)",
+	}.check(t, "insert", func(d sqlDialect) string {
+		return buildInsertSQL(d, "users", []string{"name", "email"}, 1, "id")
+	})
+
+	dialectGolden{
+		sqlite:   `INSERT INTO "users" ("name") VALUES (?), (?)`,
+		postgres: `INSERT INTO "users" ("name") VALUES ($1), ($2)`,
+		mysql:    "INSERT INTO `users` (`name`) VALUES (?), (?)",
+	}.check(t, "bulk insert", func(d sqlDialect) string {
+		return buildInsertSQL(d, "users", []string{"name"}, 2, "")
+	})
+}
+
+func TestBuildUpsertSQL(t *testing.T) {
+	dialectGolden{
+		sqlite:   `INSERT INTO "users" ("email", "name") VALUES (?, ?), (?, ?) ON CONFLICT ("email") DO UPDATE SET "name" = excluded."name" RETURNING "id"`,
+		postgres: `INSERT INTO "users" ("email", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("email") DO UPDATE SET "name" = excluded."name" RETURNING "id"`,
+		mysql:    "INSERT INTO `users` (`email`, `name`) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)",
+	}.check(t, "upsert", func(d sqlDialect) string {
+		return buildUpsertSQL(d, "users", []string{"email", "name"}, 2, []string{"email"}, []string{"name"})
+	})
+
+	dialectGolden{
+		sqlite:   `INSERT INTO "users" ("email") VALUES (?) ON CONFLICT ("email") DO NOTHING RETURNING "id"`,
+		postgres: `INSERT INTO "users" ("email") VALUES ($1) ON CONFLICT ("email") DO NOTHING RETURNING "id"`,
+		mysql:    "INSERT INTO `users` (`email`) VALUES (?) ON DUPLICATE KEY UPDATE `email` = `email`",
+	}.check(t, "upsert do nothing", func(d sqlDialect) string {
+		return buildUpsertSQL(d, "users", []string{"email"}, 1, []string{"email"}, nil)
+	})
+}
+
+func TestBuildUpdateAndDeleteSQL(t *testing.T) {
+	dialectGolden{
+		sqlite:   `UPDATE "users" SET "name" = ?, "age" = ? WHERE id = ?`,
+		postgres: `UPDATE "users" SET "name" = $1, "age" = $2 WHERE id = $3`,
+		mysql:    "UPDATE `users` SET `name` = ?, `age` = ? WHERE id = ?",
+	}.check(t, "update", func(d sqlDialect) string {
+		return buildUpdateSQL(d, "users", []string{"name", "age"}, "id = ?")
+	})
+
+	dialectGolden{
+		sqlite:   `DELETE FROM "users" WHERE id IN (?, ?)`,
+		postgres: `DELETE FROM "users" WHERE id IN ($1, $2)`,
+		mysql:    "DELETE FROM `users` WHERE id IN (?, ?)",
+	}.check(t, "delete", func(d sqlDialect) string {
+		return buildDeleteSQL(d, "users", "id IN (?, ?)")
+	})
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		dialect sqlDialect
+		name    string
+		want    string
+	}{
+		{&SQLiteAdapter{}, "users.name", `"users"."name"`},
+		{&PostgreSQLAdapter{}, `we"ird`, `"we""ird"`},
+		{&MySQLAdapter{}, "users.*", "`users`.*"},
+	}
+
+	for _, test := range tests {
+		if got := test.dialect.QuoteIdentifier(test.name); got != test.want {
+			t.Errorf("QuoteIdentifier(%q) = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestModelValues(t *testing.T) {
+	user := &TestUser{Name: "Ada", Email: "ada@example.com"}
+
+	columns, _ := modelValues(user, true)
+	if columns[0] != "name" {
+		t.Errorf("insert columns = %v, want zero ID skipped", columns)
+	}
+
+	user.ID = 7
+	columns, _ = modelValues(user, true)
+	if columns[0] != "id" {
+		t.Errorf("insert columns = %v, want explicit ID included", columns)
+	}
+
+	columns, _ = modelValues(user, false)
+	if !reflect.DeepEqual(columns, []string{"name", "email", "age", "active", "created_at", "updated_at"}) {
+		t.Errorf("update columns = %v", columns)
+	}
+}
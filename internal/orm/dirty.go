@@ -0,0 +1,95 @@
+package orm
+
+import (
+	"bytes"
+	"reflect"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// Changed reports whether model differs from the values it was loaded or
+// last saved with. Models without a snapshot, because they are new or do
+// not embed gor.Tracked, are always changed.
+func Changed(model interface{}) bool {
+	return len(Changes(model)) > 0
+}
+
+// Changes returns the old and new value of each changed column of model.
+// Without a snapshot every column has changed, from a nil old value.
+func Changes(model interface{}) map[string]gor.Change {
+	loaded, _ := dirtyState(model)
+	columns, values := modelValues(model, false)
+
+	changes := make(map[string]gor.Change)
+	for i, column := range columns {
+		old, ok := loaded[column]
+		if ok && sameValue(old, values[i]) {
+			continue
+		}
+		changes[column] = gor.Change{Old: old, New: values[i]}
+	}
+	return changes
+}
+
+// WasChanged reports whether the last create or update of model changed
+// field, given as a column or field name. It lets AfterCreate and
+// AfterUpdate callbacks react to what was saved:
+//
+//	func (u *User) AfterUpdate() error {
+//		if orm.WasChanged(u, "Email") {
+//			return sendConfirmation(u)
+//		}
+//		return nil
+//	}
+func WasChanged(model interface{}, field string) bool {
+	_, saved := dirtyState(model)
+
+	column := field
+	if f := schemaOf(reflect.TypeOf(model)).FieldByName(field); f != nil {
+		column = f.Column
+	}
+	_, ok := saved[column]
+	return ok
+}
+
+// dirtyState returns the snapshot of a tracked model
+func dirtyState(model interface{}) (map[string]interface{}, map[string]gor.Change) {
+	if tracked, ok := model.(gor.Trackable); ok {
+		return tracked.DirtyState()
+	}
+	return nil, nil
+}
+
+// snapshot records the current values of a tracked model as loaded, along
+// with the changes just saved, if any
+func snapshot(model interface{}, saved map[string]gor.Change) {
+	tracked, ok := model.(gor.Trackable)
+	if !ok {
+		return
+	}
+
+	columns, values := modelValues(model, false)
+	loaded := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		// Copy byte slices, which the caller may modify in place
+		if b, ok := values[i].([]byte); ok {
+			values[i] = append([]byte(nil), b...)
+		}
+		loaded[column] = values[i]
+	}
+	tracked.SetDirtyState(loaded, saved)
+}
+
+// sameValue compares a snapshot value with the current one
+func sameValue(old, current interface{}) bool {
+	switch old := old.(type) {
+	case time.Time:
+		current, ok := current.(time.Time)
+		return ok && old.Equal(current)
+	case []byte:
+		current, ok := current.([]byte)
+		return ok && bytes.Equal(old, current)
+	}
+	return reflect.DeepEqual(old, current)
+}
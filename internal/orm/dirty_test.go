@@ -0,0 +1,159 @@
+package orm
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type TrackedArticle struct {
+	gor.Tracked
+	ID        int64     `gor:"primary_key;auto_increment"`
+	Title     string    `gor:"not_null"`
+	Body      string    `gor:"not_null"`
+	Views     int       `gor:"not_null"`
+	CreatedAt time.Time `gor:"not_null"`
+	UpdatedAt time.Time `gor:"not_null"`
+
+	titleChanged bool
+}
+
+func (a *TrackedArticle) TableName() string { return "tracked_articles" }
+
+func (a *TrackedArticle) AfterUpdate() error {
+	a.titleChanged = WasChanged(a, "Title")
+	return nil
+}
+
+func setupDirtyORM(t *testing.T) (gor.ORM, *TrackedArticle) {
+	orm := setupTestORM(t)
+	if err := orm.Register(&TrackedArticle{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	article := &TrackedArticle{Title: "Draft", Body: "Hello"}
+	if err := orm.Create(article); err != nil {
+		t.Fatalf("Failed to create article: %v", err)
+	}
+	return orm, article
+}
+
+func TestDirty_TracksChanges(t *testing.T) {
+	orm, created := setupDirtyORM(t)
+
+	if Changed(created) {
+		t.Errorf("Changes() after Create() = %v, want none", Changes(created))
+	}
+	if !WasChanged(created, "title") || !WasChanged(created, "Body") {
+		t.Error("WasChanged() after Create() should report the saved columns")
+	}
+
+	var article TrackedArticle
+	if err := orm.Find(&article, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if Changed(&article) {
+		t.Errorf("Changes() after Find() = %v, want none", Changes(&article))
+	}
+
+	article.Title = "Published"
+	changes := Changes(&article)
+	if len(changes) != 1 || changes["title"] != (gor.Change{Old: "Draft", New: "Published"}) {
+		t.Errorf("Changes() = %v, want only the title", changes)
+	}
+
+	article.Title = "Draft"
+	if Changed(&article) {
+		t.Errorf("Changes() after reverting = %v, want none", Changes(&article))
+	}
+
+	var loaded []TrackedArticle
+	if err := orm.Query(&loaded).FindAll(&loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || Changed(&loaded[0]) {
+		t.Errorf("records from FindAll() should have a snapshot")
+	}
+
+	if !Changed(&TrackedArticle{Title: "new"}) || !Changed(&TestUser{}) {
+		t.Error("new and untracked models should count as changed")
+	}
+}
+
+func TestDirty_UpdatesOnlyChangedColumns(t *testing.T) {
+	orm, created := setupDirtyORM(t)
+	events := recordQueries(t)
+
+	// Two copies loaded before either is saved
+	var first, second TrackedArticle
+	if err := orm.Find(&first, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.Find(&second, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	first.Title = "Published"
+	if err := orm.Update(&first); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !first.titleChanged {
+		t.Error("WasChanged() in AfterUpdate() should report the title")
+	}
+
+	second.Views = 10
+	if err := orm.Update(&second); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if second.titleChanged {
+		t.Error("WasChanged() should not report an unsaved column")
+	}
+
+	var updates []string
+	for _, event := range events() {
+		if strings.HasPrefix(event.SQL, "UPDATE") {
+			updates = append(updates, event.SQL)
+		}
+	}
+	if len(updates) != 2 || !strings.Contains(updates[0], `SET "title" = ?, "updated_at" = ? WHERE`) || !strings.Contains(updates[1], `SET "views" = ?, "updated_at" = ? WHERE`) {
+		t.Errorf("updates = %v, want one column and updated_at each", updates)
+	}
+
+	var article TrackedArticle
+	if err := orm.Find(&article, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if article.Title != "Published" || article.Views != 10 {
+		t.Errorf("article = %+v, want both writers' changes", article)
+	}
+}
+
+func TestDirty_SkipsUnchangedUpdates(t *testing.T) {
+	orm, created := setupDirtyORM(t)
+
+	var article TrackedArticle
+	if err := orm.Find(&article, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	loadedAt := article.UpdatedAt
+
+	events := recordQueries(t)
+	if err := orm.Update(&article); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := orm.Table("tracked_articles").WithContext(context.Background()).Update(&article); err != nil {
+		t.Fatalf("Table.Update() error = %v", err)
+	}
+
+	for _, event := range events() {
+		if strings.HasPrefix(event.SQL, "UPDATE") {
+			t.Errorf("unchanged Update() ran %s", event.SQL)
+		}
+	}
+	if !article.UpdatedAt.Equal(loadedAt) {
+		t.Errorf("UpdatedAt = %v, want it left at %v", article.UpdatedAt, loadedAt)
+	}
+}
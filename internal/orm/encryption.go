@@ -0,0 +1,514 @@
+package orm
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// ErrNoEncryptionKey is returned when an encrypted column is written
+// before any encryption key is set
+var ErrNoEncryptionKey = errors.New("no encryption key is set")
+
+// ErrDecryption is returned when an encrypted value was tampered with or
+// written with a key that is no longer in the keyring
+var ErrDecryption = errors.New("cannot decrypt value")
+
+// encryptedPrefix starts every stored ciphertext, followed by the ID of
+// its key: gor:enc:<key id>:<base64 nonce and sealed value>
+const encryptedPrefix = "gor:enc:"
+
+// encryptionKey is one key of the keyring
+type encryptionKey struct {
+	id       string
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+// keyring holds the keys of one database's encrypted columns, newest
+// first. A nil keyring has no keys.
+type keyring struct {
+	mu   sync.RWMutex
+	keys []*encryptionKey
+}
+
+// SetEncryptionKeys sets the keyring of o's encrypted columns, newest
+// first. Values are written with the first key and read with whichever key
+// wrote them, so a key can be rotated by putting a new one in front and
+// running ReencryptModels before the old one is dropped. Each named
+// database has its own keyring, which Connect sets from its
+// DatabaseConfig.EncryptionKeys.
+func SetEncryptionKeys(o gor.ORM, secrets ...[]byte) error {
+	orm, ok := o.(*gorORM)
+	if !ok {
+		return fmt.Errorf("unsupported ORM implementation %T", o)
+	}
+	return orm.keys.set(secrets)
+}
+
+// set replaces the keys of the keyring with ones derived from secrets
+func (k *keyring) set(secrets [][]byte) error {
+	keys := make([]*encryptionKey, len(secrets))
+	for i, secret := range secrets {
+		if len(secret) < 32 {
+			return fmt.Errorf("encryption key %d must be at least 32 bytes", i)
+		}
+
+		block, err := aes.NewCipher(deriveKey(secret, "aes"))
+		if err != nil {
+			return err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(secret)
+		keys[i] = &encryptionKey{id: hex.EncodeToString(sum[:4]), aead: aead, nonceKey: deriveKey(secret, "nonce")}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	return nil
+}
+
+// deriveKey derives a 32-byte key for one purpose from a keyring secret
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("gor encrypted attributes " + purpose))
+	return mac.Sum(nil)
+}
+
+// storeKeyring returns the keyring of the database an ORM or transaction
+// runs on
+func storeKeyring(store recordStore) *keyring {
+	switch store := store.(type) {
+	case *gorORM:
+		return store.keys
+	case *gorTransaction:
+		return store.keys
+	}
+	return nil
+}
+
+// current returns the keys of the keyring, newest first
+func (k *keyring) current() []*encryptionKey {
+	if k == nil {
+		return nil
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys
+}
+
+// encryptWith seals plaintext with key. Deterministic values derive their
+// nonce from the plaintext, so equal values encrypt alike and can be
+// matched in queries; others use a random nonce.
+func encryptWith(key *encryptionKey, plaintext []byte, deterministic bool) (string, error) {
+	nonce := make([]byte, key.aead.NonceSize())
+	if deterministic {
+		mac := hmac.New(sha256.New, key.nonceKey)
+		mac.Write(plaintext)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := key.aead.Seal(nonce, nonce, plaintext, nil)
+	return encryptedPrefix + key.id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a stored value. Values without the ciphertext prefix were
+// written before the column was encrypted and are returned as they are.
+func (k *keyring) decrypt(stored string) ([]byte, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return []byte(stored), nil
+	}
+
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(stored, encryptedPrefix), ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed ciphertext", ErrDecryption)
+	}
+
+	for _, key := range k.current() {
+		if key.id != id {
+			continue
+		}
+
+		sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+		if err != nil || len(sealed) < key.aead.NonceSize() {
+			return nil, fmt.Errorf("%w: malformed ciphertext", ErrDecryption)
+		}
+		plaintext, err := key.aead.Open(nil, sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():], nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDecryption, err)
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("%w: key %s is not in the keyring", ErrDecryption, id)
+}
+
+// checkEncryptionOptions rejects the options of a field that look like
+// encrypted but are not encrypted or encrypted:deterministic, so a typo
+// cannot leave a column stored in plaintext
+func checkEncryptionOptions(field *modelField) error {
+	for key, value := range field.Options {
+		if !strings.HasPrefix(key, "encrypted") {
+			continue
+		}
+		if key != "encrypted" || (value != "" && value != "deterministic") {
+			option := key
+			if value != "" {
+				option += ":" + value
+			}
+			return fmt.Errorf("field %s has unknown encryption option %q", field.Name, option)
+		}
+	}
+	return nil
+}
+
+// isDeterministic reports whether an encrypted field is tagged
+// encrypted:deterministic or encrypted,deterministic
+func isDeterministic(field *modelField) bool {
+	return field.Options["encrypted"] == "deterministic"
+}
+
+// encryptValue encrypts the value of an encrypted field for storage. Nil
+// pointers stay NULL; []byte fields are stored as bytes, others as text.
+func encryptValue(keys *keyring, field *modelField, value interface{}) (interface{}, error) {
+	var plaintext []byte
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		plaintext = []byte(v)
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		plaintext = []byte(*v)
+	case []byte:
+		if v == nil {
+			return nil, nil
+		}
+		plaintext = v
+	default:
+		return nil, fmt.Errorf("encrypted field %s must be a string or []byte, not %T", field.Name, value)
+	}
+
+	current := keys.current()
+	if len(current) == 0 {
+		return nil, ErrNoEncryptionKey
+	}
+
+	stored, err := encryptWith(current[0], plaintext, isDeterministic(field))
+	if err != nil {
+		return nil, err
+	}
+	if field.Type == reflect.TypeOf([]byte(nil)) {
+		return []byte(stored), nil
+	}
+	return stored, nil
+}
+
+// encryptValues returns values, the values of columns of modelType, with
+// those of encrypted columns encrypted with keys for storage
+func encryptValues(keys *keyring, modelType reflect.Type, columns []string, values []interface{}) ([]interface{}, error) {
+	schema := schemaOf(modelType)
+	if schema.err != nil {
+		return nil, schema.err
+	}
+	if len(schema.Encrypted) == 0 {
+		return values, nil
+	}
+
+	stored := append([]interface{}(nil), values...)
+	for i, column := range columns {
+		field := schema.FieldByColumn(column)
+		if field == nil || !field.HasOption("encrypted") {
+			continue
+		}
+
+		var err error
+		if stored[i], err = encryptValue(keys, field, stored[i]); err != nil {
+			return nil, fmt.Errorf("cannot encrypt %s: %w", column, err)
+		}
+	}
+	return stored, nil
+}
+
+// decryptFields decrypts in place, with keys, the encrypted fields of elem,
+// a struct just scanned from the database
+func decryptFields(keys *keyring, elem reflect.Value) error {
+	for _, field := range schemaOf(elem.Type()).Encrypted {
+		target := elem.FieldByIndex(field.Index)
+
+		var stored string
+		switch target.Kind() {
+		case reflect.String:
+			stored = target.String()
+		case reflect.Ptr:
+			if target.IsNil() {
+				continue
+			}
+			stored = target.Elem().String()
+		case reflect.Slice:
+			if target.IsNil() {
+				continue
+			}
+			stored = string(target.Bytes())
+		}
+		if !strings.HasPrefix(stored, encryptedPrefix) {
+			continue
+		}
+
+		plaintext, err := keys.decrypt(stored)
+		if err != nil {
+			return fmt.Errorf("cannot decrypt %s: %w", field.Column, err)
+		}
+
+		switch target.Kind() {
+		case reflect.String:
+			target.SetString(string(plaintext))
+		case reflect.Ptr:
+			target.Elem().SetString(string(plaintext))
+		case reflect.Slice:
+			target.SetBytes(plaintext)
+		}
+	}
+	return nil
+}
+
+// encryptedEquality matches conditions comparing one column with one
+// argument, such as `email = ?` or `"users"."email" = ?`
+var encryptedEquality = regexp.MustCompile("^\\s*((?:[`\"]?\\w+[`\"]?\\.)?[`\"]?(\\w+)[`\"]?)\\s*=\\s*\\?\\s*$")
+
+// encryptCondition rewrites a condition comparing a deterministically
+// encrypted column with a value so it matches the value's ciphertext under
+// every key of the keyring. Other conditions are returned unchanged.
+func encryptCondition(keys *keyring, modelType reflect.Type, condition string, args []interface{}) (string, []interface{}, error) {
+	if modelType == nil || len(schemaOf(modelType).Encrypted) == 0 || len(args) != 1 {
+		return condition, args, nil
+	}
+
+	match := encryptedEquality.FindStringSubmatch(condition)
+	if match == nil {
+		return condition, args, nil
+	}
+	field := schemaOf(modelType).FieldByColumn(match[2])
+	if field == nil || !field.HasOption("encrypted") || args[0] == nil {
+		return condition, args, nil
+	}
+	if !isDeterministic(field) {
+		return "", nil, fmt.Errorf("%s is encrypted without the deterministic option and cannot be queried", field.Column)
+	}
+
+	variants, err := ciphertextVariants(keys, field, args[0])
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("%s IN (%s)", match[1], inPlaceholders(len(variants))), variants, nil
+}
+
+// ciphertextVariants returns value as a deterministically encrypted field
+// stores it under each key of the keyring
+func ciphertextVariants(keys *keyring, field *modelField, value interface{}) ([]interface{}, error) {
+	current := keys.current()
+	if len(current) == 0 {
+		return nil, ErrNoEncryptionKey
+	}
+
+	plaintext := []byte(fmt.Sprint(reflect.Indirect(reflect.ValueOf(value)).Interface()))
+	if b, ok := value.([]byte); ok {
+		plaintext = b
+	}
+
+	variants := make([]interface{}, len(current))
+	for i, key := range current {
+		stored, err := encryptWith(key, plaintext, true)
+		if err != nil {
+			return nil, err
+		}
+		variants[i] = stored
+		if field.Type == reflect.TypeOf([]byte(nil)) {
+			variants[i] = []byte(stored)
+		}
+	}
+	return variants, nil
+}
+
+// ReencryptModels rewrites the encrypted columns of every model registered
+// on the ORM with the newest key of its keyring, along with values written
+// before the columns were encrypted, and returns the number of rows
+// rewritten. Rows already on the newest key are left alone. It backs the
+// `gor db reencrypt` task run after a key rotation.
+func ReencryptModels(ctx context.Context, o gor.ORM) (int64, error) {
+	orm, ok := o.(*gorORM)
+	if !ok {
+		return 0, fmt.Errorf("unsupported ORM implementation %T", o)
+	}
+	if len(orm.keys.current()) == 0 {
+		return 0, ErrNoEncryptionKey
+	}
+
+	var total int64
+	for table, modelType := range orm.models {
+		schema := schemaOf(modelType)
+		if len(schema.Encrypted) == 0 {
+			continue
+		}
+
+		rewritten, err := reencryptTable(withContext(ctx, orm.db, orm.adapter, orm.keys), orm.adapter, table, schema)
+		total += rewritten
+		if err != nil {
+			return total, fmt.Errorf("failed to re-encrypt %s: %w", table, err)
+		}
+	}
+	return total, nil
+}
+
+// reencryptTable re-encrypts the encrypted fields of table, whose model's
+// schema is given, in batches ordered by primary key
+func reencryptTable(ex executor, adapter gor.DatabaseAdapter, table string, schema *modelSchema) (int64, error) {
+	batchSize := 500
+
+	pk := schema.PrimaryKey()
+	if pk == nil {
+		return 0, fmt.Errorf("%s has no primary key", schema.Type.Name())
+	}
+	keys := keyringOf(ex)
+	fields := schema.Encrypted
+
+	d := dialectFor(adapter)
+	key := d.QuoteIdentifier(pk.Column)
+	columns := make([]string, len(fields))
+	quoted := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = field.Column
+		quoted[i] = d.QuoteIdentifier(field.Column)
+	}
+	selectSQL := fmt.Sprintf("SELECT %s, %s FROM %s", key, strings.Join(quoted, ", "), d.QuoteIdentifier(table)) // #nosec G201 - Identifiers come from model metadata
+	limit := fmt.Sprintf(" ORDER BY %s", key) + d.LimitOffsetSQL(&batchSize, nil)
+	first := rebind(d, selectSQL+limit)
+	next := rebind(d, selectSQL+fmt.Sprintf(" WHERE %s > ?", key)+limit)
+	update := buildUpdateSQL(d, table, columns, key+" = ?")
+
+	var rewritten int64
+	var lastID interface{}
+	for {
+		type pending struct {
+			id     interface{}
+			values []interface{}
+		}
+		var batch []pending
+
+		query, args := first, []interface{}(nil)
+		if lastID != nil {
+			query, args = next, []interface{}{lastID}
+		}
+		rows, err := ex.Query(query, args...)
+		if err != nil {
+			return rewritten, err
+		}
+		count := 0
+		for rows.Next() {
+			count++
+			// The key is scanned into its field's type, so string and UUID
+			// keys work as well as integer ones
+			id := reflect.New(pk.Type)
+			holders := make([]interface{}, len(fields)+1)
+			holders[0] = id.Interface()
+			for i := range fields {
+				holders[i+1] = new(interface{})
+			}
+			if err := rows.Scan(holders...); err != nil {
+				rows.Close()
+				return rewritten, err
+			}
+			lastID = id.Elem().Interface()
+
+			values, changed, err := reencryptRow(keys, fields, holders[1:])
+			if err != nil {
+				rows.Close()
+				return rewritten, fmt.Errorf("row %v: %w", lastID, err)
+			}
+			if changed {
+				batch = append(batch, pending{id: lastID, values: values})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rewritten, err
+		}
+
+		for _, row := range batch {
+			if _, err := ex.Exec(update, append(row.values, row.id)...); err != nil {
+				return rewritten, err
+			}
+			rewritten++
+		}
+
+		if count < batchSize {
+			return rewritten, nil
+		}
+	}
+}
+
+// reencryptRow returns the stored values of one row encrypted with the
+// newest key of keys, and whether any of them changed
+func reencryptRow(keys *keyring, fields []*modelField, holders []interface{}) ([]interface{}, bool, error) {
+	key := keys.current()[0]
+	values := make([]interface{}, len(fields))
+	changed := false
+
+	for i, field := range fields {
+		var stored string
+		switch v := (*holders[i].(*interface{})).(type) {
+		case nil:
+			continue
+		case string:
+			stored = v
+		case []byte:
+			stored = string(v)
+		default:
+			stored = fmt.Sprint(v)
+		}
+
+		values[i] = stored
+		if field.Type == reflect.TypeOf([]byte(nil)) {
+			values[i] = []byte(stored)
+		}
+		if strings.HasPrefix(stored, encryptedPrefix+key.id+":") {
+			continue
+		}
+
+		plaintext, err := keys.decrypt(stored)
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot decrypt %s: %w", field.Column, err)
+		}
+		if stored, err = encryptWith(key, plaintext, isDeterministic(field)); err != nil {
+			return nil, false, err
+		}
+
+		values[i] = stored
+		if field.Type == reflect.TypeOf([]byte(nil)) {
+			values[i] = []byte(stored)
+		}
+		changed = true
+	}
+	return values, changed, nil
+}
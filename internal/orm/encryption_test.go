@@ -0,0 +1,269 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type SecretNote struct {
+	ID    int64   `gor:"primary_key;auto_increment"`
+	Email string  `gor:"encrypted:deterministic" validate:"uniqueness"`
+	Body  string  `gor:"encrypted"`
+	Token *string `gor:"encrypted"`
+}
+
+func (n *SecretNote) TableName() string { return "secret_notes" }
+
+type SecretToken struct {
+	ID    int64  `gor:"primary_key;auto_increment"`
+	Value string `gor:"encrypted,deterministic"`
+}
+
+func (t *SecretToken) TableName() string { return "secret_tokens" }
+
+type MistypedSecret struct {
+	ID    int64  `gor:"primary_key;auto_increment"`
+	Value string `gor:"encrypted:determinstic"`
+}
+
+const (
+	oldEncryptionKey = "0123456789abcdef0123456789abcdef-old"
+	newEncryptionKey = "0123456789abcdef0123456789abcdef-new"
+)
+
+func setupEncryptionORM(t *testing.T, keys ...string) gor.ORM {
+	orm := setupTestORM(t)
+	setKeys(t, orm, keys...)
+	if err := orm.Register(&SecretNote{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+	return orm
+}
+
+func setKeys(t *testing.T, orm gor.ORM, keys ...string) {
+	t.Helper()
+	secrets := make([][]byte, len(keys))
+	for i, key := range keys {
+		secrets[i] = []byte(key)
+	}
+	if err := SetEncryptionKeys(orm, secrets...); err != nil {
+		t.Fatalf("SetEncryptionKeys() error = %v", err)
+	}
+}
+
+// storedNote returns the email and body of a note as stored in the database
+func storedNote(t *testing.T, orm gor.ORM, id int64) (email, body string) {
+	t.Helper()
+	if err := orm.DB().QueryRow(`SELECT email, body FROM secret_notes WHERE id = ?`, id).Scan(&email, &body); err != nil {
+		t.Fatal(err)
+	}
+	return email, body
+}
+
+func TestEncryption_EncryptsAndDecryptsAttributes(t *testing.T) {
+	orm := setupEncryptionORM(t, newEncryptionKey)
+
+	token := "tok-1"
+	note := &SecretNote{Email: "ada@example.com", Body: "launch codes", Token: &token}
+	if err := orm.Create(note); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if note.Body != "launch codes" {
+		t.Errorf("Create() changed Body to %q", note.Body)
+	}
+
+	email, body := storedNote(t, orm, note.ID)
+	if !strings.HasPrefix(email, encryptedPrefix) || !strings.HasPrefix(body, encryptedPrefix) || strings.Contains(body, "launch") {
+		t.Errorf("stored email %q and body %q, want ciphertext", email, body)
+	}
+
+	var found SecretNote
+	if err := orm.Find(&found, note.ID); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if found.Email != "ada@example.com" || found.Body != "launch codes" || found.Token == nil || *found.Token != "tok-1" {
+		t.Errorf("Find() = %+v, want decrypted attributes", found)
+	}
+
+	found.Body = "new codes"
+	if err := orm.Update(&found); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	var notes []SecretNote
+	if err := orm.Query(&SecretNote{}).Where("email = ?", "ada@example.com").FindAll(&notes); err != nil {
+		t.Fatalf("Where() on a deterministic column error = %v", err)
+	}
+	if len(notes) != 1 || notes[0].Body != "new codes" {
+		t.Errorf("Where() = %+v, want the updated note", notes)
+	}
+
+	if _, err := orm.Query(&SecretNote{}).Where("body = ?", "new codes").Count(); err == nil {
+		t.Error("Where() on a non-deterministic column should fail")
+	}
+	if err := orm.Create(&SecretNote{Email: "ada@example.com"}); err == nil {
+		t.Error("Create() of a duplicate encrypted email should fail validation")
+	}
+
+	setKeys(t, orm)
+	if _, err := orm.Query(&SecretNote{}).UpdateAll(map[string]interface{}{"body": "wiped"}); !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("UpdateAll() without a key error = %v, want ErrNoEncryptionKey", err)
+	}
+}
+
+func TestEncryption_CommaSeparatedDeterministicTag(t *testing.T) {
+	orm := setupEncryptionORM(t, newEncryptionKey)
+	if err := orm.Register(&SecretToken{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	token := &SecretToken{Value: "api-token"}
+	if err := orm.Create(token); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	var stored string
+	if err := orm.DB().QueryRow("SELECT value FROM secret_tokens WHERE id = ?", token.ID).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, encryptedPrefix) || strings.Contains(stored, "api-token") {
+		t.Errorf("stored value %q, want ciphertext", stored)
+	}
+	if count, err := orm.Query(&SecretToken{}).Where("value = ?", "api-token").Count(); err != nil || count != 1 {
+		t.Errorf("Count() by value = %d, %v; want the deterministic match", count, err)
+	}
+
+	if err := orm.Register(&MistypedSecret{}); err == nil || !strings.Contains(err.Error(), "encrypted:determinstic") {
+		t.Errorf("Register() with a mistyped encryption option error = %v, want it rejected", err)
+	}
+	if err := orm.Create(&MistypedSecret{Value: "api-token"}); err == nil || !strings.Contains(err.Error(), "encrypted:determinstic") {
+		t.Error("Create() with a mistyped encryption option should fail instead of storing plaintext")
+	}
+}
+
+func TestEncryption_RotatesKeys(t *testing.T) {
+	orm := setupEncryptionORM(t, oldEncryptionKey)
+
+	note := &SecretNote{Email: "ada@example.com", Body: "old secret"}
+	if err := orm.Create(note); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	// A row written before the columns were encrypted
+	if _, err := orm.DB().Exec(`INSERT INTO secret_notes (email, body) VALUES ('bob@example.com', 'plain')`); err != nil {
+		t.Fatal(err)
+	}
+
+	setKeys(t, orm, newEncryptionKey, oldEncryptionKey)
+	if count, err := orm.Query(&SecretNote{}).Where("email = ?", "ada@example.com").Count(); err != nil || count != 1 {
+		t.Errorf("Count() by email under the old key = %d, %v; want 1", count, err)
+	}
+
+	rewritten, err := ReencryptModels(context.Background(), orm)
+	if err != nil || rewritten != 2 {
+		t.Fatalf("ReencryptModels() = %d, %v; want 2", rewritten, err)
+	}
+	if rewritten, err := ReencryptModels(context.Background(), orm); err != nil || rewritten != 0 {
+		t.Errorf("second ReencryptModels() = %d, %v; want 0", rewritten, err)
+	}
+
+	// The old key can now be dropped
+	setKeys(t, orm, newEncryptionKey)
+	newID := orm.(*gorORM).keys.current()[0].id
+	_, body := storedNote(t, orm, note.ID)
+	if !strings.HasPrefix(body, encryptedPrefix+newID+":") {
+		t.Errorf("stored body %q, want it under the new key", body)
+	}
+
+	var notes []SecretNote
+	if err := orm.Query(&SecretNote{}).Order("id").FindAll(&notes); err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+	if len(notes) != 2 || notes[0].Body != "old secret" || notes[1].Body != "plain" || notes[1].Email != "bob@example.com" {
+		t.Errorf("FindAll() = %+v, want both notes decrypted", notes)
+	}
+}
+
+type SecretCode struct {
+	Code  string `gor:"primary_key"`
+	Value string `gor:"encrypted"`
+}
+
+func (c *SecretCode) TableName() string { return "secret_codes" }
+
+func TestEncryption_RotatesKeysOfStringKeyedTables(t *testing.T) {
+	orm := setupEncryptionORM(t, oldEncryptionKey)
+	if err := orm.Register(&SecretCode{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+	for _, code := range []string{"b-2", "a-1"} {
+		if err := orm.Create(&SecretCode{Code: code, Value: "value " + code}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	setKeys(t, orm, newEncryptionKey, oldEncryptionKey)
+	if rewritten, err := ReencryptModels(context.Background(), orm); err != nil || rewritten != 2 {
+		t.Fatalf("ReencryptModels() = %d, %v; want 2", rewritten, err)
+	}
+
+	setKeys(t, orm, newEncryptionKey)
+	var codes []SecretCode
+	if err := orm.Query(&SecretCode{}).Order("code").FindAll(&codes); err != nil {
+		t.Fatalf("FindAll() under the new key error = %v", err)
+	}
+	if len(codes) != 2 || codes[0].Value != "value a-1" || codes[1].Value != "value b-2" {
+		t.Errorf("FindAll() = %+v, want both codes decrypted", codes)
+	}
+}
+
+func TestEncryption_KeepsKeysPerDatabase(t *testing.T) {
+	dir := t.TempDir()
+	config := gor.DatabaseConfig{
+		Driver:         "sqlite3",
+		Database:       filepath.Join(dir, "primary.db"),
+		EncryptionKeys: []string{oldEncryptionKey},
+		Connections: map[string]gor.DatabaseConfig{
+			"archive": {Driver: "sqlite3", Database: filepath.Join(dir, "archive.db"), EncryptionKeys: []string{newEncryptionKey}},
+		},
+	}
+	orm := NewORM(config)
+	if err := orm.Connect(context.Background(), config); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { orm.Close() })
+
+	archive := orm.Using("archive")
+	for _, db := range []gor.ORM{orm, archive} {
+		if err := db.Register(&SecretNote{}); err != nil {
+			t.Fatalf("Failed to register models: %v", err)
+		}
+		if err := db.Create(&SecretNote{Email: "ada@example.com", Body: "secret"}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	for name, db := range map[string]gor.ORM{"primary": orm, "archive": archive} {
+		var notes []SecretNote
+		if err := db.Query(&SecretNote{}).Where("email = ?", "ada@example.com").FindAll(&notes); err != nil {
+			t.Fatalf("FindAll() on %s error = %v", name, err)
+		}
+		if len(notes) != 1 || notes[0].Body != "secret" {
+			t.Errorf("FindAll() on %s = %+v, want the note decrypted", name, notes)
+		}
+	}
+
+	var primaryBody, archiveBody string
+	if err := orm.DB().QueryRow(`SELECT body FROM secret_notes`).Scan(&primaryBody); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.DB().QueryRow(`SELECT body FROM secret_notes`).Scan(&archiveBody); err != nil {
+		t.Fatal(err)
+	}
+	primaryID, archiveID := orm.(*gorORM).keys.current()[0].id, archive.(*gorORM).keys.current()[0].id
+	if primaryID == archiveID || !strings.HasPrefix(primaryBody, encryptedPrefix+primaryID+":") || !strings.HasPrefix(archiveBody, encryptedPrefix+archiveID+":") {
+		t.Errorf("stored bodies %q and %q, want each under its database's key", primaryBody, archiveBody)
+	}
+}
@@ -0,0 +1,329 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryEvent describes one statement run by the ORM
+type QueryEvent struct {
+	SQL      string
+	Args     []interface{}
+	Duration time.Duration
+
+	// Rows is the number of rows affected by a write. It is -1 for reads,
+	// whose rows are streamed to the caller after the event.
+	Rows int64
+
+	// Caller is the file:line outside the ORM that ran the statement
+	Caller string
+	Err    error
+
+	// Slow reports whether the statement took at least the slow-query
+	// threshold. Plan then holds its EXPLAIN output, if it could be read.
+	// Reads in a transaction have no plan: their connection is busy until
+	// their rows are closed, and another one may wait on the transaction.
+	Slow bool
+	Plan string
+}
+
+// QueryObserver is notified of every statement the ORM runs. Slow reads
+// outside transactions are reported from their own goroutine once their
+// plan has been read, so observers must be safe for concurrent use.
+type QueryObserver interface {
+	ObserveQuery(ctx context.Context, event QueryEvent)
+}
+
+// QueryObserverFunc adapts a function to a QueryObserver
+type QueryObserverFunc func(ctx context.Context, event QueryEvent)
+
+// ObserveQuery calls f(ctx, event)
+func (f QueryObserverFunc) ObserveQuery(ctx context.Context, event QueryEvent) {
+	f(ctx, event)
+}
+
+// explainTimeout bounds reading a slow statement's plan
+const explainTimeout = 5 * time.Second
+
+// explainSlots bounds the plans of slow reads being read at once; slow
+// reads beyond it are reported without a plan
+var explainSlots = make(chan struct{}, 4)
+
+var instruments struct {
+	sync.RWMutex
+	observers     []*registeredObserver
+	slowThreshold time.Duration
+}
+
+type registeredObserver struct {
+	QueryObserver
+}
+
+// AddQueryObserver registers an observer for every statement and returns a
+// function that removes it
+func AddQueryObserver(observer QueryObserver) (remove func()) {
+	entry := &registeredObserver{observer}
+
+	instruments.Lock()
+	instruments.observers = append(instruments.observers, entry)
+	instruments.Unlock()
+
+	return func() {
+		instruments.Lock()
+		defer instruments.Unlock()
+		for i, registered := range instruments.observers {
+			if registered == entry {
+				instruments.observers = append(instruments.observers[:i:i], instruments.observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// SetSlowQueryThreshold sets how long a statement may take before it is
+// reported as slow, with its query plan. Zero disables slow-query plans.
+func SetSlowQueryThreshold(threshold time.Duration) {
+	instruments.Lock()
+	instruments.slowThreshold = threshold
+	instruments.Unlock()
+}
+
+// instrumented reports whether statements run with ctx are observed
+func instrumented(ctx context.Context) bool {
+	instruments.RLock()
+	observed := len(instruments.observers) > 0
+	instruments.RUnlock()
+	return observed || nPlusOneTrackerFrom(ctx) != nil
+}
+
+// observe reports a statement to the N+1 tracker and observers. done is
+// set when the statement no longer holds its connection, as a read does
+// until its rows are closed.
+func (e contextExecutor) observe(query string, args []interface{}, start time.Time, rows int64, err error, done bool) {
+	event := QueryEvent{
+		SQL:      query,
+		Args:     args,
+		Duration: time.Since(start),
+		Rows:     rows,
+		Caller:   queryCaller(),
+		Err:      err,
+	}
+
+	if tracker := nPlusOneTrackerFrom(e.ctx); tracker != nil && err == nil && isRead(query) {
+		tracker.track(event)
+	}
+
+	instruments.RLock()
+	observers := append([]*registeredObserver(nil), instruments.observers...)
+	slowThreshold := instruments.slowThreshold
+	instruments.RUnlock()
+
+	if len(observers) == 0 {
+		return
+	}
+
+	if slowThreshold > 0 && event.Duration >= slowThreshold {
+		event.Slow = true
+		pool, onPool := e.conn.(*sql.DB)
+		switch {
+		case !isExplainable(query):
+		case done:
+			// The plan is read on the statement's own connection or
+			// transaction, which is free again
+			event.Plan = e.explain(e.conn, query, args)
+		case onPool:
+			select {
+			case explainSlots <- struct{}{}:
+				go func() {
+					defer func() { <-explainSlots }()
+					event.Plan = e.explain(pool, query, args)
+					notifyObservers(e.ctx, observers, event)
+				}()
+				return
+			default:
+			}
+		}
+	}
+
+	notifyObservers(e.ctx, observers, event)
+}
+
+func notifyObservers(ctx context.Context, observers []*registeredObserver, event QueryEvent) {
+	for _, observer := range observers {
+		observer.ObserveQuery(ctx, event)
+	}
+}
+
+// explain reads the query plan of a statement on conn, one line per plan
+// row
+func (e contextExecutor) explain(conn sqlConn, query string, args []interface{}) string {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(e.ctx), explainTimeout)
+	defer cancel()
+
+	rows, err := conn.QueryContext(ctx, e.dialect.ExplainSQL(query), args...)
+	if err != nil {
+		return "EXPLAIN failed: " + err.Error()
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "EXPLAIN failed: " + err.Error()
+	}
+
+	var lines []string
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return "EXPLAIN failed: " + err.Error()
+		}
+		lines = append(lines, planLine(columns, values))
+	}
+	if err := rows.Err(); err != nil {
+		return "EXPLAIN failed: " + err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// planLine formats one EXPLAIN row: SQLite's detail column, PostgreSQL's
+// single plan column, or MySQL's columns as name=value pairs
+func planLine(columns []string, values []interface{}) string {
+	text := func(value interface{}) string {
+		if b, ok := value.([]byte); ok {
+			return string(b)
+		}
+		return fmt.Sprint(value)
+	}
+
+	for i, column := range columns {
+		if column == "detail" {
+			return text(values[i])
+		}
+	}
+	if len(columns) == 1 {
+		return text(values[0])
+	}
+
+	pairs := make([]string, 0, len(columns))
+	for i, column := range columns {
+		if values[i] != nil {
+			pairs = append(pairs, column+"="+text(values[i]))
+		}
+	}
+	return strings.Join(pairs, " ")
+}
+
+// ExplainSQL returns the statement that shows how SQLite runs query
+func (a *SQLiteAdapter) ExplainSQL(query string) string { return "EXPLAIN QUERY PLAN " + query }
+
+func (a *PostgreSQLAdapter) ExplainSQL(query string) string { return "EXPLAIN " + query }
+
+func (a *MySQLAdapter) ExplainSQL(query string) string { return "EXPLAIN " + query }
+
+// statementKind returns the statement's first keyword in upper case
+func statementKind(query string) string {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	if end := strings.IndexAny(query, " \t\r\n("); end >= 0 {
+		query = query[:end]
+	}
+	return strings.ToUpper(query)
+}
+
+// isRead reports whether query reads rows
+func isRead(query string) bool {
+	switch statementKind(query) {
+	case "SELECT", "WITH":
+		return true
+	}
+	return false
+}
+
+// isExplainable reports whether query has a query plan
+func isExplainable(query string) bool {
+	switch statementKind(query) {
+	case "SELECT", "WITH", "INSERT", "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
+
+// ormDir is the directory of the ORM's sources, whose frames are skipped
+// when finding the caller of a statement
+var ormDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// queryCaller returns the file:line of the first caller outside the ORM
+func queryCaller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		inORM := filepath.Dir(frame.File) == ormDir && !strings.HasSuffix(frame.File, "_test.go")
+		if !inORM && !strings.HasPrefix(frame.Function, "runtime.") && !strings.HasPrefix(frame.Function, "reflect.") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// queryLogger writes statements as text
+type queryLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewQueryLogger returns an observer that writes each statement to out,
+// with the plan of slow statements indented below it:
+//
+//	[SQL] 1.2ms SELECT * FROM "users" WHERE id = ? [7] (app/users.go:42)
+//	[SLOW SQL] 812ms rows=1204 UPDATE "posts" SET ... (jobs/reindex.go:17)
+//	    SCAN posts
+func NewQueryLogger(out io.Writer) QueryObserver {
+	return &queryLogger{out: out}
+}
+
+func (l *queryLogger) ObserveQuery(ctx context.Context, event QueryEvent) {
+	var line strings.Builder
+	if event.Slow {
+		line.WriteString("[SLOW SQL] ")
+	} else {
+		line.WriteString("[SQL] ")
+	}
+	line.WriteString(event.Duration.Round(time.Microsecond).String())
+	if event.Rows >= 0 {
+		fmt.Fprintf(&line, " rows=%d", event.Rows)
+	}
+	line.WriteString(" " + event.SQL)
+	if len(event.Args) > 0 {
+		fmt.Fprintf(&line, " %v", event.Args)
+	}
+	if event.Caller != "" {
+		fmt.Fprintf(&line, " (%s)", event.Caller)
+	}
+	if event.Err != nil {
+		fmt.Fprintf(&line, " error: %v", event.Err)
+	}
+	line.WriteString("\n")
+	if event.Plan != "" {
+		line.WriteString("    " + strings.ReplaceAll(event.Plan, "\n", "\n    ") + "\n")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = io.WriteString(l.out, line.String())
+}
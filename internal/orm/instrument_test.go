@@ -0,0 +1,228 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// recordQueries registers an observer for the rest of the test and returns
+// the events it has seen so far
+func recordQueries(t *testing.T) func() []QueryEvent {
+	var mu sync.Mutex
+	var events []QueryEvent
+	remove := AddQueryObserver(QueryObserverFunc(func(ctx context.Context, event QueryEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}))
+	t.Cleanup(remove)
+
+	return func() []QueryEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]QueryEvent(nil), events...)
+	}
+}
+
+func TestQueryObserver_RecordsStatements(t *testing.T) {
+	orm := setupTestORM(t)
+	events := recordQueries(t)
+
+	user := &TestUser{Name: "ada", Email: "ada@example.com"}
+	if err := orm.Create(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if _, err := orm.Query(&TestUser{}).Where("name = ?", "ada").Count(); err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+
+	seen := events()
+	if len(seen) != 2 {
+		t.Fatalf("observed %d statements, want 2: %+v", len(seen), seen)
+	}
+
+	insert, count := seen[0], seen[1]
+	if !strings.HasPrefix(insert.SQL, "INSERT") || insert.Rows != 1 {
+		t.Errorf("insert event = %+v, want an INSERT affecting 1 row", insert)
+	}
+	if !strings.HasPrefix(count.SQL, "SELECT COUNT(*)") || count.Rows != -1 || len(count.Args) != 1 || count.Args[0] != "ada" {
+		t.Errorf("count event = %+v", count)
+	}
+	for _, event := range seen {
+		if !strings.Contains(event.Caller, "instrument_test.go:") {
+			t.Errorf("event caller = %q, want this test", event.Caller)
+		}
+		if event.Duration <= 0 || event.Slow {
+			t.Errorf("event timing = %v, slow %v", event.Duration, event.Slow)
+		}
+	}
+}
+
+func TestSlowQuery_CapturesPlan(t *testing.T) {
+	config := gor.DatabaseConfig{
+		Driver:          "sqlite3",
+		Database:        filepath.Join(t.TempDir(), "slow.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}
+	orm := NewORM(config)
+	if err := orm.Connect(context.Background(), config); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { orm.Close() })
+	if err := orm.Register(&TestUser{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	slow := make(chan QueryEvent, 10)
+	t.Cleanup(AddQueryObserver(QueryObserverFunc(func(ctx context.Context, event QueryEvent) {
+		if event.Slow {
+			slow <- event
+		}
+	})))
+	SetSlowQueryThreshold(time.Nanosecond)
+	t.Cleanup(func() { SetSlowQueryThreshold(0) })
+
+	// The plan is read once the single connection is free again
+	var users []TestUser
+	if err := orm.Query(&TestUser{}).Where("age > ?", 30).FindAll(&users); err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+
+	select {
+	case event := <-slow:
+		if !strings.Contains(event.SQL, `FROM "users"`) || !strings.Contains(event.Plan, "users") {
+			t.Errorf("slow event = %+v, want the users query with its plan", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no slow query reported")
+	}
+
+	// In a transaction holding the only connection, writes are explained
+	// on the transaction and reads are reported without a plan, before
+	// the statement returns
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		if _, err := tx.Exec(`UPDATE "users" SET age = age + 1 WHERE age > ?`, 30); err != nil {
+			return err
+		}
+		if event := <-slow; !strings.HasPrefix(event.SQL, "UPDATE") || !strings.Contains(event.Plan, "users") {
+			t.Errorf("slow write = %+v, want its plan", event)
+		}
+
+		if err := tx.Query(&TestUser{}).Where("age > ?", 30).FindAll(&users); err != nil {
+			return err
+		}
+		select {
+		case event := <-slow:
+			if event.Plan != "" {
+				t.Errorf("slow read in a transaction Plan = %q, want none", event.Plan)
+			}
+		default:
+			t.Error("slow read in a transaction was not reported")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+}
+
+func TestQueryLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewQueryLogger(&out)
+
+	logger.ObserveQuery(context.Background(), QueryEvent{
+		SQL: `SELECT * FROM "users" WHERE id = ?`, Args: []interface{}{7}, Duration: 1200 * time.Microsecond, Rows: -1, Caller: "app/users.go:42",
+	})
+	logger.ObserveQuery(context.Background(), QueryEvent{
+		SQL: `DELETE FROM "users"`, Duration: time.Second, Rows: 3, Slow: true, Plan: "SCAN users", Err: errors.New("boom"),
+	})
+
+	want := `[SQL] 1.2ms SELECT * FROM "users" WHERE id = ? [7] (app/users.go:42)
+[SLOW SQL] 1s rows=3 DELETE FROM "users" error: boom
+    SCAN users
+`
+	if out.String() != want {
+		t.Errorf("log =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestNPlusOne_DetectsRepeatedQueries(t *testing.T) {
+	orm := setupTestORM(t)
+	seedUsers(t, orm, 4)
+	t.Setenv("GOR_ENV", "test") // report without logging
+
+	ctx := DetectNPlusOne(context.Background())
+	db := orm.WithContext(ctx)
+
+	// Repeating the same lookup is not an N+1
+	for i := 0; i < 3; i++ {
+		var user TestUser
+		if err := db.Find(&user, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Batches repeat their query by design
+	var users []TestUser
+	if err := db.Query(&users).FindInBatches(&users, 1, func(tx gor.Transaction, batch interface{}) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if queries := NPlusOneQueries(ctx); len(queries) != 0 {
+		t.Fatalf("NPlusOneQueries() = %+v, want none", queries)
+	}
+
+	for id := 2; id <= 4; id++ {
+		var user TestUser
+		if err := db.Find(&user, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queries := NPlusOneQueries(ctx)
+	if len(queries) != 1 {
+		t.Fatalf("NPlusOneQueries() = %+v, want one", queries)
+	}
+	if queries[0].Count != 4 || !strings.Contains(queries[0].SQL, `FROM "users"`) || !strings.Contains(queries[0].Caller, "instrument_test.go:") {
+		t.Errorf("N+1 query = %+v", queries[0])
+	}
+}
+
+func TestNPlusOneMiddleware_FailsInTestEnvironment(t *testing.T) {
+	orm := setupTestORM(t)
+	seedUsers(t, orm, 3)
+	t.Setenv("GOR_ENV", "test")
+
+	handler := NPlusOneMiddleware(func(ctx *gor.Context) error {
+		db := orm.WithContext(ctx)
+		for id := 1; id <= 3; id++ {
+			var user TestUser
+			if err := db.Find(&user, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	var nPlusOne *NPlusOneError
+	if err := handler(&gor.Context{Context: context.Background()}); !errors.As(err, &nPlusOne) || len(nPlusOne.Queries) != 1 {
+		t.Errorf("handler error = %v, want an NPlusOneError", err)
+	}
+
+	job := NPlusOneJobMiddleware{}
+	err := job.Process(context.Background(), nil, func(ctx context.Context, job gor.Job) error {
+		var user TestUser
+		return orm.WithContext(ctx).Find(&user, 1)
+	})
+	if err != nil {
+		t.Errorf("job without N+1 queries error = %v", err)
+	}
+}
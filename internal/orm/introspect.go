@@ -0,0 +1,374 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// schemaIntrospector is implemented by adapters that can read the live
+// database schema
+type schemaIntrospector interface {
+	TableNames(db *sql.DB) ([]string, error)
+	TableColumns(db *sql.DB, table string) ([]gor.Column, error)
+	TableIndexes(db *sql.DB, table string) ([]gor.Index, error)
+
+	// AlterColumnTypeSQL returns the statement changing a column's type, or
+	// an empty string when the database cannot alter column types in place
+	AlterColumnTypeSQL(table string, column gor.Column) string
+	DropIndexSQL(table, name string) string
+}
+
+var (
+	_ schemaIntrospector = (*SQLiteAdapter)(nil)
+	_ schemaIntrospector = (*PostgreSQLAdapter)(nil)
+	_ schemaIntrospector = (*MySQLAdapter)(nil)
+)
+
+func introspectorFor(adapter gor.DatabaseAdapter) (schemaIntrospector, error) {
+	if inspector, ok := adapter.(schemaIntrospector); ok {
+		return inspector, nil
+	}
+	return nil, fmt.Errorf("adapter %T does not support schema introspection", adapter)
+}
+
+// SQLite
+
+func (a *SQLiteAdapter) TableNames(db *sql.DB) ([]string, error) {
+	return queryStrings(db, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+}
+
+func (a *SQLiteAdapter) TableColumns(db *sql.DB, table string) ([]gor.Column, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []gor.Column
+	for rows.Next() {
+		var (
+			cid          int
+			name, typ    string
+			notNull, pk  int
+			defaultValue sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+
+		column := gor.Column{
+			Name:       name,
+			Type:       strings.ToUpper(typ),
+			Nullable:   notNull == 0 && pk == 0,
+			PrimaryKey: pk > 0,
+		}
+		if defaultValue.Valid {
+			column.Default = defaultValue.String
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
+func (a *SQLiteAdapter) TableIndexes(db *sql.DB, table string) ([]gor.Index, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA index_list(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+
+	type indexEntry struct {
+		name   string
+		unique bool
+	}
+
+	var entries []indexEntry
+	for rows.Next() {
+		var (
+			seq, unique, partial int
+			name, origin         string
+		)
+		if err := rows.Scan(&seq, &name, &unique, &origin, &partial); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		// Only indexes created with CREATE INDEX; UNIQUE and PRIMARY KEY
+		// constraints produce automatic indexes
+		if origin != "c" {
+			continue
+		}
+		entries = append(entries, indexEntry{name: name, unique: unique == 1})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]gor.Index, 0, len(entries))
+	for _, entry := range entries {
+		infoRows, err := db.Query(fmt.Sprintf("PRAGMA index_info(%s)", entry.name))
+		if err != nil {
+			return nil, err
+		}
+
+		index := gor.Index{Name: entry.name, Table: table, Unique: entry.unique}
+		for infoRows.Next() {
+			var seqno, cid int
+			var column sql.NullString
+			if err := infoRows.Scan(&seqno, &cid, &column); err != nil {
+				infoRows.Close()
+				return nil, err
+			}
+			index.Columns = append(index.Columns, column.String)
+		}
+		infoRows.Close()
+
+		indexes = append(indexes, index)
+	}
+
+	return indexes, nil
+}
+
+func (a *SQLiteAdapter) AlterColumnTypeSQL(table string, column gor.Column) string {
+	// SQLite has no ALTER COLUMN; changing a type requires rebuilding the table
+	return ""
+}
+
+func (a *SQLiteAdapter) DropIndexSQL(table, name string) string {
+	return fmt.Sprintf("DROP INDEX %s", name)
+}
+
+// PostgreSQL
+
+func (a *PostgreSQLAdapter) TableNames(db *sql.DB) ([]string, error) {
+	return queryStrings(db, `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name`)
+}
+
+func (a *PostgreSQLAdapter) TableColumns(db *sql.DB, table string) ([]gor.Column, error) {
+	rows, err := db.Query(`SELECT c.column_name, c.data_type, c.character_maximum_length, c.is_nullable, c.column_default,
+			EXISTS (
+				SELECT 1 FROM information_schema.table_constraints tc
+				JOIN information_schema.key_column_usage kcu
+					ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+				WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_name = c.table_name
+					AND tc.table_schema = c.table_schema AND kcu.column_name = c.column_name
+			)
+		FROM information_schema.columns c
+		WHERE c.table_schema = current_schema() AND c.table_name = $1
+		ORDER BY c.ordinal_position`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanInformationSchemaColumns(rows)
+}
+
+func (a *PostgreSQLAdapter) TableIndexes(db *sql.DB, table string) ([]gor.Index, error) {
+	rows, err := db.Query(`SELECT i.indexname, i.indexdef FROM pg_indexes i
+		WHERE i.schemaname = current_schema() AND i.tablename = $1
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conname = i.indexname)
+		ORDER BY i.indexname`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []gor.Index
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, gor.Index{
+			Name:    name,
+			Table:   table,
+			Columns: indexDefinitionColumns(definition),
+			Unique:  strings.HasPrefix(strings.ToUpper(definition), "CREATE UNIQUE"),
+		})
+	}
+
+	return indexes, rows.Err()
+}
+
+func (a *PostgreSQLAdapter) AlterColumnTypeSQL(table string, column gor.Column) string {
+	columnType := a.ColumnType(column)
+	return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s",
+		table, column.Name, columnType, column.Name, columnType)
+}
+
+func (a *PostgreSQLAdapter) DropIndexSQL(table, name string) string {
+	return fmt.Sprintf("DROP INDEX %s", name)
+}
+
+// MySQL
+
+func (a *MySQLAdapter) TableNames(db *sql.DB) ([]string, error) {
+	return queryStrings(db, `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name`)
+}
+
+func (a *MySQLAdapter) TableColumns(db *sql.DB, table string) ([]gor.Column, error) {
+	rows, err := db.Query(`SELECT column_name, column_type, NULL, is_nullable, column_default, column_key = 'PRI'
+		FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ?
+		ORDER BY ordinal_position`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanInformationSchemaColumns(rows)
+}
+
+func (a *MySQLAdapter) TableIndexes(db *sql.DB, table string) ([]gor.Index, error) {
+	rows, err := db.Query(`SELECT index_name, non_unique, column_name
+		FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = ? AND index_name <> 'PRIMARY'
+		ORDER BY index_name, seq_in_index`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []gor.Index
+	for rows.Next() {
+		var name, column string
+		var nonUnique int
+		if err := rows.Scan(&name, &nonUnique, &column); err != nil {
+			return nil, err
+		}
+
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+			continue
+		}
+		indexes = append(indexes, gor.Index{
+			Name:    name,
+			Table:   table,
+			Columns: []string{column},
+			Unique:  nonUnique == 0,
+		})
+	}
+
+	return indexes, rows.Err()
+}
+
+func (a *MySQLAdapter) AlterColumnTypeSQL(table string, column gor.Column) string {
+	sql := fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, column.Name, a.ColumnType(column))
+	if !column.Nullable {
+		sql += " NOT NULL"
+	}
+	return sql
+}
+
+func (a *MySQLAdapter) DropIndexSQL(table, name string) string {
+	return fmt.Sprintf("DROP INDEX %s ON %s", name, table)
+}
+
+// Helpers
+
+func queryStrings(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// scanInformationSchemaColumns scans rows of (name, type, max length,
+// is_nullable, default, is primary key)
+func scanInformationSchemaColumns(rows *sql.Rows) ([]gor.Column, error) {
+	var columns []gor.Column
+	for rows.Next() {
+		var (
+			name, typ, nullable string
+			maxLength           sql.NullInt64
+			defaultValue        sql.NullString
+			primaryKey          bool
+		)
+		if err := rows.Scan(&name, &typ, &maxLength, &nullable, &defaultValue, &primaryKey); err != nil {
+			return nil, err
+		}
+
+		column := gor.Column{
+			Name:       name,
+			Type:       strings.ToUpper(typ),
+			Nullable:   strings.EqualFold(nullable, "YES"),
+			PrimaryKey: primaryKey,
+		}
+		if maxLength.Valid {
+			column.Size = int(maxLength.Int64)
+		}
+		if defaultValue.Valid {
+			column.Default = defaultValue.String
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
+var indexColumnsPattern = regexp.MustCompile(`\(([^)]*)\)\s*$`)
+
+// indexDefinitionColumns extracts the column list from a CREATE INDEX statement
+func indexDefinitionColumns(definition string) []string {
+	match := indexColumnsPattern.FindStringSubmatch(definition)
+	if match == nil {
+		return nil
+	}
+
+	var columns []string
+	for _, column := range strings.Split(match[1], ",") {
+		columns = append(columns, strings.Trim(strings.TrimSpace(column), `"`))
+	}
+	return columns
+}
+
+var integerDisplayWidth = regexp.MustCompile(`^(SMALLINT|INT|INTEGER|BIGINT)\(\d+\)$`)
+
+var columnTypeSynonyms = map[string]string{
+	"INT":                         "INTEGER",
+	"INT4":                        "INTEGER",
+	"INT8":                        "BIGINT",
+	"BOOL":                        "BOOLEAN",
+	"TINYINT(1)":                  "BOOLEAN",
+	"FLOAT8":                      "DOUBLE",
+	"DOUBLE PRECISION":            "DOUBLE",
+	"FLOAT4":                      "REAL",
+	"CHARACTER VARYING":           "VARCHAR",
+	"TIMESTAMP WITHOUT TIME ZONE": "TIMESTAMP",
+}
+
+// normalizeColumnType maps database-reported type names onto the names the
+// adapters emit so both sides of a schema comparison agree
+func normalizeColumnType(typ string, size int) string {
+	typ = strings.ToUpper(strings.Join(strings.Fields(typ), " "))
+	if match := integerDisplayWidth.FindStringSubmatch(typ); match != nil {
+		typ = match[1]
+	}
+	if synonym, ok := columnTypeSynonyms[typ]; ok {
+		typ = synonym
+	}
+	if typ == "VARCHAR" && size > 0 {
+		typ = fmt.Sprintf("VARCHAR(%d)", size)
+	}
+	return typ
+}
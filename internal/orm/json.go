@@ -0,0 +1,171 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// JSON columns hold a field of any JSON-encodable type, such as a map, a
+// slice or a struct, tagged json:
+//
+//	type User struct {
+//		ID       int64
+//		Settings map[string]interface{} `gor:"json"`
+//		Tags     []string               `gor:"json"`
+//	}
+//
+// The field is stored as JSON in a TEXT column on SQLite, JSONB on
+// PostgreSQL and JSON on MySQL, and decoded back into its Go type when
+// rows are scanned. WhereJSON queries values inside the document.
+
+// jsonPathPattern matches the JSON paths WhereJSON accepts: $ followed by
+// object keys and array indexes, such as $.address.city or $.tags[0]
+var jsonPathPattern = regexp.MustCompile(`^\$((\.[A-Za-z_][A-Za-z0-9_]*)|(\[[0-9]+\]))*$`)
+
+// jsonPathSegment matches one key or index of a JSON path
+var jsonPathSegment = regexp.MustCompile(`\.([A-Za-z_][A-Za-z0-9_]*)|\[([0-9]+)\]`)
+
+// jsonOperators are the comparisons WhereJSON accepts
+var jsonOperators = map[string]bool{
+	"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+	"LIKE": true, "NOT LIKE": true,
+}
+
+// jsonValue returns the value stored for a JSON field: its encoding, or
+// nil for nil maps, slices and pointers
+func jsonValue(value reflect.Value) interface{} {
+	switch value.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+	}
+
+	encoded, err := json.Marshal(value.Interface())
+	if err != nil {
+		return invalidJSON{err}
+	}
+	return string(encoded)
+}
+
+// invalidJSON is stored for a field that cannot be encoded, so that the
+// statement writing it fails with the encoding error
+type invalidJSON struct {
+	err error
+}
+
+func (v invalidJSON) Value() (driver.Value, error) {
+	return nil, v.err
+}
+
+// jsonScanner decodes a JSON column into the field dest points to
+type jsonScanner struct {
+	dest  reflect.Value
+	field *modelField
+}
+
+func (s *jsonScanner) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		s.dest.Set(reflect.Zero(s.dest.Type()))
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into JSON field %s", src, s.field.Name)
+	}
+
+	// Decode into a fresh value so keys of an earlier row do not linger
+	decoded := reflect.New(s.dest.Type())
+	if err := json.Unmarshal(data, decoded.Interface()); err != nil {
+		return fmt.Errorf("invalid JSON in %s: %w", s.field.Column, err)
+	}
+	s.dest.Set(decoded.Elem())
+	return nil
+}
+
+// jsonPathSegments splits a JSON path into its keys and indexes
+func jsonPathSegments(path string) (keys []string, indexes []bool) {
+	for _, match := range jsonPathSegment.FindAllStringSubmatch(path, -1) {
+		if match[1] != "" {
+			keys, indexes = append(keys, match[1]), append(indexes, false)
+		} else {
+			keys, indexes = append(keys, match[2]), append(indexes, true)
+		}
+	}
+	return keys, indexes
+}
+
+// SQLite
+
+// JSONExtractSQL returns the expression reading the value at path
+func (a *SQLiteAdapter) JSONExtractSQL(column, path string) string {
+	return fmt.Sprintf("json_extract(%s, '%s')", a.QuoteIdentifier(column), path)
+}
+
+// PostgreSQL
+
+// JSONExtractSQL returns the expression reading the value at path as text
+func (a *PostgreSQLAdapter) JSONExtractSQL(column, path string) string {
+	keys, indexes := jsonPathSegments(path)
+	if len(keys) == 0 {
+		return a.QuoteIdentifier(column) + "::text"
+	}
+
+	var sql strings.Builder
+	sql.WriteString(a.QuoteIdentifier(column))
+	for i, key := range keys {
+		if i == len(keys)-1 {
+			sql.WriteString("->>")
+		} else {
+			sql.WriteString("->")
+		}
+		if indexes[i] {
+			sql.WriteString(key)
+		} else {
+			sql.WriteString("'" + key + "'")
+		}
+	}
+	return sql.String()
+}
+
+// MySQL
+
+// JSONExtractSQL returns the expression reading the value at path, unquoted
+func (a *MySQLAdapter) JSONExtractSQL(column, path string) string {
+	return fmt.Sprintf("%s->>'%s'", a.QuoteIdentifier(column), path)
+}
+
+// WhereJSON compares the value at path inside a JSON column with value,
+// for example WhereJSON("settings", "$.theme", "=", "dark"). The path is $
+// followed by keys and array indexes, such as $.address.city or $.tags[0].
+// PostgreSQL and MySQL read the value as text, so compare with strings
+// there.
+func (qb *QueryBuilder) WhereJSON(column, path, operator string, value interface{}) gor.QueryBuilder {
+	if !jsonPathPattern.MatchString(path) {
+		qb.setErr(fmt.Errorf("WhereJSON: invalid JSON path %q", path))
+		return qb
+	}
+	operator = strings.ToUpper(strings.TrimSpace(operator))
+	if !jsonOperators[operator] {
+		qb.setErr(fmt.Errorf("WhereJSON: unsupported operator %q", operator))
+		return qb
+	}
+	if qb.modelType != nil {
+		if field := schemaOf(qb.modelType).FieldByColumn(column); field == nil || !field.HasOption("json") {
+			qb.setErr(fmt.Errorf("WhereJSON: %s is not a JSON column of %s", column, qb.tableName))
+			return qb
+		}
+	}
+
+	return qb.Where(dialectFor(qb.adapter).JSONExtractSQL(column, path)+" "+operator+" ?", value)
+}
@@ -0,0 +1,116 @@
+package orm
+
+import (
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type JSONAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type JSONProfile struct {
+	gor.Tracked
+	ID       int64                  `gor:"primary_key;auto_increment"`
+	Settings map[string]interface{} `gor:"json"`
+	Tags     []string               `gor:"json"`
+	Address  *JSONAddress           `gor:"json"`
+}
+
+func (p *JSONProfile) TableName() string { return "json_profiles" }
+
+func TestJSON_StoresAndScansTypedValues(t *testing.T) {
+	orm := setupTestORM(t)
+	if err := orm.Register(&JSONProfile{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	profiles := []*JSONProfile{
+		{Settings: map[string]interface{}{"theme": "dark", "font": map[string]interface{}{"size": 14}}, Tags: []string{"go", "sql"}, Address: &JSONAddress{City: "Lisbon"}},
+		{Settings: map[string]interface{}{"theme": "light"}, Tags: []string{"rust"}},
+		{},
+	}
+	for _, profile := range profiles {
+		if err := orm.Create(profile); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	var stored string
+	if err := orm.DB().QueryRow("SELECT tags FROM json_profiles WHERE id = ?", profiles[0].ID).Scan(&stored); err != nil || stored != `["go","sql"]` {
+		t.Errorf("stored tags = %q, %v; want a JSON array", stored, err)
+	}
+
+	var found JSONProfile
+	if err := orm.Find(&found, profiles[0].ID); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if found.Settings["theme"] != "dark" || len(found.Tags) != 2 || found.Address == nil || found.Address.City != "Lisbon" {
+		t.Errorf("Find() = %+v, want the decoded values", found)
+	}
+	var empty JSONProfile
+	if err := orm.Find(&empty, profiles[2].ID); err != nil || empty.Settings != nil || empty.Tags != nil || empty.Address != nil {
+		t.Errorf("Find() of empty profile = %+v, %v; want nil fields", empty, err)
+	}
+
+	// Changing the map in place is a change
+	found.Settings["theme"] = "solarized"
+	if changes := Changes(&found); len(changes) != 1 || changes["settings"].New != `{"font":{"size":14},"theme":"solarized"}` {
+		t.Errorf("Changes() = %v, want only settings", changes)
+	}
+	if err := orm.Update(&found); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	tests := []struct {
+		column, path, operator string
+		value                  interface{}
+		want                   int64
+	}{
+		{"settings", "$.theme", "=", "solarized", 1},
+		{"settings", "$.theme", "!=", "solarized", 1},
+		{"settings", "$.font.size", ">=", 12, 1},
+		{"tags", "$[0]", "=", "rust", 1},
+		{"address", "$.city", "like", "Lis%", 1},
+	}
+	for _, tt := range tests {
+		count, err := orm.Query(&JSONProfile{}).WhereJSON(tt.column, tt.path, tt.operator, tt.value).Count()
+		if err != nil || count != tt.want {
+			t.Errorf("WhereJSON(%s, %s, %s, %v) = %d, %v; want %d", tt.column, tt.path, tt.operator, tt.value, count, err, tt.want)
+		}
+	}
+
+	for _, invalid := range [][3]string{
+		{"settings", "$.theme') OR 1=1 --", "="},
+		{"settings", "$.theme", "; DROP"},
+		{"id", "$.theme", "="},
+	} {
+		if _, err := orm.Query(&JSONProfile{}).WhereJSON(invalid[0], invalid[1], invalid[2], "x").Count(); err == nil {
+			t.Errorf("WhereJSON(%q, %q, %q) should fail", invalid[0], invalid[1], invalid[2])
+		}
+	}
+}
+
+func TestJSON_DialectSQL(t *testing.T) {
+	tests := []struct {
+		adapter    gor.DatabaseAdapter
+		path       string
+		want       string
+		columnType string
+	}{
+		{NewSQLiteAdapter(), "$.font.size", `json_extract("settings", '$.font.size')`, "TEXT"},
+		{NewPostgreSQLAdapter(), "$.font.size", `"settings"->'font'->>'size'`, "JSONB"},
+		{NewPostgreSQLAdapter(), "$.tags[0]", `"settings"->'tags'->>0`, "JSONB"},
+		{NewMySQLAdapter(), "$.font.size", "`settings`->>'$.font.size'", "JSON"},
+	}
+	for _, tt := range tests {
+		if got := dialectFor(tt.adapter).JSONExtractSQL("settings", tt.path); got != tt.want {
+			t.Errorf("%T.JSONExtractSQL(%s) = %s, want %s", tt.adapter, tt.path, got, tt.want)
+		}
+		if got := tt.adapter.ColumnType(gor.Column{Type: "JSON"}); got != tt.columnType {
+			t.Errorf("%T.ColumnType(JSON) = %s, want %s", tt.adapter, got, tt.columnType)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package orm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor was tampered with,
+// signed with another secret, or issued for a different ordering
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+var cursorSecret struct {
+	sync.RWMutex
+	key []byte
+}
+
+// SetCursorSecret sets the key used to sign pagination cursors. Without
+// one, SECRET_KEY_BASE is used, or a random key that only lasts as long as
+// the process.
+func SetCursorSecret(secret []byte) {
+	cursorSecret.Lock()
+	defer cursorSecret.Unlock()
+	cursorSecret.key = append([]byte(nil), secret...)
+}
+
+func cursorKey() []byte {
+	cursorSecret.RLock()
+	key := cursorSecret.key
+	cursorSecret.RUnlock()
+	if key != nil {
+		return key
+	}
+
+	cursorSecret.Lock()
+	defer cursorSecret.Unlock()
+	if cursorSecret.key == nil {
+		if secret := os.Getenv("SECRET_KEY_BASE"); secret != "" {
+			cursorSecret.key = []byte(secret)
+		} else {
+			cursorSecret.key = make([]byte, 32)
+			if _, err := rand.Read(cursorSecret.key); err != nil {
+				panic(fmt.Sprintf("failed to generate cursor secret: %v", err))
+			}
+		}
+	}
+	return cursorSecret.key
+}
+
+// After limits the query to rows following the cursor in the current order
+func (qb *QueryBuilder) After(cursor string) gor.QueryBuilder {
+	qb.cursor = cursor
+	qb.cursorBefore = false
+	return qb
+}
+
+// Before limits the query to rows preceding the cursor in the current order
+func (qb *QueryBuilder) Before(cursor string) gor.QueryBuilder {
+	qb.cursor = cursor
+	qb.cursorBefore = true
+	return qb
+}
+
+// FindPage loads one page of up to Limit rows into dest, seeking from the
+// After or Before cursor rather than skipping rows with an offset. The
+// returned cursors address the neighbouring pages.
+//
+// Rows are ordered by the Order columns followed by the primary key, which
+// keeps the order total. Order columns must be model columns and should not
+// be NULL.
+func (qb *QueryBuilder) FindPage(dest interface{}) (gor.PageCursors, error) {
+	var cursors gor.PageCursors
+
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Slice {
+		return cursors, fmt.Errorf("destination must be a pointer to slice")
+	}
+
+	pageQB, keys, err := qb.seekQuery()
+	if err != nil {
+		return cursors, err
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	if qb.limitValue != nil {
+		limit := *qb.limitValue + 1
+		pageQB.limitValue = &limit
+	}
+	pageQB.offsetValue = nil
+	pageQB.includes = nil
+
+	page := reflect.New(destValue.Elem().Type())
+	if err := pageQB.FindAll(page.Interface()); err != nil {
+		return cursors, err
+	}
+
+	rows := page.Elem()
+	hasMore := qb.limitValue != nil && rows.Len() > *qb.limitValue
+	if hasMore {
+		rows = rows.Slice(0, *qb.limitValue)
+	}
+	if qb.cursorBefore {
+		reverseSlice(rows)
+	}
+
+	if rows.Len() > 0 {
+		first, err := encodeCursor(keys, rows.Index(0))
+		if err != nil {
+			return cursors, err
+		}
+		last, err := encodeCursor(keys, rows.Index(rows.Len()-1))
+		if err != nil {
+			return cursors, err
+		}
+
+		if qb.cursorBefore {
+			cursors.Next = last
+			if hasMore {
+				cursors.Prev = first
+			}
+		} else {
+			if hasMore {
+				cursors.Next = last
+			}
+			if qb.cursor != "" {
+				cursors.Prev = first
+			}
+		}
+	}
+
+	start := destValue.Elem().Len()
+	destValue.Elem().Set(reflect.AppendSlice(destValue.Elem(), rows))
+	if start == 0 {
+		return cursors, qb.preload(dest)
+	}
+
+	appended := reflect.New(destValue.Elem().Type())
+	appended.Elem().Set(destValue.Elem().Slice(start, destValue.Elem().Len()))
+	return cursors, qb.preload(appended.Interface())
+}
+
+// keyColumn is one column of the total order used for seeking
+type keyColumn struct {
+	column string
+	field  *modelField
+	desc   bool
+}
+
+// keyColumns returns the query's Order columns followed by the primary key
+func (qb *QueryBuilder) keyColumns() ([]keyColumn, error) {
+	if qb.modelType == nil {
+		return nil, fmt.Errorf("cursor pagination requires a model")
+	}
+	schema := schemaOf(qb.modelType)
+
+	var keys []keyColumn
+	hasID := false
+	for _, order := range qb.orderBy {
+		parts := strings.Fields(order)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("cannot paginate by %q: only plain columns are supported", order)
+		}
+
+		column := parts[0]
+		if i := strings.LastIndex(column, "."); i >= 0 {
+			column = column[i+1:]
+		}
+		column = strings.Trim(column, "\"`")
+
+		field := schema.FieldByColumn(column)
+		if field == nil {
+			return nil, fmt.Errorf("cannot paginate by %q: not a column of %s", column, qb.tableName)
+		}
+
+		keys = append(keys, keyColumn{column: column, field: field, desc: strings.EqualFold(parts[1], "DESC")})
+		hasID = hasID || column == "id"
+	}
+
+	if !hasID {
+		field := schema.FieldByColumn("id")
+		if field == nil {
+			return nil, fmt.Errorf("cursor pagination requires an id column on %s", qb.tableName)
+		}
+		desc := len(keys) > 0 && keys[len(keys)-1].desc
+		keys = append(keys, keyColumn{column: "id", field: field, desc: desc})
+	}
+
+	return keys, nil
+}
+
+// seekQuery returns a copy of the builder ordered by its key columns, and
+// reversed for Before, that only matches rows beyond the cursor
+func (qb *QueryBuilder) seekQuery() (*QueryBuilder, []keyColumn, error) {
+	keys, err := qb.keyColumns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d := dialectFor(qb.adapter)
+	seekQB := qb.clone()
+	seekQB.cursor = ""
+	seekQB.orderBy = make([]string, len(keys))
+	for i, key := range keys {
+		direction := "ASC"
+		if key.desc != qb.cursorBefore {
+			direction = "DESC"
+		}
+		seekQB.orderBy[i] = d.QuoteIdentifier(qb.tableName+"."+key.column) + " " + direction
+	}
+
+	if qb.cursor == "" {
+		return seekQB, keys, nil
+	}
+
+	values, err := decodeCursor(keys, qb.cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., flipping each comparison
+	// for descending columns and for Before
+	var alternatives []string
+	var args []interface{}
+	for i, key := range keys {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, d.QuoteIdentifier(qb.tableName+"."+keys[j].column)+" = ?")
+			args = append(args, values[j])
+		}
+
+		operator := ">"
+		if key.desc != qb.cursorBefore {
+			operator = "<"
+		}
+		terms = append(terms, d.QuoteIdentifier(qb.tableName+"."+key.column)+" "+operator+" ?")
+		args = append(args, values[i])
+
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	seekQB.Where("("+strings.Join(alternatives, " OR ")+")", args...)
+
+	return seekQB, keys, nil
+}
+
+// cursorPayload is the signed content of a cursor: the key columns and the
+// values of the row it points at
+type cursorPayload struct {
+	Columns []string      `json:"c"`
+	Values  []cursorValue `json:"v"`
+}
+
+// cursorValue keeps a key value's type so it binds the same way it was read
+type cursorValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v"`
+}
+
+// encodeCursor returns the signed cursor for a row
+func encodeCursor(keys []keyColumn, row reflect.Value) (string, error) {
+	row = reflect.Indirect(row)
+
+	payload := cursorPayload{}
+	for _, key := range keys {
+		value, err := newCursorValue(reflect.Indirect(row.FieldByIndex(key.field.Index)))
+		if err != nil {
+			return "", fmt.Errorf("cannot paginate by %s: %w", key.column, err)
+		}
+		payload.Columns = append(payload.Columns, key.column)
+		payload.Values = append(payload.Values, value)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(signCursor(data)), nil
+}
+
+// decodeCursor verifies a cursor and returns its values, which must have
+// been issued for the same key columns
+func decodeCursor(keys []keyColumn, cursor string) ([]interface{}, error) {
+	encoded, signature, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signCursor(data)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil || len(payload.Values) != len(keys) || len(payload.Columns) != len(keys) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if payload.Columns[i] != key.column {
+			return nil, fmt.Errorf("%w: issued for a different order", ErrInvalidCursor)
+		}
+		if values[i], err = payload.Values[i].decode(); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return values, nil
+}
+
+func signCursor(data []byte) []byte {
+	mac := hmac.New(sha256.New, cursorKey())
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func newCursorValue(v reflect.Value) (cursorValue, error) {
+	if !v.IsValid() {
+		return cursorValue{}, fmt.Errorf("value is NULL")
+	}
+
+	if t, ok := v.Interface().(time.Time); ok {
+		return cursorValue{Type: "time", Value: t.Format(time.RFC3339Nano)}, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cursorValue{Type: "int", Value: strconv.FormatInt(v.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cursorValue{Type: "uint", Value: strconv.FormatUint(v.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return cursorValue{Type: "float", Value: strconv.FormatFloat(v.Float(), 'g', -1, 64)}, nil
+	case reflect.Bool:
+		return cursorValue{Type: "bool", Value: strconv.FormatBool(v.Bool())}, nil
+	case reflect.String:
+		return cursorValue{Type: "string", Value: v.String()}, nil
+	}
+
+	return cursorValue{}, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func (c cursorValue) decode() (interface{}, error) {
+	switch c.Type {
+	case "time":
+		return time.Parse(time.RFC3339Nano, c.Value)
+	case "int":
+		return strconv.ParseInt(c.Value, 10, 64)
+	case "uint":
+		return strconv.ParseUint(c.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(c.Value, 64)
+	case "bool":
+		return strconv.ParseBool(c.Value)
+	case "string":
+		return c.Value, nil
+	}
+	return nil, fmt.Errorf("unknown cursor value type %q", c.Type)
+}
+
+func reverseSlice(s reflect.Value) {
+	swap := reflect.Swapper(s.Interface())
+	for i, j := 0, s.Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
@@ -0,0 +1,195 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// seedUsers creates users named user01..userNN whose ages repeat in a cycle
+// of three, so ordering by age alone is not total
+func seedUsers(t *testing.T, orm gor.ORM, n int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		user := &TestUser{Name: fmt.Sprintf("user%02d", i), Email: fmt.Sprintf("user%02d@example.com", i), Age: 20 + i%3}
+		if err := orm.Create(user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+}
+
+func namesOf(users []TestUser) []string {
+	result := make([]string, len(users))
+	for i, user := range users {
+		result[i] = user.Name
+	}
+	return result
+}
+
+func TestKeyset_PagesForwardAndBack(t *testing.T) {
+	orm := setupTestORM(t)
+	seedUsers(t, orm, 7)
+
+	// Age ascending, ties broken by ID
+	want := []string{"user03", "user06", "user01", "user04", "user07", "user02", "user05"}
+
+	var all []string
+	var cursors gor.PageCursors
+	var pages []gor.PageCursors
+	for {
+		var users []TestUser
+		qb := orm.Query(&users).Order("age").Limit(3)
+		if cursors.Next != "" {
+			qb = qb.After(cursors.Next)
+		}
+
+		var err error
+		cursors, err = qb.FindPage(&users)
+		if err != nil {
+			t.Fatalf("FindPage() error = %v", err)
+		}
+		all = append(all, namesOf(users)...)
+		pages = append(pages, cursors)
+		if cursors.Next == "" {
+			break
+		}
+	}
+
+	if !reflect.DeepEqual(all, want) {
+		t.Errorf("pages = %v, want %v", all, want)
+	}
+	if len(pages) != 3 || pages[0].Prev != "" || pages[2].Prev == "" {
+		t.Fatalf("cursors = %+v, want three pages with a previous cursor after the first", pages)
+	}
+
+	// Step back from the last page
+	var users []TestUser
+	cursors, err := orm.Query(&users).Order("age").Limit(3).Before(pages[2].Prev).FindPage(&users)
+	if err != nil {
+		t.Fatalf("FindPage() before error = %v", err)
+	}
+	if got := namesOf(users); !reflect.DeepEqual(got, want[3:6]) {
+		t.Errorf("previous page = %v, want %v", got, want[3:6])
+	}
+	if cursors.Prev == "" || cursors.Next == "" {
+		t.Errorf("middle page cursors = %+v, want both directions", cursors)
+	}
+}
+
+func TestKeyset_SeesConcurrentInserts(t *testing.T) {
+	orm := setupTestORM(t)
+	seedUsers(t, orm, 4)
+
+	var first []TestUser
+	cursors, err := orm.Query(&first).OrderDesc("id").Limit(2).FindPage(&first)
+	if err != nil {
+		t.Fatalf("FindPage() error = %v", err)
+	}
+
+	// A new row at the head would shift an offset-based second page
+	if err := orm.Create(&TestUser{Name: "newest", Email: "newest@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var second []TestUser
+	if err := orm.Query(&second).OrderDesc("id").Limit(2).After(cursors.Next).FindAll(&second); err != nil {
+		t.Fatalf("FindAll() after cursor error = %v", err)
+	}
+	if got := namesOf(second); !reflect.DeepEqual(got, []string{"user02", "user01"}) {
+		t.Errorf("second page = %v, want [user02 user01]", got)
+	}
+}
+
+func TestKeyset_RejectsBadCursors(t *testing.T) {
+	orm := setupTestORM(t)
+	seedUsers(t, orm, 3)
+
+	var users []TestUser
+	cursors, err := orm.Query(&users).Order("age").Limit(1).FindPage(&users)
+	if err != nil {
+		t.Fatalf("FindPage() error = %v", err)
+	}
+
+	payload, signature, _ := strings.Cut(cursors.Next, ".")
+	tampered := payload + "x." + signature
+
+	tests := map[string]gor.QueryBuilder{
+		"tampered":        orm.Query(&users).Order("age").After(tampered),
+		"tampered before": orm.Query(&users).Order("age").Before(tampered),
+		"garbage":         orm.Query(&users).Order("age").After("not-a-cursor"),
+		"other order":     orm.Query(&users).Order("name").After(cursors.Next),
+	}
+
+	for name, qb := range tests {
+		t.Run(name, func(t *testing.T) {
+			var page []TestUser
+			if err := qb.FindAll(&page); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("FindAll() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+
+	SetCursorSecret([]byte("rotated"))
+	t.Cleanup(func() { SetCursorSecret(nil) })
+	var page []TestUser
+	if err := orm.Query(&users).Order("age").After(cursors.Next).FindAll(&page); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("FindAll() with another secret error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestKeyset_SQL(t *testing.T) {
+	cursor, err := encodeCursor([]keyColumn{
+		{column: "age", field: schemaOf(reflect.TypeOf(TestUser{})).FieldByColumn("age")},
+		{column: "id", field: schemaOf(reflect.TypeOf(TestUser{})).FieldByColumn("id")},
+	}, reflect.ValueOf(TestUser{ID: 7, Age: 30}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dialectGolden{
+		sqlite:   `SELECT * FROM "users" WHERE (("users"."age" > ?) OR ("users"."age" = ? AND "users"."id" > ?)) ORDER BY "users"."age" ASC, "users"."id" ASC LIMIT 10`,
+		postgres: `SELECT * FROM "users" WHERE (("users"."age" > $1) OR ("users"."age" = $2 AND "users"."id" > $3)) ORDER BY "users"."age" ASC, "users"."id" ASC LIMIT 10`,
+		mysql:    "SELECT * FROM `users` WHERE ((`users`.`age` > ?) OR (`users`.`age` = ? AND `users`.`id` > ?)) ORDER BY `users`.`age` ASC, `users`.`id` ASC LIMIT 10",
+	}.check(t, "after", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) {
+			qb.Order("age").Limit(10).After(cursor)
+			seekQB, _, err := qb.seekQuery()
+			if err != nil {
+				t.Fatal(err)
+			}
+			*qb = *seekQB
+		})
+	})
+}
+
+func TestFindInBatches_SeeksByPrimaryKey(t *testing.T) {
+	orm := setupTestORM(t)
+	seedUsers(t, orm, 5)
+
+	var batches [][]string
+	var users []TestUser
+	err := orm.Query(&users).OrderDesc("name").FindInBatches(&users, 2, func(tx gor.Transaction, batch interface{}) error {
+		page := *batch.(*[]TestUser)
+		batches = append(batches, namesOf(page))
+
+		// Deleting rows that were already visited must not skip later ones
+		for _, user := range page {
+			if err := tx.Delete(&user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FindInBatches() error = %v", err)
+	}
+
+	want := [][]string{{"user01", "user02"}, {"user03", "user04"}, {"user05"}}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("batches = %v, want %v", batches, want)
+	}
+}
@@ -0,0 +1,90 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// ErrStaleObject is returned when an optimistic-locking update finds that
+// the record was changed since it was loaded
+var ErrStaleObject = errors.New("stale object: record was modified by another process")
+
+// lockMode is the pessimistic row lock requested by a query
+type lockMode int
+
+const (
+	noLock lockMode = iota
+	lockForUpdate
+	lockForShare
+)
+
+func (m lockMode) String() string {
+	switch m {
+	case lockForUpdate:
+		return "ForUpdate"
+	case lockForShare:
+		return "ForShare"
+	}
+	return "none"
+}
+
+// LockSQL returns nothing: SQLite has no row locks, and its transactions
+// begin with BEGIN IMMEDIATE, holding the database write lock until they end
+func (a *SQLiteAdapter) LockSQL(mode lockMode) string { return "" }
+
+func (a *PostgreSQLAdapter) LockSQL(mode lockMode) string {
+	switch mode {
+	case lockForUpdate:
+		return " FOR UPDATE"
+	case lockForShare:
+		return " FOR SHARE"
+	}
+	return ""
+}
+
+func (a *MySQLAdapter) LockSQL(mode lockMode) string {
+	switch mode {
+	case lockForUpdate:
+		return " FOR UPDATE"
+	case lockForShare:
+		return " LOCK IN SHARE MODE"
+	}
+	return ""
+}
+
+// ForUpdate locks the selected rows against concurrent writes until the
+// surrounding transaction ends
+func (qb *QueryBuilder) ForUpdate() gor.QueryBuilder {
+	qb.lock = lockForUpdate
+	return qb
+}
+
+// ForShare locks the selected rows against concurrent writes while still
+// allowing other transactions to read and share-lock them. SQLite has no
+// row locks, so there ForShare adds nothing to the write lock its
+// transactions already hold.
+func (qb *QueryBuilder) ForShare() gor.QueryBuilder {
+	qb.lock = lockForShare
+	return qb
+}
+
+// checkLock checks that a locking read runs inside a transaction, the
+// only place its locks mean anything
+func (qb *QueryBuilder) checkLock() error {
+	if qb.lock != noLock && qb.txn == nil {
+		return fmt.Errorf("%s requires a transaction", qb.lock)
+	}
+	return nil
+}
+
+// lockVersionFieldOf returns the optimistic-locking field of a model type,
+// if any
+func lockVersionFieldOf(modelType reflect.Type) *modelField {
+	if modelType == nil {
+		return nil
+	}
+	return schemaOf(modelType).LockVersion
+}
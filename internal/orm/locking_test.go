@@ -0,0 +1,154 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type LockedAccount struct {
+	ID          int64  `gor:"primary_key;auto_increment"`
+	Owner       string `gor:"not_null"`
+	Balance     int64  `gor:""`
+	LockVersion int    `gor:"lock_version;default:0"`
+}
+
+func (a *LockedAccount) TableName() string { return "locked_accounts" }
+
+func setupLockingORM(t *testing.T) gor.ORM {
+	path := filepath.Join(t.TempDir(), "locking.db")
+	config := gor.DatabaseConfig{
+		Driver:          "sqlite3",
+		Database:        path + "?_busy_timeout=50",
+		MaxOpenConns:    2,
+		MaxIdleConns:    2,
+		ConnMaxLifetime: time.Hour,
+	}
+
+	orm := NewORM(config)
+	if err := orm.Connect(context.Background(), config); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { orm.Close() })
+
+	if err := orm.Register(&LockedAccount{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+	if err := orm.Create(&LockedAccount{Owner: "ada", Balance: 100}); err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+
+	return orm
+}
+
+func TestOptimisticLocking(t *testing.T) {
+	orm := setupLockingORM(t)
+
+	first, second := &LockedAccount{}, &LockedAccount{}
+	if err := orm.Find(first, 1); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if err := orm.Find(second, 1); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+
+	first.Balance = 150
+	if err := orm.Update(first); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if first.LockVersion != 1 {
+		t.Errorf("LockVersion = %d, want 1 after update", first.LockVersion)
+	}
+
+	second.Balance = 50
+	err := orm.Update(second)
+	if !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("Update() of stale copy error = %v, want ErrStaleObject", err)
+	}
+	if err := orm.Table("locked_accounts").Update(second); !errors.Is(err, ErrStaleObject) {
+		t.Errorf("Table.Update() of stale copy error = %v, want ErrStaleObject", err)
+	}
+
+	reloaded := &LockedAccount{}
+	if err := orm.Find(reloaded, 1); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if reloaded.Balance != 150 || reloaded.LockVersion != 1 {
+		t.Errorf("reloaded = %+v, want the first update to win", reloaded)
+	}
+}
+
+func TestPessimisticLocking_SQL(t *testing.T) {
+	dialectGolden{
+		sqlite:   `SELECT * FROM "users" WHERE id = ? LIMIT 1`,
+		postgres: `SELECT * FROM "users" WHERE id = $1 LIMIT 1 FOR UPDATE`,
+		mysql:    "SELECT * FROM `users` WHERE id = ? LIMIT 1 FOR UPDATE",
+	}.check(t, "for update", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) { qb.Where("id = ?", 1).Limit(1).ForUpdate() })
+	})
+
+	dialectGolden{
+		sqlite:   `SELECT * FROM "users"`,
+		postgres: `SELECT * FROM "users" FOR SHARE`,
+		mysql:    "SELECT * FROM `users` LOCK IN SHARE MODE",
+	}.check(t, "for share", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) { qb.ForShare() })
+	})
+}
+
+func TestPessimisticLocking_RequiresTransaction(t *testing.T) {
+	orm := setupLockingORM(t)
+
+	account := &LockedAccount{}
+	if err := orm.Query(account).Where("id = ?", 1).ForUpdate().First(account); err == nil {
+		t.Error("ForUpdate() outside a transaction should fail")
+	}
+}
+
+func TestPessimisticLocking_SQLiteLocksOnBegin(t *testing.T) {
+	orm := setupLockingORM(t)
+
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		// Reading first is fine: the transaction took the write lock when
+		// it began
+		account := &LockedAccount{}
+		if err := tx.Query(account).Where("id = ?", 1).First(account); err != nil {
+			return err
+		}
+		if err := tx.Query(account).Where("id = ?", 1).ForUpdate().First(account); err != nil {
+			return err
+		}
+
+		// Another connection can no longer write until this transaction ends
+		if _, err := orm.DB().Exec("UPDATE locked_accounts SET balance = 0"); err == nil {
+			t.Error("concurrent write should be blocked by the transaction")
+		}
+
+		account.Balance += 10
+		return tx.Update(account)
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	account := &LockedAccount{}
+	if err := orm.Find(account, 1); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if account.Balance != 110 {
+		t.Errorf("Balance = %d, want 110", account.Balance)
+	}
+
+	err = orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		return tx.Transaction(func(nested gor.Transaction) error {
+			return nested.Query(account).Where("id = ?", 1).ForUpdate().First(account)
+		})
+	})
+	if err != nil {
+		t.Errorf("ForUpdate() in a nested transaction error = %v", err)
+	}
+}
@@ -1,30 +1,108 @@
 package orm
 
 import (
+	"bufio"
 	"context"
 	"database/sql"
 	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cuemby/gor/pkg/gor"
 )
 
+// DefaultMigrationsDir is where the migrator looks for migration files
+const DefaultMigrationsDir = "db/migrate"
+
+// MigrationFunc runs one direction of a Go migration inside the migration transaction
+type MigrationFunc func(tx *sql.Tx) error
+
+// loadedMigration is a loaded migration with both of its directions
+type loadedMigration struct {
+	gor.Migration
+	DownSQL string
+	Up      MigrationFunc
+	Down    MigrationFunc
+}
+
+var (
+	migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+	registryMu           sync.Mutex
+	registeredMigrations = make(map[string]loadedMigration)
+)
+
+// RegisterMigration registers a Go migration. It is meant to be called from
+// init() in db/migrate/<version>_<name>.go files. The version may carry the
+// migration name after an underscore, e.g. "20240101120000_create_users".
+func RegisterMigration(version string, up, down MigrationFunc) {
+	name := ""
+	if i := strings.Index(version, "_"); i > 0 {
+		version, name = version[:i], version[i+1:]
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if up == nil {
+		panic("orm: RegisterMigration up function is nil for version " + version)
+	}
+	if _, dup := registeredMigrations[version]; dup {
+		panic("orm: RegisterMigration called twice for version " + version)
+	}
+
+	registeredMigrations[version] = loadedMigration{
+		Migration: gor.Migration{Version: version, Name: name},
+		Up:        up,
+		Down:      down,
+	}
+}
+
 // Migrator handles database migrations
 type Migrator struct {
-	db      *sql.DB
-	adapter gor.DatabaseAdapter
+	db         *sql.DB
+	adapter    gor.DatabaseAdapter
+	dir        string
+	schemaPath string
 }
 
 // NewMigrator creates a new migrator instance
 func NewMigrator(db *sql.DB, adapter gor.DatabaseAdapter) *Migrator {
 	return &Migrator{
-		db:      db,
-		adapter: adapter,
+		db:         db,
+		adapter:    adapter,
+		dir:        DefaultMigrationsDir,
+		schemaPath: DefaultSchemaPath,
 	}
 }
 
+// SetMigrationsDir changes the directory migration files are loaded from
+func (m *Migrator) SetMigrationsDir(dir string) {
+	m.dir = dir
+}
+
+// SetSchemaPath changes the file the schema is dumped to after migrating.
+// An empty path turns the dump off.
+func (m *Migrator) SetSchemaPath(path string) {
+	m.schemaPath = path
+}
+
+// dumpSchema refreshes the schema dump after the migrations changed
+func (m *Migrator) dumpSchema() error {
+	if m.schemaPath == "" {
+		return nil
+	}
+	if err := writeSchemaFile(m.schemaPath, m.db, m.adapter); err != nil {
+		return fmt.Errorf("failed to dump schema: %w", err)
+	}
+	return nil
+}
+
 // Migrate runs all pending migrations
 func (m *Migrator) Migrate(ctx context.Context) error {
 	// Create migrations table if it doesn't exist
@@ -38,11 +116,6 @@ func (m *Migrator) Migrate(ctx context.Context) error {
 		return fmt.Errorf("failed to load migrations: %w", err)
 	}
 
-	// Sort migrations by version
-	sort.Slice(migrations, func(i, j int) bool {
-		return migrations[i].Version < migrations[j].Version
-	})
-
 	// Apply each migration
 	for _, migration := range migrations {
 		if err := m.applyMigration(ctx, migration); err != nil {
@@ -50,7 +123,7 @@ func (m *Migrator) Migrate(ctx context.Context) error {
 		}
 	}
 
-	return nil
+	return m.dumpSchema()
 }
 
 // Rollback rolls back the specified number of migrations
@@ -65,6 +138,16 @@ func (m *Migrator) Rollback(ctx context.Context, steps int) error {
 		return fmt.Errorf("no migrations to rollback")
 	}
 
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	byVersion := make(map[string]loadedMigration, len(migrations))
+	for _, mig := range migrations {
+		byVersion[mig.Version] = mig
+	}
+
 	// Sort by version descending
 	sort.Slice(appliedMigrations, func(i, j int) bool {
 		return appliedMigrations[i].Version > appliedMigrations[j].Version
@@ -78,23 +161,53 @@ func (m *Migrator) Rollback(ctx context.Context, steps int) error {
 	toRollback := appliedMigrations[:steps]
 
 	// Rollback each migration
-	for _, migration := range toRollback {
-		if err := m.rollbackMigration(ctx, migration); err != nil {
-			return fmt.Errorf("failed to rollback migration %s: %w", migration.Version, err)
+	for _, applied := range toRollback {
+		mig, ok := byVersion[applied.Version]
+		if !ok {
+			return fmt.Errorf("migration %s is applied but no longer exists in %s or the registry", applied.Version, m.dir)
+		}
+		if err := m.rollbackMigration(ctx, mig); err != nil {
+			return fmt.Errorf("failed to rollback migration %s: %w", applied.Version, err)
 		}
 	}
 
-	return nil
+	return m.dumpSchema()
 }
 
-// Status returns the current migration status
+// Status returns every known migration ordered by version. Pending
+// migrations have a zero AppliedAt.
 func (m *Migrator) Status(ctx context.Context) ([]gor.Migration, error) {
+	if err := m.createMigrationsTable(); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
 	appliedMigrations, err := m.getAppliedMigrations()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
 	}
 
-	return appliedMigrations, nil
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	status := make(map[string]gor.Migration, len(migrations)+len(appliedMigrations))
+	for _, mig := range migrations {
+		status[mig.Version] = mig.Migration
+	}
+	for _, applied := range appliedMigrations {
+		status[applied.Version] = applied
+	}
+
+	result := make([]gor.Migration, 0, len(status))
+	for _, mig := range status {
+		result = append(result, mig)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return result, nil
 }
 
 // createMigrationsTable creates the migrations tracking table
@@ -112,19 +225,236 @@ func (m *Migrator) createMigrationsTable() error {
 	return err
 }
 
-// loadMigrations loads all migration files from the migrations directory
-func (m *Migrator) loadMigrations() ([]gor.Migration, error) {
-	// In a real implementation, this would read migration files from disk
-	// For now, we'll return an empty slice as we haven't implemented
-	// the file system migration loading yet
-	return []gor.Migration{}, nil
+// loadMigrations loads the SQL migration files from the migrations directory
+// together with the registered Go migrations, sorted by version
+func (m *Migrator) loadMigrations() ([]loadedMigration, error) {
+	byVersion := make(map[string]loadedMigration)
+
+	registryMu.Lock()
+	for version, mig := range registeredMigrations {
+		byVersion[version] = mig
+	}
+	registryMu.Unlock()
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		// Go migrations are compiled into the application and register
+		// themselves, so only .sql files are read here
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, name := match[1], match[2]
+		if _, dup := byVersion[version]; dup {
+			return nil, fmt.Errorf("duplicate migration version %s (%s)", version, entry.Name())
+		}
+
+		up, down, err := parseMigrationFile(filepath.Join(m.dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", entry.Name(), err)
+		}
+
+		byVersion[version] = loadedMigration{
+			Migration: gor.Migration{Version: version, Name: name, SQL: up},
+			DownSQL:   down,
+		}
+	}
+
+	migrations := make([]loadedMigration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		migrations = append(migrations, mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// parseMigrationFile splits a SQL migration file into its up and down
+// sections. Sections start with "-- +up" / "-- +down" (the goose-style
+// "-- +migrate Up" / "-- +migrate Down" markers are accepted too). A file
+// without markers is treated as up-only.
+func parseMigrationFile(path string) (string, string, error) {
+	file, err := os.Open(path) // #nosec G304 - Path comes from the migrations directory listing
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	var up, down strings.Builder
+	current := &up
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		marker := strings.ToLower(strings.Join(strings.Fields(line), " "))
+
+		switch marker {
+		case "-- +up", "-- +migrate up":
+			current = &up
+			continue
+		case "-- +down", "-- +migrate down":
+			current = &down
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSpace(up.String()), strings.TrimSpace(down.String()), nil
+}
+
+// execStatements runs the statements of a migration section one at a
+// time: MySQL only runs several statements in one call when the DSN sets
+// multiStatements=true, and PostgreSQL's extended protocol never does
+func execStatements(ctx context.Context, tx *sql.Tx, section string) error {
+	for _, statement := range splitStatements(section) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%w in %q", err, firstLine(statement))
+		}
+	}
+	return nil
+}
+
+// compoundEnds are the words after END that close a MySQL IF, LOOP, WHILE
+// or REPEAT block rather than a BEGIN or CASE
+var compoundEnds = map[string]bool{"IF": true, "LOOP": true, "WHILE": true, "REPEAT": true}
+
+// splitStatements splits SQL into its statements on the semicolons ending
+// them. Semicolons in strings, quoted identifiers, comments and
+// dollar-quoted bodies do not end a statement, nor do those inside the
+// BEGIN ... END body of a trigger, procedure or function. Statements made
+// only of comments are left out.
+func splitStatements(sql string) []string {
+	var statements []string
+	var words []string
+	start, depth, hasCode := 0, 0, false
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// A doubled quote escapes the quote, so it simply reopens
+			end := strings.IndexByte(sql[i+1:], c)
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 2
+			}
+			hasCode = true
+		case strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(sql)
+			}
+		case c == '$' && dollarTag.MatchString(sql[i:]):
+			tag := dollarTag.FindString(sql[i:])
+			if end := strings.Index(sql[i+len(tag):], tag); end >= 0 {
+				i += len(tag) + end + len(tag)
+			} else {
+				i = len(sql)
+			}
+			hasCode = true
+		case isWordByte(c):
+			word := strings.ToUpper(readWord(sql, i))
+			i += len(word)
+			hasCode = true
+			if len(words) < 8 {
+				words = append(words, word)
+			}
+			if !isCompound(words) {
+				continue
+			}
+			switch word {
+			case "BEGIN", "CASE":
+				depth++
+			case "END":
+				// The word after END is consumed, so END CASE is not
+				// counted as the start of another CASE
+				space := len(sql[i:]) - len(strings.TrimLeft(sql[i:], " \t\r\n"))
+				next := strings.ToUpper(readWord(sql, i+space))
+				if compoundEnds[next] || next == "CASE" {
+					i += space + len(next)
+				}
+				if !compoundEnds[next] {
+					depth = max(depth-1, 0)
+				}
+			}
+		case c == ';' && depth == 0:
+			if hasCode {
+				statements = append(statements, strings.TrimSpace(sql[start:i]))
+			}
+			i++
+			start, words, hasCode = i, nil, false
+		default:
+			i++
+		}
+	}
+
+	if hasCode {
+		statements = append(statements, strings.TrimSpace(sql[start:]))
+	}
+	return statements
+}
+
+// dollarTag matches the tag opening a PostgreSQL dollar-quoted string
+var dollarTag = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// isCompound reports whether a statement starting with words creates a
+// trigger, procedure or function, whose body may hold semicolons
+func isCompound(words []string) bool {
+	if len(words) == 0 || words[0] != "CREATE" {
+		return false
+	}
+	for _, word := range words[1:] {
+		switch word {
+		case "TRIGGER", "PROCEDURE", "FUNCTION":
+			return true
+		}
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// readWord returns the word starting at sql[i], if any
+func readWord(sql string, i int) string {
+	end := i
+	for end < len(sql) && isWordByte(sql[end]) {
+		end++
+	}
+	return sql[i:end]
 }
 
 // applyMigration applies a single migration
-func (m *Migrator) applyMigration(ctx context.Context, migration gor.Migration) error {
+func (m *Migrator) applyMigration(ctx context.Context, migration loadedMigration) error {
 	// Check if migration is already applied
 	var count int
-	err := m.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM gor_migrations WHERE version = ?", migration.Version).Scan(&count)
+	err := m.db.QueryRowContext(ctx, rebind(dialectFor(m.adapter), "SELECT COUNT(*) FROM gor_migrations WHERE version = ?"), migration.Version).Scan(&count)
 	if err != nil {
 		return err
 	}
@@ -141,13 +471,17 @@ func (m *Migrator) applyMigration(ctx context.Context, migration gor.Migration)
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	// Apply migration SQL
-	if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+	// Apply migration
+	if migration.Up != nil {
+		if err := migration.Up(tx); err != nil {
+			return fmt.Errorf("failed to run migration: %w", err)
+		}
+	} else if err := execStatements(ctx, tx, migration.SQL); err != nil {
 		return fmt.Errorf("failed to execute migration SQL: %w", err)
 	}
 
 	// Record migration
-	_, err = tx.ExecContext(ctx, "INSERT INTO gor_migrations (version, name, sql) VALUES (?, ?, ?)",
+	_, err = tx.ExecContext(ctx, rebind(dialectFor(m.adapter), "INSERT INTO gor_migrations (version, name, sql) VALUES (?, ?, ?)"),
 		migration.Version, migration.Name, migration.SQL)
 	if err != nil {
 		return fmt.Errorf("failed to record migration: %w", err)
@@ -157,7 +491,11 @@ func (m *Migrator) applyMigration(ctx context.Context, migration gor.Migration)
 }
 
 // rollbackMigration rolls back a single migration
-func (m *Migrator) rollbackMigration(ctx context.Context, migration gor.Migration) error {
+func (m *Migrator) rollbackMigration(ctx context.Context, migration loadedMigration) error {
+	if migration.Down == nil && migration.DownSQL == "" {
+		return fmt.Errorf("migration %s has no down section", migration.Version)
+	}
+
 	// Start transaction
 	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -165,10 +503,15 @@ func (m *Migrator) rollbackMigration(ctx context.Context, migration gor.Migratio
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	// For a real implementation, we would need to store rollback SQL
-	// or generate it based on the forward migration
-	// For now, we'll just remove the record from migrations table
-	_, err = tx.ExecContext(ctx, "DELETE FROM gor_migrations WHERE version = ?", migration.Version)
+	if migration.Down != nil {
+		if err := migration.Down(tx); err != nil {
+			return fmt.Errorf("failed to run down migration: %w", err)
+		}
+	} else if err := execStatements(ctx, tx, migration.DownSQL); err != nil {
+		return fmt.Errorf("failed to execute down migration SQL: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, rebind(dialectFor(m.adapter), "DELETE FROM gor_migrations WHERE version = ?"), migration.Version)
 	if err != nil {
 		return fmt.Errorf("failed to remove migration record: %w", err)
 	}
@@ -209,27 +552,44 @@ func NewMigrationGenerator(migrationsDir string) *MigrationGenerator {
 	}
 }
 
-// GenerateMigration creates a new migration file
-func (mg *MigrationGenerator) GenerateMigration(name string) error {
+// GenerateMigration creates a new, empty SQL migration file and returns its path
+func (mg *MigrationGenerator) GenerateMigration(name string) (string, error) {
+	return mg.writeMigration(name, "", "")
+}
+
+// writeMigration writes a timestamped SQL migration file with the given up
+// and down sections and returns its path
+func (mg *MigrationGenerator) writeMigration(name, up, down string) (string, error) {
 	// Generate version based on timestamp
 	version := time.Now().Format("20060102150405")
 	filename := fmt.Sprintf("%s_%s.sql", version, name)
-	filepath := filepath.Join(mg.migrationsDir, filename)
+	path := filepath.Join(mg.migrationsDir, filename)
 
 	// Migration template
 	template := fmt.Sprintf(`-- Migration: %s
 -- Created: %s
 
--- +migrate Up
+-- +up
+%s
+-- +down
+%s`, name, time.Now().Format("2006-01-02 15:04:05"), sectionBody(up), sectionBody(down))
 
--- +migrate Down
-`, name, time.Now().Format("2006-01-02 15:04:05"))
+	if err := os.MkdirAll(mg.migrationsDir, 0755); err != nil { // #nosec G301 - Migrations directory must be readable by tooling
+		return "", err
+	}
 
-	// In a real implementation, we would write this to a file
-	_ = filepath
-	_ = template
+	if err := os.WriteFile(path, []byte(template), 0644); err != nil { // #nosec G306 - Migration files are source code
+		return "", err
+	}
 
-	return nil
+	return path, nil
+}
+
+func sectionBody(sql string) string {
+	if sql == "" {
+		return ""
+	}
+	return sql + "\n"
 }
 
 // CreateTableMigration generates a CREATE TABLE migration
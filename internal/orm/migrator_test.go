@@ -0,0 +1,324 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupTestMigrator(t *testing.T) (*Migrator, *sql.DB, string) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	dir := t.TempDir()
+	migrator := NewMigrator(db, NewSQLiteAdapter())
+	migrator.SetMigrationsDir(dir)
+
+	return migrator, db, dir
+}
+
+func writeMigrationFile(t *testing.T, dir, name, content string) {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write migration %s: %v", name, err)
+	}
+}
+
+func tableExistsIn(t *testing.T, db *sql.DB, name string) bool {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query sqlite_master: %v", err)
+	}
+	return count > 0
+}
+
+func TestParseMigrationFile(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("UpAndDown", func(t *testing.T) {
+		writeMigrationFile(t, dir, "1_a.sql", "-- +up\nCREATE TABLE a (id INTEGER);\n-- +down\nDROP TABLE a;\n")
+		up, down, err := parseMigrationFile(filepath.Join(dir, "1_a.sql"))
+		if err != nil {
+			t.Fatalf("parseMigrationFile() error = %v", err)
+		}
+		if up != "CREATE TABLE a (id INTEGER);" {
+			t.Errorf("up = %q", up)
+		}
+		if down != "DROP TABLE a;" {
+			t.Errorf("down = %q", down)
+		}
+	})
+
+	t.Run("GooseStyleMarkers", func(t *testing.T) {
+		writeMigrationFile(t, dir, "2_b.sql", "-- +migrate Up\nCREATE TABLE b (id INTEGER);\n-- +migrate Down\nDROP TABLE b;\n")
+		up, down, err := parseMigrationFile(filepath.Join(dir, "2_b.sql"))
+		if err != nil {
+			t.Fatalf("parseMigrationFile() error = %v", err)
+		}
+		if up == "" || down == "" {
+			t.Errorf("expected both sections, got up=%q down=%q", up, down)
+		}
+	})
+
+	t.Run("NoMarkers", func(t *testing.T) {
+		writeMigrationFile(t, dir, "3_c.sql", "CREATE TABLE c (id INTEGER);\n")
+		up, down, err := parseMigrationFile(filepath.Join(dir, "3_c.sql"))
+		if err != nil {
+			t.Fatalf("parseMigrationFile() error = %v", err)
+		}
+		if up != "CREATE TABLE c (id INTEGER);" || down != "" {
+			t.Errorf("got up=%q down=%q", up, down)
+		}
+	})
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "Statements",
+			sql:  "CREATE TABLE a (id INTEGER);\nCREATE INDEX idx_a ON a (id);\n",
+			want: []string{"CREATE TABLE a (id INTEGER)", "CREATE INDEX idx_a ON a (id)"},
+		},
+		{
+			name: "QuotesAndComments",
+			sql:  "-- a; comment\nINSERT INTO \"a;b\" (`c;d`) VALUES ('it''s; fine') /* ; */;\n-- trailing; comment\n",
+			want: []string{"-- a; comment\nINSERT INTO \"a;b\" (`c;d`) VALUES ('it''s; fine') /* ; */"},
+		},
+		{
+			name: "DollarQuotedFunction",
+			sql:  "CREATE FUNCTION touch() RETURNS trigger AS $body$\nBEGIN\n  NEW.updated_at = now();\n  RETURN NEW;\nEND;\n$body$ LANGUAGE plpgsql;\nSELECT $1;",
+			want: []string{"CREATE FUNCTION touch() RETURNS trigger AS $body$\nBEGIN\n  NEW.updated_at = now();\n  RETURN NEW;\nEND;\n$body$ LANGUAGE plpgsql", "SELECT $1"},
+		},
+		{
+			name: "TriggerBody",
+			sql:  "CREATE TRIGGER log AFTER INSERT ON a BEGIN\n  INSERT INTO b VALUES (CASE WHEN new.id > 0 THEN 1 ELSE 0 END);\n\n  DELETE FROM c;\nEND;\nDROP TABLE d;",
+			want: []string{"CREATE TRIGGER log AFTER INSERT ON a BEGIN\n  INSERT INTO b VALUES (CASE WHEN new.id > 0 THEN 1 ELSE 0 END);\n\n  DELETE FROM c;\nEND", "DROP TABLE d"},
+		},
+		{
+			name: "MySQLCompoundStatements",
+			sql:  "CREATE TRIGGER check_a BEFORE INSERT ON a FOR EACH ROW BEGIN\n  IF NEW.id < 0 THEN SET NEW.id = 0; END IF;\n  CASE NEW.kind WHEN 1 THEN SET NEW.n = 1; ELSE SET NEW.n = 2; END CASE;\nEND;\nDROP TABLE d",
+			want: []string{"CREATE TRIGGER check_a BEFORE INSERT ON a FOR EACH ROW BEGIN\n  IF NEW.id < 0 THEN SET NEW.id = 0; END IF;\n  CASE NEW.kind WHEN 1 THEN SET NEW.n = 1; ELSE SET NEW.n = 2; END CASE;\nEND", "DROP TABLE d"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := splitStatements(test.sql)
+			if strings.Join(got, "\n---\n") != strings.Join(test.want, "\n---\n") {
+				t.Errorf("splitStatements() =\n%q\nwant\n%q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMigrator_MigrateAndRollback(t *testing.T) {
+	migrator, db, dir := setupTestMigrator(t)
+	ctx := context.Background()
+
+	writeMigrationFile(t, dir, "20240101000001_create_authors.sql",
+		"-- +up\nCREATE TABLE authors (id INTEGER PRIMARY KEY, name TEXT);\n-- +down\nDROP TABLE authors;\n")
+	writeMigrationFile(t, dir, "20240101000002_create_books.sql",
+		"-- +up\nCREATE TABLE books (id INTEGER PRIMARY KEY, title TEXT);\n-- +down\nDROP TABLE books;\n")
+	writeMigrationFile(t, dir, "README.md", "not a migration")
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	if !tableExistsIn(t, db, "authors") || !tableExistsIn(t, db, "books") {
+		t.Fatal("Migrate() should create tables from SQL files")
+	}
+
+	// Running again is a no-op
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("second Migrate() error = %v", err)
+	}
+
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(status) != 2 || status[0].Name != "create_authors" || status[0].AppliedAt.IsZero() {
+		t.Errorf("Status() = %+v", status)
+	}
+
+	if err := migrator.Rollback(ctx, 1); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	if tableExistsIn(t, db, "books") {
+		t.Error("Rollback() should run the down section of the latest migration")
+	}
+	if !tableExistsIn(t, db, "authors") {
+		t.Error("Rollback(1) should leave earlier migrations in place")
+	}
+
+	status, err = migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(status) != 2 || !status[1].AppliedAt.IsZero() {
+		t.Errorf("Status() should report rolled back migration as pending: %+v", status)
+	}
+}
+
+func TestMigrator_FailedMigrationIsNotRecorded(t *testing.T) {
+	migrator, db, dir := setupTestMigrator(t)
+	ctx := context.Background()
+
+	writeMigrationFile(t, dir, "20240101000001_broken.sql", "-- +up\nCREATE TABLE;\n")
+
+	err := migrator.Migrate(ctx)
+	if err == nil || !strings.Contains(err.Error(), "20240101000001") {
+		t.Fatalf("Migrate() error = %v, want failure naming the version", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM gor_migrations").Scan(&count); err != nil {
+		t.Fatalf("Failed to count migrations: %v", err)
+	}
+	if count != 0 {
+		t.Error("failed migration should not be recorded")
+	}
+}
+
+func TestMigrator_RunsStatementsOneAtATime(t *testing.T) {
+	migrator, db, dir := setupTestMigrator(t)
+	ctx := context.Background()
+
+	writeMigrationFile(t, dir, "20240101000001_create_notes.sql", `-- +up
+CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT NOT NULL DEFAULT 'empty; for now');
+CREATE TABLE note_log (note_id INTEGER);
+CREATE TRIGGER notes_logged AFTER INSERT ON notes BEGIN
+  INSERT INTO note_log (note_id) VALUES (new.id);
+END;
+INSERT INTO notes (id) VALUES (1);
+-- +down
+DROP TABLE note_log;
+DROP TABLE notes;
+`)
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	var body string
+	var logged int
+	if err := db.QueryRow("SELECT body, (SELECT COUNT(*) FROM note_log) FROM notes").Scan(&body, &logged); err != nil {
+		t.Fatal(err)
+	}
+	if body != "empty; for now" || logged != 1 {
+		t.Errorf("migrated note body %q with %d log rows, want the default and the trigger's row", body, logged)
+	}
+
+	if err := migrator.Rollback(ctx, 1); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if tableExistsIn(t, db, "notes") || tableExistsIn(t, db, "note_log") {
+		t.Error("Rollback() should run every statement of the down section")
+	}
+}
+
+func TestMigrator_GoMigrations(t *testing.T) {
+	migrator, db, dir := setupTestMigrator(t)
+	ctx := context.Background()
+
+	RegisterMigration("20240102000001_create_widgets",
+		func(tx *sql.Tx) error {
+			_, err := tx.Exec("CREATE TABLE widgets (id INTEGER PRIMARY KEY)")
+			return err
+		},
+		func(tx *sql.Tx) error {
+			_, err := tx.Exec("DROP TABLE widgets")
+			return err
+		})
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registeredMigrations, "20240102000001")
+		registryMu.Unlock()
+	})
+
+	writeMigrationFile(t, dir, "20240101000001_create_gadgets.sql",
+		"-- +up\nCREATE TABLE gadgets (id INTEGER PRIMARY KEY);\n-- +down\nDROP TABLE gadgets;\n")
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if !tableExistsIn(t, db, "widgets") {
+		t.Fatal("Migrate() should run registered Go migrations")
+	}
+
+	var name string
+	if err := db.QueryRow("SELECT name FROM gor_migrations WHERE version = ?", "20240102000001").Scan(&name); err != nil {
+		t.Fatalf("Go migration was not recorded: %v", err)
+	}
+	if name != "create_widgets" {
+		t.Errorf("recorded name = %q, want create_widgets", name)
+	}
+
+	if err := migrator.Rollback(ctx, 2); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if tableExistsIn(t, db, "widgets") || tableExistsIn(t, db, "gadgets") {
+		t.Error("Rollback(2) should undo both migrations")
+	}
+}
+
+func TestMigrator_DuplicateVersion(t *testing.T) {
+	migrator, _, dir := setupTestMigrator(t)
+
+	writeMigrationFile(t, dir, "20240101000001_one.sql", "SELECT 1;")
+	writeMigrationFile(t, dir, "20240101000001_two.sql", "SELECT 1;")
+
+	if err := migrator.Migrate(context.Background()); err == nil {
+		t.Error("Migrate() should reject duplicate versions")
+	}
+}
+
+func TestMigrator_RollbackWithoutDown(t *testing.T) {
+	migrator, _, dir := setupTestMigrator(t)
+	ctx := context.Background()
+
+	writeMigrationFile(t, dir, "20240101000001_irreversible.sql", "CREATE TABLE things (id INTEGER);")
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if err := migrator.Rollback(ctx, 1); err == nil {
+		t.Error("Rollback() should fail for a migration without a down section")
+	}
+}
+
+func TestMigrationGenerator_GenerateMigration(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db", "migrate")
+	generator := NewMigrationGenerator(dir)
+
+	path, err := generator.GenerateMigration("create_users")
+	if err != nil {
+		t.Fatalf("GenerateMigration() error = %v", err)
+	}
+
+	if !migrationFilePattern.MatchString(filepath.Base(path)) {
+		t.Errorf("generated file name %q does not match the migration pattern", filepath.Base(path))
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read generated migration: %v", err)
+	}
+	if !strings.Contains(string(content), "-- +up") || !strings.Contains(string(content), "-- +down") {
+		t.Error("generated migration should contain up and down markers")
+	}
+}
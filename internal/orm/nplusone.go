@@ -0,0 +1,179 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// NPlusOne is a query that ran with different arguments at least the N+1
+// threshold times within one request or job: the signature of loading an
+// association once per record instead of preloading it with Includes
+type NPlusOne struct {
+	SQL    string
+	Count  int
+	Caller string
+}
+
+// NPlusOneError fails a request or job that ran N+1 queries in the test
+// environment
+type NPlusOneError struct {
+	Queries []NPlusOne
+}
+
+func (e *NPlusOneError) Error() string {
+	queries := make([]string, len(e.Queries))
+	for i, query := range e.Queries {
+		queries[i] = fmt.Sprintf("%s ran %d times (%s)", query.SQL, query.Count, query.Caller)
+	}
+	return "N+1 queries detected: " + strings.Join(queries, "; ")
+}
+
+var nPlusOneThreshold atomic.Int64
+
+func init() {
+	nPlusOneThreshold.Store(3)
+}
+
+// SetNPlusOneThreshold sets how many times a query may run with different
+// arguments in one request or job before it is reported. The default is 3.
+func SetNPlusOneThreshold(n int) {
+	nPlusOneThreshold.Store(int64(n))
+}
+
+type nPlusOneKey struct{}
+
+// nPlusOneTracker counts query shapes within one unit of work
+type nPlusOneTracker struct {
+	mu       sync.Mutex
+	shapes   map[string]*queryShape
+	detected []*queryShape
+}
+
+type queryShape struct {
+	NPlusOne
+	args map[string]bool
+}
+
+// DetectNPlusOne returns a context that tracks the reads run with it, for
+// the length of one request or job:
+//
+//	ctx := orm.DetectNPlusOne(ctx)
+//	db := db.WithContext(ctx)
+//
+// Outside the test environment each N+1 query is logged when found; in it
+// (GOR_ENV or GO_ENV set to "test") the middlewares fail instead.
+func DetectNPlusOne(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, nPlusOneKey{}, &nPlusOneTracker{shapes: make(map[string]*queryShape)})
+}
+
+// NPlusOneQueries returns the N+1 queries found so far in ctx's unit of work
+func NPlusOneQueries(ctx context.Context) []NPlusOne {
+	tracker := nPlusOneTrackerFrom(ctx)
+	if tracker == nil {
+		return nil
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	queries := make([]NPlusOne, len(tracker.detected))
+	for i, shape := range tracker.detected {
+		queries[i] = shape.NPlusOne
+	}
+	return queries
+}
+
+// withoutNPlusOne returns a context whose reads are not tracked, for
+// statements that repeat by design, such as the queries of a batch loop
+func withoutNPlusOne(ctx context.Context) context.Context {
+	if nPlusOneTrackerFrom(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, nPlusOneKey{}, (*nPlusOneTracker)(nil))
+}
+
+func nPlusOneTrackerFrom(ctx context.Context) *nPlusOneTracker {
+	tracker, _ := ctx.Value(nPlusOneKey{}).(*nPlusOneTracker)
+	return tracker
+}
+
+// track counts a read, reporting its shape the first time it reaches the
+// threshold
+func (t *nPlusOneTracker) track(event QueryEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	shape, ok := t.shapes[event.SQL]
+	if !ok {
+		shape = &queryShape{NPlusOne: NPlusOne{SQL: event.SQL, Caller: event.Caller}, args: make(map[string]bool)}
+		t.shapes[event.SQL] = shape
+	}
+
+	key := fmt.Sprintf("%#v", event.Args)
+	if shape.args[key] {
+		return
+	}
+	shape.args[key] = true
+	shape.Count++
+
+	if int64(shape.Count) == nPlusOneThreshold.Load() {
+		t.detected = append(t.detected, shape)
+		if !testEnvironment() {
+			log.Printf("orm: N+1 query: %s ran %d times with different arguments (%s); preload it with Includes", shape.SQL, shape.Count, shape.Caller)
+		}
+	}
+}
+
+// testEnvironment reports whether the application runs its tests
+func testEnvironment() bool {
+	env := os.Getenv("GOR_ENV")
+	if env == "" {
+		env = os.Getenv("GO_ENV")
+	}
+	return env == "test"
+}
+
+// nPlusOneFailure returns the error failing a unit of work that ran N+1
+// queries in the test environment
+func nPlusOneFailure(ctx context.Context) error {
+	if !testEnvironment() {
+		return nil
+	}
+	if queries := NPlusOneQueries(ctx); len(queries) > 0 {
+		return &NPlusOneError{Queries: queries}
+	}
+	return nil
+}
+
+// NPlusOneMiddleware detects N+1 queries within each request. Handlers
+// must run their queries with the request context, db.WithContext(ctx).
+func NPlusOneMiddleware(next gor.HandlerFunc) gor.HandlerFunc {
+	return func(ctx *gor.Context) error {
+		ctx.Context = DetectNPlusOne(ctx.Context)
+		if err := next(ctx); err != nil {
+			return err
+		}
+		return nPlusOneFailure(ctx.Context)
+	}
+}
+
+// NPlusOneJobMiddleware detects N+1 queries within each job
+type NPlusOneJobMiddleware struct{}
+
+// Process runs the job with N+1 detection
+func (NPlusOneJobMiddleware) Process(ctx context.Context, job gor.Job, next func(context.Context, gor.Job) error) error {
+	ctx = DetectNPlusOne(ctx)
+	if err := next(ctx, job); err != nil {
+		return err
+	}
+	return nPlusOneFailure(ctx)
+}
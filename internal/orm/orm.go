@@ -25,6 +25,8 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cuemby/gor/pkg/gor"
@@ -33,21 +35,50 @@ import (
 // gorORM implements the gor.ORM interface
 type gorORM struct {
 	db       *sql.DB
+	ctx      context.Context
 	adapter  gor.DatabaseAdapter
 	models   map[string]reflect.Type
 	migrator *Migrator
 	config   gor.DatabaseConfig
+
+	// replicas serve reads outside transactions; connections are the
+	// other named databases
+	replicas    *replicaSet
+	connections map[string]*gorORM
+
+	// keys encrypts the encrypted columns of this database's models
+	keys *keyring
 }
 
 // NewORM creates a new ORM instance
 func NewORM(config gor.DatabaseConfig) gor.ORM {
 	return &gorORM{
+		ctx:     context.Background(),
 		models:  make(map[string]reflect.Type),
 		config:  config,
 		adapter: getAdapter(config.Driver),
+		keys:    &keyring{},
 	}
 }
 
+// WithContext returns an ORM sharing this one's connection whose
+// statements run with ctx, so they are canceled along with it:
+//
+//	db := orm.WithContext(r.Context())
+func (o *gorORM) WithContext(ctx context.Context) gor.ORM {
+	if ctx == nil {
+		panic("orm: nil context")
+	}
+	scoped := *o
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// exec returns the database bound to the ORM's context
+func (o *gorORM) exec() executor {
+	return withContext(o.ctx, o.db, o.adapter, o.keys)
+}
+
 // Connect establishes database connection
 func (o *gorORM) Connect(ctx context.Context, config gor.DatabaseConfig) error {
 	db, err := o.adapter.Connect(config)
@@ -58,17 +89,54 @@ func (o *gorORM) Connect(ctx context.Context, config gor.DatabaseConfig) error {
 	o.db = db
 	o.migrator = NewMigrator(db, o.adapter)
 
+	if len(config.EncryptionKeys) > 0 {
+		keys := make([][]byte, len(config.EncryptionKeys))
+		for i, key := range config.EncryptionKeys {
+			keys[i] = []byte(key)
+		}
+		if err := o.keys.set(keys); err != nil {
+			return fmt.Errorf("invalid encryption keys: %w", err)
+		}
+	}
+
 	// Configure connection pool
 	o.db.SetMaxOpenConns(config.MaxOpenConns)
 	o.db.SetMaxIdleConns(config.MaxIdleConns)
 	o.db.SetConnMaxLifetime(config.ConnMaxLifetime)
 
 	// Test connection
-	return o.db.PingContext(ctx)
+	if err := o.db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	replicas, err := connectReplicas(ctx, config)
+	if err != nil {
+		return err
+	}
+	o.replicas = replicas
+
+	for name, connectionConfig := range config.Connections {
+		connection := NewORM(connectionConfig).(*gorORM)
+		connection.models = o.models
+		if err := connection.Connect(ctx, connectionConfig); err != nil {
+			return fmt.Errorf("failed to connect to %s database: %w", name, err)
+		}
+		if o.connections == nil {
+			o.connections = make(map[string]*gorORM)
+		}
+		o.connections[name] = connection
+	}
+
+	return nil
 }
 
 // Close closes the database connection
 func (o *gorORM) Close() error {
+	for _, connection := range o.connections {
+		_ = connection.Close()
+	}
+	_ = o.replicas.close()
+
 	if o.db != nil {
 		return o.db.Close()
 	}
@@ -87,25 +155,47 @@ func (o *gorORM) Register(models ...interface{}) error {
 		if t.Kind() == reflect.Ptr {
 			t = t.Elem()
 		}
+		if err := schemaOf(t).err; err != nil {
+			return err
+		}
 
 		// Get table name
 		tableName := getTableName(t)
 		o.models[tableName] = t
+		registerModelType(t)
 
 		// Create table if auto-migrate is enabled
 		if err := o.createTableIfNotExists(t); err != nil {
 			return fmt.Errorf("failed to create table for %s: %w", tableName, err)
 		}
+
+		// Audited models keep their history in the versions table
+		if schemaOf(t).Audited {
+			if err := o.Register(&Version{}); err != nil {
+				return err
+			}
+		}
+
+		if machine := stateMachineOf(t); machine != nil {
+			if _, err := stateField(t, machine); err != nil {
+				return err
+			}
+			if machine.history {
+				if err := o.Register(&StateTransition{}); err != nil {
+					return err
+				}
+			}
+		}
 	}
 	return nil
 }
 
 // Table returns a table instance
 func (o *gorORM) Table(name string) gor.Table {
-	if modelType, exists := o.models[name]; exists {
-		return NewTable(name, modelType, o.db, o.adapter)
-	}
-	return NewTable(name, nil, o.db, o.adapter)
+	table := NewTable(name, o.models[name], o.db, o.adapter).(*gorTable)
+	table.replicas = o.replicas
+	table.keys = o.keys
+	return table.WithContext(o.ctx)
 }
 
 // Transaction executes a function within a database transaction
@@ -115,28 +205,31 @@ func (o *gorORM) Transaction(ctx context.Context, fn func(tx gor.Transaction) er
 		return err
 	}
 
-	gorTx := &gorTransaction{tx: tx, orm: o}
+	gorTx := newTransaction(ctx, o.db, tx, o.adapter, o.keys)
 
 	defer func() {
 		if r := recover(); r != nil {
-			_ = tx.Rollback() // Ignore rollback errors in panic recovery
+			_ = gorTx.Rollback() // Ignore rollback errors in panic recovery
 			panic(r)
 		}
 	}()
 
 	if err := fn(gorTx); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
+		if rbErr := gorTx.Rollback(); rbErr != nil {
 			return fmt.Errorf("tx error: %v, rollback error: %v", err, rbErr)
 		}
 		return err
 	}
 
-	return tx.Commit()
+	return gorTx.Commit()
 }
 
 // Query creates a new query builder
 func (o *gorORM) Query(model interface{}) gor.QueryBuilder {
-	return NewQueryBuilder(model, o.db, o.adapter)
+	qb := NewQueryBuilder(model, o.db, o.adapter).(*QueryBuilder)
+	qb.replicas = o.replicas
+	qb.keys = o.keys
+	return qb.WithContext(o.ctx)
 }
 
 // Find finds a record by ID
@@ -153,6 +246,20 @@ func (o *gorORM) FindAll(models interface{}) error {
 
 // Create creates a new record
 func (o *gorORM) Create(model interface{}) error {
+	// Audited and counter-cached models are saved along with the rows they
+	// keep in sync
+	if savesAtomically(reflect.TypeOf(model)) {
+		return o.Transaction(o.ctx, func(tx gor.Transaction) error { return tx.Create(model) })
+	}
+
+	// Stamp the context's tenant, then run tag and model validations
+	if err := stampTenant(o.ctx, getTableName(reflect.TypeOf(model)), model); err != nil {
+		return err
+	}
+	if err := validateRecord(o.exec(), o.adapter, getTableName(reflect.TypeOf(model)), model); err != nil {
+		return err
+	}
+
 	// Call BeforeCreate hook if model implements it
 	if hook, ok := model.(interface{ BeforeCreate() error }); ok {
 		if err := hook.BeforeCreate(); err != nil {
@@ -164,21 +271,10 @@ func (o *gorORM) Create(model interface{}) error {
 	setTimestamps(model, true)
 
 	// Generate and execute insert SQL
-	sql, args, err := o.adapter.GenerateSQL(NewQueryBuilder(model, o.db, o.adapter))
-	if err != nil {
-		return err
-	}
-
-	result, err := o.db.Exec(sql, args...)
-	if err != nil {
+	if err := insertRecord(o.exec(), o.adapter, getTableName(reflect.TypeOf(model)), model); err != nil {
 		return err
 	}
 
-	// Set ID if auto-increment
-	if id, err := result.LastInsertId(); err == nil {
-		setID(model, id)
-	}
-
 	// Call AfterCreate hook if model implements it
 	if hook, ok := model.(interface{ AfterCreate() error }); ok {
 		if err := hook.AfterCreate(); err != nil {
@@ -191,6 +287,20 @@ func (o *gorORM) Create(model interface{}) error {
 
 // Update updates an existing record
 func (o *gorORM) Update(model interface{}) error {
+	// Audited and counter-cached models are saved along with the rows they
+	// keep in sync
+	if savesAtomically(reflect.TypeOf(model)) {
+		return o.Transaction(o.ctx, func(tx gor.Transaction) error { return tx.Update(model) })
+	}
+
+	// Stamp the context's tenant, then run tag and model validations
+	if err := stampTenant(o.ctx, getTableName(reflect.TypeOf(model)), model); err != nil {
+		return err
+	}
+	if err := validateRecord(o.exec(), o.adapter, getTableName(reflect.TypeOf(model)), model); err != nil {
+		return err
+	}
+
 	// Call BeforeUpdate hook
 	if hook, ok := model.(interface{ BeforeUpdate() error }); ok {
 		if err := hook.BeforeUpdate(); err != nil {
@@ -202,15 +312,7 @@ func (o *gorORM) Update(model interface{}) error {
 	setTimestamps(model, false)
 
 	// Generate and execute update SQL
-	id := getID(model)
-	qb := NewQueryBuilder(model, o.db, o.adapter).Where("id = ?", id)
-	sql, args, err := o.adapter.GenerateSQL(qb)
-	if err != nil {
-		return err
-	}
-
-	_, err = o.db.Exec(sql, args...)
-	if err != nil {
+	if _, err := updateRecord(o.exec(), o.adapter, getTableName(reflect.TypeOf(model)), model); err != nil {
 		return err
 	}
 
@@ -226,6 +328,12 @@ func (o *gorORM) Update(model interface{}) error {
 
 // Delete deletes a record
 func (o *gorORM) Delete(model interface{}) error {
+	// Audited and counter-cached models are saved along with the rows they
+	// keep in sync
+	if savesAtomically(reflect.TypeOf(model)) {
+		return o.Transaction(o.ctx, func(tx gor.Transaction) error { return tx.Delete(model) })
+	}
+
 	// Call BeforeDelete hook
 	if hook, ok := model.(interface{ BeforeDelete() error }); ok {
 		if err := hook.BeforeDelete(); err != nil {
@@ -233,14 +341,11 @@ func (o *gorORM) Delete(model interface{}) error {
 		}
 	}
 
-	id := getID(model)
-	tableName := getTableName(reflect.TypeOf(model))
-
-	sql := fmt.Sprintf("DELETE FROM %s WHERE id = ?", tableName) // #nosec G201 - Table name is system-controlled
-	_, err := o.db.Exec(sql, id)
+	_, deletedAt, err := deleteRecords(o.exec(), o.adapter, getTableName(reflect.TypeOf(model)), reflect.TypeOf(model), getID(model))
 	if err != nil {
 		return err
 	}
+	markDeleted(model, deletedAt)
 
 	// Call AfterDelete hook
 	if hook, ok := model.(interface{ AfterDelete() error }); ok {
@@ -361,7 +466,7 @@ func (o *gorORM) createTableIfNotExists(t reflect.Type) error {
 		// Create table
 		sql := o.adapter.CreateTableSQL(tableName, columns)
 		fmt.Printf("Creating table %s with SQL: %s\n", tableName, sql)
-		_, err = o.db.Exec(sql)
+		_, err = o.exec().Exec(sql)
 		if err != nil {
 			return fmt.Errorf("failed to create table %s: %w", tableName, err)
 		}
@@ -370,7 +475,7 @@ func (o *gorORM) createTableIfNotExists(t reflect.Type) error {
 		fmt.Printf("ℹ️  Table %s already exists\n", tableName)
 	}
 
-	return nil
+	return o.createSearchIndex(t)
 }
 
 func (o *gorORM) tableExists(tableName string) (bool, error) {
@@ -380,11 +485,11 @@ func (o *gorORM) tableExists(tableName string) (bool, error) {
 	if o.config.Driver == "sqlite" || o.config.Driver == "sqlite3" {
 		query = "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name = ?"
 		var count int
-		err := o.db.QueryRow(query, tableName).Scan(&count)
+		err := o.exec().QueryRow(query, tableName).Scan(&count)
 		return count > 0, err
 	} else {
-		query = "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = ?)"
-		err := o.db.QueryRow(query, tableName).Scan(&exists)
+		query = rebind(dialectFor(o.adapter), "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = ?)")
+		err := o.exec().QueryRow(query, tableName).Scan(&exists)
 		return exists, err
 	}
 }
@@ -392,32 +497,21 @@ func (o *gorORM) tableExists(tableName string) (bool, error) {
 func extractColumns(t reflect.Type) []gor.Column {
 	var columns []gor.Column
 
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-
-		// Skip unexported fields
-		if !field.IsExported() {
-			continue
-		}
-
-		// Skip embedded structs (like BaseModel)
-		if field.Anonymous {
-			// Recursively extract fields from embedded struct
-			embeddedColumns := extractColumns(field.Type)
-			columns = append(columns, embeddedColumns...)
-			continue
-		}
-
+	for _, field := range schemaOf(t).Fields {
 		column := gor.Column{
-			Name: toSnakeCase(field.Name),
+			Name: field.Column,
 			Type: getColumnType(field.Type),
+			// Pointer fields such as DeletedAt *time.Time hold NULL
+			Nullable: field.Type.Kind() == reflect.Ptr,
 		}
-
-		// Parse struct tags
-		if tag := field.Tag.Get("gor"); tag != "" {
-			parseStructTag(tag, &column)
+		if field.HasOption("json") {
+			column.Type = "JSON"
+			column.Nullable = true
 		}
 
+		// Apply struct tag options
+		parseStructTag(field.Options, &column)
+
 		columns = append(columns, column)
 	}
 
@@ -425,6 +519,10 @@ func extractColumns(t reflect.Type) []gor.Column {
 }
 
 func getColumnType(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
 	switch t.Kind() {
 	case reflect.Int, reflect.Int32:
 		return "INTEGER"
@@ -455,30 +553,25 @@ func getColumnType(t reflect.Type) string {
 	}
 }
 
-func parseStructTag(tag string, column *gor.Column) {
-	// Simple tag parsing - can be enhanced
-	if contains(tag, "primary_key") {
+func parseStructTag(options map[string]string, column *gor.Column) {
+	if hasOption(options, "primary_key") {
 		column.PrimaryKey = true
 	}
-	if contains(tag, "not_null") {
+	if hasOption(options, "not_null") {
 		column.Nullable = false
 	}
-	if contains(tag, "unique") {
+	if hasOption(options, "unique") {
 		column.Unique = true
 	}
-	if contains(tag, "index") {
+	if hasOption(options, "index") {
 		column.Index = true
 	}
-	if contains(tag, "auto_increment") {
-		// TODO: Implement auto_increment support when Column struct supports it
-		_ = tag // Use tag to prevent unused warning
+	if size, err := strconv.Atoi(options["size"]); err == nil {
+		column.Size = size
+	}
+	if def, ok := options["default"]; ok && def != "" {
+		column.Default = def
 	}
-}
-
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr ||
-		(len(s) > len(substr) && (s[:len(substr)+1] == substr+";" ||
-			s[len(s)-len(substr)-1:] == ";"+substr)))
 }
 
 func toSnakeCase(s string) string {
@@ -498,6 +591,11 @@ func toSnakeCase(s string) string {
 		return "updated_at"
 	}
 
+	// Foreign keys such as AuthorID map to author_id
+	if len(s) > 2 && strings.HasSuffix(s, "ID") {
+		return toSnakeCase(s[:len(s)-2]) + "_id"
+	}
+
 	// Convert to snake_case
 	var result []rune
 
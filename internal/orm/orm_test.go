@@ -473,6 +473,40 @@ func TestORM_Transaction(t *testing.T) {
 			t.Logf("Transaction() error = %v, expected 'intentional rollback'", err)
 		}
 	})
+
+	t.Run("ChainedQueryUsesTransaction", func(t *testing.T) {
+		ctx := context.Background()
+
+		err := orm.Transaction(ctx, func(tx gor.Transaction) error {
+			user := &TestUser{Name: "Uncommitted", Email: "uncommitted@example.com"}
+			if err := tx.Create(user); err != nil {
+				return err
+			}
+
+			// The record is only visible through the transaction
+			found := &TestUser{}
+			if err := tx.Query(found).Where("email = ?", user.Email).First(found); err != nil {
+				return fmt.Errorf("chained query did not run in transaction: %w", err)
+			}
+			if found.ID != user.ID {
+				return fmt.Errorf("found ID %d, want %d", found.ID, user.ID)
+			}
+
+			count, err := tx.Query(&TestUser{}).Where("email = ?", user.Email).Count()
+			if err != nil {
+				return err
+			}
+			if count != 1 {
+				return fmt.Errorf("Count() = %d, want 1", count)
+			}
+
+			return fmt.Errorf("intentional rollback")
+		})
+
+		if err == nil || err.Error() != "intentional rollback" {
+			t.Fatalf("Transaction() error = %v", err)
+		}
+	})
 }
 
 func TestORM_Table(t *testing.T) {
@@ -571,6 +605,7 @@ func TestToSnakeCase(t *testing.T) {
 	}{
 		{"ID", "id"},
 		{"UserID", "user_id"},
+		{"AuthorID", "author_id"},
 		{"CreatedAt", "created_at"},
 		{"UpdatedAt", "updated_at"},
 		{"FirstName", "first_name"},
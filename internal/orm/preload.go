@@ -0,0 +1,439 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// ownerKeyColumn is the alias used to carry the owner key through
+// many_to_many join queries
+const ownerKeyColumn = "gor_owner_key"
+
+// preloadAssociations eagerly loads the named associations for the records
+// in dest, which may be a pointer to a struct or to a slice of structs.
+// Each association costs one extra IN (...) query regardless of how many
+// records were loaded. Nested associations use dot notation, e.g.
+// "Comments.Author".
+func preloadAssociations(q executor, adapter gor.DatabaseAdapter, dest interface{}, includes []string) error {
+	return preloadOwners(q, adapter, collectRecords(reflect.ValueOf(dest)), includes)
+}
+
+func preloadOwners(q executor, adapter gor.DatabaseAdapter, owners []reflect.Value, includes []string) error {
+	if len(owners) == 0 || len(includes) == 0 {
+		return nil
+	}
+
+	// Group nested paths under their first segment, preserving order
+	var order []string
+	nested := make(map[string][]string)
+	for _, include := range includes {
+		head, rest, _ := strings.Cut(include, ".")
+		if _, seen := nested[head]; !seen {
+			order = append(order, head)
+			nested[head] = nil
+		}
+		if rest != "" {
+			nested[head] = append(nested[head], rest)
+		}
+	}
+
+	ownerType := owners[0].Type()
+	for _, name := range order {
+		assoc, err := associationFor(ownerType, name)
+		if err != nil {
+			return err
+		}
+
+		if err := loadAssociation(q, adapter, assoc, owners); err != nil {
+			return fmt.Errorf("failed to preload %s: %w", name, err)
+		}
+
+		if len(nested[name]) > 0 {
+			var children []reflect.Value
+			for _, owner := range owners {
+				children = append(children, collectRecords(owner.FieldByIndex(assoc.index))...)
+			}
+			if err := preloadOwners(q, adapter, children, nested[name]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadAssociation runs the association query and assigns the results to
+// the association field of every owner
+func loadAssociation(q executor, adapter gor.DatabaseAdapter, assoc *association, owners []reflect.Value) error {
+	ownerSchema := schemaOf(assoc.owner)
+	targetSchema := schemaOf(assoc.model)
+
+	switch assoc.kind {
+	case gor.BelongsTo:
+		if assoc.polymorphic {
+			return loadPolymorphic(q, adapter, assoc, owners)
+		}
+
+		fkField := ownerSchema.FieldByColumn(assoc.foreignKey)
+		if fkField == nil {
+			return fmt.Errorf("%s has no %s column", ownerSchema.Type.Name(), assoc.foreignKey)
+		}
+		refField := targetSchema.FieldByColumn(assoc.references)
+		if refField == nil {
+			return fmt.Errorf("%s has no %s column", targetSchema.Type.Name(), assoc.references)
+		}
+
+		keys, args := distinctKeys(owners, fkField.Index)
+		if len(args) == 0 {
+			return nil
+		}
+
+		grouped, err := inKeyChunks(adapter, args, 0, func(chunk []interface{}) (map[string][]reflect.Value, error) {
+			return queryGrouped(q, adapter, assoc.model, whereIn(adapter, targetSchema.Table, assoc.references, len(chunk)), chunk,
+				func(record reflect.Value, _ map[string]interface{}) string {
+					return keyOf(record.FieldByIndex(refField.Index))
+				})
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, owner := range owners {
+			if records := grouped[keys[i]]; len(records) > 0 {
+				assignAssociation(owner.FieldByIndex(assoc.index), records[:1])
+			}
+		}
+
+	case gor.HasOne, gor.HasMany:
+		refField := ownerSchema.FieldByColumn(assoc.references)
+		if refField == nil {
+			return fmt.Errorf("%s has no %s column", ownerSchema.Type.Name(), assoc.references)
+		}
+		fkField := targetSchema.FieldByColumn(assoc.foreignKey)
+		if fkField == nil {
+			return fmt.Errorf("%s has no %s column", targetSchema.Type.Name(), assoc.foreignKey)
+		}
+
+		keys, args := distinctKeys(owners, refField.Index)
+		if len(args) == 0 {
+			return nil
+		}
+
+		// Polymorphic children also name the owner's table
+		var typeCondition string
+		var typeArgs []interface{}
+		if assoc.typeColumn != "" {
+			typeCondition = " AND " + dialectFor(adapter).QuoteIdentifier(targetSchema.Table+"."+assoc.typeColumn) + " = ?"
+			typeArgs = append(typeArgs, assoc.typeValue)
+		}
+
+		grouped, err := inKeyChunks(adapter, args, len(typeArgs), func(chunk []interface{}) (map[string][]reflect.Value, error) {
+			condition := whereIn(adapter, targetSchema.Table, assoc.foreignKey, len(chunk)) + typeCondition
+			return queryGrouped(q, adapter, assoc.model, condition, append(chunk, typeArgs...),
+				func(record reflect.Value, _ map[string]interface{}) string {
+					return keyOf(record.FieldByIndex(fkField.Index))
+				})
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, owner := range owners {
+			records := grouped[keys[i]]
+			if assoc.kind == gor.HasOne && len(records) > 1 {
+				records = records[:1]
+			}
+			assignAssociation(owner.FieldByIndex(assoc.index), records)
+		}
+
+	case gor.ManyToMany:
+		// The join table holds the owner's id and the target's references
+		// column
+		idField := ownerSchema.FieldByColumn("id")
+		if idField == nil {
+			return fmt.Errorf("%s has no id column", ownerSchema.Type.Name())
+		}
+		if targetSchema.FieldByColumn(assoc.references) == nil {
+			return fmt.Errorf("%s has no %s column", targetSchema.Type.Name(), assoc.references)
+		}
+
+		keys, args := distinctKeys(owners, idField.Index)
+		if len(args) == 0 {
+			return nil
+		}
+
+		d := dialectFor(adapter)
+		query := fmt.Sprintf("SELECT %s.*, %s AS %s FROM %s INNER JOIN %s ON %s = %s", // #nosec G201 - Identifiers come from model metadata
+			d.QuoteIdentifier(targetSchema.Table), d.QuoteIdentifier(assoc.joinTable+"."+assoc.joinForeignKey), d.QuoteIdentifier(ownerKeyColumn),
+			d.QuoteIdentifier(targetSchema.Table), d.QuoteIdentifier(assoc.joinTable),
+			d.QuoteIdentifier(assoc.joinTable+"."+assoc.joinReferences), d.QuoteIdentifier(targetSchema.Table+"."+assoc.references))
+
+		var filter string
+		if field := targetSchema.SoftDelete; field != nil {
+			filter += " AND " + deletedCondition(d, targetSchema.Table, field.Column, excludeDeleted)
+		}
+		condition, tenantArgs, err := tenantCondition(contextOf(q), d, targetSchema.Table, targetSchema.Type)
+		if err != nil {
+			return err
+		}
+		if condition != "" {
+			filter += " AND " + condition
+		}
+
+		grouped, err := inKeyChunks(adapter, args, len(tenantArgs), func(chunk []interface{}) (map[string][]reflect.Value, error) {
+			chunkQuery := query + " WHERE " + whereIn(adapter, assoc.joinTable, assoc.joinForeignKey, len(chunk)) + filter
+			return queryGroupedRaw(q, adapter, assoc.model, rebind(d, chunkQuery), append(chunk, tenantArgs...),
+				func(_ reflect.Value, extra map[string]interface{}) string {
+					return keyOf(reflect.ValueOf(extra[ownerKeyColumn]))
+				})
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, owner := range owners {
+			assignAssociation(owner.FieldByIndex(assoc.index), grouped[keys[i]])
+		}
+	}
+
+	return nil
+}
+
+// loadPolymorphic loads a polymorphic belongs_to association with one
+// query per parent table named by the owners' type column
+func loadPolymorphic(q executor, adapter gor.DatabaseAdapter, assoc *association, owners []reflect.Value) error {
+	ownerSchema := schemaOf(assoc.owner)
+	fkField := ownerSchema.FieldByColumn(assoc.foreignKey)
+	typeField := ownerSchema.FieldByColumn(assoc.typeColumn)
+	if fkField == nil || typeField == nil {
+		return fmt.Errorf("%s needs %s and %s columns", ownerSchema.Type.Name(), assoc.foreignKey, assoc.typeColumn)
+	}
+
+	var tables []string
+	byTable := make(map[string][]reflect.Value)
+	for _, owner := range owners {
+		table := owner.FieldByIndex(typeField.Index).String()
+		if table == "" {
+			continue
+		}
+		if _, seen := byTable[table]; !seen {
+			tables = append(tables, table)
+		}
+		byTable[table] = append(byTable[table], owner)
+	}
+
+	for _, table := range tables {
+		modelType, ok := modelTypeForTable(table)
+		if !ok {
+			return fmt.Errorf("%s %q is not a registered model table", assoc.typeColumn, table)
+		}
+		refField := schemaOf(modelType).FieldByColumn(assoc.references)
+		if refField == nil {
+			return fmt.Errorf("%s has no %s column", modelType.Name(), assoc.references)
+		}
+
+		keys, args := distinctKeys(byTable[table], fkField.Index)
+		if len(args) == 0 {
+			continue
+		}
+
+		grouped, err := inKeyChunks(adapter, args, 0, func(chunk []interface{}) (map[string][]reflect.Value, error) {
+			return queryGrouped(q, adapter, modelType, whereIn(adapter, table, assoc.references, len(chunk)), chunk,
+				func(record reflect.Value, _ map[string]interface{}) string {
+					return keyOf(record.FieldByIndex(refField.Index))
+				})
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, owner := range byTable[table] {
+			if records := grouped[keys[i]]; len(records) > 0 {
+				assignAssociation(owner.FieldByIndex(assoc.index), records[:1])
+			}
+		}
+	}
+
+	return nil
+}
+
+// queryGrouped loads records of modelType matching condition and groups them by key
+func queryGrouped(q executor, adapter gor.DatabaseAdapter, modelType reflect.Type, condition string, args []interface{},
+	key func(record reflect.Value, extra map[string]interface{}) string) (map[string][]reflect.Value, error) {
+
+	qb := NewQueryBuilder(reflect.New(modelType).Interface(), nil, adapter).(*QueryBuilder)
+	qb.ctx = contextOf(q)
+	qb.keys = keyringOf(q)
+	qb.Where(condition, args...)
+
+	sqlQuery, sqlArgs, err := adapter.GenerateSQL(qb)
+	if err != nil {
+		return nil, err
+	}
+
+	return queryGroupedRaw(q, adapter, modelType, sqlQuery, sqlArgs, key)
+}
+
+// inKeyChunks calls query for consecutive chunks of keys, each small
+// enough that the keys and the reserved other arguments of its statement
+// fit the dialect's parameter limit, and merges the grouped records. Each
+// chunk is capped, so query may append its other arguments to it.
+func inKeyChunks(adapter gor.DatabaseAdapter, keys []interface{}, reserved int,
+	query func(chunk []interface{}) (map[string][]reflect.Value, error)) (map[string][]reflect.Value, error) {
+
+	size := max(dialectFor(adapter).MaxPlaceholders()-reserved, 1)
+	if len(keys) <= size {
+		return query(keys[:len(keys):len(keys)])
+	}
+
+	merged := make(map[string][]reflect.Value)
+	for start := 0; start < len(keys); start += size {
+		end := min(start+size, len(keys))
+		grouped, err := query(keys[start:end:end])
+		if err != nil {
+			return nil, err
+		}
+		for key, records := range grouped {
+			merged[key] = append(merged[key], records...)
+		}
+	}
+	return merged, nil
+}
+
+func queryGroupedRaw(q executor, adapter gor.DatabaseAdapter, modelType reflect.Type, query string, args []interface{},
+	key func(record reflect.Value, extra map[string]interface{}) string) (map[string][]reflect.Value, error) {
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grouped := make(map[string][]reflect.Value)
+	err = scanModelRows(keyringOf(q), rows, modelType, func(record reflect.Value, extra map[string]interface{}) error {
+		k := key(record, extra)
+		grouped[k] = append(grouped[k], record)
+		return nil
+	})
+
+	return grouped, err
+}
+
+// assignAssociation stores records in an association field, which may be a
+// struct, a pointer to a struct, or a slice of either. Interface fields of
+// polymorphic associations get a pointer to the record.
+func assignAssociation(field reflect.Value, records []reflect.Value) {
+	switch field.Kind() {
+	case reflect.Interface:
+		if len(records) == 0 {
+			field.Set(reflect.Zero(field.Type()))
+			return
+		}
+		field.Set(records[0].Addr())
+	case reflect.Slice:
+		elemType := field.Type().Elem()
+		slice := reflect.MakeSlice(field.Type(), 0, len(records))
+		for _, record := range records {
+			if elemType.Kind() == reflect.Ptr {
+				ptr := reflect.New(elemType.Elem())
+				ptr.Elem().Set(record)
+				slice = reflect.Append(slice, ptr)
+			} else {
+				slice = reflect.Append(slice, record)
+			}
+		}
+		field.Set(slice)
+	case reflect.Ptr:
+		if len(records) == 0 {
+			field.Set(reflect.Zero(field.Type()))
+			return
+		}
+		ptr := reflect.New(field.Type().Elem())
+		ptr.Elem().Set(records[0])
+		field.Set(ptr)
+	default:
+		if len(records) > 0 {
+			field.Set(records[0])
+		}
+	}
+}
+
+// collectRecords returns the addressable structs held by v, which may be a
+// struct, a pointer, or a slice of either. Nil pointers are skipped.
+func collectRecords(v reflect.Value) []reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{v}
+	case reflect.Slice:
+		records := make([]reflect.Value, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			records = append(records, collectRecords(v.Index(i).Addr())...)
+		}
+		return records
+	}
+
+	return nil
+}
+
+// distinctKeys returns the key of every record's field along with the
+// de-duplicated non-null values to use as query arguments
+func distinctKeys(records []reflect.Value, index []int) ([]string, []interface{}) {
+	keys := make([]string, len(records))
+	seen := make(map[string]bool)
+	var args []interface{}
+
+	for i, record := range records {
+		value := record.FieldByIndex(index)
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+
+		keys[i] = keyOf(value)
+		if !seen[keys[i]] {
+			seen[keys[i]] = true
+			args = append(args, value.Interface())
+		}
+	}
+
+	return keys, args
+}
+
+// keyOf normalizes a key value so that, e.g., an int64 read from the
+// database matches a uint held by a struct field
+func keyOf(v reflect.Value) string {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return ""
+	}
+	if b, ok := v.Interface().([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// whereIn builds a quoted "table"."column" IN (?, ?, ...) condition
+func whereIn(adapter gor.DatabaseAdapter, table, column string, n int) string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+	return fmt.Sprintf("%s IN (%s)", dialectFor(adapter).QuoteIdentifier(table+"."+column), strings.Join(placeholders, ", "))
+}
@@ -0,0 +1,285 @@
+package orm
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type PreloadAuthor struct {
+	ID      int64           `gor:"primary_key;auto_increment"`
+	Name    string          `gor:"not_null"`
+	Profile *PreloadProfile `gor:"has_one;foreign_key:author_id"`
+	Posts   []PreloadPost   `gor:"has_many;foreign_key:author_id"`
+}
+
+func (a *PreloadAuthor) TableName() string { return "preload_authors" }
+
+type PreloadProfile struct {
+	ID       int64  `gor:"primary_key;auto_increment"`
+	AuthorID int64  `gor:"index"`
+	Bio      string `gor:""`
+}
+
+func (p *PreloadProfile) TableName() string { return "preload_profiles" }
+
+type PreloadPost struct {
+	ID       int64             `gor:"primary_key;auto_increment"`
+	Title    string            `gor:"not_null"`
+	AuthorID int64             `gor:"index"`
+	Author   *PreloadAuthor    `gor:"belongs_to"`
+	Comments []*PreloadComment `gor:"has_many;foreign_key:post_id"`
+	Tags     []PreloadTag      `gor:"many_to_many:preload_post_tags;foreign_key:post_id;association_foreign_key:tag_id"`
+	Labels   []PreloadLabel    `gor:"many_to_many:preload_post_labels;foreign_key:post_id;association_foreign_key:label_code;references:code"`
+}
+
+func (p *PreloadPost) TableName() string { return "preload_posts" }
+
+type PreloadComment struct {
+	ID       int64          `gor:"primary_key;auto_increment"`
+	PostID   int64          `gor:"index"`
+	AuthorID int64          `gor:""`
+	Body     string         `gor:""`
+	Author   *PreloadAuthor `gor:"belongs_to"`
+}
+
+func (c *PreloadComment) TableName() string { return "preload_comments" }
+
+type PreloadTag struct {
+	ID   int64  `gor:"primary_key;auto_increment"`
+	Name string `gor:"unique"`
+}
+
+func (t *PreloadTag) TableName() string { return "preload_tags" }
+
+type PreloadLabel struct {
+	ID   int64  `gor:"primary_key;auto_increment"`
+	Code string `gor:"unique"`
+}
+
+func (l *PreloadLabel) TableName() string { return "preload_labels" }
+
+func setupPreloadORM(t *testing.T) gor.ORM {
+	config := gor.DatabaseConfig{
+		Driver:          "sqlite3",
+		Database:        filepath.Join(t.TempDir(), "preload.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}
+
+	orm := NewORM(config)
+	if err := orm.Connect(context.Background(), config); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { orm.Close() })
+
+	if err := orm.Register(&PreloadAuthor{}, &PreloadProfile{}, &PreloadPost{}, &PreloadComment{}, &PreloadTag{}, &PreloadLabel{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	statements := []string{
+		"CREATE TABLE preload_post_tags (post_id INTEGER, tag_id INTEGER)",
+		"INSERT INTO preload_authors (id, name) VALUES (1, 'Ada'), (2, 'Grace')",
+		"INSERT INTO preload_profiles (id, author_id, bio) VALUES (1, 1, 'Mathematician')",
+		"INSERT INTO preload_posts (id, title, author_id) VALUES (1, 'Engines', 1), (2, 'Compilers', 2), (3, 'Notes', 1)",
+		"INSERT INTO preload_comments (id, post_id, author_id, body) VALUES (1, 1, 2, 'Great'), (2, 1, 1, 'Thanks'), (3, 2, 1, 'Nice')",
+		"INSERT INTO preload_tags (id, name) VALUES (1, 'history'), (2, 'computing')",
+		"INSERT INTO preload_post_tags (post_id, tag_id) VALUES (1, 1), (1, 2), (2, 2)",
+		"CREATE TABLE preload_post_labels (post_id INTEGER, label_code TEXT)",
+		"INSERT INTO preload_labels (id, code) VALUES (1, 'draft'), (2, 'featured')",
+		"INSERT INTO preload_post_labels (post_id, label_code) VALUES (1, 'featured'), (2, 'draft')",
+	}
+	for _, statement := range statements {
+		if _, err := orm.DB().Exec(statement); err != nil {
+			t.Fatalf("Failed to seed data (%s): %v", statement, err)
+		}
+	}
+
+	return orm
+}
+
+func TestSchemaOf_Associations(t *testing.T) {
+	schema := schemaOf(reflect.TypeOf(&PreloadPost{}))
+
+	if schema.FieldByName("Author") != nil || schema.FieldByName("Comments") != nil {
+		t.Error("association fields should not be mapped to columns")
+	}
+
+	tests := []struct {
+		name       string
+		kind       gor.AssociationType
+		foreignKey string
+	}{
+		{"Author", gor.BelongsTo, "author_id"},
+		{"Comments", gor.HasMany, "post_id"},
+		{"Tags", gor.ManyToMany, "post_id"},
+	}
+
+	for _, test := range tests {
+		assoc, ok := schema.Associations[test.name]
+		if !ok {
+			t.Errorf("association %s not found", test.name)
+			continue
+		}
+		if assoc.Type() != test.kind {
+			t.Errorf("%s Type() = %v, want %v", test.name, assoc.Type(), test.kind)
+		}
+		if assoc.ForeignKey() != test.foreignKey {
+			t.Errorf("%s ForeignKey() = %v, want %v", test.name, assoc.ForeignKey(), test.foreignKey)
+		}
+	}
+
+	if cols := extractColumns(reflect.TypeOf(&PreloadPost{})); len(cols) != 3 {
+		t.Errorf("extractColumns() returned %d columns, want 3", len(cols))
+	}
+}
+
+func TestQueryBuilder_IncludesBelongsTo(t *testing.T) {
+	orm := setupPreloadORM(t)
+
+	var posts []PreloadPost
+	if err := orm.Query(&posts).Includes("Author").Order("id").FindAll(&posts); err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+
+	if len(posts) != 3 {
+		t.Fatalf("FindAll() returned %d posts, want 3", len(posts))
+	}
+
+	for _, post := range posts {
+		if post.Author == nil {
+			t.Fatalf("post %d Author was not preloaded", post.ID)
+		}
+		if post.Author.ID != post.AuthorID {
+			t.Errorf("post %d Author.ID = %d, want %d", post.ID, post.Author.ID, post.AuthorID)
+		}
+	}
+
+	if posts[0].Author.Name != "Ada" || posts[1].Author.Name != "Grace" {
+		t.Errorf("unexpected authors: %q, %q", posts[0].Author.Name, posts[1].Author.Name)
+	}
+}
+
+func TestQueryBuilder_IncludesHasManyAndHasOne(t *testing.T) {
+	orm := setupPreloadORM(t)
+
+	var authors []*PreloadAuthor
+	if err := orm.Query(&authors).Preload("Posts", "Profile").Order("id").FindAll(&authors); err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+
+	if len(authors) != 2 {
+		t.Fatalf("FindAll() returned %d authors, want 2", len(authors))
+	}
+
+	if len(authors[0].Posts) != 2 || len(authors[1].Posts) != 1 {
+		t.Errorf("Posts lengths = %d, %d; want 2, 1", len(authors[0].Posts), len(authors[1].Posts))
+	}
+
+	if authors[0].Profile == nil || authors[0].Profile.Bio != "Mathematician" {
+		t.Errorf("Profile was not preloaded: %+v", authors[0].Profile)
+	}
+	if authors[1].Profile != nil {
+		t.Error("author without profile should have nil Profile")
+	}
+}
+
+func TestQueryBuilder_IncludesManyToManyAndNested(t *testing.T) {
+	orm := setupPreloadORM(t)
+
+	post := &PreloadPost{}
+	if err := orm.Query(post).Where("id = ?", 1).Includes("Tags", "Comments.Author").First(post); err != nil {
+		t.Fatalf("First() error = %v", err)
+	}
+
+	if len(post.Tags) != 2 {
+		t.Errorf("Tags length = %d, want 2", len(post.Tags))
+	}
+
+	if len(post.Comments) != 2 {
+		t.Fatalf("Comments length = %d, want 2", len(post.Comments))
+	}
+	for _, comment := range post.Comments {
+		if comment.Author == nil || comment.Author.ID != comment.AuthorID {
+			t.Errorf("comment %d Author was not preloaded", comment.ID)
+		}
+	}
+}
+
+func TestQueryBuilder_IncludesManyToManyByReferences(t *testing.T) {
+	orm := setupPreloadORM(t)
+
+	var posts []PreloadPost
+	if err := orm.Query(&PreloadPost{}).Order("id").Includes("Labels").FindAll(&posts); err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+
+	if len(posts) != 3 {
+		t.Fatalf("posts length = %d, want 3", len(posts))
+	}
+	if len(posts[0].Labels) != 1 || posts[0].Labels[0].Code != "featured" {
+		t.Errorf("post 1 Labels = %+v, want the label joined by code", posts[0].Labels)
+	}
+	if len(posts[1].Labels) != 1 || posts[1].Labels[0].Code != "draft" {
+		t.Errorf("post 2 Labels = %+v, want the label joined by code", posts[1].Labels)
+	}
+	if len(posts[2].Labels) != 0 {
+		t.Errorf("post 3 Labels = %+v, want none", posts[2].Labels)
+	}
+}
+
+func TestQueryBuilder_IncludesUnknownAssociation(t *testing.T) {
+	orm := setupPreloadORM(t)
+
+	var posts []PreloadPost
+	err := orm.Query(&posts).Includes("Editor").FindAll(&posts)
+	if err == nil {
+		t.Error("FindAll() should fail for an unknown association")
+	}
+}
+
+type PreloadShelf struct {
+	ID   int64        `gor:"primary_key;auto_increment"`
+	Tags []PreloadTag `gor:"many_to_many:order;foreign_key:shelf_id;association_foreign_key:tag_id"`
+}
+
+func (s *PreloadShelf) TableName() string { return "preload_shelves" }
+
+func TestQueryBuilder_IncludesManyToManyOfManyOwners(t *testing.T) {
+	orm := setupPreloadORM(t)
+	if err := orm.Register(&PreloadShelf{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	// More shelves than one statement may bind, joined through a table
+	// whose name is a keyword
+	shelves := dialectFor(&SQLiteAdapter{}).MaxPlaceholders() + 10
+	statements := []string{
+		`CREATE TABLE "order" (shelf_id INTEGER, tag_id INTEGER)`,
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?) INSERT INTO preload_shelves (id) SELECT i FROM n`,
+		`INSERT INTO "order" (shelf_id, tag_id) SELECT id, 1 + id % 2 FROM preload_shelves`,
+	}
+	for _, statement := range statements {
+		if _, err := orm.DB().Exec(statement, shelves); err != nil {
+			t.Fatalf("Failed to seed data (%s): %v", statement, err)
+		}
+	}
+
+	var loaded []PreloadShelf
+	if err := orm.Query(&PreloadShelf{}).Order("id").Includes("Tags").FindAll(&loaded); err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+	if len(loaded) != shelves {
+		t.Fatalf("shelves length = %d, want %d", len(loaded), shelves)
+	}
+	for _, shelf := range loaded {
+		if len(shelf.Tags) != 1 || shelf.Tags[0].ID != 1+shelf.ID%2 {
+			t.Fatalf("shelf %d Tags = %+v, want tag %d", shelf.ID, shelf.Tags, 1+shelf.ID%2)
+		}
+	}
+}
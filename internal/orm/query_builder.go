@@ -1,10 +1,12 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/cuemby/gor/pkg/gor"
 )
@@ -15,19 +17,37 @@ type QueryBuilder struct {
 	modelType reflect.Type
 	tableName string
 	db        *sql.DB
+	replicas  *replicaSet
+	ctx       context.Context
+	txn       *gorTransaction
 	adapter   gor.DatabaseAdapter
+	keys      *keyring
 
 	// Query building state
-	whereConditions []string
-	whereArgs       []interface{}
-	orderBy         []string
-	limitValue      *int
-	offsetValue     *int
-	joins           []string
-	includes        []string
-	isCount         bool
-	rawSQL          string
-	rawArgs         []interface{}
+	selects          []string
+	distinct         bool
+	whereConditions  []string
+	whereArgs        []interface{}
+	groupBy          []string
+	havingConditions []string
+	havingArgs       []interface{}
+	orderBy          []string
+	limitValue       *int
+	offsetValue      *int
+	joins            []string
+	includes         []string
+	isCount          bool
+	unscoped         bool
+	deletedScope     deletedScope
+	lock             lockMode
+	cursor           string
+	cursorBefore     bool
+	rawSQL           string
+	rawArgs          []interface{}
+
+	// err is the first error found while composing the query, reported
+	// when it runs
+	err error
 }
 
 // NewQueryBuilder creates a new query builder instance
@@ -54,12 +74,30 @@ func NewQueryBuilder(model interface{}, db *sql.DB, adapter gor.DatabaseAdapter)
 		modelType: modelType,
 		tableName: tableName,
 		db:        db,
+		ctx:       context.Background(),
 		adapter:   adapter,
 	}
 }
 
+// WithContext runs the query's statements with ctx, so they are canceled
+// along with it
+func (qb *QueryBuilder) WithContext(ctx context.Context) gor.QueryBuilder {
+	if ctx == nil {
+		panic("orm: nil context")
+	}
+	qb.ctx = ctx
+	return qb
+}
+
 // Where adds a WHERE condition
 func (qb *QueryBuilder) Where(condition string, args ...interface{}) gor.QueryBuilder {
+	// Equality on a deterministically encrypted column matches its ciphertext
+	condition, args, err := encryptCondition(qb.keys, qb.modelType, condition, args)
+	if err != nil {
+		qb.setErr(err)
+		return qb
+	}
+
 	qb.whereConditions = append(qb.whereConditions, condition)
 	qb.whereArgs = append(qb.whereArgs, args...)
 	return qb
@@ -80,6 +118,94 @@ func (qb *QueryBuilder) Not(condition string, args ...interface{}) gor.QueryBuil
 	return qb
 }
 
+// Or matches rows satisfying either the conditions so far or those added
+// by fn, which receives an empty builder for the same model
+func (qb *QueryBuilder) Or(fn func(gor.QueryBuilder) gor.QueryBuilder) gor.QueryBuilder {
+	empty := NewQueryBuilder(qb.model, qb.db, qb.adapter).(*QueryBuilder)
+	empty.keys = qb.keys
+	alternative, ok := fn(empty).(*QueryBuilder)
+	if !ok {
+		qb.setErr(fmt.Errorf("Or: unsupported query builder"))
+		return qb
+	}
+	if alternative.err != nil {
+		qb.setErr(alternative.err)
+		return qb
+	}
+
+	// Without conditions on either side every row already matches
+	if len(qb.whereConditions) == 0 || len(alternative.whereConditions) == 0 {
+		qb.whereConditions = nil
+		qb.whereArgs = nil
+		return qb
+	}
+
+	qb.whereConditions = []string{fmt.Sprintf("((%s) OR (%s))",
+		strings.Join(qb.whereConditions, " AND "), strings.Join(alternative.whereConditions, " AND "))}
+	qb.whereArgs = append(qb.whereArgs, alternative.whereArgs...)
+	return qb
+}
+
+// WhereIn adds a column IN (subquery) condition
+func (qb *QueryBuilder) WhereIn(column string, subquery gor.QueryBuilder) gor.QueryBuilder {
+	return qb.whereSubquery(column+" IN (", subquery, ")")
+}
+
+// WhereExists adds an EXISTS (subquery) condition. The subquery can refer
+// to the outer table to correlate with each row.
+func (qb *QueryBuilder) WhereExists(subquery gor.QueryBuilder) gor.QueryBuilder {
+	return qb.whereSubquery("EXISTS (", subquery, ")")
+}
+
+// WhereNotExists adds a NOT EXISTS (subquery) condition
+func (qb *QueryBuilder) WhereNotExists(subquery gor.QueryBuilder) gor.QueryBuilder {
+	return qb.whereSubquery("NOT EXISTS (", subquery, ")")
+}
+
+// whereSubquery renders subquery between prefix and suffix as a condition.
+// The subquery is rendered immediately, so later changes to it are ignored.
+func (qb *QueryBuilder) whereSubquery(prefix string, subquery gor.QueryBuilder, suffix string) gor.QueryBuilder {
+	sub, ok := subquery.(*QueryBuilder)
+	if !ok {
+		qb.setErr(fmt.Errorf("unsupported subquery %T", subquery))
+		return qb
+	}
+
+	sql, args, err := selectSQL(dialectFor(qb.adapter), sub)
+	if err != nil {
+		qb.setErr(err)
+		return qb
+	}
+
+	return qb.Where(prefix+sql+suffix, args...)
+}
+
+// Select restricts the selected columns. Columns may be expressions such as
+// "COUNT(*) AS total"; scan them into any struct with matching fields.
+func (qb *QueryBuilder) Select(columns ...string) gor.QueryBuilder {
+	qb.selects = append(qb.selects, columns...)
+	return qb
+}
+
+// Distinct removes duplicate rows from the result
+func (qb *QueryBuilder) Distinct() gor.QueryBuilder {
+	qb.distinct = true
+	return qb
+}
+
+// Group adds a GROUP BY clause
+func (qb *QueryBuilder) Group(columns ...string) gor.QueryBuilder {
+	qb.groupBy = append(qb.groupBy, columns...)
+	return qb
+}
+
+// Having adds a HAVING condition on the groups
+func (qb *QueryBuilder) Having(condition string, args ...interface{}) gor.QueryBuilder {
+	qb.havingConditions = append(qb.havingConditions, condition)
+	qb.havingArgs = append(qb.havingArgs, args...)
+	return qb
+}
+
 // Order adds an ORDER BY clause
 func (qb *QueryBuilder) Order(field string) gor.QueryBuilder {
 	qb.orderBy = append(qb.orderBy, fmt.Sprintf("%s ASC", field))
@@ -137,17 +263,12 @@ func (qb *QueryBuilder) Preload(associations ...string) gor.QueryBuilder {
 
 // Count returns the count of matching records
 func (qb *QueryBuilder) Count() (int64, error) {
-	countQB := &QueryBuilder{
-		model:           qb.model,
-		modelType:       qb.modelType,
-		tableName:       qb.tableName,
-		db:              qb.db,
-		adapter:         qb.adapter,
-		whereConditions: qb.whereConditions,
-		whereArgs:       qb.whereArgs,
-		joins:           qb.joins,
-		isCount:         true,
-	}
+	countQB := qb.clone()
+	countQB.orderBy = nil
+	countQB.limitValue = nil
+	countQB.offsetValue = nil
+	countQB.isCount = true
+	countQB.lock = noLock
 
 	sql, args, err := qb.adapter.GenerateSQL(countQB)
 	if err != nil {
@@ -155,47 +276,55 @@ func (qb *QueryBuilder) Count() (int64, error) {
 	}
 
 	var count int64
-	err = qb.db.QueryRow(sql, args...).Scan(&count)
+	err = qb.reader().QueryRow(sql, args...).Scan(&count)
 	return count, err
 }
 
 // Sum calculates the sum of a field
 func (qb *QueryBuilder) Sum(field string) (float64, error) {
-	sql := qb.buildAggregateSQL("SUM", field)
-	args := qb.whereArgs
+	sql, args, err := buildAggregateSQL(dialectFor(qb.adapter), qb, "SUM", field)
+	if err != nil {
+		return 0, err
+	}
 
 	var sum float64
-	err := qb.db.QueryRow(sql, args...).Scan(&sum)
+	err = qb.reader().QueryRow(sql, args...).Scan(&sum)
 	return sum, err
 }
 
 // Average calculates the average of a field
 func (qb *QueryBuilder) Average(field string) (float64, error) {
-	sql := qb.buildAggregateSQL("AVG", field)
-	args := qb.whereArgs
+	sql, args, err := buildAggregateSQL(dialectFor(qb.adapter), qb, "AVG", field)
+	if err != nil {
+		return 0, err
+	}
 
 	var avg float64
-	err := qb.db.QueryRow(sql, args...).Scan(&avg)
+	err = qb.reader().QueryRow(sql, args...).Scan(&avg)
 	return avg, err
 }
 
 // Maximum finds the maximum value of a field
 func (qb *QueryBuilder) Maximum(field string) (interface{}, error) {
-	sql := qb.buildAggregateSQL("MAX", field)
-	args := qb.whereArgs
+	sql, args, err := buildAggregateSQL(dialectFor(qb.adapter), qb, "MAX", field)
+	if err != nil {
+		return nil, err
+	}
 
 	var max interface{}
-	err := qb.db.QueryRow(sql, args...).Scan(&max)
+	err = qb.reader().QueryRow(sql, args...).Scan(&max)
 	return max, err
 }
 
 // Minimum finds the minimum value of a field
 func (qb *QueryBuilder) Minimum(field string) (interface{}, error) {
-	sql := qb.buildAggregateSQL("MIN", field)
-	args := qb.whereArgs
+	sql, args, err := buildAggregateSQL(dialectFor(qb.adapter), qb, "MIN", field)
+	if err != nil {
+		return nil, err
+	}
 
 	var min interface{}
-	err := qb.db.QueryRow(sql, args...).Scan(&min)
+	err = qb.reader().QueryRow(sql, args...).Scan(&min)
 	return min, err
 }
 
@@ -203,13 +332,30 @@ func (qb *QueryBuilder) Minimum(field string) (interface{}, error) {
 func (qb *QueryBuilder) First(dest interface{}) error {
 	qb.limitValue = &[]int{1}[0]
 
+	if qb.cursor != "" {
+		return qb.firstFromPage(dest)
+	}
+
+	if err := qb.checkLock(); err != nil {
+		return err
+	}
+
 	sql, args, err := qb.adapter.GenerateSQL(qb)
 	if err != nil {
 		return err
 	}
 
-	row := qb.db.QueryRow(sql, args...)
-	return qb.scanRow(row, dest)
+	rows, err := qb.reader().Query(sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err := scanFirst(qb.keys, rows, dest); err != nil {
+		return err
+	}
+
+	return qb.preload(dest)
 }
 
 // Last finds the last matching record
@@ -238,18 +384,40 @@ func (qb *QueryBuilder) Find(dest interface{}) error {
 
 // FindAll finds all matching records
 func (qb *QueryBuilder) FindAll(dest interface{}) error {
+	if qb.cursor != "" {
+		_, err := qb.FindPage(dest)
+		return err
+	}
+
+	if err := qb.checkLock(); err != nil {
+		return err
+	}
+
 	sql, args, err := qb.adapter.GenerateSQL(qb)
 	if err != nil {
 		return err
 	}
 
-	rows, err := qb.db.Query(sql, args...)
+	rows, err := qb.reader().Query(sql, args...)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
-	return qb.scanRows(rows, dest)
+	if err := qb.scanRows(rows, dest); err != nil {
+		return err
+	}
+
+	return qb.preload(dest)
+}
+
+// Pluck loads a single column of the matching rows into dest, a pointer to
+// a slice of that column's type
+func (qb *QueryBuilder) Pluck(column string, dest interface{}) error {
+	pluckQB := qb.clone()
+	pluckQB.selects = []string{column}
+	pluckQB.includes = nil
+	return pluckQB.FindAll(dest)
 }
 
 // Exists checks if any matching records exist
@@ -258,28 +426,36 @@ func (qb *QueryBuilder) Exists() (bool, error) {
 	return count > 0, err
 }
 
-// FindInBatches processes records in batches
+// FindInBatches processes records in batches. Batches are read in primary
+// key order by seeking past the last ID of the previous batch, so each
+// batch costs the same however deep into the table it is; any Order on the
+// builder is replaced.
 func (qb *QueryBuilder) FindInBatches(dest interface{}, batchSize int, fn func(tx gor.Transaction, batch interface{}) error) error {
-	offset := 0
+	if batchSize <= 0 {
+		return fmt.Errorf("batch size must be positive")
+	}
+
+	batchType := reflect.TypeOf(dest)
+	if batchType.Kind() == reflect.Ptr {
+		batchType = batchType.Elem()
+	}
+
+	d := dialectFor(qb.adapter)
+	id := d.QuoteIdentifier(qb.tableName + ".id")
+	var lastID interface{}
 
 	for {
-		batchQB := &QueryBuilder{
-			model:           qb.model,
-			modelType:       qb.modelType,
-			tableName:       qb.tableName,
-			db:              qb.db,
-			adapter:         qb.adapter,
-			whereConditions: qb.whereConditions,
-			whereArgs:       qb.whereArgs,
-			orderBy:         qb.orderBy,
-			joins:           qb.joins,
-			includes:        qb.includes,
-			limitValue:      &batchSize,
-			offsetValue:     &offset,
+		batchQB := qb.clone()
+		batchQB.orderBy = []string{id + " ASC"}
+		batchQB.limitValue = &batchSize
+		batchQB.offsetValue = nil
+		batchQB.cursor = ""
+		batchQB.ctx = withoutNPlusOne(qb.ctx)
+		if lastID != nil {
+			batchQB.Where(id+" > ?", lastID)
 		}
 
 		// Create batch slice
-		batchType := reflect.TypeOf(dest)
 		batch := reflect.New(batchType).Interface()
 
 		err := batchQB.FindAll(batch)
@@ -292,20 +468,13 @@ func (qb *QueryBuilder) FindInBatches(dest interface{}, batchSize int, fn func(t
 		if batchValue.Len() == 0 {
 			break
 		}
-
-		// Process batch in transaction
-		tx, err := qb.db.Begin()
-		if err != nil {
-			return err
-		}
-
-		gorTx := &gorTransaction{tx: tx}
-		if err := fn(gorTx, batch); err != nil {
-			_ = tx.Rollback()
-			return err
+		lastID = getID(batchValue.Index(batchValue.Len() - 1).Interface())
+		if lastID == nil {
+			return fmt.Errorf("batches of %s require an id column", qb.tableName)
 		}
 
-		if err := tx.Commit(); err != nil {
+		// Process batch in transaction
+		if err := qb.inTransaction(func(tx *gorTransaction) error { return fn(tx, batch) }); err != nil {
 			return err
 		}
 
@@ -313,8 +482,6 @@ func (qb *QueryBuilder) FindInBatches(dest interface{}, batchSize int, fn func(t
 		if batchValue.Len() < batchSize {
 			break
 		}
-
-		offset += batchSize
 	}
 
 	return nil
@@ -322,22 +489,31 @@ func (qb *QueryBuilder) FindInBatches(dest interface{}, batchSize int, fn func(t
 
 // UpdateAll updates all matching records
 func (qb *QueryBuilder) UpdateAll(updates map[string]interface{}) (int64, error) {
-	setParts := make([]string, 0, len(updates))
-	args := make([]interface{}, 0, len(updates)+len(qb.whereArgs))
-
-	for field, value := range updates {
-		setParts = append(setParts, fmt.Sprintf("%s = ?", field))
-		args = append(args, value)
+	if qb.err != nil {
+		return 0, qb.err
 	}
 
-	sql := fmt.Sprintf("UPDATE %s SET %s", qb.tableName, strings.Join(setParts, ", ")) // #nosec G201 - Table name from schema
+	d := dialectFor(qb.adapter)
+	conditions, whereArgs, err := qb.scopedConditions(d, qb.deletedScope)
+	if err != nil {
+		return 0, err
+	}
 
-	if len(qb.whereConditions) > 0 {
-		sql += " WHERE " + strings.Join(qb.whereConditions, " AND ")
-		args = append(args, qb.whereArgs...)
+	columns := sortedKeys(updates)
+	args := make([]interface{}, 0, len(updates)+len(whereArgs))
+	for _, column := range columns {
+		args = append(args, updates[column])
 	}
+	if qb.modelType != nil {
+		if args, err = encryptValues(qb.keys, qb.modelType, columns, args); err != nil {
+			return 0, err
+		}
+	}
+	args = append(args, whereArgs...)
+
+	sql := buildUpdateSQL(d, qb.tableName, columns, strings.Join(conditions, " AND "))
 
-	result, err := qb.db.Exec(sql, args...)
+	result, err := qb.executor().Exec(sql, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -345,15 +521,35 @@ func (qb *QueryBuilder) UpdateAll(updates map[string]interface{}) (int64, error)
 	return result.RowsAffected()
 }
 
-// DeleteAll deletes all matching records
+// DeleteAll deletes all matching records. Records of soft-delete models are
+// marked as deleted instead of being removed.
 func (qb *QueryBuilder) DeleteAll() (int64, error) {
-	sql := fmt.Sprintf("DELETE FROM %s", qb.tableName) // #nosec G201 - Table name from schema
+	if qb.softDeleteField() != nil && !qb.unscoped {
+		return qb.softDeleteAll()
+	}
+	return qb.HardDelete()
+}
+
+// HardDelete permanently removes all matching records, including
+// soft-deleted ones unless OnlyDeleted is set
+func (qb *QueryBuilder) HardDelete() (int64, error) {
+	if qb.err != nil {
+		return 0, qb.err
+	}
 
-	if len(qb.whereConditions) > 0 {
-		sql += " WHERE " + strings.Join(qb.whereConditions, " AND ")
+	scope := qb.deletedScope
+	if scope == excludeDeleted {
+		scope = includeDeleted
 	}
 
-	result, err := qb.db.Exec(sql, qb.whereArgs...)
+	d := dialectFor(qb.adapter)
+	conditions, args, err := qb.scopedConditions(d, scope)
+	if err != nil {
+		return 0, err
+	}
+	sql := buildDeleteSQL(d, qb.tableName, strings.Join(conditions, " AND "))
+
+	result, err := qb.executor().Exec(sql, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -369,40 +565,84 @@ func (qb *QueryBuilder) Raw(sqlQuery string, args ...interface{}) gor.QueryBuild
 }
 
 // Helper methods
-func (qb *QueryBuilder) buildAggregateSQL(function, field string) string {
-	sql := fmt.Sprintf("SELECT %s(%s) FROM %s", function, field, qb.tableName)
 
-	if len(qb.joins) > 0 {
-		sql += " " + strings.Join(qb.joins, " ")
-	}
+// clone returns a copy of the builder that can be modified independently
+func (qb *QueryBuilder) clone() *QueryBuilder {
+	c := *qb
+	c.selects = append([]string(nil), qb.selects...)
+	c.whereConditions = append([]string(nil), qb.whereConditions...)
+	c.whereArgs = append([]interface{}(nil), qb.whereArgs...)
+	c.groupBy = append([]string(nil), qb.groupBy...)
+	c.havingConditions = append([]string(nil), qb.havingConditions...)
+	c.havingArgs = append([]interface{}(nil), qb.havingArgs...)
+	c.orderBy = append([]string(nil), qb.orderBy...)
+	c.joins = append([]string(nil), qb.joins...)
+	c.includes = append([]string(nil), qb.includes...)
+	return &c
+}
 
-	if len(qb.whereConditions) > 0 {
-		sql += " WHERE " + strings.Join(qb.whereConditions, " AND ")
+// executor returns the connection the query runs on: its transaction, if
+// any, or the database, bound to the query's context
+func (qb *QueryBuilder) executor() executor {
+	if qb.txn != nil {
+		return withContext(qb.ctx, qb.txn.tx, qb.adapter, qb.keys)
 	}
+	return withContext(qb.ctx, qb.db, qb.adapter, qb.keys)
+}
 
-	return sql
+// setErr records the first error found while composing the query
+func (qb *QueryBuilder) setErr(err error) {
+	if qb.err == nil {
+		qb.err = err
+	}
 }
 
-func (qb *QueryBuilder) scanRow(row *sql.Row, dest interface{}) error {
-	// Get the fields of the destination struct
+// firstFromPage loads the first row of the cursor's page into dest
+func (qb *QueryBuilder) firstFromPage(dest interface{}) error {
 	destValue := reflect.ValueOf(dest)
-	if destValue.Kind() != reflect.Ptr {
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() {
 		return fmt.Errorf("destination must be a pointer")
 	}
 
-	destValue = destValue.Elem()
-	destType := destValue.Type()
-
-	// Prepare scan destinations
-	scanDests := make([]interface{}, destType.NumField())
-	for i := 0; i < destType.NumField(); i++ {
-		field := destValue.Field(i)
-		if field.CanSet() {
-			scanDests[i] = field.Addr().Interface()
-		}
+	page := reflect.New(reflect.SliceOf(destValue.Elem().Type()))
+	if _, err := qb.FindPage(page.Interface()); err != nil {
+		return err
+	}
+	if page.Elem().Len() == 0 {
+		return sql.ErrNoRows
+	}
+
+	destValue.Elem().Set(page.Elem().Index(0))
+	return nil
+}
+
+// inTransaction runs fn in the builder's transaction, or in a new one when
+// the builder runs against the database directly
+func (qb *QueryBuilder) inTransaction(fn func(tx *gorTransaction) error) error {
+	if qb.txn != nil {
+		return fn(qb.txn)
+	}
+
+	tx, err := qb.db.BeginTx(qb.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	gorTx := newTransaction(qb.ctx, qb.db, tx, qb.adapter, qb.keys)
+	if err := fn(gorTx); err != nil {
+		_ = gorTx.Rollback()
+		return err
 	}
 
-	return row.Scan(scanDests...)
+	return gorTx.Commit()
+}
+
+// preload loads the associations requested with Includes into dest
+func (qb *QueryBuilder) preload(dest interface{}) error {
+	if len(qb.includes) == 0 {
+		return nil
+	}
+	return preloadAssociations(qb.reader(), qb.adapter, dest, qb.includes)
 }
 
 func (qb *QueryBuilder) scanRows(rows *sql.Rows, dest interface{}) error {
@@ -417,34 +657,138 @@ func (qb *QueryBuilder) scanRows(rows *sql.Rows, dest interface{}) error {
 	}
 
 	elemType := destValue.Type().Elem()
-	if elemType.Kind() == reflect.Ptr {
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
 		elemType = elemType.Elem()
 	}
 
+	return scanModelRows(qb.keys, rows, elemType, func(elem reflect.Value, extra map[string]interface{}) error {
+		setSearchResult(elem, extra)
+
+		// Append to slice
+		if isPtr {
+			destValue.Set(reflect.Append(destValue, elem.Addr()))
+		} else {
+			destValue.Set(reflect.Append(destValue, elem))
+		}
+		return nil
+	})
+}
+
+// scanFirst scans the first row into dest, returning sql.ErrNoRows when the
+// result is empty. The rows are closed so the connection is released before
+// any follow-up queries.
+func scanFirst(keys *keyring, rows *sql.Rows, dest interface{}) error {
+	defer rows.Close()
+
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() {
+		return fmt.Errorf("destination must be a pointer")
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	scanDests, extraDests := scanDestinations(columns, destValue.Elem())
+	if err := rows.Scan(scanDests...); err != nil {
+		return err
+	}
+	if err := decryptFields(keys, destValue.Elem()); err != nil {
+		return err
+	}
+	if len(extraDests) > 0 {
+		extra := make(map[string]interface{}, len(extraDests))
+		for column, value := range extraDests {
+			extra[column] = *value
+		}
+		setSearchResult(destValue.Elem(), extra)
+	}
+	snapshot(dest, nil)
+	return nil
+}
+
+// scanModelRows scans every row into a new value of elemType, mapping
+// result columns to fields by column name. Columns that match no field are
+// handed to fn in extra.
+func scanModelRows(keys *keyring, rows *sql.Rows, elemType reflect.Type, fn func(elem reflect.Value, extra map[string]interface{}) error) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
 	for rows.Next() {
 		// Create new instance
-		elem := reflect.New(elemType)
-
-		// Prepare scan destinations
-		scanDests := make([]interface{}, elemType.NumField())
-		for i := 0; i < elemType.NumField(); i++ {
-			field := elem.Elem().Field(i)
-			if field.CanSet() {
-				scanDests[i] = field.Addr().Interface()
-			}
-		}
+		elem := reflect.New(elemType).Elem()
 
+		scanDests, extraDests := scanDestinations(columns, elem)
 		if err := rows.Scan(scanDests...); err != nil {
 			return err
 		}
+		if err := decryptFields(keys, elem); err != nil {
+			return err
+		}
+		snapshot(elem.Addr().Interface(), nil)
 
-		// Append to slice
-		if destValue.Type().Elem().Kind() == reflect.Ptr {
-			destValue.Set(reflect.Append(destValue, elem))
-		} else {
-			destValue.Set(reflect.Append(destValue, elem.Elem()))
+		var extra map[string]interface{}
+		if len(extraDests) > 0 {
+			extra = make(map[string]interface{}, len(extraDests))
+			for column, value := range extraDests {
+				extra[column] = *value
+			}
+		}
+
+		if err := fn(elem, extra); err != nil {
+			return err
 		}
 	}
 
 	return rows.Err()
 }
+
+// scanDestinations maps result columns onto the fields of elem. Columns
+// without a matching field scan into placeholders returned in extra.
+func scanDestinations(columns []string, elem reflect.Value) ([]interface{}, map[string]*interface{}) {
+	scanDests := make([]interface{}, len(columns))
+	var extra map[string]*interface{}
+
+	// Scalar destinations take the first column
+	if elem.Kind() != reflect.Struct || elem.Type() == reflect.TypeOf(time.Time{}) {
+		for i := range columns {
+			scanDests[i] = new(interface{})
+		}
+		if len(columns) > 0 {
+			scanDests[0] = elem.Addr().Interface()
+		}
+		return scanDests, nil
+	}
+
+	schema := schemaOf(elem.Type())
+	for i, column := range columns {
+		if field := schema.FieldByColumn(column); field != nil {
+			if field.HasOption("json") {
+				scanDests[i] = &jsonScanner{dest: elem.FieldByIndex(field.Index), field: field}
+			} else {
+				scanDests[i] = elem.FieldByIndex(field.Index).Addr().Interface()
+			}
+			continue
+		}
+
+		holder := new(interface{})
+		if extra == nil {
+			extra = make(map[string]*interface{})
+		}
+		extra[column] = holder
+		scanDests[i] = holder
+	}
+
+	return scanDests, extra
+}
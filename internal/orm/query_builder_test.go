@@ -0,0 +1,177 @@
+package orm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+func TestGenerateSQL_Composition(t *testing.T) {
+	dialectGolden{
+		sqlite:   `SELECT DISTINCT age, COUNT(*) AS total FROM "users" WHERE active = ? GROUP BY age HAVING COUNT(*) > ? ORDER BY age ASC`,
+		postgres: `SELECT DISTINCT age, COUNT(*) AS total FROM "users" WHERE active = $1 GROUP BY age HAVING COUNT(*) > $2 ORDER BY age ASC`,
+		mysql:    "SELECT DISTINCT age, COUNT(*) AS total FROM `users` WHERE active = ? GROUP BY age HAVING COUNT(*) > ? ORDER BY age ASC",
+	}.check(t, "select group having", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) {
+			qb.Select("age", "COUNT(*) AS total").Distinct().Where("active = ?", true).Group("age").Having("COUNT(*) > ?", 1).Order("age")
+		})
+	})
+
+	dialectGolden{
+		sqlite:   `SELECT * FROM "users" WHERE ((age > ? AND active = ?) OR (name = ?))`,
+		postgres: `SELECT * FROM "users" WHERE ((age > $1 AND active = $2) OR (name = $3))`,
+		mysql:    "SELECT * FROM `users` WHERE ((age > ? AND active = ?) OR (name = ?))",
+	}.check(t, "or", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) {
+			qb.Where("age > ?", 30).Where("active = ?", true).Or(func(q gor.QueryBuilder) gor.QueryBuilder {
+				return q.Where("name = ?", "ada")
+			})
+		})
+	})
+
+	dialectGolden{
+		sqlite:   `SELECT * FROM "users" WHERE age > ? AND id IN (SELECT user_id FROM "posts" WHERE published = ?)`,
+		postgres: `SELECT * FROM "users" WHERE age > $1 AND id IN (SELECT user_id FROM "posts" WHERE published = $2)`,
+		mysql:    "SELECT * FROM `users` WHERE age > ? AND id IN (SELECT user_id FROM `posts` WHERE published = ?)",
+	}.check(t, "where in", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) {
+			posts := NewQueryBuilder(&TestPost{}, nil, d.(gor.DatabaseAdapter)).Select("user_id").Where("published = ?", true)
+			qb.Where("age > ?", 18).WhereIn("id", posts)
+		})
+	})
+
+	dialectGolden{
+		sqlite:   `SELECT COUNT(*) FROM (SELECT age FROM "users" GROUP BY age) AS gor_count`,
+		postgres: `SELECT COUNT(*) FROM (SELECT age FROM "users" GROUP BY age) AS gor_count`,
+		mysql:    "SELECT COUNT(*) FROM (SELECT age FROM `users` GROUP BY age) AS gor_count",
+	}.check(t, "grouped count", func(d sqlDialect) string {
+		return goldenQuery(d, func(qb *QueryBuilder) {
+			qb.Select("age").Group("age")
+			qb.isCount = true
+		})
+	})
+}
+
+type ageCount struct {
+	Age   int
+	Total int64
+}
+
+func TestQueryBuilder_Composition(t *testing.T) {
+	orm := setupTestORM(t)
+
+	users := []*TestUser{
+		{Name: "ada", Email: "ada@example.com", Age: 30, Active: true},
+		{Name: "bob", Email: "bob@example.com", Age: 30, Active: false},
+		{Name: "cy", Email: "cy@example.com", Age: 40, Active: true},
+		{Name: "di", Email: "di@example.com", Age: 50, Active: true},
+	}
+	for _, user := range users {
+		if err := orm.Create(user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	for _, post := range []*TestPost{{Title: "one", UserID: users[0].ID, Published: true}, {Title: "two", UserID: users[2].ID}} {
+		if err := orm.Create(post); err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+	}
+
+	t.Run("Pluck", func(t *testing.T) {
+		var names []string
+		if err := orm.Query(&TestUser{}).Where("active = ?", true).Order("name").Pluck("name", &names); err != nil {
+			t.Fatalf("Pluck() error = %v", err)
+		}
+		if !reflect.DeepEqual(names, []string{"ada", "cy", "di"}) {
+			t.Errorf("Pluck() = %v", names)
+		}
+
+		var ages []int
+		if err := orm.Query(&TestUser{}).Distinct().Order("age").Pluck("age", &ages); err != nil {
+			t.Fatalf("Pluck() distinct error = %v", err)
+		}
+		if !reflect.DeepEqual(ages, []int{30, 40, 50}) {
+			t.Errorf("Pluck() distinct = %v", ages)
+		}
+	})
+
+	t.Run("GroupIntoResultStruct", func(t *testing.T) {
+		var counts []ageCount
+		qb := orm.Query(&TestUser{}).Select("age", "COUNT(*) AS total").Group("age").Having("COUNT(*) >= ?", 1).Order("age")
+		if err := qb.FindAll(&counts); err != nil {
+			t.Fatalf("FindAll() error = %v", err)
+		}
+		want := []ageCount{{30, 2}, {40, 1}, {50, 1}}
+		if !reflect.DeepEqual(counts, want) {
+			t.Errorf("counts = %v, want %v", counts, want)
+		}
+
+		groups, err := orm.Query(&TestUser{}).Select("age").Group("age").Count()
+		if err != nil {
+			t.Fatalf("Count() error = %v", err)
+		}
+		if groups != 3 {
+			t.Errorf("grouped Count() = %d, want 3", groups)
+		}
+	})
+
+	t.Run("Or", func(t *testing.T) {
+		var names []string
+		err := orm.Query(&TestUser{}).Where("age = ?", 30).Where("active = ?", true).
+			Or(func(q gor.QueryBuilder) gor.QueryBuilder { return q.Where("age = ?", 50) }).
+			Order("name").Pluck("name", &names)
+		if err != nil {
+			t.Fatalf("Pluck() error = %v", err)
+		}
+		if !reflect.DeepEqual(names, []string{"ada", "di"}) {
+			t.Errorf("Or() = %v, want [ada di]", names)
+		}
+	})
+
+	t.Run("Subqueries", func(t *testing.T) {
+		var authors []string
+		published := orm.Query(&TestPost{}).Select("user_id").Where("published = ?", true)
+		if err := orm.Query(&TestUser{}).WhereIn("id", published).Pluck("name", &authors); err != nil {
+			t.Fatalf("WhereIn() error = %v", err)
+		}
+		if !reflect.DeepEqual(authors, []string{"ada"}) {
+			t.Errorf("WhereIn() = %v, want [ada]", authors)
+		}
+
+		var withoutPosts []string
+		posts := orm.Query(&TestPost{}).Select("1").Where("posts.user_id = users.id")
+		if err := orm.Query(&TestUser{}).WhereNotExists(posts).Order("name").Pluck("name", &withoutPosts); err != nil {
+			t.Fatalf("WhereNotExists() error = %v", err)
+		}
+		if !reflect.DeepEqual(withoutPosts, []string{"bob", "di"}) {
+			t.Errorf("WhereNotExists() = %v, want [bob di]", withoutPosts)
+		}
+	})
+
+	t.Run("InTransaction", func(t *testing.T) {
+		err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+			posts := tx.Query(&TestPost{}).Select("1").Where("posts.user_id = users.id")
+
+			var names []string
+			if err := tx.Query(&TestUser{}).WhereExists(posts).Order("name").Pluck("name", &names); err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(names, []string{"ada", "cy"}) {
+				t.Errorf("WhereExists() in transaction = %v, want [ada cy]", names)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Transaction() error = %v", err)
+		}
+	})
+
+	t.Run("UnsupportedSubquery", func(t *testing.T) {
+		var names []string
+		if err := orm.Query(&TestUser{}).WhereIn("id", nil).Pluck("name", &names); err == nil {
+			t.Error("WhereIn() with a nil subquery should fail")
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// Names accepted by ORM.Using besides those of DatabaseConfig.Connections
+const (
+	PrimaryDatabase = "primary"
+	ReplicaDatabase = "replica"
+)
+
+// ErrUnknownDatabase is returned by the operations of an ORM using a
+// database that is not configured
+var ErrUnknownDatabase = errors.New("unknown database")
+
+// replicaSet spreads reads across the read replicas of a database
+type replicaSet struct {
+	dbs  []*sql.DB
+	next atomic.Uint64
+}
+
+// pick returns the replica for a read run with ctx, or nil when the read
+// must go to the primary: there are no replicas, or the context's session
+// has written to the primary and so must read its own writes
+func (r *replicaSet) pick(ctx context.Context) *sql.DB {
+	if r == nil || len(r.dbs) == 0 || sessionWrote(ctx) {
+		return nil
+	}
+	return r.nextDB()
+}
+
+// nextDB returns the replicas in turn
+func (r *replicaSet) nextDB() *sql.DB {
+	return r.dbs[(r.next.Add(1)-1)%uint64(len(r.dbs))]
+}
+
+// connectReplicas opens the replicas of config, which default to the
+// primary's driver and pool settings
+func connectReplicas(ctx context.Context, config gor.DatabaseConfig) (*replicaSet, error) {
+	if len(config.Replicas) == 0 {
+		return nil, nil
+	}
+
+	replicas := &replicaSet{}
+	for i, replicaConfig := range config.Replicas {
+		if replicaConfig.Driver == "" {
+			replicaConfig.Driver = config.Driver
+		}
+		if replicaConfig.MaxOpenConns == 0 {
+			replicaConfig.MaxOpenConns = config.MaxOpenConns
+			replicaConfig.MaxIdleConns = config.MaxIdleConns
+			replicaConfig.ConnMaxLifetime = config.ConnMaxLifetime
+		}
+
+		db, err := getAdapter(replicaConfig.Driver).Connect(replicaConfig)
+		if err != nil {
+			_ = replicas.close()
+			return nil, fmt.Errorf("failed to connect to replica %d: %w", i, err)
+		}
+		replicas.dbs = append(replicas.dbs, db)
+
+		db.SetMaxOpenConns(replicaConfig.MaxOpenConns)
+		db.SetMaxIdleConns(replicaConfig.MaxIdleConns)
+		db.SetConnMaxLifetime(replicaConfig.ConnMaxLifetime)
+		if err := db.PingContext(ctx); err != nil {
+			_ = replicas.close()
+			return nil, fmt.Errorf("failed to connect to replica %d: %w", i, err)
+		}
+	}
+	return replicas, nil
+}
+
+func (r *replicaSet) close() error {
+	if r == nil {
+		return nil
+	}
+
+	var firstErr error
+	for _, db := range r.dbs {
+		if err := db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Using returns an ORM that runs every statement on the named database:
+// "primary", "replica" (one of the read replicas) or one of the
+// DatabaseConfig.Connections. Without replicas, "replica" is the primary.
+// The operations of an ORM using an unknown name fail with an error.
+//
+//	total, err := db.Using("analytics").Query(&Event{}).Count()
+func (o *gorORM) Using(name string) gor.ORM {
+	scoped := *o
+	scoped.replicas = nil
+
+	switch name {
+	case PrimaryDatabase:
+	case ReplicaDatabase:
+		if o.replicas != nil && len(o.replicas.dbs) > 0 {
+			scoped.db = o.replicas.nextDB()
+			scoped.migrator = NewMigrator(scoped.db, o.adapter)
+		}
+	default:
+		connection, ok := o.connections[name]
+		if !ok {
+			return &unknownDatabase{err: fmt.Errorf("%w %q", ErrUnknownDatabase, name), adapter: o.adapter}
+		}
+		return connection.WithContext(o.ctx)
+	}
+
+	return &scoped
+}
+
+// unknownDatabase is the ORM Using returns for a database that is not
+// configured. Its operations fail with err, so a configuration mistake
+// fails the requests using the database instead of crashing them.
+type unknownDatabase struct {
+	err     error
+	adapter gor.DatabaseAdapter
+}
+
+func (u *unknownDatabase) Connect(ctx context.Context, config gor.DatabaseConfig) error {
+	return u.err
+}
+func (u *unknownDatabase) Close() error                                  { return nil }
+func (u *unknownDatabase) DB() *sql.DB                                   { return nil }
+func (u *unknownDatabase) WithContext(ctx context.Context) gor.ORM       { return u }
+func (u *unknownDatabase) Using(name string) gor.ORM                     { return u }
+func (u *unknownDatabase) Migrate(ctx context.Context) error             { return u.err }
+func (u *unknownDatabase) Rollback(ctx context.Context, steps int) error { return u.err }
+func (u *unknownDatabase) MigrationStatus(ctx context.Context) ([]gor.Migration, error) {
+	return nil, u.err
+}
+func (u *unknownDatabase) DumpSchema(w io.Writer) error         { return u.err }
+func (u *unknownDatabase) LoadSchema(r io.Reader) error         { return u.err }
+func (u *unknownDatabase) Register(models ...interface{}) error { return u.err }
+func (u *unknownDatabase) Table(name string) gor.Table          { return &unknownTable{name: name, err: u.err} }
+func (u *unknownDatabase) Transaction(ctx context.Context, fn func(tx gor.Transaction) error) error {
+	return u.err
+}
+func (u *unknownDatabase) Query(model interface{}) gor.QueryBuilder {
+	qb := NewQueryBuilder(model, nil, u.adapter).(*QueryBuilder)
+	qb.setErr(u.err)
+	return qb
+}
+func (u *unknownDatabase) Find(model interface{}, id interface{}) error { return u.err }
+func (u *unknownDatabase) FindAll(models interface{}) error             { return u.err }
+func (u *unknownDatabase) Create(model interface{}) error               { return u.err }
+func (u *unknownDatabase) Update(model interface{}) error               { return u.err }
+func (u *unknownDatabase) Delete(model interface{}) error               { return u.err }
+
+// unknownTable is a table of an unknown database
+type unknownTable struct {
+	name string
+	err  error
+}
+
+func (t *unknownTable) Name() string                                { return t.name }
+func (t *unknownTable) Columns() []gor.Column                       { return nil }
+func (t *unknownTable) Indexes() []gor.Index                        { return nil }
+func (t *unknownTable) Create(model interface{}) error              { return t.err }
+func (t *unknownTable) Update(model interface{}) error              { return t.err }
+func (t *unknownTable) Delete(id interface{}) error                 { return t.err }
+func (t *unknownTable) Find(id interface{}, dest interface{}) error { return t.err }
+func (t *unknownTable) BulkInsert(models interface{}) error         { return t.err }
+func (t *unknownTable) BulkUpdate(models interface{}) error         { return t.err }
+func (t *unknownTable) BulkDelete(ids interface{}) error            { return t.err }
+func (t *unknownTable) Upsert(model interface{}, onConflict gor.OnConflict) error {
+	return t.err
+}
+func (t *unknownTable) BulkUpsert(models interface{}, onConflict gor.OnConflict) ([]int64, error) {
+	return nil, t.err
+}
+func (t *unknownTable) AddColumn(column gor.Column) error         { return t.err }
+func (t *unknownTable) DropColumn(name string) error              { return t.err }
+func (t *unknownTable) AddIndex(index gor.Index) error            { return t.err }
+func (t *unknownTable) DropIndex(name string) error               { return t.err }
+func (t *unknownTable) WithContext(ctx context.Context) gor.Table { return t }
+
+// reader returns the connection a read runs on: a replica when there is
+// one, unless the query runs in a transaction or locks its rows
+func (qb *QueryBuilder) reader() executor {
+	if qb.txn == nil && qb.lock == noLock {
+		if replica := qb.replicas.pick(qb.ctx); replica != nil {
+			return withContext(qb.ctx, replica, qb.adapter, qb.keys)
+		}
+	}
+	return qb.executor()
+}
+
+// reader returns the connection the table's reads run on
+func (t *gorTable) reader() executor {
+	if t.tx == nil {
+		if replica := t.replicas.pick(t.ctx); replica != nil {
+			return withContext(t.ctx, replica, t.adapter, t.keys)
+		}
+	}
+	return t.exec()
+}
+
+type sessionKey struct{}
+
+// dbSession records whether a request has written to the primary
+type dbSession struct {
+	wrote atomic.Bool
+}
+
+// WithDatabaseSession returns a context whose reads stick to the primary
+// once a write has run with it, so a request reads its own writes even
+// when the replicas lag behind.
+func WithDatabaseSession(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, sessionKey{}, &dbSession{})
+}
+
+// DatabaseSessionMiddleware gives each request a database session. Handlers
+// must run their queries with the request context, db.WithContext(ctx).
+func DatabaseSessionMiddleware(next gor.HandlerFunc) gor.HandlerFunc {
+	return func(ctx *gor.Context) error {
+		ctx.Context = WithDatabaseSession(ctx.Context)
+		return next(ctx)
+	}
+}
+
+// noteWrite marks the context's session as having written when query is
+// not a read
+func noteWrite(ctx context.Context, query string) {
+	if session, ok := ctx.Value(sessionKey{}).(*dbSession); ok && !isRead(query) {
+		session.wrote.Store(true)
+	}
+}
+
+func sessionWrote(ctx context.Context) bool {
+	session, ok := ctx.Value(sessionKey{}).(*dbSession)
+	return ok && session.wrote.Load()
+}
@@ -0,0 +1,164 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// setupReplicatedORM connects to a primary, one replica and an analytics
+// database, each its own SQLite file. Replication is not simulated: rows
+// written to one file are only visible there, which shows where each
+// statement ran.
+func setupReplicatedORM(t *testing.T) gor.ORM {
+	dir := t.TempDir()
+	config := gor.DatabaseConfig{
+		Driver:          "sqlite3",
+		Database:        filepath.Join(dir, "primary.db"),
+		MaxOpenConns:    2,
+		MaxIdleConns:    2,
+		ConnMaxLifetime: time.Hour,
+		Replicas:        []gor.DatabaseConfig{{Database: filepath.Join(dir, "replica.db")}},
+		Connections: map[string]gor.DatabaseConfig{
+			"analytics": {Driver: "sqlite3", Database: filepath.Join(dir, "analytics.db")},
+		},
+	}
+
+	orm := NewORM(config)
+	if err := orm.Connect(context.Background(), config); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { orm.Close() })
+
+	for _, db := range []gor.ORM{orm, orm.Using(ReplicaDatabase)} {
+		if err := db.Register(&TestUser{}); err != nil {
+			t.Fatalf("Failed to register models: %v", err)
+		}
+		if err := db.Create(&TestUser{Name: "shared", Email: "shared@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := orm.Using(ReplicaDatabase).Create(&TestUser{Name: "replica", Email: "replica@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	return orm
+}
+
+func replicaNames(t *testing.T, qb gor.QueryBuilder) []string {
+	t.Helper()
+	var names []string
+	if err := qb.Order("id").Pluck("name", &names); err != nil {
+		t.Fatalf("Pluck() error = %v", err)
+	}
+	return names
+}
+
+func TestReplicas_RouteReadsAndWrites(t *testing.T) {
+	orm := setupReplicatedORM(t)
+
+	if err := orm.Create(&TestUser{Name: "primary", Email: "primary@example.com"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if got := replicaNames(t, orm.Query(&TestUser{})); !reflect.DeepEqual(got, []string{"shared", "replica"}) {
+		t.Errorf("read = %v, want the replica's rows", got)
+	}
+
+	var user TestUser
+	if err := orm.Table("users").Find(2, &user); err != nil || user.Name != "replica" {
+		t.Errorf("Table.Find() = %+v, %v; want the replica's row", user, err)
+	}
+
+	if got := replicaNames(t, orm.Using(PrimaryDatabase).Query(&TestUser{})); !reflect.DeepEqual(got, []string{"shared", "primary"}) {
+		t.Errorf("Using(primary) read = %v, want the primary's rows", got)
+	}
+
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		if got := replicaNames(t, tx.Query(&TestUser{})); !reflect.DeepEqual(got, []string{"shared", "primary"}) {
+			t.Errorf("read in transaction = %v, want the primary's rows", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+}
+
+func TestReplicas_StickToPrimaryAfterWrite(t *testing.T) {
+	orm := setupReplicatedORM(t)
+
+	var names []string
+	handler := DatabaseSessionMiddleware(func(ctx *gor.Context) error {
+		db := orm.WithContext(ctx)
+		names = append(names, replicaNames(t, db.Query(&TestUser{}))...)
+
+		if err := db.Create(&TestUser{Name: "written", Email: "written@example.com"}); err != nil {
+			return err
+		}
+		names = append(names, replicaNames(t, db.Query(&TestUser{}))...)
+		return nil
+	})
+	if err := handler(&gor.Context{Context: context.Background()}); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+
+	want := []string{"shared", "replica", "shared", "written"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("reads = %v, want the replica before the write and the primary after", names)
+	}
+
+	// Another request starts on the replica again
+	if got := replicaNames(t, orm.WithContext(WithDatabaseSession(context.Background())).Query(&TestUser{})); !reflect.DeepEqual(got, []string{"shared", "replica"}) {
+		t.Errorf("read in a new session = %v, want the replica's rows", got)
+	}
+}
+
+func TestReplicas_UsingNamedConnection(t *testing.T) {
+	orm := setupReplicatedORM(t)
+	analytics := orm.Using("analytics")
+
+	if err := analytics.Register(&TestPost{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+	if err := analytics.Create(&TestPost{Title: "event", UserID: 1}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if count, err := analytics.Query(&TestPost{}).Count(); err != nil || count != 1 {
+		t.Errorf("analytics Count() = %d, %v; want 1", count, err)
+	}
+	if _, err := orm.Query(&TestPost{}).Count(); err == nil {
+		t.Error("posts should only exist in the analytics database")
+	}
+
+	// An unknown database fails its operations rather than panicking
+	archive := orm.Using("archive")
+	if err := archive.Create(&TestPost{Title: "old", UserID: 1}); !errors.Is(err, ErrUnknownDatabase) {
+		t.Errorf("Using(archive).Create() error = %v, want ErrUnknownDatabase", err)
+	}
+	if _, err := archive.Query(&TestPost{}).Where("title = ?", "old").Count(); !errors.Is(err, ErrUnknownDatabase) {
+		t.Errorf("Using(archive).Query().Count() error = %v, want ErrUnknownDatabase", err)
+	}
+	var post TestPost
+	if err := archive.Query(&TestPost{}).First(&post); !errors.Is(err, ErrUnknownDatabase) {
+		t.Errorf("Using(archive).Query().First() error = %v, want ErrUnknownDatabase", err)
+	}
+	if err := archive.Table("posts").Find(1, &post); !errors.Is(err, ErrUnknownDatabase) {
+		t.Errorf("Using(archive).Table().Find() error = %v, want ErrUnknownDatabase", err)
+	}
+}
+
+func TestReplicas_UsingReplicaWithoutReplicas(t *testing.T) {
+	orm := setupTestORM(t)
+	if err := orm.Create(&TestUser{Name: "ada", Email: "ada@example.com"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if count, err := orm.Using(ReplicaDatabase).Query(&TestUser{}).Count(); err != nil || count != 1 {
+		t.Errorf("Using(replica) Count() without replicas = %d, %v; want the primary's row", count, err)
+	}
+}
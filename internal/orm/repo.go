@@ -0,0 +1,304 @@
+package orm
+
+import (
+	"context"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// recordStore is the part of gor.ORM and gor.Transaction a Repo needs
+type recordStore interface {
+	Query(model interface{}) gor.QueryBuilder
+	Create(model interface{}) error
+	Update(model interface{}) error
+	Delete(model interface{}) error
+}
+
+// Repo is a typed view of one model's table. T is the model struct type;
+// methods take and return *T, so passing the wrong shape fails to compile
+// instead of failing at runtime:
+//
+//	users := orm.NewRepo[User](db)
+//	user, err := users.Find(ctx, 1)
+//	active, err := users.Where("active = ?", true).Order("name").All(ctx)
+type Repo[T any] struct {
+	store recordStore
+}
+
+// RepoModel constrains the model of a Repo: *T must name its table, as
+// models do, so NewRepo[User] compiles and NewRepo[*User] or NewRepo[int]
+// does not
+type RepoModel[T any] interface {
+	*T
+	TableName() string
+}
+
+// NewRepo creates a repository for T over an ORM or a transaction. PT is
+// inferred from T.
+func NewRepo[T any, PT RepoModel[T]](store recordStore) *Repo[T] {
+	return &Repo[T]{store: store}
+}
+
+// WithTx returns a repository that works within the transaction
+func (r *Repo[T]) WithTx(tx gor.Transaction) *Repo[T] {
+	return &Repo[T]{store: tx}
+}
+
+// Find loads the record with the given ID
+func (r *Repo[T]) Find(ctx context.Context, id interface{}) (*T, error) {
+	return r.Where("id = ?", id).First(ctx)
+}
+
+// All loads every record
+func (r *Repo[T]) All(ctx context.Context) ([]T, error) {
+	return r.Query().All(ctx)
+}
+
+// Create inserts model
+func (r *Repo[T]) Create(ctx context.Context, model *T) error {
+	return r.storeFor(ctx).Create(model)
+}
+
+// Update saves model
+func (r *Repo[T]) Update(ctx context.Context, model *T) error {
+	return r.storeFor(ctx).Update(model)
+}
+
+// Delete deletes model
+func (r *Repo[T]) Delete(ctx context.Context, model *T) error {
+	return r.storeFor(ctx).Delete(model)
+}
+
+// storeFor returns the store bound to ctx
+func (r *Repo[T]) storeFor(ctx context.Context) recordStore {
+	switch store := r.store.(type) {
+	case gor.ORM:
+		return store.WithContext(ctx)
+	case gor.Transaction:
+		return store.WithContext(ctx)
+	}
+	return r.store
+}
+
+// Query starts a typed query over the table
+func (r *Repo[T]) Query() *Query[T] {
+	return &Query[T]{qb: r.store.Query(new(T))}
+}
+
+// Where starts a query with a condition
+func (r *Repo[T]) Where(condition string, args ...interface{}) *Query[T] {
+	return r.Query().Where(condition, args...)
+}
+
+// Scope starts a query with the given scopes applied
+func (r *Repo[T]) Scope(scopes ...Scope[T]) *Query[T] {
+	return r.Query().Scope(scopes...)
+}
+
+// Scope is reusable, typed query logic:
+//
+//	func Published(q *orm.Query[Post]) *orm.Query[Post] {
+//		return q.Where("published = ?", true)
+//	}
+type Scope[T any] func(q *Query[T]) *Query[T]
+
+// Query is a typed wrapper around gor.QueryBuilder. Like the builder it
+// wraps, its methods modify and return the same query.
+type Query[T any] struct {
+	qb gor.QueryBuilder
+}
+
+// Builder returns the underlying query builder for anything the typed
+// API does not cover
+func (q *Query[T]) Builder() gor.QueryBuilder {
+	return q.qb
+}
+
+// Scope applies each scope in turn
+func (q *Query[T]) Scope(scopes ...Scope[T]) *Query[T] {
+	for _, scope := range scopes {
+		q = scope(q)
+	}
+	return q
+}
+
+// Where adds a WHERE condition
+func (q *Query[T]) Where(condition string, args ...interface{}) *Query[T] {
+	q.qb = q.qb.Where(condition, args...)
+	return q
+}
+
+// WhereMap adds an equality condition for each entry
+func (q *Query[T]) WhereMap(conditions map[string]interface{}) *Query[T] {
+	q.qb = q.qb.WhereMap(conditions)
+	return q
+}
+
+// Not adds a NOT WHERE condition
+func (q *Query[T]) Not(condition string, args ...interface{}) *Query[T] {
+	q.qb = q.qb.Not(condition, args...)
+	return q
+}
+
+// Or matches rows satisfying either the conditions so far or those added
+// by fn
+func (q *Query[T]) Or(fn func(q *Query[T]) *Query[T]) *Query[T] {
+	q.qb = q.qb.Or(func(qb gor.QueryBuilder) gor.QueryBuilder {
+		return fn(&Query[T]{qb: qb}).qb
+	})
+	return q
+}
+
+// Order adds an ascending ORDER BY clause
+func (q *Query[T]) Order(field string) *Query[T] {
+	q.qb = q.qb.Order(field)
+	return q
+}
+
+// OrderDesc adds a descending ORDER BY clause
+func (q *Query[T]) OrderDesc(field string) *Query[T] {
+	q.qb = q.qb.OrderDesc(field)
+	return q
+}
+
+// Limit sets the LIMIT clause
+func (q *Query[T]) Limit(limit int) *Query[T] {
+	q.qb = q.qb.Limit(limit)
+	return q
+}
+
+// Offset sets the OFFSET clause
+func (q *Query[T]) Offset(offset int) *Query[T] {
+	q.qb = q.qb.Offset(offset)
+	return q
+}
+
+// After continues from a keyset cursor
+func (q *Query[T]) After(cursor string) *Query[T] {
+	q.qb = q.qb.After(cursor)
+	return q
+}
+
+// Before pages back from a keyset cursor
+func (q *Query[T]) Before(cursor string) *Query[T] {
+	q.qb = q.qb.Before(cursor)
+	return q
+}
+
+// WhereJSON compares the value at a JSON path inside a JSON column
+func (q *Query[T]) WhereJSON(column, path, operator string, value interface{}) *Query[T] {
+	q.qb = q.qb.WhereJSON(column, path, operator, value)
+	return q
+}
+
+// Search matches records whose searchable fields match query, best
+// matches first
+func (q *Query[T]) Search(query string) *Query[T] {
+	q.qb = q.qb.Search(query)
+	return q
+}
+
+// Joins adds an INNER JOIN clause
+func (q *Query[T]) Joins(table string) *Query[T] {
+	q.qb = q.qb.Joins(table)
+	return q
+}
+
+// Includes eager loads associations
+func (q *Query[T]) Includes(associations ...string) *Query[T] {
+	q.qb = q.qb.Includes(associations...)
+	return q
+}
+
+// Unscoped removes the default scopes
+func (q *Query[T]) Unscoped() *Query[T] {
+	q.qb = q.qb.Unscoped()
+	return q
+}
+
+// WithDeleted includes soft-deleted records
+func (q *Query[T]) WithDeleted() *Query[T] {
+	q.qb = q.qb.WithDeleted()
+	return q
+}
+
+// OnlyDeleted matches soft-deleted records only
+func (q *Query[T]) OnlyDeleted() *Query[T] {
+	q.qb = q.qb.OnlyDeleted()
+	return q
+}
+
+// ForUpdate locks the selected rows until the transaction ends
+func (q *Query[T]) ForUpdate() *Query[T] {
+	q.qb = q.qb.ForUpdate()
+	return q
+}
+
+// All loads the matching records
+func (q *Query[T]) All(ctx context.Context) ([]T, error) {
+	records := []T{}
+	if err := q.qb.WithContext(ctx).FindAll(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// First loads the first matching record
+func (q *Query[T]) First(ctx context.Context) (*T, error) {
+	record := new(T)
+	if err := q.qb.WithContext(ctx).First(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Last loads the last matching record
+func (q *Query[T]) Last(ctx context.Context) (*T, error) {
+	record := new(T)
+	if err := q.qb.WithContext(ctx).Last(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Page loads one keyset page and the cursors around it
+func (q *Query[T]) Page(ctx context.Context) ([]T, gor.PageCursors, error) {
+	records := []T{}
+	cursors, err := q.qb.WithContext(ctx).FindPage(&records)
+	if err != nil {
+		return nil, gor.PageCursors{}, err
+	}
+	return records, cursors, nil
+}
+
+// Count counts the matching records
+func (q *Query[T]) Count(ctx context.Context) (int64, error) {
+	return q.qb.WithContext(ctx).Count()
+}
+
+// Exists reports whether any record matches
+func (q *Query[T]) Exists(ctx context.Context) (bool, error) {
+	return q.qb.WithContext(ctx).Exists()
+}
+
+// InBatches calls fn with the matching records in batches of size, each in
+// a transaction. The transaction is typed with the same repository.
+func (q *Query[T]) InBatches(ctx context.Context, size int, fn func(tx *Repo[T], batch []T) error) error {
+	var records []T
+	return q.qb.WithContext(ctx).FindInBatches(&records, size, func(tx gor.Transaction, batch interface{}) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(&Repo[T]{store: tx}, *batch.(*[]T))
+	})
+}
+
+// UpdateAll updates the matching records
+func (q *Query[T]) UpdateAll(ctx context.Context, updates map[string]interface{}) (int64, error) {
+	return q.qb.WithContext(ctx).UpdateAll(updates)
+}
+
+// DeleteAll deletes the matching records
+func (q *Query[T]) DeleteAll(ctx context.Context) (int64, error) {
+	return q.qb.WithContext(ctx).DeleteAll()
+}
@@ -0,0 +1,148 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+func activeUsers(q *Query[TestUser]) *Query[TestUser] {
+	return q.Where("active = ?", true)
+}
+
+func olderThan(age int) Scope[TestUser] {
+	return func(q *Query[TestUser]) *Query[TestUser] {
+		return q.Where("age > ?", age)
+	}
+}
+
+func TestRepo_CRUD(t *testing.T) {
+	ctx := context.Background()
+	users := NewRepo[TestUser](setupTestORM(t))
+
+	user := &TestUser{Name: "ada", Email: "ada@example.com", Age: 36, Active: true}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	found, err := users.Find(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if found.Name != "ada" {
+		t.Errorf("Find() = %+v", found)
+	}
+
+	found.Age = 37
+	if err := users.Update(ctx, found); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if reloaded, _ := users.Find(ctx, user.ID); reloaded.Age != 37 {
+		t.Errorf("Age after Update() = %d, want 37", reloaded.Age)
+	}
+
+	if err := users.Delete(ctx, found); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := users.Find(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Find() after Delete() error = %v, want sql.ErrNoRows", err)
+	}
+
+	all, err := users.All(ctx)
+	if err != nil || all == nil || len(all) != 0 {
+		t.Errorf("All() = %v, %v; want an empty slice", all, err)
+	}
+}
+
+func TestRepo_QueriesAndScopes(t *testing.T) {
+	ctx := context.Background()
+	orm := setupTestORM(t)
+	users := NewRepo[TestUser](orm)
+
+	for _, user := range []*TestUser{
+		{Name: "ada", Email: "ada@example.com", Age: 36, Active: true},
+		{Name: "bob", Email: "bob@example.com", Age: 20, Active: true},
+		{Name: "cy", Email: "cy@example.com", Age: 50, Active: false},
+	} {
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	found, err := users.Scope(activeUsers, olderThan(30)).All(ctx)
+	if err != nil {
+		t.Fatalf("All() error = %v", err)
+	}
+	if len(found) != 1 || found[0].Name != "ada" {
+		t.Errorf("scoped All() = %v, want [ada]", found)
+	}
+
+	either, err := users.Where("age < ?", 25).Or(func(q *Query[TestUser]) *Query[TestUser] {
+		return q.Where("active = ?", false)
+	}).Order("name").All(ctx)
+	if err != nil {
+		t.Fatalf("Or() error = %v", err)
+	}
+	if got := namesOf(either); !reflect.DeepEqual(got, []string{"bob", "cy"}) {
+		t.Errorf("Or() = %v, want [bob cy]", got)
+	}
+
+	count, err := users.Scope(activeUsers).Count(ctx)
+	if err != nil || count != 2 {
+		t.Errorf("Count() = %d, %v; want 2", count, err)
+	}
+
+	page, cursors, err := users.Query().Order("age").Limit(2).Page(ctx)
+	if err != nil {
+		t.Fatalf("Page() error = %v", err)
+	}
+	if got := namesOf(page); !reflect.DeepEqual(got, []string{"bob", "ada"}) || cursors.Next == "" {
+		t.Errorf("Page() = %v, %+v", got, cursors)
+	}
+
+	var batches int
+	err = users.Query().InBatches(ctx, 2, func(tx *Repo[TestUser], batch []TestUser) error {
+		batches++
+		for i := range batch {
+			batch[i].Active = true
+			if err := tx.Update(ctx, &batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("InBatches() error = %v", err)
+	}
+	if batches != 2 {
+		t.Errorf("InBatches() ran %d batches, want 2", batches)
+	}
+	if count, _ := users.Scope(activeUsers).Count(ctx); count != 3 {
+		t.Errorf("active users after InBatches() = %d, want 3", count)
+	}
+}
+
+func TestRepo_TransactionAndContext(t *testing.T) {
+	orm := setupTestORM(t)
+	users := NewRepo[TestUser](orm)
+
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		return users.WithTx(tx).Create(context.Background(), &TestUser{Name: "ada", Email: "ada@example.com"})
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := users.All(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("All() with a canceled context error = %v, want context.Canceled", err)
+	}
+	if err := users.Create(ctx, &TestUser{Name: "bob", Email: "bob@example.com"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Create() with a canceled context error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,375 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// modelField describes a struct field that maps to a table column
+type modelField struct {
+	Name    string
+	Column  string
+	Index   []int
+	Type    reflect.Type
+	Options map[string]string
+}
+
+// HasOption reports whether the field's gor tag contains the given option
+func (f *modelField) HasOption(name string) bool {
+	_, ok := f.Options[name]
+	return ok
+}
+
+// modelSchema is the reflected description of a model struct
+type modelSchema struct {
+	Type         reflect.Type
+	Table        string
+	Fields       []*modelField
+	Associations map[string]*association
+
+	// SoftDelete is the field tagged soft_delete, if any
+	SoftDelete *modelField
+
+	// LockVersion is the optimistic-locking field tagged lock_version, if any
+	LockVersion *modelField
+
+	// Tenant is the field tagged tenant that scopes rows to a tenant, if any
+	Tenant *modelField
+
+	// Audited is set when a field, usually the embedded BaseModel, is
+	// tagged audited
+	Audited bool
+
+	// Encrypted are the fields tagged encrypted, whose values are stored
+	// encrypted with the keyring set by SetEncryptionKeys
+	Encrypted []*modelField
+
+	// Searchable are the fields tagged searchable, indexed for full-text
+	// search
+	Searchable []*modelField
+
+	// CounterCaches are the belongs_to associations tagged counter_cache,
+	// which keep a count of the model's rows on their parent
+	CounterCaches []*association
+
+	byColumn map[string]*modelField
+	byName   map[string]*modelField
+
+	// err is set when a field's gor tag is invalid. Registering the model
+	// or writing it fails with it.
+	err error
+}
+
+// FieldByColumn returns the field mapped to a column name
+func (s *modelSchema) FieldByColumn(column string) *modelField {
+	return s.byColumn[column]
+}
+
+// FieldByName returns the field with the given Go name
+func (s *modelSchema) FieldByName(name string) *modelField {
+	return s.byName[name]
+}
+
+// PrimaryKey returns the field tagged primary_key, or the id column's
+func (s *modelSchema) PrimaryKey() *modelField {
+	for _, field := range s.Fields {
+		if field.HasOption("primary_key") {
+			return field
+		}
+	}
+	return s.FieldByColumn("id")
+}
+
+var schemaCache sync.Map // reflect.Type -> *modelSchema
+
+var registeredModels sync.Map // table name -> reflect.Type
+
+// registerModelType records the model type stored in a table, so the
+// _type column of a polymorphic association can be resolved to it
+func registerModelType(t reflect.Type) {
+	registeredModels.Store(getTableName(t), indirectType(t))
+}
+
+// modelTypeForTable returns the model type registered for a table
+func modelTypeForTable(table string) (reflect.Type, bool) {
+	t, ok := registeredModels.Load(table)
+	if !ok {
+		return nil, false
+	}
+	return t.(reflect.Type), true
+}
+
+// schemaOf returns the cached schema for a model type. Pointer, slice and
+// slice-of-pointer types are unwrapped to their struct type.
+func schemaOf(t reflect.Type) *modelSchema {
+	t = indirectType(t)
+
+	if cached, ok := schemaCache.Load(t); ok {
+		return cached.(*modelSchema)
+	}
+
+	schema := &modelSchema{
+		Type:         t,
+		Table:        getTableName(t),
+		Associations: make(map[string]*association),
+		byColumn:     make(map[string]*modelField),
+		byName:       make(map[string]*modelField),
+	}
+
+	if t.Kind() == reflect.Struct {
+		schema.collectFields(t, nil)
+	}
+
+	actual, _ := schemaCache.LoadOrStore(t, schema)
+	return actual.(*modelSchema)
+}
+
+func (s *modelSchema) collectFields(t reflect.Type, parentIndex []int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		// Skip unexported fields
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("gor")
+		if tag == "-" {
+			continue
+		}
+
+		index := make([]int, 0, len(parentIndex)+1)
+		index = append(index, parentIndex...)
+		index = append(index, i)
+
+		options := parseTagOptions(tag)
+		if _, ok := options["audited"]; ok {
+			s.Audited = true
+		}
+
+		// Flatten embedded structs (like BaseModel)
+		if field.Anonymous && indirectType(field.Type).Kind() == reflect.Struct && field.Type.Kind() != reflect.Ptr {
+			s.collectFields(field.Type, index)
+			continue
+		}
+
+		if assoc := newAssociation(s.Type, field, index, options); assoc != nil {
+			s.Associations[field.Name] = assoc
+			if assoc.counterCache != "" {
+				s.CounterCaches = append(s.CounterCaches, assoc)
+			}
+			continue
+		}
+
+		column := toSnakeCase(field.Name)
+		if name := options["column"]; name != "" {
+			column = name
+		}
+
+		// Fields declared on the outer struct shadow embedded ones
+		if _, exists := s.byColumn[column]; exists {
+			continue
+		}
+
+		mf := &modelField{
+			Name:    field.Name,
+			Column:  column,
+			Index:   index,
+			Type:    field.Type,
+			Options: options,
+		}
+		s.Fields = append(s.Fields, mf)
+		s.byColumn[column] = mf
+		s.byName[field.Name] = mf
+
+		if mf.HasOption("soft_delete") && s.SoftDelete == nil {
+			s.SoftDelete = mf
+		}
+		if mf.HasOption("lock_version") && s.LockVersion == nil {
+			s.LockVersion = mf
+		}
+		if mf.HasOption("tenant") && s.Tenant == nil {
+			s.Tenant = mf
+		}
+		if err := checkEncryptionOptions(mf); err != nil && s.err == nil {
+			s.err = fmt.Errorf("%s: %w", s.Type.Name(), err)
+		}
+		if mf.HasOption("encrypted") {
+			s.Encrypted = append(s.Encrypted, mf)
+		}
+		if mf.HasOption("searchable") {
+			s.Searchable = append(s.Searchable, mf)
+		}
+	}
+}
+
+// parseTagOptions parses a gor struct tag such as
+// "primary_key;auto_increment;foreign_key:author_id" into its options.
+// encrypted,deterministic is read as encrypted:deterministic.
+func parseTagOptions(tag string) map[string]string {
+	options := make(map[string]string)
+	for _, part := range strings.Split(tag, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(part, ":")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if name, mode, ok := strings.Cut(key, ","); ok && strings.TrimSpace(name) == "encrypted" && value == "" {
+			key, value = "encrypted", strings.TrimSpace(mode)
+		}
+		options[key] = value
+	}
+	return options
+}
+
+// indirectType unwraps pointer and slice types down to the element type
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return t
+		}
+		t = t.Elem()
+	}
+	return t
+}
+
+// association describes a relationship declared with a gor struct tag:
+//
+//	Author   *User     `gor:"belongs_to"`
+//	Profile  *Profile  `gor:"has_one"`
+//	Comments []Comment `gor:"has_many;foreign_key:post_id"`
+//	Tags     []Tag     `gor:"many_to_many:post_tags"`
+//
+// The join table of a many_to_many holds the owner's id, in foreign_key,
+// and the associated model's references column, id by default, in
+// association_foreign_key:
+//
+//	Tags []Tag `gor:"many_to_many:post_tags;association_foreign_key:tag_slug;references:slug"`
+//
+// A polymorphic belongs_to can point at rows of several tables. It is
+// declared on an interface{} field and stored in a <name>_id and a
+// <name>_type column, which holds the parent's table name; the parents
+// declare the other side with as:
+//
+//	Commentable interface{} `gor:"belongs_to;polymorphic;counter_cache"`
+//	Comments    []Comment   `gor:"has_many;as:commentable"`
+type association struct {
+	name       string
+	kind       gor.AssociationType
+	owner      reflect.Type
+	model      reflect.Type
+	index      []int
+	foreignKey string
+	references string
+
+	// polymorphic belongs_to, and has_one or has_many with as, only:
+	// typeColumn holds the parent's table, which is typeValue for as
+	polymorphic bool
+	typeColumn  string
+	typeValue   string
+
+	// counterCache is the column of the parent counting the owner's rows,
+	// for belongs_to tagged counter_cache
+	counterCache string
+
+	// many_to_many only
+	joinTable      string
+	joinForeignKey string
+	joinReferences string
+}
+
+var _ gor.Association = (*association)(nil)
+
+func (a *association) Type() gor.AssociationType { return a.kind }
+func (a *association) Model() reflect.Type       { return a.model }
+func (a *association) ForeignKey() string        { return a.foreignKey }
+func (a *association) References() string        { return a.references }
+
+func newAssociation(owner reflect.Type, field reflect.StructField, index []int, options map[string]string) *association {
+	assoc := &association{
+		name:       field.Name,
+		owner:      owner,
+		model:      indirectType(field.Type),
+		index:      index,
+		foreignKey: options["foreign_key"],
+		references: options["references"],
+	}
+
+	ownerKey := toSnakeCase(owner.Name()) + "_id"
+
+	switch {
+	case hasOption(options, "belongs_to"):
+		assoc.kind = gor.BelongsTo
+		if assoc.foreignKey == "" {
+			assoc.foreignKey = toSnakeCase(field.Name) + "_id"
+		}
+		if hasOption(options, "polymorphic") {
+			assoc.polymorphic = true
+			assoc.typeColumn = toSnakeCase(field.Name) + "_type"
+		}
+		if hasOption(options, "counter_cache") {
+			// Counters default to the owner's table, such as comments_count
+			assoc.counterCache = options["counter_cache"]
+			if assoc.counterCache == "" {
+				assoc.counterCache = getTableName(owner) + "_count"
+			}
+		}
+	case hasOption(options, "has_one"), hasOption(options, "has_many"):
+		assoc.kind = gor.HasMany
+		if hasOption(options, "has_one") {
+			assoc.kind = gor.HasOne
+		}
+		if as := options["as"]; as != "" {
+			ownerKey = as + "_id"
+			assoc.typeColumn = as + "_type"
+			assoc.typeValue = getTableName(owner)
+		}
+		if assoc.foreignKey == "" {
+			assoc.foreignKey = ownerKey
+		}
+	case hasOption(options, "many_to_many"):
+		assoc.kind = gor.ManyToMany
+		assoc.joinTable = options["many_to_many"]
+		if assoc.joinTable == "" {
+			assoc.joinTable = toSnakeCase(owner.Name()) + "_" + getTableName(assoc.model)
+		}
+		assoc.joinForeignKey = assoc.foreignKey
+		if assoc.joinForeignKey == "" {
+			assoc.joinForeignKey = ownerKey
+		}
+		assoc.joinReferences = options["association_foreign_key"]
+		if assoc.joinReferences == "" {
+			assoc.joinReferences = toSnakeCase(assoc.model.Name()) + "_id"
+		}
+		assoc.foreignKey = assoc.joinForeignKey
+	default:
+		return nil
+	}
+
+	if assoc.references == "" {
+		assoc.references = "id"
+	}
+
+	return assoc
+}
+
+func hasOption(options map[string]string, name string) bool {
+	_, ok := options[name]
+	return ok
+}
+
+// associationFor looks up an association by field name
+func associationFor(t reflect.Type, name string) (*association, error) {
+	schema := schemaOf(t)
+	assoc, ok := schema.Associations[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown association %q on %s", name, schema.Type.Name())
+	}
+	return assoc, nil
+}
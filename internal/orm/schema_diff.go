@@ -0,0 +1,238 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// SchemaDiff holds the statements that bring the live schema in line with
+// the registered models, and the statements that undo them
+type SchemaDiff struct {
+	Up   []string
+	Down []string
+}
+
+// Empty reports whether the schema already matches the models
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Up) == 0
+}
+
+func (d *SchemaDiff) add(up, down string) {
+	d.Up = append(d.Up, up)
+	if down != "" {
+		// Down statements run in reverse order
+		d.Down = append([]string{down}, d.Down...)
+	}
+}
+
+// note records a change that needs manual attention as a SQL comment
+func (d *SchemaDiff) note(format string, args ...interface{}) {
+	d.Up = append(d.Up, "-- "+fmt.Sprintf(format, args...))
+}
+
+// DiffModels compares the live database schema with the columns and indexes
+// declared by the given models
+func DiffModels(db *sql.DB, adapter gor.DatabaseAdapter, models ...interface{}) (*SchemaDiff, error) {
+	inspector, err := introspectorFor(adapter)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := inspector.TableNames(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	existing := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		existing[table] = true
+	}
+
+	diff := &SchemaDiff{}
+	for _, model := range models {
+		t := reflect.TypeOf(model)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		tableName := getTableName(t)
+		columns := extractColumns(t)
+		indexes := extractIndexes(t, tableName)
+
+		if !existing[tableName] {
+			diff.add(adapter.CreateTableSQL(tableName, columns)+";", fmt.Sprintf("DROP TABLE %s;", tableName))
+			for _, index := range indexes {
+				diff.add(adapter.IndexSQL(index)+";", "")
+			}
+		} else if err := diffTable(diff, db, adapter, inspector, tableName, columns, indexes); err != nil {
+			return nil, fmt.Errorf("failed to diff table %s: %w", tableName, err)
+		}
+
+		// Full-text search indexes only exist on SQLite
+		if _, ok := adapter.(*SQLiteAdapter); ok {
+			if err := diffSearchIndex(diff, inspector, db, tableName, searchColumns(t), existing); err != nil {
+				return nil, fmt.Errorf("failed to diff search index of %s: %w", tableName, err)
+			}
+		}
+	}
+
+	return diff, nil
+}
+
+func diffTable(diff *SchemaDiff, db *sql.DB, adapter gor.DatabaseAdapter, inspector schemaIntrospector,
+	tableName string, columns []gor.Column, indexes []gor.Index) error {
+
+	liveColumns, err := inspector.TableColumns(db, tableName)
+	if err != nil {
+		return err
+	}
+	liveIndexes, err := inspector.TableIndexes(db, tableName)
+	if err != nil {
+		return err
+	}
+
+	liveByName := make(map[string]gor.Column, len(liveColumns))
+	for _, column := range liveColumns {
+		liveByName[column.Name] = column
+	}
+
+	modelColumns := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		modelColumns[column.Name] = true
+
+		live, ok := liveByName[column.Name]
+		if !ok {
+			diff.add(addColumnSQL(adapter, tableName, column)+";",
+				fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", tableName, column.Name))
+
+			// Inline UNIQUE is not allowed when adding a column
+			if column.Unique && !column.Index {
+				index := gor.Index{
+					Name:    fmt.Sprintf("idx_%s_%s", tableName, column.Name),
+					Table:   tableName,
+					Columns: []string{column.Name},
+					Unique:  true,
+				}
+				indexes = append(indexes, index)
+			}
+			continue
+		}
+
+		wantType := normalizeColumnType(adapter.ColumnType(column), 0)
+		haveType := normalizeColumnType(live.Type, live.Size)
+		if wantType == haveType {
+			continue
+		}
+
+		if up := inspector.AlterColumnTypeSQL(tableName, column); up != "" {
+			diff.add(up+";", alterBackSQL(inspector, tableName, live)+";")
+		} else {
+			diff.note("%s.%s type changed from %s to %s; this database cannot alter column types in place, rebuild the table manually",
+				tableName, column.Name, haveType, wantType)
+		}
+	}
+
+	for _, live := range liveColumns {
+		if !modelColumns[live.Name] {
+			diff.note("%s.%s exists in the database but is not mapped by the model", tableName, live.Name)
+		}
+	}
+
+	liveIndexByName := make(map[string]gor.Index, len(liveIndexes))
+	for _, index := range liveIndexes {
+		liveIndexByName[index.Name] = index
+	}
+
+	for _, index := range indexes {
+		live, ok := liveIndexByName[index.Name]
+		if ok && live.Unique == index.Unique {
+			continue
+		}
+
+		if ok {
+			// Uniqueness changed: recreate the index
+			diff.add(inspector.DropIndexSQL(tableName, index.Name)+";", adapter.IndexSQL(live)+";")
+		}
+		diff.add(adapter.IndexSQL(index)+";", inspector.DropIndexSQL(tableName, index.Name)+";")
+	}
+
+	return nil
+}
+
+// addColumnSQL builds an ALTER TABLE ... ADD COLUMN statement. NOT NULL is
+// only emitted together with a default so the statement works on tables
+// that already hold rows.
+func addColumnSQL(adapter gor.DatabaseAdapter, tableName string, column gor.Column) string {
+	sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", tableName, column.Name, adapter.ColumnType(column))
+
+	if column.Default != nil {
+		if !column.Nullable {
+			sql += " NOT NULL"
+		}
+		sql += fmt.Sprintf(" DEFAULT %v", column.Default)
+	}
+
+	return sql
+}
+
+// alterBackSQL restores a column to the type reported by the live schema.
+// The live type is already in database syntax, so it is used verbatim
+// instead of going through the adapter's ColumnType mapping.
+func alterBackSQL(inspector schemaIntrospector, tableName string, live gor.Column) string {
+	switch inspector.(type) {
+	case *PostgreSQLAdapter:
+		return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s",
+			tableName, live.Name, live.Type, live.Name, live.Type)
+	case *MySQLAdapter:
+		sql := fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", tableName, live.Name, live.Type)
+		if !live.Nullable {
+			sql += " NOT NULL"
+		}
+		return sql
+	}
+
+	return ""
+}
+
+// FromModels compares the live schema with the given models and writes a
+// timestamped migration containing the statements needed to reconcile them.
+// It returns the path of the new file, or an empty path when the schema is
+// already up to date.
+func (mg *MigrationGenerator) FromModels(db *sql.DB, adapter gor.DatabaseAdapter, name string, models ...interface{}) (string, error) {
+	diff, err := DiffModels(db, adapter, models...)
+	if err != nil {
+		return "", err
+	}
+
+	if diff.Empty() {
+		return "", nil
+	}
+
+	return mg.writeMigration(name, joinStrings(diff.Up, "\n"), joinStrings(diff.Down, "\n"))
+}
+
+// GenerateDiffMigration writes a migration reconciling the live schema with
+// every model registered on the ORM. It backs the `gor db diff` task.
+func GenerateDiffMigration(o gor.ORM, migrationsDir, name string) (string, error) {
+	orm, ok := o.(*gorORM)
+	if !ok {
+		return "", fmt.Errorf("unsupported ORM implementation %T", o)
+	}
+
+	tableNames := make([]string, 0, len(orm.models))
+	for tableName := range orm.models {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	models := make([]interface{}, 0, len(tableNames))
+	for _, tableName := range tableNames {
+		models = append(models, reflect.New(orm.models[tableName]).Interface())
+	}
+
+	return NewMigrationGenerator(migrationsDir).FromModels(orm.db, orm.adapter, name, models...)
+}
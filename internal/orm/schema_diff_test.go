@@ -0,0 +1,130 @@
+package orm
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+type DiffWidget struct {
+	ID       int64  `gor:"primary_key;auto_increment"`
+	Name     string `gor:"not_null"`
+	Sku      string `gor:"unique"`
+	Price    int64  `gor:"not_null;default:0"`
+	Category string `gor:"index"`
+}
+
+func (w *DiffWidget) TableName() string { return "diff_widgets" }
+
+func TestDiffModels_MissingTable(t *testing.T) {
+	_, db, _ := setupTestMigrator(t)
+
+	diff, err := DiffModels(db, NewSQLiteAdapter(), &DiffWidget{})
+	if err != nil {
+		t.Fatalf("DiffModels() error = %v", err)
+	}
+
+	if len(diff.Up) != 2 {
+		t.Fatalf("Up = %v, want CREATE TABLE and CREATE INDEX", diff.Up)
+	}
+	if !strings.HasPrefix(diff.Up[0], "CREATE TABLE IF NOT EXISTS diff_widgets") {
+		t.Errorf("Up[0] = %q, want CREATE TABLE", diff.Up[0])
+	}
+	if diff.Up[1] != "CREATE INDEX idx_diff_widgets_category ON diff_widgets (category);" {
+		t.Errorf("Up[1] = %q", diff.Up[1])
+	}
+	if len(diff.Down) != 1 || diff.Down[0] != "DROP TABLE diff_widgets;" {
+		t.Errorf("Down = %v, want DROP TABLE", diff.Down)
+	}
+}
+
+func TestDiffModels_ChangedTable(t *testing.T) {
+	_, db, _ := setupTestMigrator(t)
+
+	if _, err := db.Exec("CREATE TABLE diff_widgets (id INTEGER PRIMARY KEY AUTOINCREMENT, name INTEGER NOT NULL, legacy TEXT)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	diff, err := DiffModels(db, NewSQLiteAdapter(), &DiffWidget{})
+	if err != nil {
+		t.Fatalf("DiffModels() error = %v", err)
+	}
+
+	up := strings.Join(diff.Up, "\n")
+	expected := []string{
+		"ALTER TABLE diff_widgets ADD COLUMN sku TEXT;",
+		"ALTER TABLE diff_widgets ADD COLUMN price INTEGER NOT NULL DEFAULT 0;",
+		"ALTER TABLE diff_widgets ADD COLUMN category TEXT;",
+		"CREATE INDEX idx_diff_widgets_category ON diff_widgets (category);",
+		"CREATE UNIQUE INDEX idx_diff_widgets_sku ON diff_widgets (sku);",
+		"-- diff_widgets.name type changed from INTEGER to TEXT",
+		"-- diff_widgets.legacy exists in the database but is not mapped by the model",
+	}
+	for _, statement := range expected {
+		if !strings.Contains(up, statement) {
+			t.Errorf("Up is missing %q:\n%s", statement, up)
+		}
+	}
+
+	if diff.Down[0] != "DROP INDEX idx_diff_widgets_sku;" {
+		t.Errorf("Down[0] = %q, want the last change undone first", diff.Down[0])
+	}
+
+	// The generated statements must apply cleanly
+	for _, statement := range diff.Up {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to apply %q: %v", statement, err)
+		}
+	}
+
+	diff, err = DiffModels(db, NewSQLiteAdapter(), &DiffWidget{})
+	if err != nil {
+		t.Fatalf("DiffModels() error = %v", err)
+	}
+	for _, statement := range diff.Up {
+		if !strings.HasPrefix(statement, "--") {
+			t.Errorf("unexpected statement after applying diff: %q", statement)
+		}
+	}
+}
+
+func TestMigrationGenerator_FromModels(t *testing.T) {
+	migrator, db, dir := setupTestMigrator(t)
+	generator := NewMigrationGenerator(dir)
+
+	path, err := generator.FromModels(db, NewSQLiteAdapter(), "create_diff_widgets", &DiffWidget{})
+	if err != nil {
+		t.Fatalf("FromModels() error = %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read generated migration: %v", err)
+	}
+	if !strings.Contains(string(content), "-- +up\nCREATE TABLE IF NOT EXISTS diff_widgets") {
+		t.Errorf("unexpected migration content:\n%s", content)
+	}
+
+	if err := migrator.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if !tableExistsIn(t, db, "diff_widgets") {
+		t.Fatal("generated migration did not create diff_widgets")
+	}
+
+	path, err = generator.FromModels(db, NewSQLiteAdapter(), "noop", &DiffWidget{})
+	if err != nil {
+		t.Fatalf("FromModels() error = %v", err)
+	}
+	if path != "" {
+		t.Errorf("FromModels() = %q, want no migration for an up-to-date schema", path)
+	}
+
+	if err := migrator.Rollback(context.Background(), 1); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if tableExistsIn(t, db, "diff_widgets") {
+		t.Error("rollback did not drop diff_widgets")
+	}
+}
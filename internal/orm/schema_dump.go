@@ -0,0 +1,404 @@
+package orm
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// The schema dump is the database's schema as the SQL the database itself
+// reports for it, each statement followed by a delimiter line: tables,
+// then indexes, views and triggers, followed by the versions of the
+// applied migrations. Loading it builds the same database as replaying
+// every migration, only faster.
+
+// DefaultSchemaPath is where the migrator dumps the schema after migrating
+const DefaultSchemaPath = "db/schema.sql"
+
+// schemaStatementDelimiter follows every statement of a dump on a line of
+// its own. Trigger and function bodies hold semicolons and blank lines, so
+// statements are split on it instead.
+const schemaStatementDelimiter = "-- gor:end"
+
+// dumpSchema writes the schema of db and its applied migrations to w
+func dumpSchema(w io.Writer, db *sql.DB, adapter gor.DatabaseAdapter) error {
+	var statements []string
+	var err error
+	switch adapter.(type) {
+	case *SQLiteAdapter:
+		statements, err = sqliteSchemaStatements(db)
+	case *PostgreSQLAdapter:
+		statements, err = postgresSchemaStatements(db)
+	case *MySQLAdapter:
+		statements, err = mysqlSchemaStatements(db)
+	default:
+		err = fmt.Errorf("adapter %T does not support schema dumps", adapter)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	versions, err := migrationVersionStatements(db, adapter)
+	if err != nil {
+		return fmt.Errorf("failed to read migration versions: %w", err)
+	}
+
+	out := bufio.NewWriter(w)
+	for _, statement := range append(statements, versions...) {
+		statement = strings.TrimSuffix(strings.TrimSpace(statement), ";")
+		if _, err := out.WriteString(statement + ";\n" + schemaStatementDelimiter + "\n\n"); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// sqliteSchemaStatements returns the statements sqlite_master recorded for
+// the schema, leaving out SQLite's internal tables and the shadow tables
+// behind full-text search indexes, which their virtual table recreates
+func sqliteSchemaStatements(db *sql.DB) ([]string, error) {
+	return queryStrings(db, `SELECT sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+			AND name NOT IN (SELECT name FROM pragma_table_list WHERE type = 'shadow')
+		ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 WHEN 'view' THEN 2 ELSE 3 END, name`)
+}
+
+// postgresSchemaQueries read the schema of PostgreSQL's current schema
+// from its catalog, in the order the statements must run. Column types,
+// defaults and constraints are printed by PostgreSQL itself; foreign keys
+// are added once every table exists.
+var postgresSchemaQueries = []string{
+	// Sequences, other than those behind identity columns
+	`SELECT format('CREATE SEQUENCE IF NOT EXISTS %I', c.relname) FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'S' AND n.nspname = current_schema()
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = c.oid AND d.deptype = 'i')
+		ORDER BY c.relname`,
+	// Functions, which defaults and triggers may call
+	`SELECT pg_get_functiondef(p.oid) FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE p.prokind = 'f' AND n.nspname = current_schema()
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = p.oid AND d.deptype = 'e')
+		ORDER BY p.proname, p.oid`,
+	`SELECT format('CREATE TABLE %I (%s)', c.relname, string_agg(
+			format('%I %s', a.attname, format_type(a.atttypid, a.atttypmod))
+			|| CASE a.attidentity WHEN 'a' THEN ' GENERATED ALWAYS AS IDENTITY' WHEN 'd' THEN ' GENERATED BY DEFAULT AS IDENTITY' ELSE '' END
+			|| CASE WHEN a.attgenerated = 's' THEN ' GENERATED ALWAYS AS (' || pg_get_expr(ad.adbin, ad.adrelid) || ') STORED'
+				WHEN ad.adbin IS NOT NULL THEN ' DEFAULT ' || pg_get_expr(ad.adbin, ad.adrelid) ELSE '' END
+			|| CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END,
+			', ' ORDER BY a.attnum))
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		LEFT JOIN pg_attrdef ad ON ad.adrelid = c.oid AND ad.adnum = a.attnum
+		WHERE c.relkind IN ('r', 'p') AND n.nspname = current_schema()
+		GROUP BY c.relname
+		ORDER BY c.relname`,
+	`SELECT format('ALTER TABLE %I ADD CONSTRAINT %I %s', c.relname, con.conname, pg_get_constraintdef(con.oid))
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE con.contype IN ('p', 'u', 'c', 'x', 'f') AND n.nspname = current_schema()
+		ORDER BY con.contype = 'f', c.relname, con.conname`,
+	`SELECT format('ALTER SEQUENCE %I OWNED BY %I.%I', s.relname, t.relname, a.attname) FROM pg_depend d
+		JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+		JOIN pg_namespace n ON n.oid = s.relnamespace
+		JOIN pg_class t ON t.oid = d.refobjid
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		WHERE d.deptype = 'a' AND n.nspname = current_schema()
+		ORDER BY s.relname`,
+	// Indexes, other than those behind constraints
+	`SELECT pg_get_indexdef(i.indexrelid) FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema()
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = i.indexrelid AND con.contype IN ('p', 'u', 'x'))
+		ORDER BY c.relname`,
+	// Views in creation order, as they may select from one another
+	`SELECT format('CREATE OR REPLACE VIEW %I AS %s', c.relname, pg_get_viewdef(c.oid, true)) FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'v' AND n.nspname = current_schema()
+		ORDER BY c.oid`,
+	`SELECT pg_get_triggerdef(t.oid, true) FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE NOT t.tgisinternal AND n.nspname = current_schema()
+		ORDER BY c.relname, t.tgname`,
+}
+
+// postgresSchemaStatements returns the statements creating the current
+// schema of a PostgreSQL database
+func postgresSchemaStatements(db *sql.DB) ([]string, error) {
+	var statements []string
+	for _, query := range postgresSchemaQueries {
+		values, err := queryStrings(db, query)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, values...)
+	}
+	return statements, nil
+}
+
+// mysqlVolatileClauses are the parts of MySQL's SHOW CREATE output that
+// describe the database's state or user rather than its schema
+var mysqlVolatileClauses = regexp.MustCompile(` AUTO_INCREMENT=\d+| DEFINER=\S+`)
+
+// mysqlSchemaStatements returns the statements MySQL's SHOW CREATE reports
+// for the tables, views and triggers of the current database. Views are
+// created or replaced, as loading a schema only drops tables.
+func mysqlSchemaStatements(db *sql.DB) ([]string, error) {
+	tables, err := queryStrings(db, `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name`)
+	if err != nil {
+		return nil, err
+	}
+	views, err := queryStrings(db, `SELECT table_name FROM information_schema.views
+		WHERE table_schema = DATABASE() ORDER BY table_name`)
+	if err != nil {
+		return nil, err
+	}
+	triggers, err := queryStrings(db, `SELECT trigger_name FROM information_schema.triggers
+		WHERE trigger_schema = DATABASE() ORDER BY event_object_table, action_order`)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &MySQLAdapter{}
+	var statements []string
+	for _, object := range []struct {
+		kind   string
+		names  []string
+		column int
+	}{{"TABLE", tables, 1}, {"VIEW", views, 1}, {"TRIGGER", triggers, 2}} {
+		for _, name := range object.names {
+			statement, err := showCreate(db, "SHOW CREATE "+object.kind+" "+d.QuoteIdentifier(name), object.column)
+			if err != nil {
+				return nil, err
+			}
+			statement = mysqlVolatileClauses.ReplaceAllString(statement, "")
+			if object.kind == "VIEW" {
+				statement = "CREATE OR REPLACE " + strings.TrimPrefix(statement, "CREATE ")
+			}
+			statements = append(statements, statement)
+		}
+	}
+	return statements, nil
+}
+
+// showCreate returns the given column of the single row of a SHOW CREATE
+// statement, whose other columns vary between MySQL versions
+func showCreate(db *sql.DB, query string, column int) (string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%s returned no rows", query)
+	}
+	values := make([]sql.NullString, len(columns))
+	holders := make([]interface{}, len(columns))
+	for i := range values {
+		holders[i] = &values[i]
+	}
+	if err := rows.Scan(holders...); err != nil {
+		return "", err
+	}
+	if column >= len(values) {
+		return "", fmt.Errorf("%s returned %d columns", query, len(values))
+	}
+	return values[column].String, nil
+}
+
+// migrationVersionStatements returns the inserts recording the applied
+// migrations. Their SQL is left out, as the tables above already hold it.
+func migrationVersionStatements(db *sql.DB, adapter gor.DatabaseAdapter) ([]string, error) {
+	migrator := NewMigrator(db, adapter)
+	if err := migrator.createMigrationsTable(); err != nil {
+		return nil, err
+	}
+	applied, err := migrator.getAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]string, 0, len(applied))
+	for _, migration := range applied {
+		statements = append(statements, fmt.Sprintf("INSERT INTO gor_migrations (version, name, sql) VALUES (%s, %s, '')",
+			quoteSQLString(migration.Version), quoteSQLString(migration.Name)))
+	}
+	return statements, nil
+}
+
+// quoteSQLString returns s as a SQL string literal
+func quoteSQLString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// loadSchema replaces the tables of db with the schema dump read from r.
+// Every statement runs in one transaction, so a dump that fails to load
+// leaves the database as it was where the database supports transactional
+// DDL.
+func loadSchema(r io.Reader, db *sql.DB, adapter gor.DatabaseAdapter) error {
+	dump, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	// The tables are listed before the transaction takes the connection
+	tables, err := schemaTables(db, adapter)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := replaceSchema(tx, adapter, tables, splitSchemaStatements(string(dump))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// splitSchemaStatements returns the statements of a schema dump, each
+// ended by a delimiter line. Text after the last delimiter is a statement
+// too, so a dump edited by hand still loads its last statement.
+func splitSchemaStatements(dump string) []string {
+	var statements []string
+	var statement strings.Builder
+	for _, line := range strings.SplitAfter(dump, "\n") {
+		if strings.TrimSpace(line) != schemaStatementDelimiter {
+			statement.WriteString(line)
+			continue
+		}
+		if text := strings.TrimSpace(statement.String()); text != "" {
+			statements = append(statements, text)
+		}
+		statement.Reset()
+	}
+	if text := strings.TrimSpace(statement.String()); text != "" {
+		statements = append(statements, text)
+	}
+	return statements
+}
+
+// replaceSchema drops tables and runs the statements of a schema dump
+// within tx. MySQL checks foreign keys as tables are dropped and created,
+// so the checks are off until every table exists.
+func replaceSchema(tx *sql.Tx, adapter gor.DatabaseAdapter, tables, statements []string) error {
+	if _, ok := adapter.(*MySQLAdapter); ok {
+		if _, err := tx.Exec("SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+			return err
+		}
+		defer func() { _, _ = tx.Exec("SET FOREIGN_KEY_CHECKS = 1") }()
+	}
+
+	if err := dropTables(tx, adapter, tables); err != nil {
+		return fmt.Errorf("failed to drop existing tables: %w", err)
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to load schema statement %q: %w", firstLine(statement), err)
+		}
+	}
+	return nil
+}
+
+// schemaTables returns the tables of db that loading a schema replaces
+func schemaTables(db *sql.DB, adapter gor.DatabaseAdapter) ([]string, error) {
+	if _, ok := adapter.(*SQLiteAdapter); ok {
+		// Dropping a virtual table drops its shadow tables
+		return queryStrings(db, `SELECT name FROM sqlite_master
+			WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+				AND name NOT IN (SELECT name FROM pragma_table_list WHERE type = 'shadow')
+			ORDER BY name`)
+	}
+
+	inspector, err := introspectorFor(adapter)
+	if err != nil {
+		return nil, err
+	}
+	return inspector.TableNames(db)
+}
+
+// dropTables drops tables within tx, whatever foreign keys reference them.
+// On MySQL the caller turns foreign key checks off.
+func dropTables(tx *sql.Tx, adapter gor.DatabaseAdapter, tables []string) error {
+	suffix := ""
+	switch adapter.(type) {
+	case *SQLiteAdapter:
+		if _, err := tx.Exec("PRAGMA defer_foreign_keys = ON"); err != nil {
+			return err
+		}
+	case *PostgreSQLAdapter:
+		suffix = " CASCADE"
+	}
+
+	d := dialectFor(adapter)
+	for _, table := range tables {
+		if _, err := tx.Exec("DROP TABLE IF EXISTS " + d.QuoteIdentifier(table) + suffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstLine returns the first line of statement, to name it in errors
+func firstLine(statement string) string {
+	statement = strings.TrimSpace(statement)
+	if i := strings.IndexByte(statement, '\n'); i >= 0 {
+		return statement[:i]
+	}
+	return statement
+}
+
+// writeSchemaFile dumps the schema of db to path. Nothing is written when
+// the directory of path does not exist, so applications without a db
+// directory are left alone.
+func writeSchemaFile(path string, db *sql.DB, adapter gor.DatabaseAdapter) error {
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := dumpSchema(&buf, db, adapter); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil { // #nosec G306 - The schema dump is checked in like migrations
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// DumpSchema writes the database's schema and applied migration versions
+// to w
+func (o *gorORM) DumpSchema(w io.Writer) error {
+	return dumpSchema(w, o.db, o.adapter)
+}
+
+// LoadSchema replaces the database's tables with the schema dump read from
+// r, as written by DumpSchema
+func (o *gorORM) LoadSchema(r io.Reader) error {
+	return loadSchema(r, o.db, o.adapter)
+}
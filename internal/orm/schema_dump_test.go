@@ -0,0 +1,149 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSchemaDump_WrittenAfterMigrateAndLoaded(t *testing.T) {
+	migrator, db, dir := setupTestMigrator(t)
+	schemaPath := filepath.Join(t.TempDir(), "schema.sql")
+	migrator.SetSchemaPath(schemaPath)
+
+	writeMigrationFile(t, dir, "20240101000001_create_widgets.sql",
+		"-- +up\nCREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT NOT NULL);\nCREATE INDEX idx_widgets_name ON widgets (name);\n-- +down\nDROP TABLE widgets;\n")
+	writeMigrationFile(t, dir, "20240101000002_create_gadgets.sql",
+		"-- +up\nCREATE TABLE gadgets (id INTEGER PRIMARY KEY, widget_id INTEGER REFERENCES widgets (id));\n-- +down\nDROP TABLE gadgets;\n")
+
+	if err := migrator.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	dump, err := os.ReadFile(schemaPath)
+	if err != nil {
+		t.Fatalf("Migrate() did not write the schema: %v", err)
+	}
+	want := strings.Join([]string{
+		"CREATE TABLE gadgets (id INTEGER PRIMARY KEY, widget_id INTEGER REFERENCES widgets (id));",
+		"CREATE TABLE gor_migrations (",
+		"CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT NOT NULL);",
+		"CREATE INDEX idx_widgets_name ON widgets (name);",
+		"INSERT INTO gor_migrations (version, name, sql) VALUES ('20240101000001', 'create_widgets', '');",
+		"INSERT INTO gor_migrations (version, name, sql) VALUES ('20240101000002', 'create_gadgets', '');",
+	}, "\n")
+	var got []string
+	for _, statement := range strings.Split(strings.TrimSpace(string(dump)), "\n\n") {
+		got = append(got, strings.SplitN(statement, "\n", 2)[0])
+	}
+	if strings.Join(got, "\n") != want {
+		t.Errorf("schema dump =\n%s\nwant statements starting with\n%s", dump, want)
+	}
+
+	// Loading replaces whatever tables the database holds
+	loaded, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.SetMaxOpenConns(1)
+	t.Cleanup(func() { loaded.Close() })
+	if _, err := loaded.Exec("CREATE TABLE widgets (stale TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	adapter := NewSQLiteAdapter()
+	if err := loadSchema(bytes.NewReader(dump), loaded, adapter); err != nil {
+		t.Fatalf("loadSchema() error = %v", err)
+	}
+	var reloaded bytes.Buffer
+	if err := dumpSchema(&reloaded, loaded, adapter); err != nil {
+		t.Fatalf("dumpSchema() error = %v", err)
+	}
+	if reloaded.String() != string(dump) {
+		t.Errorf("dump of the loaded schema =\n%s\nwant\n%s", reloaded.String(), dump)
+	}
+
+	// The loaded database counts the migrations as applied
+	status, err := NewMigrator(loaded, adapter).Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(status) != 2 || status[1].Version != "20240101000002" || status[1].AppliedAt.IsZero() {
+		t.Errorf("Status() = %+v, want both migrations applied", status)
+	}
+
+	// Rolling back refreshes the dump
+	if err := migrator.Rollback(context.Background(), 1); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if dump, _ := os.ReadFile(schemaPath); strings.Contains(string(dump), "gadgets") {
+		t.Errorf("schema dump after Rollback() =\n%s\nwant gadgets gone", dump)
+	}
+	if !tableExistsIn(t, db, "widgets") {
+		t.Error("Rollback() should keep widgets")
+	}
+}
+
+func TestSchemaDump_SkipsMissingDirectory(t *testing.T) {
+	migrator, _, _ := setupTestMigrator(t)
+	schemaPath := filepath.Join(t.TempDir(), "db", "schema.sql")
+	migrator.SetSchemaPath(schemaPath)
+
+	if err := migrator.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if _, err := os.Stat(schemaPath); !os.IsNotExist(err) {
+		t.Errorf("Migrate() wrote %s without a db directory", schemaPath)
+	}
+}
+
+func TestSchemaDump_KeepsStatementsWithBlankLines(t *testing.T) {
+	_, db, _ := setupTestMigrator(t)
+	statements := []string{
+		"CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT NOT NULL DEFAULT 'unnamed')",
+		"CREATE TABLE widget_log (widget_id INTEGER, note TEXT)",
+		"CREATE TRIGGER widgets_logged AFTER INSERT ON widgets BEGIN\n  INSERT INTO widget_log (widget_id, note) VALUES (new.id, 'created');\n\n  INSERT INTO widget_log (widget_id, note) VALUES (new.id, 'named');\nEND",
+		"CREATE VIEW named_widgets AS SELECT id,\n\n  name FROM widgets WHERE name <> 'unnamed'",
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	adapter := NewSQLiteAdapter()
+	var dump bytes.Buffer
+	if err := dumpSchema(&dump, db, adapter); err != nil {
+		t.Fatalf("dumpSchema() error = %v", err)
+	}
+
+	loaded, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.SetMaxOpenConns(1)
+	t.Cleanup(func() { loaded.Close() })
+	if err := loadSchema(bytes.NewReader(dump.Bytes()), loaded, adapter); err != nil {
+		t.Fatalf("loadSchema() error = %v\n%s", err, dump.String())
+	}
+
+	if _, err := loaded.Exec("INSERT INTO widgets (id) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	var logged int
+	if err := loaded.QueryRow("SELECT name, (SELECT COUNT(*) FROM widget_log) FROM widgets").Scan(&name, &logged); err != nil {
+		t.Fatal(err)
+	}
+	if name != "unnamed" || logged != 2 {
+		t.Errorf("loaded schema gave name %q and %d log rows, want the default and both trigger statements", name, logged)
+	}
+	var named int
+	if err := loaded.QueryRow("SELECT COUNT(*) FROM named_widgets").Scan(&named); err != nil || named != 0 {
+		t.Errorf("named_widgets count = %d, %v; want the view loaded and empty", named, err)
+	}
+}
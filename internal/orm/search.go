@@ -0,0 +1,192 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"reflect"
+	"strings"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// Full-text search keeps an FTS5 index of the fields tagged searchable:
+//
+//	type Article struct {
+//		ID    int64  `gor:"primary_key;auto_increment"`
+//		Title string `gor:"searchable"`
+//		Body  string `gor:"searchable"`
+//	}
+//
+// The index is the external-content table <table>_fts, kept in sync with
+// the model's table by triggers, so every write path including raw SQL
+// updates it. It is only available on SQLite, whose driver must be built
+// with the sqlite_fts5 tag.
+
+// Markers placed around matches by snippet(), replaced with <mark> tags
+// once the snippet is escaped
+const (
+	searchMatchStart = "\x02"
+	searchMatchEnd   = "\x03"
+)
+
+// searchTable returns the name of the FTS5 table indexing table
+func searchTable(table string) string {
+	return table + "_fts"
+}
+
+// searchColumns returns the columns of modelType tagged searchable
+func searchColumns(modelType reflect.Type) []string {
+	var columns []string
+	for _, field := range schemaOf(modelType).Searchable {
+		columns = append(columns, field.Column)
+	}
+	return columns
+}
+
+// createSearchIndexSQL creates the FTS5 table over the given columns of
+// table and the triggers that keep it in sync
+func createSearchIndexSQL(table string, columns []string) string {
+	index := searchTable(table)
+	list := strings.Join(columns, ", ")
+	newValues := "new." + strings.Join(columns, ", new.")
+	oldValues := "old." + strings.Join(columns, ", old.")
+
+	statements := []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, content='%s', content_rowid='id');", index, list, table),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ai AFTER INSERT ON %s BEGIN INSERT INTO %s(rowid, %s) VALUES (new.id, %s); END;",
+			index, table, index, list, newValues),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ad AFTER DELETE ON %s BEGIN INSERT INTO %s(%s, rowid, %s) VALUES ('delete', old.id, %s); END;",
+			index, table, index, index, list, oldValues),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_au AFTER UPDATE ON %s BEGIN INSERT INTO %s(%s, rowid, %s) VALUES ('delete', old.id, %s); INSERT INTO %s(rowid, %s) VALUES (new.id, %s); END;",
+			index, table, index, index, list, oldValues, index, list, newValues),
+	}
+	return strings.Join(statements, "\n")
+}
+
+// dropSearchIndexSQL drops the FTS5 table of table and its triggers
+func dropSearchIndexSQL(table string) string {
+	index := searchTable(table)
+	return fmt.Sprintf("DROP TRIGGER IF EXISTS %s_au;\nDROP TRIGGER IF EXISTS %s_ad;\nDROP TRIGGER IF EXISTS %s_ai;\nDROP TABLE IF EXISTS %s;",
+		index, index, index, index)
+}
+
+// rebuildSearchIndexSQL reindexes every row of table, for indexes created
+// over a table that already holds rows
+func rebuildSearchIndexSQL(table string) string {
+	index := searchTable(table)
+	return fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild');", index, index)
+}
+
+// createSearchIndex creates the search index of a registered model that
+// does not have one yet and indexes the rows already in its table
+func (o *gorORM) createSearchIndex(t reflect.Type) error {
+	columns := searchColumns(t)
+	if len(columns) == 0 {
+		return nil
+	}
+	if _, ok := o.adapter.(*SQLiteAdapter); !ok {
+		return fmt.Errorf("searchable fields require SQLite")
+	}
+	for _, field := range schemaOf(t).Searchable {
+		if field.HasOption("encrypted") {
+			return fmt.Errorf("%s cannot be both encrypted and searchable", field.Name)
+		}
+	}
+
+	table := getTableName(t)
+	exists, err := o.tableExists(searchTable(table))
+	if err != nil || exists {
+		return err
+	}
+
+	if _, err := o.exec().Exec(createSearchIndexSQL(table, columns) + "\n" + rebuildSearchIndexSQL(table)); err != nil {
+		return fmt.Errorf("failed to create search index (is SQLite built with the sqlite_fts5 tag?): %w", err)
+	}
+	return nil
+}
+
+// diffSearchIndex adds the statements that create, rebuild or drop the
+// search index of table so it covers columns, the searchable columns of
+// its model
+func diffSearchIndex(diff *SchemaDiff, inspector schemaIntrospector, db *sql.DB, table string, columns []string, existing map[string]bool) error {
+	index := searchTable(table)
+
+	var live []string
+	if existing[index] {
+		liveColumns, err := inspector.TableColumns(db, index)
+		if err != nil {
+			return err
+		}
+		for _, column := range liveColumns {
+			live = append(live, column.Name)
+		}
+	}
+
+	switch {
+	case strings.Join(live, ",") == strings.Join(columns, ","):
+	case len(live) == 0:
+		diff.add(createSearchIndexSQL(table, columns)+"\n"+rebuildSearchIndexSQL(table), dropSearchIndexSQL(table))
+	case len(columns) == 0:
+		diff.add(dropSearchIndexSQL(table), createSearchIndexSQL(table, live)+"\n"+rebuildSearchIndexSQL(table))
+	default:
+		diff.add(dropSearchIndexSQL(table)+"\n"+createSearchIndexSQL(table, columns)+"\n"+rebuildSearchIndexSQL(table),
+			dropSearchIndexSQL(table)+"\n"+createSearchIndexSQL(table, live)+"\n"+rebuildSearchIndexSQL(table))
+	}
+	return nil
+}
+
+// Search matches rows whose searchable columns match query, best matches
+// first. The query uses FTS5 syntax, so it may hold phrases in quotes,
+// prefixes such as "data*" and the AND, OR and NOT operators.
+func (qb *QueryBuilder) Search(query string) gor.QueryBuilder {
+	if _, ok := qb.adapter.(*SQLiteAdapter); !ok {
+		qb.setErr(fmt.Errorf("Search: full-text search requires SQLite"))
+		return qb
+	}
+	if qb.modelType == nil || len(schemaOf(qb.modelType).Searchable) == 0 {
+		qb.setErr(fmt.Errorf("Search: %s has no searchable fields", qb.tableName))
+		return qb
+	}
+
+	d := dialectFor(qb.adapter)
+	table := d.QuoteIdentifier(qb.tableName)
+	index := d.QuoteIdentifier(searchTable(qb.tableName))
+
+	qb.joins = append(qb.joins, fmt.Sprintf("JOIN %s ON %s.rowid = %s.%s", index, index, table, d.QuoteIdentifier("id")))
+	qb.Where(index+" MATCH ?", query)
+	if len(qb.selects) == 0 {
+		qb.selects = []string{
+			table + ".*",
+			fmt.Sprintf("bm25(%s) AS search_rank", index),
+			fmt.Sprintf("snippet(%s, -1, '%s', '%s', '…', 16) AS search_snippet", index, searchMatchStart, searchMatchEnd),
+		}
+	}
+	qb.orderBy = append(qb.orderBy, fmt.Sprintf("bm25(%s)", index))
+	return qb
+}
+
+// setSearchResult hands the rank and snippet a search selected for a row
+// to models embedding gor.SearchHit
+func setSearchResult(elem reflect.Value, extra map[string]interface{}) {
+	result, ok := elem.Addr().Interface().(gor.SearchResult)
+	if !ok {
+		return
+	}
+	if _, searched := extra["search_rank"]; !searched {
+		return
+	}
+
+	rank, _ := extra["search_rank"].(float64)
+	var snippet string
+	switch v := extra["search_snippet"].(type) {
+	case string:
+		snippet = v
+	case []byte:
+		snippet = string(v)
+	}
+
+	snippet = html.EscapeString(snippet)
+	snippet = strings.NewReplacer(searchMatchStart, "<mark>", searchMatchEnd, "</mark>").Replace(snippet)
+	result.SetSearchResult(rank, snippet)
+}
@@ -0,0 +1,121 @@
+package orm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type SearchArticle struct {
+	ID    int64  `gor:"primary_key;auto_increment"`
+	Title string `gor:"not_null;searchable"`
+	Body  string `gor:"not_null;searchable"`
+	Draft bool   `gor:"not_null"`
+
+	gor.SearchHit
+}
+
+func (a *SearchArticle) TableName() string { return "search_articles" }
+
+// requireFTS5 skips tests when the SQLite driver was built without FTS5,
+// which needs the sqlite_fts5 build tag
+func requireFTS5(t *testing.T, orm gor.ORM) {
+	t.Helper()
+	var enabled bool
+	if err := orm.DB().QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil || !enabled {
+		t.Skip("SQLite is built without FTS5; run with -tags sqlite_fts5")
+	}
+}
+
+func TestSearch_RanksAndHighlightsMatches(t *testing.T) {
+	orm := setupTestORM(t)
+	requireFTS5(t, orm)
+	if err := orm.Register(&SearchArticle{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	articles := []*SearchArticle{
+		{Title: "Gardening", Body: "Tomatoes need sun and a little <b>patience</b>"},
+		{Title: "Databases", Body: "Indexes make database queries fast"},
+		{Title: "Database internals", Body: "How a database stores pages on disk"},
+	}
+	for _, article := range articles {
+		if err := orm.Create(article); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	var results []SearchArticle
+	if err := orm.Query(&SearchArticle{}).Search("database").FindAll(&results); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 2 || results[0].ID != articles[2].ID {
+		t.Fatalf("Search() = %+v, want both database articles, internals first", results)
+	}
+	if results[0].SearchRank() >= 0 || results[0].SearchRank() > results[1].SearchRank() {
+		t.Errorf("ranks = %v, %v; want ascending bm25 ranks", results[0].SearchRank(), results[1].SearchRank())
+	}
+	if !strings.Contains(results[0].SearchSnippet(), "<mark>Database</mark>") {
+		t.Errorf("SearchSnippet() = %q, want the match highlighted", results[0].SearchSnippet())
+	}
+
+	var first SearchArticle
+	if err := orm.Query(&SearchArticle{}).Search("patience").First(&first); err != nil {
+		t.Fatalf("First() error = %v", err)
+	}
+	if !strings.Contains(first.SearchSnippet(), "&lt;b&gt;<mark>patience</mark>&lt;/b&gt;") {
+		t.Errorf("SearchSnippet() = %q, want the text escaped", first.SearchSnippet())
+	}
+
+	// Triggers keep the index in sync with updates and deletes
+	articles[0].Body = "Tomatoes grow well next to a database server"
+	if err := orm.Update(articles[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.Delete(articles[1]); err != nil {
+		t.Fatal(err)
+	}
+	count, err := orm.Query(&SearchArticle{}).Where("draft = ?", false).Search("database").Count()
+	if err != nil || count != 2 {
+		t.Errorf("Count() after changes = %d, %v; want 2", count, err)
+	}
+	if count, _ := orm.Query(&SearchArticle{}).Search("patience").Count(); count != 0 {
+		t.Errorf("Count() of replaced text = %d, want 0", count)
+	}
+}
+
+func TestSearch_RequiresSearchableFields(t *testing.T) {
+	orm := setupTestORM(t)
+
+	if _, err := orm.Query(&TestUser{}).Search("ada").Count(); err == nil {
+		t.Error("Search() on a model without searchable fields should fail")
+	}
+}
+
+func TestDiffModels_SearchIndex(t *testing.T) {
+	_, db, _ := setupTestMigrator(t)
+
+	if _, err := db.Exec("CREATE TABLE search_articles (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT NOT NULL, body TEXT NOT NULL, draft INTEGER NOT NULL)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	diff, err := DiffModels(db, NewSQLiteAdapter(), &SearchArticle{})
+	if err != nil {
+		t.Fatalf("DiffModels() error = %v", err)
+	}
+
+	up := strings.Join(diff.Up, "\n")
+	for _, want := range []string{
+		"CREATE VIRTUAL TABLE IF NOT EXISTS search_articles_fts USING fts5(title, body, content='search_articles', content_rowid='id');",
+		"CREATE TRIGGER IF NOT EXISTS search_articles_fts_au AFTER UPDATE ON search_articles",
+		"INSERT INTO search_articles_fts(search_articles_fts) VALUES ('rebuild');",
+	} {
+		if !strings.Contains(up, want) {
+			t.Errorf("Up missing %q:\n%s", want, up)
+		}
+	}
+	if down := strings.Join(diff.Down, "\n"); !strings.Contains(down, "DROP TABLE IF EXISTS search_articles_fts;") {
+		t.Errorf("Down = %q, want the search index dropped", down)
+	}
+}
@@ -0,0 +1,392 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// DefaultSeedsDir is where the seeder looks for YAML seed files
+const DefaultSeedsDir = "db/seeds"
+
+// SeedFunc loads one seed. Seeds run on every `gor db seed`, so they
+// should be idempotent, for instance by using FindOrCreateBy.
+type SeedFunc func(ctx context.Context, o gor.ORM) error
+
+// SeedFactory builds models from named factory definitions, such as the
+// *testing.Factory of internal/testing
+type SeedFactory interface {
+	Build(name string, overrides ...map[string]interface{}) (interface{}, error)
+}
+
+// seed is a loaded seed, from the registry or a YAML file
+type seed struct {
+	name string
+	run  func(ctx context.Context, s *Seeder) error
+}
+
+var (
+	seedRegistryMu  sync.Mutex
+	registeredSeeds = make(map[string]map[string]SeedFunc) // environment -> name -> seed
+)
+
+// RegisterSeed registers a Go seed for env, or for every environment when
+// env is empty. It is meant to be called from init() in db/seeds files.
+// Seeds run in name order, so names usually start with a number, e.g.
+// "010_admin_user".
+func RegisterSeed(env, name string, fn SeedFunc) {
+	seedRegistryMu.Lock()
+	defer seedRegistryMu.Unlock()
+
+	if fn == nil {
+		panic("orm: RegisterSeed function is nil for seed " + name)
+	}
+	if registeredSeeds[env] == nil {
+		registeredSeeds[env] = make(map[string]SeedFunc)
+	}
+	if _, dup := registeredSeeds[env][name]; dup {
+		panic("orm: RegisterSeed called twice for seed " + name)
+	}
+	registeredSeeds[env][name] = fn
+}
+
+// Seeder loads the seeds of one environment: first the seeds shared by
+// every environment, registered with an empty environment or kept in
+// db/seeds/*.yml, then those of the environment, registered for it or kept
+// in db/seeds/<env>/*.yml. Within each group seeds run in name order.
+type Seeder struct {
+	orm        gor.ORM
+	env        string
+	dir        string
+	schemaPath string
+	factory    SeedFactory
+}
+
+// NewSeeder creates a seeder loading the seeds of env into o
+func NewSeeder(o gor.ORM, env string) *Seeder {
+	return &Seeder{
+		orm:        o,
+		env:        env,
+		dir:        DefaultSeedsDir,
+		schemaPath: DefaultSchemaPath,
+	}
+}
+
+// SetSeedsDir changes the directory YAML seed files are loaded from
+func (s *Seeder) SetSeedsDir(dir string) {
+	s.dir = dir
+}
+
+// SetSchemaPath changes the schema dump Reset loads
+func (s *Seeder) SetSchemaPath(path string) {
+	s.schemaPath = path
+}
+
+// SetFactory sets the factory YAML seeds with a factory key build rows
+// with
+func (s *Seeder) SetFactory(factory SeedFactory) {
+	s.factory = factory
+}
+
+// Run loads every seed of the environment
+func (s *Seeder) Run(ctx context.Context) error {
+	for _, env := range []string{"", s.env} {
+		seeds, err := s.loadSeeds(env)
+		if err != nil {
+			return err
+		}
+		for _, seed := range seeds {
+			if err := seed.run(ctx, s); err != nil {
+				return fmt.Errorf("failed to run seed %s: %w", seed.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Reset replaces the database's tables with the schema dump and loads the
+// seeds, leaving a fresh database
+func (s *Seeder) Reset(ctx context.Context) error {
+	schema, err := os.Open(s.schemaPath)
+	if err != nil {
+		return fmt.Errorf("failed to open schema: %w", err)
+	}
+	defer schema.Close()
+
+	if err := s.orm.LoadSchema(schema); err != nil {
+		return err
+	}
+	return s.Run(ctx)
+}
+
+// loadSeeds returns the registered and YAML seeds of env, sorted by name.
+// The empty environment loads the shared seeds.
+func (s *Seeder) loadSeeds(env string) ([]seed, error) {
+	byName := make(map[string]seed)
+
+	seedRegistryMu.Lock()
+	for name, fn := range registeredSeeds[env] {
+		byName[name] = seed{name: name, run: func(ctx context.Context, s *Seeder) error {
+			return fn(ctx, s.orm.WithContext(ctx))
+		}}
+	}
+	seedRegistryMu.Unlock()
+
+	dir := s.dir
+	if env != "" {
+		dir = filepath.Join(s.dir, env)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read seeds directory %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if _, dup := byName[name]; dup {
+			return nil, fmt.Errorf("seed %s is both registered and in %s", name, dir)
+		}
+		path := filepath.Join(dir, entry.Name())
+		byName[name] = seed{name: name, run: func(ctx context.Context, s *Seeder) error {
+			return s.runYAML(ctx, path)
+		}}
+	}
+
+	seeds := make([]seed, 0, len(byName))
+	for _, seed := range byName {
+		seeds = append(seeds, seed)
+	}
+	sort.Slice(seeds, func(i, j int) bool {
+		return seeds[i].name < seeds[j].name
+	})
+	return seeds, nil
+}
+
+// yamlSeed is a YAML seed file: the rows of one model's table,
+//
+//	model: users
+//	factory: user
+//	find_by: [email]
+//	rows:
+//	  - email: admin@example.com
+//	    name: Admin
+//
+// model is the table of a registered model. Rows found by their find_by
+// columns, or by all their columns without find_by, are left alone; the
+// others are created, built by the named factory when there is one.
+type yamlSeed struct {
+	Model   string                   `yaml:"model"`
+	Factory string                   `yaml:"factory"`
+	FindBy  []string                 `yaml:"find_by"`
+	Rows    []map[string]interface{} `yaml:"rows"`
+}
+
+// runYAML loads the rows of a YAML seed file in one transaction
+func (s *Seeder) runYAML(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - Seed files come from the application's seeds directory
+	if err != nil {
+		return err
+	}
+
+	var file yamlSeed
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid seed file %s: %w", path, err)
+	}
+	modelType, ok := modelTypeForTable(file.Model)
+	if !ok {
+		return fmt.Errorf("seed file %s: %q is not a registered model table", path, file.Model)
+	}
+	if file.Factory != "" && s.factory == nil {
+		return fmt.Errorf("seed file %s uses factory %q but the seeder has no factory", path, file.Factory)
+	}
+
+	return s.orm.Transaction(ctx, func(tx gor.Transaction) error {
+		for i, row := range file.Rows {
+			model, err := s.buildRow(modelType, file.Factory, row)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", i+1, err)
+			}
+
+			findBy := file.FindBy
+			if len(findBy) == 0 {
+				for column := range row {
+					findBy = append(findBy, column)
+				}
+			}
+			conditions, err := columnConditions(model, findBy)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", i+1, err)
+			}
+			if _, err := FindOrCreateBy(tx, model, conditions); err != nil {
+				return fmt.Errorf("row %d: %w", i+1, err)
+			}
+		}
+		return nil
+	})
+}
+
+// buildRow returns a new model of modelType, built by factory when given,
+// with the columns of row set
+func (s *Seeder) buildRow(modelType reflect.Type, factory string, row map[string]interface{}) (interface{}, error) {
+	model := reflect.New(modelType).Interface()
+	if factory != "" {
+		built, err := s.factory.Build(factory)
+		if err != nil {
+			return nil, err
+		}
+		if reflect.TypeOf(built) != reflect.PtrTo(modelType) {
+			return nil, fmt.Errorf("factory %q builds %T, not *%s", factory, built, modelType.Name())
+		}
+		model = built
+	}
+
+	if err := setColumns(model, row); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// setColumns sets the fields of model mapped to the given columns.
+// Values that do not convert to the field's type, such as maps for JSON
+// fields, are converted through JSON; strings set JSON fields to the
+// document they encode.
+func setColumns(model interface{}, values map[string]interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(model))
+	schema := schemaOf(v.Type())
+
+	for column, value := range values {
+		field := schema.FieldByColumn(column)
+		if field == nil {
+			return fmt.Errorf("%s has no %s column", v.Type().Name(), column)
+		}
+
+		target := v.FieldByIndex(field.Index)
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		if text, ok := value.(string); ok && field.HasOption("json") {
+			// A string is the stored encoding of a JSON field
+			if err := json.Unmarshal([]byte(text), target.Addr().Interface()); err != nil {
+				return fmt.Errorf("cannot set %s: %w", column, err)
+			}
+			continue
+		}
+
+		rv := reflect.ValueOf(value)
+		if target.Kind() == reflect.String && rv.Kind() != reflect.String {
+			// Converting a number to a string would make it a rune
+			target.SetString(fmt.Sprint(value))
+			continue
+		}
+		if rv.Type().ConvertibleTo(target.Type()) && !field.HasOption("json") {
+			target.Set(rv.Convert(target.Type()))
+			continue
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("cannot set %s: %w", column, err)
+		}
+		if err := json.Unmarshal(encoded, target.Addr().Interface()); err != nil {
+			return fmt.Errorf("cannot set %s from %v: %w", column, value, err)
+		}
+	}
+	return nil
+}
+
+// columnConditions returns the values of model for the given columns
+func columnConditions(model interface{}, columns []string) (map[string]interface{}, error) {
+	names, values := modelValues(model, false)
+	byColumn := make(map[string]interface{}, len(names))
+	for i, column := range names {
+		byColumn[column] = values[i]
+	}
+
+	conditions := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		value, ok := byColumn[column]
+		if !ok {
+			return nil, fmt.Errorf("cannot find by %s", column)
+		}
+		conditions[column] = value
+	}
+	return conditions, nil
+}
+
+// FindOrCreateBy loads into model the first record matching conditions, a
+// map of column to value, or creates model with the conditions set when
+// there is none. It reports whether model was created.
+//
+//	admin := &User{Name: "Admin"}
+//	created, err := orm.FindOrCreateBy(db, admin, map[string]interface{}{"email": "admin@example.com"})
+func FindOrCreateBy(store recordStore, model interface{}, conditions map[string]interface{}) (bool, error) {
+	found, err := FindOrInitializeBy(store, model, conditions)
+	if err != nil || found {
+		return false, err
+	}
+	if err := store.Create(model); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FindOrInitializeBy loads into model the first record matching
+// conditions, or sets the conditions on model without saving it when
+// there is none. It reports whether a record was found.
+func FindOrInitializeBy(store recordStore, model interface{}, conditions map[string]interface{}) (bool, error) {
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return false, fmt.Errorf("model must be a pointer to a struct")
+	}
+
+	// The conditions are set first, so they are compared converted to the
+	// column's type, e.g. encoded as JSON
+	if err := setColumns(model, conditions); err != nil {
+		return false, err
+	}
+	columns := make([]string, 0, len(conditions))
+	for column := range conditions {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	stored, err := columnConditions(model, columns)
+	if err != nil {
+		return false, err
+	}
+
+	query := store.Query(model)
+	for _, column := range columns {
+		if stored[column] == nil {
+			query = query.Where(column + " IS NULL")
+		} else {
+			query = query.Where(column+" = ?", stored[column])
+		}
+	}
+
+	record := reflect.New(v.Elem().Type())
+	if err := query.First(record.Interface()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	v.Elem().Set(record.Elem())
+	return true, nil
+}
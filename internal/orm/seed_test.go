@@ -0,0 +1,194 @@
+package orm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gortest "github.com/cuemby/gor/internal/testing"
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type SeedUser struct {
+	ID          int64  `gor:"primary_key;auto_increment"`
+	Email       string `gor:"not_null;unique"`
+	Name        string
+	Role        string
+	Preferences map[string]interface{} `gor:"json"`
+}
+
+func (u *SeedUser) TableName() string { return "seed_users" }
+
+func writeSeedFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write seed %s: %v", name, err)
+	}
+}
+
+func registerTestSeed(t *testing.T, env, name string, fn SeedFunc) {
+	RegisterSeed(env, name, fn)
+	t.Cleanup(func() {
+		seedRegistryMu.Lock()
+		delete(registeredSeeds[env], name)
+		seedRegistryMu.Unlock()
+	})
+}
+
+func countSeedUsers(t *testing.T, orm gor.ORM) int64 {
+	t.Helper()
+	count, err := orm.Query(&SeedUser{}).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func setupSeeder(t *testing.T) (gor.ORM, *Seeder) {
+	orm := setupTestORM(t)
+	if err := orm.Register(&SeedUser{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	dir := t.TempDir()
+	writeSeedFile(t, dir, "010_admins.yml", `
+model: seed_users
+find_by: [email]
+rows:
+  - email: admin@example.com
+    name: Admin
+    role: admin
+    preferences:
+      theme: dark
+`)
+	writeSeedFile(t, filepath.Join(dir, "development"), "020_members.yml", `
+model: seed_users
+factory: seed_user
+find_by: [email]
+rows:
+  - email: ada@example.com
+  - email: grace@example.com
+    name: Grace
+`)
+	writeSeedFile(t, filepath.Join(dir, "production"), "020_members.yml", `
+model: seed_users
+rows:
+  - email: ops@example.com
+`)
+
+	factory := gortest.NewFactory()
+	factory.Define("seed_user", &SeedUser{}, map[string]gortest.AttributeFunc{
+		"Name": gortest.FixedValue("Member"),
+		"Role": gortest.FixedValue("member"),
+	})
+
+	seeder := NewSeeder(orm, "development")
+	seeder.SetSeedsDir(dir)
+	seeder.SetFactory(factory)
+	return orm, seeder
+}
+
+func TestSeeder_RunsEnvironmentSeedsIdempotently(t *testing.T) {
+	orm, seeder := setupSeeder(t)
+
+	var ran []string
+	registerTestSeed(t, "", "015_shared", func(ctx context.Context, o gor.ORM) error {
+		// Shared seeds run in name order, before the environment's
+		if count := countSeedUsers(t, o); len(ran) == 0 && count != 1 {
+			t.Errorf("users before 015_shared = %d, want only the admin", count)
+		}
+		ran = append(ran, "015_shared")
+		return nil
+	})
+	registerTestSeed(t, "development", "030_settings", func(ctx context.Context, o gor.ORM) error {
+		ran = append(ran, "030_settings")
+		_, err := FindOrCreateBy(o, &SeedUser{Name: "Bot"}, map[string]interface{}{"email": "bot@example.com"})
+		return err
+	})
+	registerTestSeed(t, "production", "030_settings", func(ctx context.Context, o gor.ORM) error {
+		t.Error("production seeds should not run in development")
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := seeder.Run(context.Background()); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}
+	if count := countSeedUsers(t, orm); count != 4 {
+		t.Errorf("users after seeding twice = %d, want 4", count)
+	}
+	if len(ran) != 4 || ran[0] != "015_shared" || ran[1] != "030_settings" {
+		t.Errorf("seeds ran %v, want shared then development seeds, twice", ran)
+	}
+
+	var admin, ada, grace SeedUser
+	for email, user := range map[string]*SeedUser{"admin@example.com": &admin, "ada@example.com": &ada, "grace@example.com": &grace} {
+		if err := orm.Query(&SeedUser{}).Where("email = ?", email).First(user); err != nil {
+			t.Fatalf("First(%s) error = %v", email, err)
+		}
+	}
+	if admin.Role != "admin" || admin.Preferences["theme"] != "dark" {
+		t.Errorf("admin = %+v, want the YAML attributes", admin)
+	}
+	if ada.Name != "Member" || ada.Role != "member" || grace.Name != "Grace" {
+		t.Errorf("members = %+v, %+v; want factory defaults under the YAML attributes", ada, grace)
+	}
+}
+
+func TestSeeder_ResetReloadsSchemaAndSeeds(t *testing.T) {
+	orm, seeder := setupSeeder(t)
+
+	schemaPath := filepath.Join(t.TempDir(), "schema.sql")
+	schema, err := os.Create(schemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.DumpSchema(schema); err != nil {
+		t.Fatalf("DumpSchema() error = %v", err)
+	}
+	schema.Close()
+	seeder.SetSchemaPath(schemaPath)
+
+	if err := orm.Create(&SeedUser{Email: "stale@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := seeder.Reset(context.Background()); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if count := countSeedUsers(t, orm); count != 3 {
+		t.Errorf("users after Reset() = %d, want only the 3 seeded", count)
+	}
+}
+
+func TestFindOrCreateBy(t *testing.T) {
+	orm := setupTestORM(t)
+	if err := orm.Register(&SeedUser{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	first := &SeedUser{Name: "Ada"}
+	created, err := FindOrCreateBy(orm, first, map[string]interface{}{"email": "ada@example.com"})
+	if err != nil || !created || first.ID == 0 || first.Email != "ada@example.com" {
+		t.Fatalf("FindOrCreateBy() = %v, %v, %+v; want a created user", created, err, first)
+	}
+
+	again := &SeedUser{Name: "Someone else"}
+	created, err = FindOrCreateBy(orm, again, map[string]interface{}{"email": "ada@example.com"})
+	if err != nil || created || again.ID != first.ID || again.Name != "Ada" {
+		t.Errorf("FindOrCreateBy() = %v, %v, %+v; want the existing user", created, err, again)
+	}
+
+	initialized := &SeedUser{}
+	found, err := FindOrInitializeBy(orm, initialized, map[string]interface{}{"email": "new@example.com", "role": nil})
+	if err != nil || found || initialized.ID != 0 || initialized.Email != "new@example.com" {
+		t.Errorf("FindOrInitializeBy() = %v, %v, %+v; want an unsaved user", found, err, initialized)
+	}
+	if _, err := FindOrCreateBy(orm, &SeedUser{}, map[string]interface{}{"nickname": "ada"}); err == nil {
+		t.Error("FindOrCreateBy() on an unknown column should fail")
+	}
+}
@@ -0,0 +1,161 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// deletedScope controls which rows of a soft-delete model a query sees
+type deletedScope int
+
+const (
+	excludeDeleted deletedScope = iota
+	includeDeleted
+	onlyDeleted
+)
+
+// Unscoped removes the query's default scopes, so soft-deleted records are
+// returned and DeleteAll removes rows permanently. The tenant scope stays;
+// see WithoutTenant.
+func (qb *QueryBuilder) Unscoped() gor.QueryBuilder {
+	qb.unscoped = true
+	qb.deletedScope = includeDeleted
+	return qb
+}
+
+// WithDeleted includes soft-deleted records in the results
+func (qb *QueryBuilder) WithDeleted() gor.QueryBuilder {
+	qb.deletedScope = includeDeleted
+	return qb
+}
+
+// OnlyDeleted restricts the results to soft-deleted records
+func (qb *QueryBuilder) OnlyDeleted() gor.QueryBuilder {
+	qb.deletedScope = onlyDeleted
+	return qb
+}
+
+// Restore clears the deletion timestamp of all matching soft-deleted records
+func (qb *QueryBuilder) Restore() (int64, error) {
+	field := qb.softDeleteField()
+	if field == nil {
+		return 0, fmt.Errorf("%s does not support soft deletes", qb.tableName)
+	}
+	if qb.err != nil {
+		return 0, qb.err
+	}
+
+	d := dialectFor(qb.adapter)
+	conditions, whereArgs, err := qb.scopedConditions(d, onlyDeleted)
+	if err != nil {
+		return 0, err
+	}
+	sql := buildUpdateSQL(d, qb.tableName, []string{field.Column}, strings.Join(conditions, " AND "))
+
+	args := append([]interface{}{nil}, whereArgs...)
+	result, err := qb.executor().Exec(sql, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// softDeleteAll marks all matching records as deleted
+func (qb *QueryBuilder) softDeleteAll() (int64, error) {
+	if qb.err != nil {
+		return 0, qb.err
+	}
+
+	field := qb.softDeleteField()
+
+	d := dialectFor(qb.adapter)
+	conditions, whereArgs, err := qb.scopedConditions(d, excludeDeleted)
+	if err != nil {
+		return 0, err
+	}
+	sql := buildUpdateSQL(d, qb.tableName, []string{field.Column}, strings.Join(conditions, " AND "))
+
+	args := append([]interface{}{time.Now()}, whereArgs...)
+	result, err := qb.executor().Exec(sql, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (qb *QueryBuilder) softDeleteField() *modelField {
+	return softDeleteFieldOf(qb.modelType)
+}
+
+// scopedConditions returns the query's WHERE conditions followed by the
+// conditions implementing the given deleted scope and the context's tenant,
+// along with their arguments
+func (qb *QueryBuilder) scopedConditions(d sqlDialect, scope deletedScope) ([]string, []interface{}, error) {
+	conditions := qb.whereConditions
+	args := qb.whereArgs
+
+	if field := qb.softDeleteField(); field != nil {
+		if condition := deletedCondition(d, qb.tableName, field.Column, scope); condition != "" {
+			conditions = append(append([]string(nil), conditions...), condition)
+		}
+	}
+
+	condition, tenantArgs, err := tenantCondition(qb.ctx, d, qb.tableName, qb.modelType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if condition != "" {
+		// Parenthesize the query's conditions so an OR among them cannot
+		// reach rows of other tenants
+		scoped := make([]string, 0, len(conditions)+1)
+		for i, c := range conditions {
+			if i < len(qb.whereConditions) {
+				c = "(" + c + ")"
+			}
+			scoped = append(scoped, c)
+		}
+		conditions = append(scoped, condition)
+		args = append(append([]interface{}(nil), args...), tenantArgs...)
+	}
+
+	return conditions, args, nil
+}
+
+// deletedCondition returns the condition selecting the rows in scope
+func deletedCondition(d sqlDialect, table, column string, scope deletedScope) string {
+	column = d.QuoteIdentifier(table + "." + column)
+
+	switch scope {
+	case excludeDeleted:
+		return column + " IS NULL"
+	case onlyDeleted:
+		return column + " IS NOT NULL"
+	}
+	return ""
+}
+
+// markDeleted sets the soft-delete field of model to deletedAt
+func markDeleted(model interface{}, deletedAt time.Time) {
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	field := schemaOf(v.Type()).SoftDelete
+	if field == nil {
+		return
+	}
+
+	if target := v.FieldByIndex(field.Index); target.Type() == reflect.TypeOf(&deletedAt) {
+		target.Set(reflect.ValueOf(&deletedAt))
+	}
+}
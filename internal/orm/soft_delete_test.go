@@ -0,0 +1,175 @@
+package orm
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type SoftDeletes struct {
+	DeletedAt *time.Time `gor:"soft_delete"`
+}
+
+type SoftNote struct {
+	ID    int64  `gor:"primary_key;auto_increment"`
+	Title string `gor:"not_null"`
+	SoftDeletes
+}
+
+func (n *SoftNote) TableName() string { return "soft_notes" }
+
+func setupSoftDeleteORM(t *testing.T) gor.ORM {
+	config := gor.DatabaseConfig{
+		Driver:          "sqlite3",
+		Database:        filepath.Join(t.TempDir(), "soft.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}
+
+	orm := NewORM(config)
+	if err := orm.Connect(context.Background(), config); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { orm.Close() })
+
+	if err := orm.Register(&SoftNote{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	for _, title := range []string{"first", "second", "third"} {
+		if err := orm.Create(&SoftNote{Title: title}); err != nil {
+			t.Fatalf("Failed to create note: %v", err)
+		}
+	}
+
+	return orm
+}
+
+func countNotes(t *testing.T, qb gor.QueryBuilder) int64 {
+	t.Helper()
+	count, err := qb.Count()
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	return count
+}
+
+func TestSoftDelete_Delete(t *testing.T) {
+	orm := setupSoftDeleteORM(t)
+
+	note := &SoftNote{}
+	if err := orm.Find(note, 1); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+
+	if err := orm.Delete(note); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if note.DeletedAt == nil {
+		t.Error("Delete() should set DeletedAt on the model")
+	}
+
+	if err := orm.Find(&SoftNote{}, 1); err == nil {
+		t.Error("Find() should not return a soft-deleted record")
+	}
+	if err := orm.Table("soft_notes").Find(1, &SoftNote{}); err == nil {
+		t.Error("Table.Find() should not return a soft-deleted record")
+	}
+
+	var raw int
+	if err := orm.DB().QueryRow("SELECT COUNT(*) FROM soft_notes").Scan(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw != 3 {
+		t.Errorf("rows in table = %d, want 3", raw)
+	}
+
+	if got := countNotes(t, orm.Query(&SoftNote{})); got != 2 {
+		t.Errorf("default scope Count() = %d, want 2", got)
+	}
+	if got := countNotes(t, orm.Query(&SoftNote{}).WithDeleted()); got != 3 {
+		t.Errorf("WithDeleted Count() = %d, want 3", got)
+	}
+	if got := countNotes(t, orm.Query(&SoftNote{}).Unscoped()); got != 3 {
+		t.Errorf("Unscoped Count() = %d, want 3", got)
+	}
+	if got := countNotes(t, orm.Query(&SoftNote{}).OnlyDeleted()); got != 1 {
+		t.Errorf("OnlyDeleted Count() = %d, want 1", got)
+	}
+}
+
+func TestSoftDelete_RestoreAndHardDelete(t *testing.T) {
+	orm := setupSoftDeleteORM(t)
+
+	if err := orm.Table("soft_notes").Delete(2); err != nil {
+		t.Fatalf("Table.Delete() error = %v", err)
+	}
+	if err := orm.Table("soft_notes").Delete(2); err == nil {
+		t.Error("deleting an already deleted record should fail")
+	}
+
+	restored, err := orm.Query(&SoftNote{}).Where("id = ?", 2).Restore()
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if restored != 1 {
+		t.Errorf("Restore() = %d, want 1", restored)
+	}
+	if got := countNotes(t, orm.Query(&SoftNote{})); got != 3 {
+		t.Errorf("Count() after restore = %d, want 3", got)
+	}
+
+	if _, err := orm.Query(&SoftNote{}).Where("title = ?", "third").DeleteAll(); err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	purged, err := orm.Query(&SoftNote{}).OnlyDeleted().HardDelete()
+	if err != nil {
+		t.Fatalf("HardDelete() error = %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("HardDelete() = %d, want 1", purged)
+	}
+	if got := countNotes(t, orm.Query(&SoftNote{}).Unscoped()); got != 2 {
+		t.Errorf("Unscoped Count() after purge = %d, want 2", got)
+	}
+}
+
+func TestSoftDelete_TransactionAndBatches(t *testing.T) {
+	orm := setupSoftDeleteORM(t)
+
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		note := &SoftNote{ID: 3}
+		if err := tx.Delete(note); err != nil {
+			return err
+		}
+
+		var notes []SoftNote
+		if err := tx.Query(&notes).FindAll(&notes); err != nil {
+			return err
+		}
+		if len(notes) != 2 {
+			t.Errorf("FindAll() in transaction returned %d notes, want 2", len(notes))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	var seen int
+	var batches []SoftNote
+	err = orm.Query(&batches).Order("id").FindInBatches(&batches, 1, func(tx gor.Transaction, batch interface{}) error {
+		seen += len(*batch.(*[]SoftNote))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FindInBatches() error = %v", err)
+	}
+	if seen != 2 {
+		t.Errorf("FindInBatches() visited %d notes, want 2", seen)
+	}
+}
@@ -0,0 +1,400 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// ErrInvalidTransition is returned when an event cannot fire from the
+// current state of a model, or its guards reject it
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// StateMachine describes the states a model moves through, kept in a
+// string column. Models declare one by returning it from a StateMachine
+// method, usually a package-level variable:
+//
+//	var orderStates = orm.NewStateMachine("status", "pending", "paid", "shipped", "cancelled").
+//		Event("pay", []string{"pending"}, "paid").
+//		Event("ship", []string{"paid"}, "shipped", func(model interface{}) bool {
+//			return model.(*Order).Address != ""
+//		}).
+//		Event("cancel", []string{"pending", "paid"}, "cancelled").
+//		After(notifyCustomer, "ship").
+//		WithHistory()
+//
+//	func (o *Order) StateMachine() *orm.StateMachine { return orderStates }
+//
+// Fire then moves a model along one of the events. New records start in
+// the first state.
+type StateMachine struct {
+	column string
+	states []string
+	events map[string][]stateTransition
+	before []transitionHook
+	after  []transitionHook
+
+	history bool
+}
+
+// Transition is one move of a model from a state to another
+type Transition struct {
+	Event string
+	From  string
+	To    string
+}
+
+// TransitionGuard reports whether model may take a transition
+type TransitionGuard func(model interface{}) bool
+
+// TransitionCallback runs around a transition within its transaction. An
+// error cancels the transition.
+type TransitionCallback func(tx gor.Transaction, model interface{}, transition Transition) error
+
+type stateTransition struct {
+	from   map[string]bool
+	to     string
+	guards []TransitionGuard
+}
+
+type transitionHook struct {
+	events   map[string]bool
+	callback TransitionCallback
+}
+
+// stateful is implemented by models with a state machine
+type stateful interface {
+	StateMachine() *StateMachine
+}
+
+// NewStateMachine returns a state machine over the given states, kept in
+// column. The first state is the initial one.
+func NewStateMachine(column string, states ...string) *StateMachine {
+	if len(states) == 0 {
+		panic("orm: NewStateMachine needs at least one state")
+	}
+	return &StateMachine{column: column, states: states, events: make(map[string][]stateTransition)}
+}
+
+// Event adds a transition taken by event from any of the from states to
+// the to state, when all guards pass. An event may be declared several
+// times; it takes the first of its transitions that applies.
+func (m *StateMachine) Event(name string, from []string, to string, guards ...TransitionGuard) *StateMachine {
+	transition := stateTransition{from: make(map[string]bool, len(from)), to: m.state(name, to), guards: guards}
+	for _, state := range from {
+		transition.from[m.state(name, state)] = true
+	}
+	m.events[name] = append(m.events[name], transition)
+	return m
+}
+
+// Before adds a callback run before the transitions of the given events,
+// or of every event when none are given
+func (m *StateMachine) Before(callback TransitionCallback, events ...string) *StateMachine {
+	m.before = append(m.before, m.hook(callback, events))
+	return m
+}
+
+// After adds a callback run after the transitions of the given events, or
+// of every event when none are given, once the new state is saved
+func (m *StateMachine) After(callback TransitionCallback, events ...string) *StateMachine {
+	m.after = append(m.after, m.hook(callback, events))
+	return m
+}
+
+// WithHistory records every transition in the state_transitions table
+func (m *StateMachine) WithHistory() *StateMachine {
+	m.history = true
+	return m
+}
+
+// Initial returns the state new records start in
+func (m *StateMachine) Initial() string {
+	return m.states[0]
+}
+
+// state returns state, panicking when the machine does not declare it
+func (m *StateMachine) state(event, state string) string {
+	for _, s := range m.states {
+		if s == state {
+			return state
+		}
+	}
+	panic(fmt.Sprintf("orm: event %q uses undeclared state %q", event, state))
+}
+
+func (m *StateMachine) hook(callback TransitionCallback, events []string) transitionHook {
+	hook := transitionHook{callback: callback}
+	if len(events) > 0 {
+		hook.events = make(map[string]bool, len(events))
+		for _, event := range events {
+			if _, ok := m.events[event]; !ok {
+				panic(fmt.Sprintf("orm: callback for undeclared event %q", event))
+			}
+			hook.events[event] = true
+		}
+	}
+	return hook
+}
+
+// transition returns the transition event takes model from state
+func (m *StateMachine) transition(model interface{}, event, state string) (Transition, error) {
+	transitions, ok := m.events[event]
+	if !ok {
+		return Transition{}, fmt.Errorf("%w: unknown event %q", ErrInvalidTransition, event)
+	}
+
+	guarded := false
+	for _, transition := range transitions {
+		if !transition.from[state] {
+			continue
+		}
+		if !passes(model, transition.guards) {
+			guarded = true
+			continue
+		}
+		return Transition{Event: event, From: state, To: transition.to}, nil
+	}
+
+	if guarded {
+		return Transition{}, fmt.Errorf("%w: guard rejected %q from %q", ErrInvalidTransition, event, state)
+	}
+	return Transition{}, fmt.Errorf("%w: cannot %q from %q", ErrInvalidTransition, event, state)
+}
+
+func passes(model interface{}, guards []TransitionGuard) bool {
+	for _, guard := range guards {
+		if !guard(model) {
+			return false
+		}
+	}
+	return true
+}
+
+// runHooks runs the hooks that apply to transition
+func runHooks(hooks []transitionHook, tx gor.Transaction, model interface{}, transition Transition) error {
+	for _, hook := range hooks {
+		if hook.events != nil && !hook.events[transition.Event] {
+			continue
+		}
+		if err := hook.callback(tx, model, transition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stateMachineOf returns the state machine of modelType, or nil
+func stateMachineOf(modelType reflect.Type) *StateMachine {
+	if modelType == nil {
+		return nil
+	}
+	if machine, ok := reflect.New(indirectType(modelType)).Interface().(stateful); ok {
+		return machine.StateMachine()
+	}
+	return nil
+}
+
+// stateField returns the field holding the state of modelType
+func stateField(modelType reflect.Type, machine *StateMachine) (*modelField, error) {
+	field := schemaOf(modelType).FieldByColumn(machine.column)
+	if field == nil || field.Type.Kind() != reflect.String {
+		return nil, fmt.Errorf("%s has no string %s column for its state machine", indirectType(modelType).Name(), machine.column)
+	}
+	return field, nil
+}
+
+// setInitialState puts a new record without a state in its machine's
+// initial state
+func setInitialState(model interface{}) {
+	machine := stateMachineOf(reflect.TypeOf(model))
+	if machine == nil {
+		return
+	}
+	field, err := stateField(reflect.TypeOf(model), machine)
+	if err != nil {
+		return
+	}
+	if state := reflect.Indirect(reflect.ValueOf(model)).FieldByIndex(field.Index); state.String() == "" {
+		state.SetString(machine.Initial())
+	}
+}
+
+// CanFire reports whether event can move model from its current state
+func CanFire(model interface{}, event string) bool {
+	machine := stateMachineOf(reflect.TypeOf(model))
+	if machine == nil {
+		return false
+	}
+	field, err := stateField(reflect.TypeOf(model), machine)
+	if err != nil {
+		return false
+	}
+	state := reflect.Indirect(reflect.ValueOf(model)).FieldByIndex(field.Index).String()
+	_, err = machine.transition(model, event, state)
+	return err == nil
+}
+
+// Fire moves model along event and saves its new state. The UPDATE only
+// matches the row while it is still in the state model was loaded in, so
+// of two concurrent transitions one fails with ErrStaleObject. Callbacks,
+// the history entry and the version of audited models are written in the
+// same transaction; store is an ORM or a transaction to join.
+func Fire(store recordStore, model interface{}, event string) error {
+	switch s := store.(type) {
+	case *gorORM:
+		return s.Transaction(s.ctx, func(tx gor.Transaction) error {
+			return fire(tx.(*gorTransaction), model, event)
+		})
+	case *gorTransaction:
+		return s.Transaction(func(tx gor.Transaction) error {
+			return fire(tx.(*gorTransaction), model, event)
+		})
+	}
+	return fmt.Errorf("unsupported store %T", store)
+}
+
+func fire(tx *gorTransaction, model interface{}, event string) error {
+	modelType := reflect.TypeOf(model)
+	machine := stateMachineOf(modelType)
+	if machine == nil {
+		return fmt.Errorf("%s has no state machine", indirectType(modelType).Name())
+	}
+	field, err := stateField(modelType, machine)
+	if err != nil {
+		return err
+	}
+	id := getID(model)
+	if id == nil || reflect.ValueOf(id).IsZero() {
+		return fmt.Errorf("cannot fire %q on a record without ID", event)
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(model))
+	transition, err := machine.transition(model, event, v.FieldByIndex(field.Index).String())
+	if err != nil {
+		return err
+	}
+
+	if err := runHooks(machine.before, tx, model, transition); err != nil {
+		return err
+	}
+
+	// The saved record is built on a copy, so model is left as it was when
+	// the transition fails
+	before := reflect.New(v.Type())
+	before.Elem().Set(v)
+	after := reflect.New(v.Type())
+	after.Elem().Set(v)
+	after.Elem().FieldByIndex(field.Index).SetString(transition.To)
+	setTimestamps(after.Interface(), false)
+
+	table := getTableName(modelType)
+	columns := []string{field.Column}
+	values := []interface{}{transition.To}
+	if timestamp := schemaOf(modelType).FieldByName("UpdatedAt"); timestamp != nil {
+		columns = append(columns, timestamp.Column)
+		values = append(values, after.Elem().FieldByIndex(timestamp.Index).Interface())
+	}
+
+	d := dialectFor(tx.adapter)
+	where := d.QuoteIdentifier("id") + " = ? AND " + d.QuoteIdentifier(field.Column) + " = ?"
+	values = append(values, id, transition.From)
+
+	condition, tenantArgs, err := tenantCondition(tx.ctx, d, table, modelType)
+	if err != nil {
+		return err
+	}
+	if condition != "" {
+		where += " AND " + condition
+		values = append(values, tenantArgs...)
+	}
+
+	result, err := tx.exec().Exec(buildUpdateSQL(d, table, columns, where), values...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s %v is no longer %q: %w", table, id, transition.From, ErrStaleObject)
+	}
+
+	if err := recordVersion(tx.exec(), tx.adapter, table, VersionUpdate, before.Interface(), after.Interface()); err != nil {
+		return err
+	}
+	if machine.history {
+		if err := recordTransition(tx, table, id, transition); err != nil {
+			return err
+		}
+	}
+
+	v.Set(after.Elem())
+	markTransitioned(model, columns, values)
+
+	return runHooks(machine.after, tx, model, transition)
+}
+
+// markTransitioned records the columns a transition saved in the snapshot
+// of a tracked model, so a later Update does not write them again
+func markTransitioned(model interface{}, columns []string, values []interface{}) {
+	loaded, _ := dirtyState(model)
+	if loaded == nil {
+		return
+	}
+
+	saved := make(map[string]gor.Change, len(columns))
+	for i, column := range columns {
+		saved[column] = gor.Change{Old: loaded[column], New: values[i]}
+		loaded[column] = values[i]
+	}
+	model.(gor.Trackable).SetDirtyState(loaded, saved)
+}
+
+// StateTransition is one entry in the transition history of a model whose
+// state machine was declared WithHistory
+type StateTransition struct {
+	ID        int64  `gor:"primary_key;auto_increment"`
+	ItemType  string `gor:"not_null;index"`
+	ItemID    string `gor:"not_null;index"`
+	Event     string `gor:"not_null"`
+	FromState string `gor:"not_null"`
+	ToState   string `gor:"not_null"`
+
+	// Actor is who fired the event and RequestID the request it was part of
+	Actor     string
+	RequestID string
+	CreatedAt time.Time `gor:"not_null"`
+}
+
+// TableName returns the state transitions table
+func (s *StateTransition) TableName() string { return "state_transitions" }
+
+// recordTransition writes the history entry of transition
+func recordTransition(tx *gorTransaction, table string, id interface{}, transition Transition) error {
+	entry := &StateTransition{
+		ItemType:  table,
+		ItemID:    fmt.Sprint(id),
+		Event:     transition.Event,
+		FromState: transition.From,
+		ToState:   transition.To,
+		Actor:     gor.ActorFrom(tx.ctx),
+		RequestID: gor.RequestIDFrom(tx.ctx),
+		CreatedAt: time.Now(),
+	}
+	return insertRecord(tx.exec(), tx.adapter, entry.TableName(), entry)
+}
+
+// StateTransitions returns the transition history of model, oldest first
+func StateTransitions(store recordStore, model interface{}) ([]StateTransition, error) {
+	var transitions []StateTransition
+	err := store.Query(&StateTransition{}).
+		Where("item_type = ? AND item_id = ?", getTableName(reflect.TypeOf(model)), fmt.Sprint(getID(model))).
+		Order("id").
+		FindAll(&transitions)
+	return transitions, err
+}
@@ -0,0 +1,161 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type MachineOrder struct {
+	gor.Tracked
+	ID        int64  `gor:"primary_key;auto_increment"`
+	Status    string `gor:"not_null"`
+	Address   string
+	UpdatedAt time.Time
+}
+
+func (o *MachineOrder) TableName() string { return "machine_orders" }
+
+var errNoStock = errors.New("out of stock")
+
+var machineOrderStates = NewStateMachine("status", "pending", "paid", "shipped", "cancelled").
+	Event("pay", []string{"pending"}, "paid").
+	Event("ship", []string{"paid"}, "shipped", func(model interface{}) bool {
+		return model.(*MachineOrder).Address != ""
+	}).
+	Event("cancel", []string{"pending", "paid"}, "cancelled").
+	Before(func(tx gor.Transaction, model interface{}, transition Transition) error {
+		if model.(*MachineOrder).Address == "nowhere" {
+			return errNoStock
+		}
+		return nil
+	}, "ship").
+	After(func(tx gor.Transaction, model interface{}, transition Transition) error {
+		// Callbacks write in the transition's transaction
+		_, err := tx.Exec("UPDATE machine_orders SET address = address || ' (cancelled)' WHERE id = ?", getID(model))
+		return err
+	}, "cancel").
+	WithHistory()
+
+func (o *MachineOrder) StateMachine() *StateMachine { return machineOrderStates }
+
+func setupStateMachineORM(t *testing.T) (gor.ORM, *MachineOrder) {
+	orm := setupTestORM(t)
+	if err := orm.Register(&MachineOrder{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	order := &MachineOrder{}
+	if err := orm.Create(order); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return orm, order
+}
+
+func storedStatus(t *testing.T, orm gor.ORM, id int64) string {
+	t.Helper()
+	var status string
+	if err := orm.DB().QueryRow("SELECT status FROM machine_orders WHERE id = ?", id).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestStateMachine_FiresGuardedTransitions(t *testing.T) {
+	orm, order := setupStateMachineORM(t)
+
+	if order.Status != "pending" {
+		t.Fatalf("Create() status = %q, want the initial state", order.Status)
+	}
+	if CanFire(order, "ship") || !CanFire(order, "pay") {
+		t.Error("CanFire() should only allow pay from pending")
+	}
+	if err := Fire(orm, order, "ship"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Fire(ship) from pending error = %v, want ErrInvalidTransition", err)
+	}
+
+	ops := orm.WithContext(WithDatabaseSession(WithActor(context.Background(), "ops")))
+	if err := Fire(ops, order, "pay"); err != nil {
+		t.Fatalf("Fire(pay) error = %v", err)
+	}
+	if order.Status != "paid" || storedStatus(t, orm, order.ID) != "paid" || order.UpdatedAt.IsZero() {
+		t.Errorf("after pay status = %q, stored %q; want paid", order.Status, storedStatus(t, orm, order.ID))
+	}
+
+	// The guard needs an address and the before callback rejects this one
+	if err := Fire(orm, order, "ship"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Fire(ship) without an address error = %v, want ErrInvalidTransition", err)
+	}
+	order.Address = "nowhere"
+	if err := Fire(orm, order, "ship"); !errors.Is(err, errNoStock) {
+		t.Errorf("Fire(ship) error = %v, want the callback's error", err)
+	}
+	if order.Status != "paid" {
+		t.Errorf("failed Fire() changed status to %q", order.Status)
+	}
+
+	order.Address = "1 Main St"
+	if err := Fire(orm, order, "ship"); err != nil {
+		t.Fatalf("Fire(ship) error = %v", err)
+	}
+	// The transition left the tracked address change to the next save
+	if changes := Changes(order); len(changes) != 1 || changes["address"].New != "1 Main St" {
+		t.Errorf("Changes() after Fire() = %v, want only the address", changes)
+	}
+
+	history, err := StateTransitions(orm, order)
+	if err != nil {
+		t.Fatalf("StateTransitions() error = %v", err)
+	}
+	if len(history) != 2 || history[0].FromState != "pending" || history[1].Event != "ship" || history[1].ToState != "shipped" || history[0].Actor != "ops" {
+		t.Errorf("StateTransitions() = %+v, want pay by ops then ship", history)
+	}
+}
+
+func TestStateMachine_TransitionsAreAtomic(t *testing.T) {
+	orm, order := setupStateMachineORM(t)
+
+	// Another process pays the order after it was loaded
+	var stale MachineOrder
+	if err := orm.Find(&stale, order.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := Fire(orm, order, "pay"); err != nil {
+		t.Fatalf("Fire(pay) error = %v", err)
+	}
+	if err := Fire(orm, &stale, "pay"); !errors.Is(err, ErrStaleObject) {
+		t.Errorf("Fire(pay) on a stale order error = %v, want ErrStaleObject", err)
+	}
+	if stale.Status != "pending" {
+		t.Errorf("stale status = %q, want it unchanged", stale.Status)
+	}
+
+	// Transitions roll back with the transaction they joined
+	errRollback := errors.New("rollback")
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		if err := Fire(tx, order, "cancel"); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+	if status := storedStatus(t, orm, order.ID); status != "paid" {
+		t.Errorf("status after rollback = %q, want paid", status)
+	}
+	if history, _ := StateTransitions(orm, order); len(history) != 1 {
+		t.Errorf("StateTransitions() after rollback = %+v, want only pay", history)
+	}
+
+	if err := Fire(orm, &MachineOrder{ID: order.ID, Status: "paid"}, "cancel"); err != nil {
+		t.Fatalf("Fire(cancel) error = %v", err)
+	}
+	var cancelled MachineOrder
+	if err := orm.Find(&cancelled, order.ID); err != nil || cancelled.Status != "cancelled" || cancelled.Address != " (cancelled)" {
+		t.Errorf("cancelled order = %+v, %v; want the after callback's write", cancelled, err)
+	}
+}
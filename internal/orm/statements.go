@@ -0,0 +1,495 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// executor is satisfied by both *sql.DB and *sql.Tx
+type executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// buildSelectSQL renders a query builder as a SELECT statement in the
+// given dialect
+func buildSelectSQL(d sqlDialect, qb *QueryBuilder) (string, []interface{}, error) {
+	sql, args, err := selectSQL(d, qb)
+	if err != nil {
+		return "", nil, err
+	}
+	return rebind(d, sql), args, nil
+}
+
+// selectSQL renders the SELECT statement with "?" placeholders, so it can
+// also be nested as a subquery before the outer statement is rebound
+func selectSQL(d sqlDialect, qb *QueryBuilder) (string, []interface{}, error) {
+	if qb.err != nil {
+		return "", nil, qb.err
+	}
+	if qb.rawSQL != "" {
+		return qb.rawSQL, qb.rawArgs, nil
+	}
+
+	// Grouped and distinct rows are counted from the query itself
+	if qb.isCount && (qb.distinct || len(qb.groupBy) > 0) {
+		inner := qb.clone()
+		inner.isCount = false
+		sql, args, err := selectSQL(d, inner)
+		if err != nil {
+			return "", nil, err
+		}
+		return "SELECT COUNT(*) FROM (" + sql + ") AS gor_count", args, nil
+	}
+
+	table := d.QuoteIdentifier(qb.tableName)
+
+	var sql strings.Builder
+	var args []interface{}
+
+	sql.WriteString("SELECT ")
+	if qb.distinct && !qb.isCount {
+		sql.WriteString("DISTINCT ")
+	}
+
+	switch {
+	case qb.isCount:
+		sql.WriteString("COUNT(*)")
+	case len(qb.selects) > 0:
+		sql.WriteString(strings.Join(qb.selects, ", "))
+	case len(qb.joins) > 0:
+		// Only the model's own columns, so joined tables cannot shadow them
+		sql.WriteString(table + ".*")
+	default:
+		sql.WriteString("*")
+	}
+
+	sql.WriteString(" FROM " + table)
+	if err := writeFilters(d, &sql, &args, qb); err != nil {
+		return "", nil, err
+	}
+
+	// Add GROUP BY and HAVING
+	if len(qb.groupBy) > 0 {
+		sql.WriteString(" GROUP BY ")
+		sql.WriteString(strings.Join(qb.groupBy, ", "))
+	}
+	if len(qb.havingConditions) > 0 {
+		sql.WriteString(" HAVING ")
+		sql.WriteString(strings.Join(qb.havingConditions, " AND "))
+		args = append(args, qb.havingArgs...)
+	}
+
+	// Add ORDER BY
+	if len(qb.orderBy) > 0 && !qb.isCount {
+		sql.WriteString(" ORDER BY ")
+		sql.WriteString(strings.Join(qb.orderBy, ", "))
+	}
+
+	// Add LIMIT, OFFSET and row locks
+	if !qb.isCount {
+		sql.WriteString(d.LimitOffsetSQL(qb.limitValue, qb.offsetValue))
+		sql.WriteString(d.LockSQL(qb.lock))
+	}
+
+	return sql.String(), args, nil
+}
+
+// buildAggregateSQL renders SELECT fn(field) over the query's filters
+func buildAggregateSQL(d sqlDialect, qb *QueryBuilder, function, field string) (string, []interface{}, error) {
+	if qb.err != nil {
+		return "", nil, qb.err
+	}
+
+	var sql strings.Builder
+	var args []interface{}
+
+	sql.WriteString(fmt.Sprintf("SELECT %s(%s) FROM %s", function, field, d.QuoteIdentifier(qb.tableName)))
+	if err := writeFilters(d, &sql, &args, qb); err != nil {
+		return "", nil, err
+	}
+
+	return rebind(d, sql.String()), args, nil
+}
+
+// writeFilters appends the JOIN and WHERE clauses of qb, including its
+// default scopes
+func writeFilters(d sqlDialect, sql *strings.Builder, args *[]interface{}, qb *QueryBuilder) error {
+	for _, join := range qb.joins {
+		sql.WriteString(" ")
+		sql.WriteString(join)
+	}
+
+	conditions, whereArgs, err := qb.scopedConditions(d, qb.deletedScope)
+	if err != nil {
+		return err
+	}
+	if len(conditions) > 0 {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(strings.Join(conditions, " AND "))
+		*args = append(*args, whereArgs...)
+	}
+	return nil
+}
+
+// buildInsertSQL renders an INSERT of rows rows. When returning is set and
+// the dialect supports it, the statement returns that column.
+func buildInsertSQL(d sqlDialect, table string, columns []string, rows int, returning string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = d.QuoteIdentifier(column)
+	}
+
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	values := make([]string, rows)
+	for i := range values {
+		values[i] = row
+	}
+
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", // #nosec G201 - Identifiers come from model metadata
+		d.QuoteIdentifier(table), strings.Join(quoted, ", "), strings.Join(values, ", "))
+
+	if returning != "" && d.SupportsReturning() {
+		sql += " RETURNING " + d.QuoteIdentifier(returning)
+	}
+
+	return rebind(d, sql)
+}
+
+// buildUpsertSQL renders an INSERT of rows rows that updates the given
+// columns when a row conflicts on the conflict columns. Where the dialect
+// can, the statement returns the IDs of the rows it wrote.
+func buildUpsertSQL(d sqlDialect, table string, columns []string, rows int, conflict, updates []string) string {
+	sql := buildInsertSQL(d, table, columns, rows, "") + d.UpsertSQL(conflict, updates)
+	if d.UpsertReturning() {
+		sql += " RETURNING " + d.QuoteIdentifier("id")
+	}
+	return sql
+}
+
+// buildUpdateSQL renders UPDATE table SET columns... followed by the where
+// clause, which may use "?" placeholders
+func buildUpdateSQL(d sqlDialect, table string, columns []string, where string) string {
+	sets := make([]string, len(columns))
+	for i, column := range columns {
+		sets[i] = d.QuoteIdentifier(column) + " = ?"
+	}
+
+	sql := fmt.Sprintf("UPDATE %s SET %s", d.QuoteIdentifier(table), strings.Join(sets, ", ")) // #nosec G201 - Identifiers come from model metadata
+	if where != "" {
+		sql += " WHERE " + where
+	}
+
+	return rebind(d, sql)
+}
+
+// buildDeleteSQL renders DELETE FROM table followed by the where clause
+func buildDeleteSQL(d sqlDialect, table, where string) string {
+	sql := fmt.Sprintf("DELETE FROM %s", d.QuoteIdentifier(table)) // #nosec G201 - Identifiers come from model metadata
+	if where != "" {
+		sql += " WHERE " + where
+	}
+
+	return rebind(d, sql)
+}
+
+// inPlaceholders returns "?, ?, ..." for n arguments
+func inPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// sortedKeys returns the keys of updates in a stable order
+func sortedKeys(updates map[string]interface{}) []string {
+	keys := make([]string, 0, len(updates))
+	for key := range updates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Record operations shared by gorORM, gorTable and gorTransaction
+
+// modelValues returns the columns and values of model. The ID column is
+// skipped when it holds its zero value so the database assigns one.
+func modelValues(model interface{}, forInsert bool) ([]string, []interface{}) {
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	var columns []string
+	var values []interface{}
+
+	for _, field := range schemaOf(v.Type()).Fields {
+		value := v.FieldByIndex(field.Index)
+		if field.Name == "ID" && (!forInsert || value.IsZero()) {
+			continue
+		}
+
+		columns = append(columns, field.Column)
+		if field.HasOption("json") {
+			values = append(values, jsonValue(value))
+		} else {
+			values = append(values, value.Interface())
+		}
+	}
+
+	return columns, values
+}
+
+// setPolymorphicKeys fills the _type and _id columns of the polymorphic
+// belongs_to associations of model that hold a parent
+func setPolymorphicKeys(model interface{}) {
+	v := reflect.Indirect(reflect.ValueOf(model))
+	schema := schemaOf(v.Type())
+
+	for _, assoc := range schema.Associations {
+		if !assoc.polymorphic {
+			continue
+		}
+		parent := v.FieldByIndex(assoc.index)
+		typeField, fkField := schema.FieldByColumn(assoc.typeColumn), schema.FieldByColumn(assoc.foreignKey)
+		if parent.IsNil() || typeField == nil || fkField == nil {
+			continue
+		}
+
+		v.FieldByIndex(typeField.Index).SetString(getTableName(parent.Elem().Type()))
+		id := reflect.ValueOf(getID(parent.Interface()))
+		if fk := v.FieldByIndex(fkField.Index); id.IsValid() && !id.IsZero() && id.Type().ConvertibleTo(fk.Type()) {
+			fk.Set(id.Convert(fk.Type()))
+		}
+	}
+}
+
+// insertRecord inserts model into table and stores the generated ID
+func insertRecord(ex executor, adapter gor.DatabaseAdapter, table string, model interface{}) error {
+	setPolymorphicKeys(model)
+	setInitialState(model)
+
+	d := dialectFor(adapter)
+	columns, values := modelValues(model, true)
+	values, err := encryptValues(keyringOf(ex), reflect.TypeOf(model), columns, values)
+	if err != nil {
+		return err
+	}
+
+	var changes map[string]gor.Change
+	if _, tracked := model.(gor.Trackable); tracked {
+		changes = Changes(model)
+	}
+
+	if d.SupportsReturning() {
+		var id int64
+		if err := ex.QueryRow(buildInsertSQL(d, table, columns, 1, "id"), values...).Scan(&id); err != nil {
+			return err
+		}
+		setID(model, id)
+		snapshot(model, changes)
+		return nil
+	}
+
+	result, err := ex.Exec(buildInsertSQL(d, table, columns, 1, ""), values...)
+	if err != nil {
+		return err
+	}
+
+	// Set ID if auto-increment
+	if id, err := result.LastInsertId(); err == nil && id > 0 {
+		setID(model, id)
+	}
+	snapshot(model, changes)
+
+	return nil
+}
+
+// updateRecord saves model to the row with its ID and returns the number
+// of rows written. Tracked models write only their changed columns, and
+// nothing at all, returning -1, when only updated_at changed. Models with a
+// lock_version field are only saved when the version still matches, and
+// ErrStaleObject is returned otherwise.
+func updateRecord(ex executor, adapter gor.DatabaseAdapter, table string, model interface{}) (int64, error) {
+	id := getID(model)
+	if id == nil {
+		return 0, fmt.Errorf("cannot update record without ID")
+	}
+
+	setPolymorphicKeys(model)
+
+	d := dialectFor(adapter)
+	columns, values := modelValues(model, false)
+
+	v := reflect.Indirect(reflect.ValueOf(model))
+	lockField := lockVersionFieldOf(v.Type())
+
+	var changes map[string]gor.Change
+	if loaded, _ := dirtyState(model); loaded != nil {
+		changes = Changes(model)
+		timestamp := schemaOf(v.Type()).FieldByName("UpdatedAt")
+		columns, values = changedValues(columns, values, changes, timestamp, lockField)
+		if columns == nil {
+			// Undo the updated_at bump so the model still matches its row
+			if timestamp != nil && loaded[timestamp.Column] != nil {
+				v.FieldByIndex(timestamp.Index).Set(reflect.ValueOf(loaded[timestamp.Column]))
+			}
+			return -1, nil
+		}
+	} else if _, tracked := model.(gor.Trackable); tracked {
+		changes = Changes(model)
+	}
+
+	values, err := encryptValues(keyringOf(ex), v.Type(), columns, values)
+	if err != nil {
+		return 0, err
+	}
+
+	where := d.QuoteIdentifier("id") + " = ?"
+	values = append(values, id)
+
+	condition, tenantArgs, err := tenantCondition(contextOf(ex), d, table, v.Type())
+	if err != nil {
+		return 0, err
+	}
+	if condition != "" {
+		where += " AND " + condition
+		values = append(values, tenantArgs...)
+	}
+
+	var version int64
+	if lockField != nil {
+		version = v.FieldByIndex(lockField.Index).Int()
+		for i, column := range columns {
+			if column == lockField.Column {
+				values[i] = version + 1
+			}
+		}
+		where += " AND " + d.QuoteIdentifier(lockField.Column) + " = ?"
+		values = append(values, version)
+	}
+
+	result, err := ex.Exec(buildUpdateSQL(d, table, columns, where), values...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return affected, err
+	}
+	if lockField == nil {
+		snapshot(model, changes)
+		return affected, nil
+	}
+
+	if affected == 0 {
+		return 0, fmt.Errorf("%w: %s with ID %v and lock version %d", ErrStaleObject, table, id, version)
+	}
+	v.FieldByIndex(lockField.Index).SetInt(version + 1)
+	snapshot(model, changes)
+
+	return affected, nil
+}
+
+// changedValues keeps the columns of a tracked model that changed, plus its
+// lock_version. It returns nil when nothing but the timestamp changed.
+func changedValues(columns []string, values []interface{}, changes map[string]gor.Change, timestamp, lockField *modelField) ([]string, []interface{}) {
+	var keptColumns []string
+	var keptValues []interface{}
+	significant := false
+
+	for i, column := range columns {
+		isLock := lockField != nil && column == lockField.Column
+		if _, changed := changes[column]; !changed && !isLock {
+			continue
+		}
+		if !isLock && (timestamp == nil || column != timestamp.Column) {
+			significant = true
+		}
+		keptColumns = append(keptColumns, column)
+		keptValues = append(keptValues, values[i])
+	}
+
+	if !significant {
+		return nil, nil
+	}
+	return keptColumns, keptValues
+}
+
+// deleteRecords deletes the rows with the given IDs, of the context's
+// tenant. Rows of soft-delete models are marked as deleted at the returned
+// time instead.
+func deleteRecords(ex executor, adapter gor.DatabaseAdapter, table string, modelType reflect.Type, ids ...interface{}) (int64, time.Time, error) {
+	d := dialectFor(adapter)
+	now := time.Now()
+
+	where := d.QuoteIdentifier("id") + " = ?"
+	if len(ids) != 1 {
+		where = fmt.Sprintf("%s IN (%s)", d.QuoteIdentifier("id"), inPlaceholders(len(ids)))
+	}
+
+	condition, tenantArgs, err := tenantCondition(contextOf(ex), d, table, modelType)
+	if err != nil {
+		return 0, now, err
+	}
+	if condition != "" {
+		where += " AND " + condition
+	}
+
+	sql := buildDeleteSQL(d, table, where)
+	args := append(append([]interface{}(nil), ids...), tenantArgs...)
+
+	if field := softDeleteFieldOf(modelType); field != nil {
+		where += " AND " + deletedCondition(d, table, field.Column, excludeDeleted)
+		sql = buildUpdateSQL(d, table, []string{field.Column}, where)
+		args = append([]interface{}{now}, args...)
+	}
+
+	result, err := ex.Exec(sql, args...)
+	if err != nil {
+		return 0, now, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected, now, err
+}
+
+// findRecord loads the row with the given ID into dest, skipping
+// soft-deleted rows and rows of other tenants
+func findRecord(ex executor, adapter gor.DatabaseAdapter, table string, id, dest interface{}) error {
+	d := dialectFor(adapter)
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s = ?", d.QuoteIdentifier(table), d.QuoteIdentifier("id")) // #nosec G201 - Identifiers come from model metadata
+
+	if field := softDeleteFieldOf(reflect.TypeOf(dest)); field != nil {
+		query += " AND " + deletedCondition(d, table, field.Column, excludeDeleted)
+	}
+
+	condition, tenantArgs, err := tenantCondition(contextOf(ex), d, table, reflect.TypeOf(dest))
+	if err != nil {
+		return err
+	}
+	if condition != "" {
+		query += " AND " + condition
+	}
+
+	rows, err := ex.Query(rebind(d, query), append([]interface{}{id}, tenantArgs...)...)
+	if err != nil {
+		return err
+	}
+
+	return scanFirst(keyringOf(ex), rows, dest)
+}
+
+// softDeleteFieldOf returns the soft-delete field of a model type, if any
+func softDeleteFieldOf(modelType reflect.Type) *modelField {
+	if modelType == nil {
+		return nil
+	}
+	return schemaOf(modelType).SoftDelete
+}
@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -13,6 +14,10 @@ type gorTable struct {
 	name      string
 	modelType reflect.Type
 	db        *sql.DB
+	tx        *sql.Tx
+	replicas  *replicaSet
+	keys      *keyring
+	ctx       context.Context
 	adapter   gor.DatabaseAdapter
 	columns   []gor.Column
 	indexes   []gor.Index
@@ -24,6 +29,7 @@ func NewTable(name string, modelType reflect.Type, db *sql.DB, adapter gor.Datab
 		name:      name,
 		modelType: modelType,
 		db:        db,
+		ctx:       context.Background(),
 		adapter:   adapter,
 	}
 
@@ -35,6 +41,58 @@ func NewTable(name string, modelType reflect.Type, db *sql.DB, adapter gor.Datab
 	return table
 }
 
+// WithContext returns a copy of the table whose statements run with ctx
+func (t *gorTable) WithContext(ctx context.Context) gor.Table {
+	if ctx == nil {
+		panic("orm: nil context")
+	}
+	scoped := *t
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// exec returns the database, or the table's transaction, bound to the
+// table's context
+func (t *gorTable) exec() executor {
+	if t.tx != nil {
+		return withContext(t.ctx, t.tx, t.adapter, t.keys)
+	}
+	return withContext(t.ctx, t.db, t.adapter, t.keys)
+}
+
+// atomically runs fn with the table when saving modelType writes no other
+// rows, and otherwise with a copy of it bound to a transaction, so records
+// are saved together with their versions and their parents' counters
+func (t *gorTable) atomically(modelType reflect.Type, fn func(t *gorTable) error) error {
+	if !savesAtomically(modelType) {
+		return fn(t)
+	}
+	return t.transaction(fn)
+}
+
+// transaction runs fn with the table when it is bound to a transaction,
+// and otherwise with a copy of it bound to a new one
+func (t *gorTable) transaction(fn func(t *gorTable) error) error {
+	if t.tx != nil {
+		return fn(t)
+	}
+
+	tx, err := t.db.BeginTx(t.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback() // Ignore error, tx.Commit() will handle success case
+	}()
+
+	scoped := *t
+	scoped.tx = tx
+	if err := fn(&scoped); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // Name returns the table name
 func (t *gorTable) Name() string {
 	return t.name
@@ -52,11 +110,23 @@ func (t *gorTable) Indexes() []gor.Index {
 
 // Create creates a new record in the table
 func (t *gorTable) Create(model interface{}) error {
+	return t.atomically(reflect.TypeOf(model), func(t *gorTable) error { return t.create(model) })
+}
+
+func (t *gorTable) create(model interface{}) error {
 	// Validate model type
 	if err := t.validateModel(model); err != nil {
 		return err
 	}
 
+	// Stamp the context's tenant, then run tag and model validations
+	if err := stampTenant(t.ctx, t.name, model); err != nil {
+		return err
+	}
+	if err := validateRecord(t.exec(), t.adapter, t.name, model); err != nil {
+		return err
+	}
+
 	// Call BeforeCreate hook if model implements it
 	if hook, ok := model.(interface{ BeforeCreate() error }); ok {
 		if err := hook.BeforeCreate(); err != nil {
@@ -68,19 +138,14 @@ func (t *gorTable) Create(model interface{}) error {
 	setTimestamps(model, true)
 
 	// Generate insert SQL
-	fields, values, placeholders := t.extractFieldsAndValues(model, false)
-
-	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-		t.name, fields, placeholders)
-
-	result, err := t.db.Exec(sql, values...)
-	if err != nil {
+	if err := insertRecord(t.exec(), t.adapter, t.name, model); err != nil {
 		return fmt.Errorf("failed to create record: %w", err)
 	}
-
-	// Set ID if auto-increment
-	if id, err := result.LastInsertId(); err == nil {
-		setID(model, id)
+	if err := recordVersion(t.exec(), t.adapter, t.name, VersionCreate, nil, model); err != nil {
+		return err
+	}
+	if err := updateCounterCaches(t.exec(), t.adapter, model, 1); err != nil {
+		return err
 	}
 
 	// Call AfterCreate hook if model implements it
@@ -95,11 +160,23 @@ func (t *gorTable) Create(model interface{}) error {
 
 // Update updates an existing record in the table
 func (t *gorTable) Update(model interface{}) error {
+	return t.atomically(reflect.TypeOf(model), func(t *gorTable) error { return t.update(model) })
+}
+
+func (t *gorTable) update(model interface{}) error {
 	// Validate model type
 	if err := t.validateModel(model); err != nil {
 		return err
 	}
 
+	// Stamp the context's tenant, then run tag and model validations
+	if err := stampTenant(t.ctx, t.name, model); err != nil {
+		return err
+	}
+	if err := validateRecord(t.exec(), t.adapter, t.name, model); err != nil {
+		return err
+	}
+
 	// Call BeforeUpdate hook
 	if hook, ok := model.(interface{ BeforeUpdate() error }); ok {
 		if err := hook.BeforeUpdate(); err != nil {
@@ -111,30 +188,34 @@ func (t *gorTable) Update(model interface{}) error {
 	setTimestamps(model, false)
 
 	// Generate update SQL
-	setParts, values := t.extractUpdateFields(model)
 	id := getID(model)
-
 	if id == nil {
 		return fmt.Errorf("cannot update record without ID")
 	}
 
-	sql := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", t.name, setParts) // #nosec G201 - Table name is system-controlled
-	values = append(values, id)
-
-	result, err := t.db.Exec(sql, values...)
+	before, err := storedRow(t.exec(), t.adapter, t.name, reflect.TypeOf(model), id)
 	if err != nil {
-		return fmt.Errorf("failed to update record: %w", err)
+		return err
 	}
 
-	affected, err := result.RowsAffected()
+	affected, err := updateRecord(t.exec(), t.adapter, t.name, model)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to update record: %w", err)
 	}
 
 	if affected == 0 {
 		return fmt.Errorf("no record found with ID %v", id)
 	}
 
+	if affected > 0 {
+		if err := recordVersion(t.exec(), t.adapter, t.name, VersionUpdate, before, model); err != nil {
+			return err
+		}
+		if err := moveCounterCaches(t.exec(), t.adapter, before, model); err != nil {
+			return err
+		}
+	}
+
 	// Call AfterUpdate hook
 	if hook, ok := model.(interface{ AfterUpdate() error }); ok {
 		if err := hook.AfterUpdate(); err != nil {
@@ -147,30 +228,37 @@ func (t *gorTable) Update(model interface{}) error {
 
 // Delete deletes a record by ID
 func (t *gorTable) Delete(id interface{}) error {
-	sql := fmt.Sprintf("DELETE FROM %s WHERE id = ?", t.name) // #nosec G201 - Table name is system-controlled
-	result, err := t.db.Exec(sql, id)
+	return t.atomically(t.modelType, func(t *gorTable) error { return t.delete(id) })
+}
+
+func (t *gorTable) delete(id interface{}) error {
+	before, err := storedRow(t.exec(), t.adapter, t.name, t.modelType, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete record: %w", err)
+		return err
 	}
 
-	affected, err := result.RowsAffected()
+	affected, _, err := deleteRecords(t.exec(), t.adapter, t.name, t.modelType, id)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to delete record: %w", err)
 	}
 
 	if affected == 0 {
 		return fmt.Errorf("no record found with ID %v", id)
 	}
 
+	if err := recordVersion(t.exec(), t.adapter, t.name, VersionDestroy, before, nil); err != nil {
+		return err
+	}
+	if err := updateCounterCaches(t.exec(), t.adapter, before, -1); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // Find finds a record by ID
 func (t *gorTable) Find(id interface{}, dest interface{}) error {
-	sql := fmt.Sprintf("SELECT * FROM %s WHERE id = ?", t.name) // #nosec G201 - Table name is system-controlled
-	row := t.db.QueryRow(sql, id)
-
-	return t.scanRow(row, dest)
+	return findRecord(t.reader(), t.adapter, t.name, id, dest)
 }
 
 // BulkInsert inserts multiple records at once
@@ -184,35 +272,73 @@ func (t *gorTable) BulkInsert(models interface{}) error {
 		return nil // No records to insert
 	}
 
-	// Get the first model to determine structure
-	firstModel := v.Index(0).Interface()
-	fields, _, placeholders := t.extractFieldsAndValues(firstModel, false)
-
-	// Build bulk insert SQL
-	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", t.name, fields) // #nosec G201 - Table name is system-controlled
-
-	var allValues []interface{}
-	var valuePlaceholders []string
+	var columns []string
+	var rows [][]interface{}
 
 	for i := 0; i < v.Len(); i++ {
-		model := v.Index(i).Interface()
+		model := recordAt(v, i)
 
-		// Set timestamps for each model
+		// Stamp the tenant and set timestamps for each model
+		if err := stampTenant(t.ctx, t.name, model); err != nil {
+			return fmt.Errorf("record at index %d: %w", i, err)
+		}
 		setTimestamps(model, true)
+		setPolymorphicKeys(model)
+		if schemaOf(reflect.TypeOf(model)).Audited {
+			continue
+		}
 
-		_, values, _ := t.extractFieldsAndValues(model, false)
-		allValues = append(allValues, values...)
-		valuePlaceholders = append(valuePlaceholders, fmt.Sprintf("(%s)", placeholders))
-	}
+		// IDs are always assigned by the database so every row has the same columns
+		modelColumns, values := modelValues(model, false)
+		values, err := encryptValues(t.keys, reflect.TypeOf(model), modelColumns, values)
+		if err != nil {
+			return fmt.Errorf("record at index %d: %w", i, err)
+		}
+		columns = modelColumns
+		rows = append(rows, values)
+	}
+
+	modelType := reflect.TypeOf(recordAt(v, 0))
+	return t.atomically(modelType, func(t *gorTable) error {
+		// Each version needs the ID of its record, so audited records are
+		// inserted one by one
+		if schemaOf(modelType).Audited {
+			for i := 0; i < v.Len(); i++ {
+				model := recordAt(v, i)
+				if err := insertRecord(t.exec(), t.adapter, t.name, model); err != nil {
+					return fmt.Errorf("failed to bulk insert record at index %d: %w", i, err)
+				}
+				if err := recordVersion(t.exec(), t.adapter, t.name, VersionCreate, nil, model); err != nil {
+					return err
+				}
+			}
+		} else if err := t.insertRows(columns, rows); err != nil {
+			return err
+		}
 
-	sql += joinStrings(valuePlaceholders, ", ")
+		for i := 0; i < v.Len(); i++ {
+			if err := updateCounterCaches(t.exec(), t.adapter, recordAt(v, i), 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	_, err := t.db.Exec(sql, allValues...)
-	if err != nil {
-		return fmt.Errorf("failed to bulk insert: %w", err)
-	}
+// insertRows inserts rows in chunks that fit the parameter limit
+func (t *gorTable) insertRows(columns []string, rows [][]interface{}) error {
+	d := dialectFor(t.adapter)
+	return t.inChunks(len(rows), len(columns), func(ex executor, start, end int) error {
+		var args []interface{}
+		for _, row := range rows[start:end] {
+			args = append(args, row...)
+		}
 
-	return nil
+		if _, err := ex.Exec(buildInsertSQL(d, t.name, columns, end-start, ""), args...); err != nil {
+			return fmt.Errorf("failed to bulk insert: %w", err)
+		}
+		return nil
+	})
 }
 
 // BulkUpdate updates multiple records with the same values
@@ -226,39 +352,41 @@ func (t *gorTable) BulkUpdate(models interface{}) error {
 		return nil
 	}
 
-	// For bulk update, we'll use a transaction to update each record
-	tx, err := t.db.Begin()
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = tx.Rollback() // Ignore error, tx.Commit() will handle success case
-	}()
-
-	for i := 0; i < v.Len(); i++ {
-		model := v.Index(i).Interface()
-
-		// Set timestamps
-		setTimestamps(model, false)
-
-		// Generate update SQL
-		setParts, values := t.extractUpdateFields(model)
-		id := getID(model)
+	// Records are updated one by one in a transaction, each with its version
+	return t.transaction(func(t *gorTable) error {
+		for i := 0; i < v.Len(); i++ {
+			model := recordAt(v, i)
 
-		if id == nil {
-			return fmt.Errorf("cannot update record at index %d without ID", i)
-		}
+			// Check the tenant and set timestamps
+			if err := stampTenant(t.ctx, t.name, model); err != nil {
+				return fmt.Errorf("record at index %d: %w", i, err)
+			}
+			setTimestamps(model, false)
 
-		sql := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", t.name, setParts) // #nosec G201 - Table name is system-controlled
-		values = append(values, id)
+			id := getID(model)
+			if id == nil {
+				return fmt.Errorf("cannot update record at index %d without ID", i)
+			}
 
-		_, err := tx.Exec(sql, values...)
-		if err != nil {
-			return fmt.Errorf("failed to update record at index %d: %w", i, err)
+			before, err := storedRow(t.exec(), t.adapter, t.name, reflect.TypeOf(model), id)
+			if err != nil {
+				return err
+			}
+			affected, err := updateRecord(t.exec(), t.adapter, t.name, model)
+			if err != nil {
+				return fmt.Errorf("failed to update record at index %d: %w", i, err)
+			}
+			if affected > 0 {
+				if err := recordVersion(t.exec(), t.adapter, t.name, VersionUpdate, before, model); err != nil {
+					return err
+				}
+				if err := moveCounterCaches(t.exec(), t.adapter, before, model); err != nil {
+					return err
+				}
+			}
 		}
-	}
-
-	return tx.Commit()
+		return nil
+	})
 }
 
 // BulkDelete deletes multiple records by IDs
@@ -272,33 +400,42 @@ func (t *gorTable) BulkDelete(ids interface{}) error {
 		return nil
 	}
 
-	// Build IN clause
-	placeholders := make([]string, v.Len())
 	values := make([]interface{}, v.Len())
-
 	for i := 0; i < v.Len(); i++ {
-		placeholders[i] = "?"
 		values[i] = v.Index(i).Interface()
 	}
 
-	sql := fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", // #nosec G201 - Table name is system-controlled
-		t.name, joinStrings(placeholders, ", "))
-
-	result, err := t.db.Exec(sql, values...)
-	if err != nil {
-		return fmt.Errorf("failed to bulk delete: %w", err)
-	}
+	return t.atomically(t.modelType, func(t *gorTable) error {
+		var befores []interface{}
+		for _, id := range values {
+			before, err := storedRow(t.exec(), t.adapter, t.name, t.modelType, id)
+			if err != nil {
+				return err
+			}
+			if before != nil {
+				befores = append(befores, before)
+			}
+		}
 
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
+		affected, _, err := deleteRecords(t.exec(), t.adapter, t.name, t.modelType, values...)
+		if err != nil {
+			return fmt.Errorf("failed to bulk delete: %w", err)
+		}
 
-	if affected == 0 {
-		return fmt.Errorf("no records found with provided IDs")
-	}
+		if affected == 0 {
+			return fmt.Errorf("no records found with provided IDs")
+		}
 
-	return nil
+		for _, before := range befores {
+			if err := recordVersion(t.exec(), t.adapter, t.name, VersionDestroy, before, nil); err != nil {
+				return err
+			}
+			if err := updateCounterCaches(t.exec(), t.adapter, before, -1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // AddColumn adds a new column to the table
@@ -314,7 +451,7 @@ func (t *gorTable) AddColumn(column gor.Column) error {
 		sql += fmt.Sprintf(" DEFAULT %v", column.Default)
 	}
 
-	_, err := t.db.Exec(sql)
+	_, err := t.exec().Exec(sql)
 	if err != nil {
 		return fmt.Errorf("failed to add column: %w", err)
 	}
@@ -329,7 +466,7 @@ func (t *gorTable) AddColumn(column gor.Column) error {
 func (t *gorTable) DropColumn(name string) error {
 	sql := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", t.name, name)
 
-	_, err := t.db.Exec(sql)
+	_, err := t.exec().Exec(sql)
 	if err != nil {
 		return fmt.Errorf("failed to drop column: %w", err)
 	}
@@ -349,7 +486,7 @@ func (t *gorTable) DropColumn(name string) error {
 func (t *gorTable) AddIndex(index gor.Index) error {
 	sql := t.adapter.IndexSQL(index)
 
-	_, err := t.db.Exec(sql)
+	_, err := t.exec().Exec(sql)
 	if err != nil {
 		return fmt.Errorf("failed to add index: %w", err)
 	}
@@ -363,8 +500,11 @@ func (t *gorTable) AddIndex(index gor.Index) error {
 // DropIndex removes an index from the table
 func (t *gorTable) DropIndex(name string) error {
 	sql := fmt.Sprintf("DROP INDEX %s", name)
+	if inspector, err := introspectorFor(t.adapter); err == nil {
+		sql = inspector.DropIndexSQL(t.name, name)
+	}
 
-	_, err := t.db.Exec(sql)
+	_, err := t.exec().Exec(sql)
 	if err != nil {
 		return fmt.Errorf("failed to drop index: %w", err)
 	}
@@ -399,100 +539,16 @@ func (t *gorTable) validateModel(model interface{}) error {
 	return nil
 }
 
-func (t *gorTable) extractFieldsAndValues(model interface{}, includeID bool) (string, []interface{}, string) {
-	v := reflect.ValueOf(model)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
-	}
-
-	var fields []string
-	var values []interface{}
-	var placeholders []string
-
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Type().Field(i)
-		value := v.Field(i)
-
-		// Skip unexported fields
-		if !field.IsExported() {
-			continue
-		}
-
-		// Skip ID for inserts unless explicitly included
-		if !includeID && field.Name == "ID" {
-			continue
-		}
-
-		fieldName := toSnakeCase(field.Name)
-		fields = append(fields, fieldName)
-		values = append(values, value.Interface())
-		placeholders = append(placeholders, "?")
-	}
-
-	return joinStrings(fields, ", "), values, joinStrings(placeholders, ", ")
-}
-
-func (t *gorTable) extractUpdateFields(model interface{}) (string, []interface{}) {
-	v := reflect.ValueOf(model)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
-	}
-
-	var setParts []string
-	var values []interface{}
-
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Type().Field(i)
-		value := v.Field(i)
-
-		// Skip unexported fields and ID
-		if !field.IsExported() || field.Name == "ID" {
-			continue
-		}
-
-		fieldName := toSnakeCase(field.Name)
-		setParts = append(setParts, fmt.Sprintf("%s = ?", fieldName))
-		values = append(values, value.Interface())
-	}
-
-	return joinStrings(setParts, ", "), values
-}
-
-func (t *gorTable) scanRow(row *sql.Row, dest interface{}) error {
-	// Get the fields of the destination struct
-	destValue := reflect.ValueOf(dest)
-	if destValue.Kind() != reflect.Ptr {
-		return fmt.Errorf("destination must be a pointer")
-	}
-
-	destValue = destValue.Elem()
-	destType := destValue.Type()
-
-	// Prepare scan destinations
-	scanDests := make([]interface{}, destType.NumField())
-	for i := 0; i < destType.NumField(); i++ {
-		field := destValue.Field(i)
-		if field.CanSet() {
-			scanDests[i] = field.Addr().Interface()
-		}
-	}
-
-	return row.Scan(scanDests...)
-}
-
 func extractIndexes(t reflect.Type, tableName string) []gor.Index {
 	var indexes []gor.Index
 
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("gor")
-
-		if contains(tag, "index") {
+	for _, field := range schemaOf(t).Fields {
+		if field.HasOption("index") {
 			index := gor.Index{
-				Name:    fmt.Sprintf("idx_%s_%s", tableName, toSnakeCase(field.Name)),
+				Name:    fmt.Sprintf("idx_%s_%s", tableName, field.Column),
 				Table:   tableName,
-				Columns: []string{toSnakeCase(field.Name)},
-				Unique:  contains(tag, "unique"),
+				Columns: []string{field.Column},
+				Unique:  field.HasOption("unique"),
 			}
 			indexes = append(indexes, index)
 		}
@@ -0,0 +1,138 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// RunTask runs a `gor db` task, such as migrate or seed, and reports its
+// outcome to out. The tasks need the models, migrations and seeds the
+// application registers, so the gor CLI runs them through the db
+// subcommand of the application's main.go:
+//
+//	if len(os.Args) > 1 && os.Args[1] == "db" {
+//		if err := orm.RunTask(ctx, app.ORM(), os.Args[2:], os.Stdout); err != nil {
+//			log.Fatal(err)
+//		}
+//		return
+//	}
+//
+// Seeds are loaded for the environment in GOR_ENV or GO_ENV, development
+// by default.
+func RunTask(ctx context.Context, o gor.ORM, args []string, out io.Writer) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up", "migrate":
+		if err := o.Migrate(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "✓ All migrations completed")
+	case "down", "rollback":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+			steps = n
+		}
+		if err := o.Rollback(ctx, steps); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "✓ Rollback completed")
+	case "status":
+		migrations, err := o.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "📄 Migration Status:")
+		if len(migrations) == 0 {
+			fmt.Fprintln(out, "  No migrations")
+		}
+		for _, migration := range migrations {
+			state := "pending"
+			if !migration.AppliedAt.IsZero() {
+				state = "applied"
+			}
+			fmt.Fprintf(out, "  %s_%s [%s]\n", migration.Version, migration.Name, state)
+		}
+	case "diff":
+		name := "schema_diff"
+		if len(args) > 1 {
+			name = args[1]
+		}
+		path, err := GenerateDiffMigration(o, DefaultMigrationsDir, name)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			fmt.Fprintln(out, "✓ The database schema matches the models")
+		} else {
+			fmt.Fprintf(out, "✓ Created %s\n", path)
+		}
+	case "reencrypt":
+		rewritten, err := ReencryptModels(ctx, o)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "✓ Re-encrypted %d rows\n", rewritten)
+	case "schema:dump":
+		schema, err := os.Create(DefaultSchemaPath)
+		if err != nil {
+			return fmt.Errorf("failed to create schema: %w", err)
+		}
+		err = o.DumpSchema(schema)
+		if closeErr := schema.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "✓ Dumped the schema to %s\n", DefaultSchemaPath)
+	case "schema:load":
+		schema, err := os.Open(DefaultSchemaPath)
+		if err != nil {
+			return fmt.Errorf("failed to open schema: %w", err)
+		}
+		defer schema.Close()
+
+		if err := o.LoadSchema(schema); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "✓ Loaded the schema from %s\n", DefaultSchemaPath)
+	case "seed":
+		if err := NewSeeder(o, taskEnvironment()).Run(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "✓ Database seeded")
+	case "reset":
+		if err := NewSeeder(o, taskEnvironment()).Reset(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "✓ Database reset and seeded")
+	default:
+		return fmt.Errorf("unknown action: %s", action)
+	}
+	return nil
+}
+
+// taskEnvironment returns the environment the application runs in
+func taskEnvironment() string {
+	env := os.Getenv("GOR_ENV")
+	if env == "" {
+		env = os.Getenv("GO_ENV")
+	}
+	if env == "" {
+		env = "development"
+	}
+	return env
+}
@@ -0,0 +1,44 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+func TestRunTask_SeedsTheEnvironment(t *testing.T) {
+	orm := setupTestORM(t)
+	t.Setenv("GOR_ENV", "staging")
+
+	var ran []string
+	registerTestSeed(t, "", "001_task_shared", func(ctx context.Context, o gor.ORM) error {
+		ran = append(ran, "shared")
+		return nil
+	})
+	registerTestSeed(t, "staging", "001_task_staging", func(ctx context.Context, o gor.ORM) error {
+		ran = append(ran, "staging")
+		return nil
+	})
+	registerTestSeed(t, "development", "001_task_development", func(ctx context.Context, o gor.ORM) error {
+		t.Error("development seeds should not run in staging")
+		return nil
+	})
+
+	var out bytes.Buffer
+	if err := RunTask(context.Background(), orm, []string{"seed"}, &out); err != nil {
+		t.Fatalf("RunTask(seed) error = %v", err)
+	}
+	if len(ran) != 2 || ran[0] != "shared" || ran[1] != "staging" {
+		t.Errorf("seeds ran %v, want the shared then the staging seed", ran)
+	}
+	if !strings.Contains(out.String(), "seeded") {
+		t.Errorf("RunTask(seed) output = %q, want a report", out.String())
+	}
+
+	if err := RunTask(context.Background(), orm, []string{"launch"}, &out); err == nil || !strings.Contains(err.Error(), "unknown action") {
+		t.Errorf("RunTask(launch) error = %v, want an unknown action", err)
+	}
+}
@@ -0,0 +1,157 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// ErrNoTenant is returned in tests for statements on a tenant model whose
+// context has no tenant and does not come from WithoutTenant
+var ErrNoTenant = errors.New("no tenant in context")
+
+// ErrWrongTenant is returned when saving a record of another tenant
+var ErrWrongTenant = errors.New("record belongs to another tenant")
+
+type tenantKey struct{}
+
+// tenantScope is the tenant carried by a context; a nil scope from
+// WithoutTenant disables scoping
+type tenantScope struct {
+	id interface{}
+}
+
+// WithTenant returns a context whose statements are scoped to tenant. Models
+// with a field tagged tenant only see that tenant's rows, and records
+// created with the context are stamped with it:
+//
+//	type Project struct {
+//		gor.BaseModel
+//		TenantID int64 `gor:"tenant;index"`
+//		Name     string
+//	}
+//
+//	db := orm.WithContext(WithTenant(ctx, account.ID))
+func WithTenant(ctx context.Context, tenant interface{}) context.Context {
+	return context.WithValue(ctx, tenantKey{}, &tenantScope{id: tenant})
+}
+
+// WithoutTenant returns a context whose statements see the rows of every
+// tenant, for admin code and jobs that work across accounts
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantKey{}, (*tenantScope)(nil))
+}
+
+// TenantFrom returns the tenant of ctx, if any
+func TenantFrom(ctx context.Context) (interface{}, bool) {
+	scope, _ := ctx.Value(tenantKey{}).(*tenantScope)
+	if scope == nil {
+		return nil, false
+	}
+	return scope.id, true
+}
+
+// TenantMiddleware scopes each request to the tenant resolve returns, such
+// as the account of the signed-in user. Handlers must run their queries
+// with the request context, db.WithContext(ctx).
+func TenantMiddleware(resolve func(ctx *gor.Context) (interface{}, error)) gor.MiddlewareFunc {
+	return func(next gor.HandlerFunc) gor.HandlerFunc {
+		return func(ctx *gor.Context) error {
+			tenant, err := resolve(ctx)
+			if err != nil {
+				return err
+			}
+			ctx.Context = WithTenant(ctx.Context, tenant)
+			return next(ctx)
+		}
+	}
+}
+
+// TenantJobMiddleware scopes each job to the tenant Resolve returns,
+// typically read from the job's payload
+type TenantJobMiddleware struct {
+	Resolve func(job gor.Job) (interface{}, error)
+}
+
+// Process runs the job scoped to its tenant
+func (m TenantJobMiddleware) Process(ctx context.Context, job gor.Job, next func(context.Context, gor.Job) error) error {
+	tenant, err := m.Resolve(job)
+	if err != nil {
+		return err
+	}
+	return next(WithTenant(ctx, tenant), job)
+}
+
+// tenantOf returns the tenant statements on ctx are scoped to. It reports
+// false when they are not scoped: the context comes from WithoutTenant, or
+// has no tenant outside tests. In tests a missing tenant is ErrNoTenant, so
+// unscoped access is caught before it ships.
+func tenantOf(ctx context.Context, table string) (interface{}, bool, error) {
+	scope, ok := ctx.Value(tenantKey{}).(*tenantScope)
+	switch {
+	case scope != nil:
+		return scope.id, true, nil
+	case ok:
+		return nil, false, nil
+	case testEnvironment():
+		return nil, false, fmt.Errorf("%w: %s is scoped to tenants", ErrNoTenant, table)
+	}
+	return nil, false, nil
+}
+
+// tenantCondition returns the condition restricting table, which holds
+// modelType, to the tenant of ctx and its argument. Both are empty when
+// the model has no tenant field or ctx is not scoped.
+func tenantCondition(ctx context.Context, d sqlDialect, table string, modelType reflect.Type) (string, []interface{}, error) {
+	field := tenantFieldOf(modelType)
+	if field == nil {
+		return "", nil, nil
+	}
+
+	tenant, scoped, err := tenantOf(ctx, table)
+	if !scoped {
+		return "", nil, err
+	}
+	return d.QuoteIdentifier(table+"."+field.Column) + " = ?", []interface{}{tenant}, nil
+}
+
+// stampTenant sets the tenant field of a new record to the tenant of ctx,
+// failing with ErrWrongTenant when it already holds another tenant
+func stampTenant(ctx context.Context, table string, model interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(model))
+	field := tenantFieldOf(v.Type())
+	if field == nil {
+		return nil
+	}
+
+	tenant, scoped, err := tenantOf(ctx, table)
+	if !scoped {
+		return err
+	}
+
+	target := v.FieldByIndex(field.Index)
+	value := reflect.ValueOf(tenant)
+	if !value.Type().ConvertibleTo(target.Type()) {
+		return fmt.Errorf("tenant %v cannot be stored in %s.%s", tenant, table, field.Column)
+	}
+	value = value.Convert(target.Type())
+
+	if !target.IsZero() && !sameValue(target.Interface(), value.Interface()) {
+		return fmt.Errorf("%w: %s.%s is %v, not %v", ErrWrongTenant, table, field.Column, target.Interface(), tenant)
+	}
+	if target.CanSet() {
+		target.Set(value)
+	}
+	return nil
+}
+
+// tenantFieldOf returns the tenant field of a model type, if any
+func tenantFieldOf(modelType reflect.Type) *modelField {
+	if modelType == nil {
+		return nil
+	}
+	return schemaOf(modelType).Tenant
+}
@@ -0,0 +1,163 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type TenantProject struct {
+	ID        int64     `gor:"primary_key;auto_increment"`
+	TenantID  int64     `gor:"tenant;not_null"`
+	Name      string    `gor:"not_null" validate:"uniqueness"`
+	CreatedAt time.Time `gor:"not_null"`
+	UpdatedAt time.Time `gor:"not_null"`
+}
+
+func (p *TenantProject) TableName() string { return "tenant_projects" }
+
+// setupTenantORM returns the ORM and its views scoped to two tenants, each
+// with a project named roadmap
+func setupTenantORM(t *testing.T) (orm, acme, globex gor.ORM) {
+	orm = setupTestORM(t)
+	if err := orm.Register(&TenantProject{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	acme = orm.WithContext(WithTenant(context.Background(), int64(1)))
+	globex = orm.WithContext(WithTenant(context.Background(), 2))
+	for _, db := range []gor.ORM{acme, globex} {
+		if err := db.Create(&TenantProject{Name: "roadmap"}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	return orm, acme, globex
+}
+
+func TestTenant_ScopesQueriesAndStampsRecords(t *testing.T) {
+	orm, acme, globex := setupTenantORM(t)
+
+	var theirs TenantProject
+	if err := globex.Query(&TenantProject{}).First(&theirs); err != nil {
+		t.Fatal(err)
+	}
+	if theirs.TenantID != 2 {
+		t.Errorf("Create() stamped tenant %d, want 2", theirs.TenantID)
+	}
+
+	count, err := acme.Query(&TenantProject{}).Where("name = ? OR id = ?", "roadmap", theirs.ID).Count()
+	if err != nil || count != 1 {
+		t.Errorf("Count() = %d, %v; want only the tenant's project", count, err)
+	}
+
+	var found TenantProject
+	if err := acme.Find(&found, theirs.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Find() of another tenant's project error = %v, want sql.ErrNoRows", err)
+	}
+	if err := acme.Table("tenant_projects").Find(theirs.ID, &found); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Table.Find() of another tenant's project error = %v, want sql.ErrNoRows", err)
+	}
+	if err := acme.Table("tenant_projects").Delete(theirs.ID); err == nil {
+		t.Error("Table.Delete() of another tenant's project should fail")
+	}
+	if err := acme.Update(&theirs); !errors.Is(err, ErrWrongTenant) {
+		t.Errorf("Update() of another tenant's project error = %v, want ErrWrongTenant", err)
+	}
+	if err := acme.Create(&TenantProject{TenantID: 2, Name: "hijack"}); !errors.Is(err, ErrWrongTenant) {
+		t.Errorf("Create() for another tenant error = %v, want ErrWrongTenant", err)
+	}
+	if err := acme.Create(&TenantProject{Name: "roadmap"}); err == nil {
+		t.Error("Create() of a duplicate name within a tenant should fail validation")
+	}
+
+	if updated, err := acme.Query(&TenantProject{}).UpdateAll(map[string]interface{}{"name": "plan"}); err != nil || updated != 1 {
+		t.Errorf("UpdateAll() = %d, %v; want 1", updated, err)
+	}
+
+	admin := orm.WithContext(WithoutTenant(context.Background()))
+	var names []string
+	if err := admin.Query(&TenantProject{}).Order("id").Pluck("name", &names); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "plan" || names[1] != "roadmap" {
+		t.Errorf("names without tenant = %v, want both tenants' projects", names)
+	}
+}
+
+func TestTenant_BulkOperations(t *testing.T) {
+	orm, acme, _ := setupTenantORM(t)
+	projects := acme.Table("tenant_projects")
+
+	if err := projects.BulkInsert([]TenantProject{{Name: "alpha"}, {Name: "beta"}}); err != nil {
+		t.Fatalf("BulkInsert() error = %v", err)
+	}
+	if count, err := acme.Query(&TenantProject{}).Count(); err != nil || count != 3 {
+		t.Errorf("Count() after BulkInsert() = %d, %v; want 3", count, err)
+	}
+
+	rows := []TenantProject{{Name: "alpha"}}
+	if _, err := projects.BulkUpsert(rows, gor.OnConflict{Columns: []string{"name"}}); err == nil {
+		t.Error("BulkUpsert() without the tenant among the conflict columns should fail")
+	}
+
+	if _, err := orm.DB().Exec(`CREATE UNIQUE INDEX idx_tenant_projects_name ON tenant_projects (tenant_id, name)`); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := projects.BulkUpsert(rows, gor.OnConflict{Columns: []string{"tenant_id", "name"}})
+	if err != nil || len(ids) != 1 || rows[0].TenantID != 1 {
+		t.Errorf("BulkUpsert() = %v, %v with tenant %d; want one row of tenant 1", ids, err, rows[0].TenantID)
+	}
+}
+
+func TestTenant_FailsUnscopedAccessInTests(t *testing.T) {
+	orm, _, _ := setupTenantORM(t)
+
+	t.Setenv("GOR_ENV", "test")
+	if _, err := orm.Query(&TenantProject{}).Count(); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("unscoped Count() error = %v, want ErrNoTenant", err)
+	}
+	if err := orm.Create(&TenantProject{Name: "orphan"}); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("unscoped Create() error = %v, want ErrNoTenant", err)
+	}
+	if _, err := orm.Query(&TestUser{}).Count(); err != nil {
+		t.Errorf("Count() of a model without tenants error = %v", err)
+	}
+
+	t.Setenv("GOR_ENV", "development")
+	if count, err := orm.Query(&TenantProject{}).Count(); err != nil || count != 2 {
+		t.Errorf("unscoped Count() outside tests = %d, %v; want every tenant's rows", count, err)
+	}
+}
+
+func TestTenant_Middleware(t *testing.T) {
+	_, acme, _ := setupTenantORM(t)
+
+	handler := TenantMiddleware(func(ctx *gor.Context) (interface{}, error) {
+		return int64(2), nil
+	})(func(ctx *gor.Context) error {
+		tenant, ok := TenantFrom(ctx)
+		if !ok || tenant != int64(2) {
+			t.Errorf("TenantFrom() = %v, %v; want 2", tenant, ok)
+		}
+		return nil
+	})
+	if err := handler(&gor.Context{Context: context.Background()}); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+
+	job := TenantJobMiddleware{Resolve: func(gor.Job) (interface{}, error) { return int64(1), nil }}
+	err := job.Process(context.Background(), nil, func(ctx context.Context, _ gor.Job) error {
+		count, err := acme.WithContext(ctx).Query(&TenantProject{}).Count()
+		if err != nil || count != 1 {
+			t.Errorf("Count() in job = %d, %v; want 1", count, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -8,24 +9,169 @@ import (
 	"github.com/cuemby/gor/pkg/gor"
 )
 
-// gorTransaction implements the gor.Transaction interface
+// gorTransaction implements the gor.Transaction interface. Nested
+// transactions share the underlying *sql.Tx and are backed by savepoints.
 type gorTransaction struct {
-	tx  *sql.Tx
-	orm *gorORM
+	db      *sql.DB
+	tx      *sql.Tx
+	ctx     context.Context
+	adapter gor.DatabaseAdapter
+	keys    *keyring
+
+	// origin is the transaction a WithContext view was made from
+	origin *gorTransaction
+
+	parent    *gorTransaction
+	savepoint string
+	state     *txState
+
+	afterCommit   []func()
+	afterRollback []func()
+}
+
+// txState is shared by a transaction and all of its nested transactions
+type txState struct {
+	savepoints int
+
+	// rolledBack holds the AfterRollback callbacks of nested transactions
+	// that were rolled back to their savepoint
+	rolledBack []func()
+}
+
+func newTransaction(ctx context.Context, db *sql.DB, tx *sql.Tx, adapter gor.DatabaseAdapter, keys *keyring) *gorTransaction {
+	return &gorTransaction{db: db, tx: tx, ctx: ctx, adapter: adapter, keys: keys, state: &txState{}}
+}
+
+// WithContext returns a view of the transaction whose statements run with
+// ctx. Commit, Rollback and callbacks act on the original transaction.
+func (t *gorTransaction) WithContext(ctx context.Context) gor.Transaction {
+	if ctx == nil {
+		panic("orm: nil context")
+	}
+	return &gorTransaction{db: t.db, tx: t.tx, ctx: ctx, adapter: t.adapter, keys: t.keys, origin: t.owner()}
+}
+
+// owner returns the transaction that holds the savepoint and callbacks
+func (t *gorTransaction) owner() *gorTransaction {
+	if t.origin != nil {
+		return t.origin
+	}
+	return t
+}
+
+// exec returns the transaction bound to its context
+func (t *gorTransaction) exec() executor {
+	return withContext(t.ctx, t.tx, t.adapter, t.keys)
 }
 
-// Commit commits the transaction
+// Commit commits the transaction. For a nested transaction the savepoint is
+// released and its callbacks are handed to the enclosing transaction.
 func (t *gorTransaction) Commit() error {
-	return t.tx.Commit()
+	t = t.owner()
+	if t.parent != nil {
+		if _, err := t.exec().Exec("RELEASE SAVEPOINT " + t.savepoint); err != nil {
+			return err
+		}
+		t.parent.afterCommit = append(t.parent.afterCommit, t.afterCommit...)
+		t.parent.afterRollback = append(t.parent.afterRollback, t.afterRollback...)
+		return nil
+	}
+
+	if err := t.tx.Commit(); err != nil {
+		t.runCallbacks(append(t.state.rolledBack, t.afterRollback...))
+		return err
+	}
+
+	t.runCallbacks(append(t.afterCommit, t.state.rolledBack...))
+	return nil
 }
 
-// Rollback rolls back the transaction
+// Rollback rolls back the transaction. For a nested transaction only the
+// work done since its savepoint is undone.
 func (t *gorTransaction) Rollback() error {
-	return t.tx.Rollback()
+	t = t.owner()
+	if t.parent != nil {
+		if _, err := t.exec().Exec("ROLLBACK TO SAVEPOINT " + t.savepoint); err != nil {
+			return err
+		}
+		t.state.rolledBack = append(t.state.rolledBack, t.afterRollback...)
+		_, err := t.exec().Exec("RELEASE SAVEPOINT " + t.savepoint)
+		return err
+	}
+
+	err := t.tx.Rollback()
+	t.runCallbacks(append(t.state.rolledBack, t.afterRollback...))
+	return err
+}
+
+// Transaction runs fn in a nested transaction backed by a savepoint. An
+// error or panic from fn rolls back only the nested work.
+func (t *gorTransaction) Transaction(fn func(tx gor.Transaction) error) error {
+	parent := t.owner()
+	parent.state.savepoints++
+	nested := &gorTransaction{
+		db:        t.db,
+		tx:        t.tx,
+		ctx:       t.ctx,
+		adapter:   t.adapter,
+		keys:      t.keys,
+		parent:    parent,
+		savepoint: fmt.Sprintf("gor_savepoint_%d", parent.state.savepoints),
+		state:     parent.state,
+	}
+
+	if _, err := nested.exec().Exec("SAVEPOINT " + nested.savepoint); err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = nested.Rollback() // Ignore rollback errors in panic recovery
+			panic(r)
+		}
+	}()
+
+	if err := fn(nested); err != nil {
+		if rbErr := nested.Rollback(); rbErr != nil {
+			return fmt.Errorf("tx error: %v, rollback error: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return nested.Commit()
+}
+
+// AfterCommit registers fn to run once the outermost transaction commits
+func (t *gorTransaction) AfterCommit(fn func()) {
+	t = t.owner()
+	t.afterCommit = append(t.afterCommit, fn)
+}
+
+// AfterRollback registers fn to run once the outermost transaction finishes
+// if the work it belongs to was rolled back
+func (t *gorTransaction) AfterRollback(fn func()) {
+	t = t.owner()
+	t.afterRollback = append(t.afterRollback, fn)
+}
+
+func (t *gorTransaction) runCallbacks(callbacks []func()) {
+	t.state.rolledBack = nil
+	t.afterCommit, t.afterRollback = nil, nil
+	for _, fn := range callbacks {
+		fn()
+	}
 }
 
 // Create creates a new record within the transaction
 func (t *gorTransaction) Create(model interface{}) error {
+	// Stamp the context's tenant, then run tag and model validations
+	if err := stampTenant(t.ctx, getTableName(reflect.TypeOf(model)), model); err != nil {
+		return err
+	}
+	if err := validateRecord(t.exec(), t.adapter, getTableName(reflect.TypeOf(model)), model); err != nil {
+		return err
+	}
+
 	// Call BeforeCreate hook if model implements it
 	if hook, ok := model.(interface{ BeforeCreate() error }); ok {
 		if err := hook.BeforeCreate(); err != nil {
@@ -36,23 +182,14 @@ func (t *gorTransaction) Create(model interface{}) error {
 	// Set timestamps
 	setTimestamps(model, true)
 
-	// Generate insert SQL
-	tableName := getTableName(reflect.TypeOf(model))
-	fields, values, placeholders := t.extractFieldsAndValues(model, true)
-
-	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", // #nosec G201 - Table name is system-controlled
-		tableName,
-		fields,
-		placeholders)
-
-	result, err := t.tx.Exec(sql, values...)
-	if err != nil {
+	if err := insertRecord(t.exec(), t.adapter, getTableName(reflect.TypeOf(model)), model); err != nil {
 		return err
 	}
-
-	// Set ID if auto-increment
-	if id, err := result.LastInsertId(); err == nil {
-		setID(model, id)
+	if err := recordVersion(t.exec(), t.adapter, getTableName(reflect.TypeOf(model)), VersionCreate, nil, model); err != nil {
+		return err
+	}
+	if err := updateCounterCaches(t.exec(), t.adapter, model, 1); err != nil {
+		return err
 	}
 
 	// Call AfterCreate hook if model implements it
@@ -67,6 +204,14 @@ func (t *gorTransaction) Create(model interface{}) error {
 
 // Update updates an existing record within the transaction
 func (t *gorTransaction) Update(model interface{}) error {
+	// Stamp the context's tenant, then run tag and model validations
+	if err := stampTenant(t.ctx, getTableName(reflect.TypeOf(model)), model); err != nil {
+		return err
+	}
+	if err := validateRecord(t.exec(), t.adapter, getTableName(reflect.TypeOf(model)), model); err != nil {
+		return err
+	}
+
 	// Call BeforeUpdate hook
 	if hook, ok := model.(interface{ BeforeUpdate() error }); ok {
 		if err := hook.BeforeUpdate(); err != nil {
@@ -77,18 +222,22 @@ func (t *gorTransaction) Update(model interface{}) error {
 	// Set updated timestamp
 	setTimestamps(model, false)
 
-	// Generate update SQL
-	tableName := getTableName(reflect.TypeOf(model))
-	setParts, values := t.extractUpdateFields(model)
-	id := getID(model)
-
-	sql := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", tableName, setParts) // #nosec G201 - Table name is system-controlled
-	values = append(values, id)
-
-	_, err := t.tx.Exec(sql, values...)
+	before, err := storedRow(t.exec(), t.adapter, getTableName(reflect.TypeOf(model)), reflect.TypeOf(model), getID(model))
 	if err != nil {
 		return err
 	}
+	affected, err := updateRecord(t.exec(), t.adapter, getTableName(reflect.TypeOf(model)), model)
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		if err := recordVersion(t.exec(), t.adapter, getTableName(reflect.TypeOf(model)), VersionUpdate, before, model); err != nil {
+			return err
+		}
+		if err := moveCounterCaches(t.exec(), t.adapter, before, model); err != nil {
+			return err
+		}
+	}
 
 	// Call AfterUpdate hook
 	if hook, ok := model.(interface{ AfterUpdate() error }); ok {
@@ -109,14 +258,23 @@ func (t *gorTransaction) Delete(model interface{}) error {
 		}
 	}
 
-	id := getID(model)
-	tableName := getTableName(reflect.TypeOf(model))
-
-	sql := fmt.Sprintf("DELETE FROM %s WHERE id = ?", tableName) // #nosec G201 - Table name is system-controlled
-	_, err := t.tx.Exec(sql, id)
+	before, err := storedRow(t.exec(), t.adapter, getTableName(reflect.TypeOf(model)), reflect.TypeOf(model), getID(model))
 	if err != nil {
 		return err
 	}
+	affected, deletedAt, err := deleteRecords(t.exec(), t.adapter, getTableName(reflect.TypeOf(model)), reflect.TypeOf(model), getID(model))
+	if err != nil {
+		return err
+	}
+	markDeleted(model, deletedAt)
+	if affected > 0 {
+		if err := recordVersion(t.exec(), t.adapter, getTableName(reflect.TypeOf(model)), VersionDestroy, before, nil); err != nil {
+			return err
+		}
+		if err := updateCounterCaches(t.exec(), t.adapter, before, -1); err != nil {
+			return err
+		}
+	}
 
 	// Call AfterDelete hook
 	if hook, ok := model.(interface{ AfterDelete() error }); ok {
@@ -128,183 +286,28 @@ func (t *gorTransaction) Delete(model interface{}) error {
 	return nil
 }
 
-// Query creates a new query builder within the transaction
+// Query creates a new query builder that runs within the transaction
 func (t *gorTransaction) Query(model interface{}) gor.QueryBuilder {
-	// Create a transaction-aware query builder
-	return &TransactionQueryBuilder{
-		QueryBuilder: NewQueryBuilder(model, nil, t.orm.adapter).(*QueryBuilder),
-		tx:           t.tx,
-	}
+	qb := NewQueryBuilder(model, nil, t.adapter).(*QueryBuilder)
+	qb.ctx = t.ctx
+	qb.txn = t
+	qb.keys = t.keys
+	return qb
 }
 
 // Exec executes raw SQL within the transaction
 func (t *gorTransaction) Exec(sqlQuery string, args ...interface{}) (sql.Result, error) {
-	return t.tx.Exec(sqlQuery, args...)
+	return t.exec().Exec(sqlQuery, args...)
 }
 
 // QuerySQL executes a raw SQL query within the transaction
 func (t *gorTransaction) QuerySQL(sqlQuery string, args ...interface{}) (*sql.Rows, error) {
-	return t.tx.Query(sqlQuery, args...)
+	return t.exec().Query(sqlQuery, args...)
 }
 
 // QueryRow executes a raw SQL query that returns a single row within the transaction
 func (t *gorTransaction) QueryRow(sqlQuery string, args ...interface{}) *sql.Row {
-	return t.tx.QueryRow(sqlQuery, args...)
-}
-
-// TransactionQueryBuilder wraps QueryBuilder to use transaction
-type TransactionQueryBuilder struct {
-	*QueryBuilder
-	tx *sql.Tx
-}
-
-// Override methods to use transaction
-func (tqb *TransactionQueryBuilder) First(dest interface{}) error {
-	tqb.limitValue = &[]int{1}[0]
-
-	sql, args, err := tqb.adapter.GenerateSQL(tqb.QueryBuilder)
-	if err != nil {
-		return err
-	}
-
-	row := tqb.tx.QueryRow(sql, args...)
-	return tqb.scanRow(row, dest)
-}
-
-func (tqb *TransactionQueryBuilder) FindAll(dest interface{}) error {
-	sql, args, err := tqb.adapter.GenerateSQL(tqb.QueryBuilder)
-	if err != nil {
-		return err
-	}
-
-	rows, err := tqb.tx.Query(sql, args...)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	return tqb.scanRows(rows, dest)
-}
-
-func (tqb *TransactionQueryBuilder) Count() (int64, error) {
-	countQB := &QueryBuilder{
-		model:           tqb.model,
-		modelType:       tqb.modelType,
-		tableName:       tqb.tableName,
-		adapter:         tqb.adapter,
-		whereConditions: tqb.whereConditions,
-		whereArgs:       tqb.whereArgs,
-		joins:           tqb.joins,
-		isCount:         true,
-	}
-
-	sql, args, err := tqb.adapter.GenerateSQL(countQB)
-	if err != nil {
-		return 0, err
-	}
-
-	var count int64
-	err = tqb.tx.QueryRow(sql, args...).Scan(&count)
-	return count, err
-}
-
-func (tqb *TransactionQueryBuilder) UpdateAll(updates map[string]interface{}) (int64, error) {
-	setParts := make([]string, 0, len(updates))
-	args := make([]interface{}, 0, len(updates)+len(tqb.whereArgs))
-
-	for field, value := range updates {
-		setParts = append(setParts, fmt.Sprintf("%s = ?", field))
-		args = append(args, value)
-	}
-
-	sql := fmt.Sprintf("UPDATE %s SET %s", tqb.tableName, joinStrings(setParts, ", ")) // #nosec G201 - Table name is system-controlled
-
-	if len(tqb.whereConditions) > 0 {
-		sql += " WHERE " + joinStrings(tqb.whereConditions, " AND ")
-		args = append(args, tqb.whereArgs...)
-	}
-
-	result, err := tqb.tx.Exec(sql, args...)
-	if err != nil {
-		return 0, err
-	}
-
-	return result.RowsAffected()
-}
-
-func (tqb *TransactionQueryBuilder) DeleteAll() (int64, error) {
-	sql := fmt.Sprintf("DELETE FROM %s", tqb.tableName) // #nosec G201 - Table name is system-controlled
-
-	if len(tqb.whereConditions) > 0 {
-		sql += " WHERE " + joinStrings(tqb.whereConditions, " AND ")
-	}
-
-	result, err := tqb.tx.Exec(sql, tqb.whereArgs...)
-	if err != nil {
-		return 0, err
-	}
-
-	return result.RowsAffected()
-}
-
-// Helper functions for transaction
-func (t *gorTransaction) extractFieldsAndValues(model interface{}, includeID bool) (string, []interface{}, string) {
-	v := reflect.ValueOf(model)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
-	}
-
-	var fields []string
-	var values []interface{}
-	var placeholders []string
-
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Type().Field(i)
-		value := v.Field(i)
-
-		// Skip unexported fields
-		if !field.IsExported() {
-			continue
-		}
-
-		// Skip ID for inserts unless explicitly included
-		if !includeID && field.Name == "ID" {
-			continue
-		}
-
-		fieldName := toSnakeCase(field.Name)
-		fields = append(fields, fieldName)
-		values = append(values, value.Interface())
-		placeholders = append(placeholders, "?")
-	}
-
-	return joinStrings(fields, ", "), values, joinStrings(placeholders, ", ")
-}
-
-func (t *gorTransaction) extractUpdateFields(model interface{}) (string, []interface{}) {
-	v := reflect.ValueOf(model)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
-	}
-
-	var setParts []string
-	var values []interface{}
-
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Type().Field(i)
-		value := v.Field(i)
-
-		// Skip unexported fields and ID
-		if !field.IsExported() || field.Name == "ID" {
-			continue
-		}
-
-		fieldName := toSnakeCase(field.Name)
-		setParts = append(setParts, fmt.Sprintf("%s = ?", fieldName))
-		values = append(values, value.Interface())
-	}
-
-	return joinStrings(setParts, ", "), values
+	return t.exec().QueryRow(sqlQuery, args...)
 }
 
 func joinStrings(strs []string, sep string) string {
@@ -0,0 +1,163 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+func setupTransactionORM(t *testing.T) gor.ORM {
+	config := gor.DatabaseConfig{
+		Driver:          "sqlite3",
+		Database:        filepath.Join(t.TempDir(), "tx.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}
+
+	orm := NewORM(config)
+	if err := orm.Connect(context.Background(), config); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { orm.Close() })
+
+	if err := orm.Register(&TestUser{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	return orm
+}
+
+func userNames(t *testing.T, orm gor.ORM) []string {
+	t.Helper()
+
+	var users []TestUser
+	if err := orm.Query(&users).Order("id").FindAll(&users); err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+
+	names := []string{}
+	for _, user := range users {
+		names = append(names, user.Name)
+	}
+	return names
+}
+
+func TestTransaction_NestedSavepoints(t *testing.T) {
+	orm := setupTransactionORM(t)
+
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		if err := tx.Create(&TestUser{Name: "outer", Email: "outer@example.com"}); err != nil {
+			return err
+		}
+
+		err := tx.Transaction(func(nested gor.Transaction) error {
+			if err := nested.Create(&TestUser{Name: "discarded", Email: "discarded@example.com"}); err != nil {
+				return err
+			}
+			return fmt.Errorf("nested failure")
+		})
+		if err == nil || err.Error() != "nested failure" {
+			return fmt.Errorf("nested Transaction() error = %v", err)
+		}
+
+		return tx.Transaction(func(nested gor.Transaction) error {
+			return nested.Transaction(func(inner gor.Transaction) error {
+				return inner.Create(&TestUser{Name: "kept", Email: "kept@example.com"})
+			})
+		})
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	if names := userNames(t, orm); !reflect.DeepEqual(names, []string{"outer", "kept"}) {
+		t.Errorf("users = %v, want [outer kept]", names)
+	}
+}
+
+func TestTransaction_NestedPanicRollsBackSavepoint(t *testing.T) {
+	orm := setupTransactionORM(t)
+
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		if err := tx.Create(&TestUser{Name: "outer", Email: "outer@example.com"}); err != nil {
+			return err
+		}
+
+		func() {
+			defer func() { _ = recover() }()
+			_ = tx.Transaction(func(nested gor.Transaction) error {
+				if err := nested.Create(&TestUser{Name: "panicked", Email: "panicked@example.com"}); err != nil {
+					return err
+				}
+				panic("boom")
+			})
+		}()
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	if names := userNames(t, orm); !reflect.DeepEqual(names, []string{"outer"}) {
+		t.Errorf("users = %v, want [outer]", names)
+	}
+}
+
+func TestTransaction_Callbacks(t *testing.T) {
+	orm := setupTransactionORM(t)
+
+	var events []string
+	record := func(event string) func() {
+		return func() { events = append(events, event) }
+	}
+
+	err := orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		tx.AfterCommit(record("outer commit"))
+		tx.AfterRollback(record("outer rollback"))
+
+		_ = tx.Transaction(func(nested gor.Transaction) error {
+			nested.AfterCommit(record("failed commit"))
+			nested.AfterRollback(record("failed rollback"))
+			return fmt.Errorf("nested failure")
+		})
+
+		_ = tx.Transaction(func(nested gor.Transaction) error {
+			nested.AfterCommit(record("nested commit"))
+			return nil
+		})
+
+		if len(events) != 0 {
+			t.Errorf("callbacks ran before the outermost transaction finished: %v", events)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	want := []string{"outer commit", "nested commit", "failed rollback"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events after commit = %v, want %v", events, want)
+	}
+
+	events = nil
+	_ = orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		tx.AfterCommit(record("commit"))
+		_ = tx.Transaction(func(nested gor.Transaction) error {
+			nested.AfterRollback(record("nested rollback"))
+			return nil
+		})
+		return fmt.Errorf("outer failure")
+	})
+
+	if !reflect.DeepEqual(events, []string{"nested rollback"}) {
+		t.Errorf("events after rollback = %v, want [nested rollback]", events)
+	}
+}
@@ -0,0 +1,273 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// UpsertReturning is true: SQLite has supported RETURNING since 3.35
+func (a *SQLiteAdapter) UpsertReturning() bool { return true }
+
+// MaxPlaceholders is SQLITE_MAX_VARIABLE_NUMBER since SQLite 3.32
+func (a *SQLiteAdapter) MaxPlaceholders() int { return 32766 }
+
+func (a *PostgreSQLAdapter) UpsertReturning() bool { return true }
+
+func (a *PostgreSQLAdapter) MaxPlaceholders() int { return 65535 }
+
+// UpsertReturning is false: MySQL reports one insert ID per statement, so
+// the IDs are looked up by key instead
+func (a *MySQLAdapter) UpsertReturning() bool { return false }
+
+func (a *MySQLAdapter) MaxPlaceholders() int { return 65535 }
+
+// upsertPlan holds the statement shape and values of an upsert
+type upsertPlan struct {
+	columns  []string
+	conflict []string
+	updates  []string
+	rows     [][]interface{}
+	keys     [][]interface{}
+}
+
+// Upsert inserts model or, when it conflicts with an existing row, applies
+// onConflict, then stores the ID of the row. Like BulkInsert it skips
+// validations and callbacks.
+func (t *gorTable) Upsert(model interface{}, onConflict gor.OnConflict) error {
+	plan, err := t.planUpsert([]interface{}{model}, onConflict)
+	if err != nil {
+		return err
+	}
+
+	ids, err := t.runUpsert(plan)
+	if err != nil {
+		return err
+	}
+
+	// A row left alone by DoNothing returns no ID
+	if len(ids) == 0 {
+		if ids, err = idsByKey(t.exec(), dialectFor(t.adapter), t.name, plan.conflict, plan.keys); err != nil {
+			return err
+		}
+	}
+	if len(ids) == 1 {
+		setID(model, ids[0])
+	}
+	return nil
+}
+
+// BulkUpsert upserts models in as few statements as the dialect's parameter
+// limit allows, in one transaction, and returns the IDs of the rows written.
+// On MySQL, whose upserts cannot return IDs, it returns the IDs of every
+// row with the models' keys.
+func (t *gorTable) BulkUpsert(models interface{}, onConflict gor.OnConflict) ([]int64, error) {
+	v := reflect.ValueOf(models)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("models must be a slice")
+	}
+	if v.Len() == 0 {
+		return nil, nil
+	}
+
+	records := make([]interface{}, v.Len())
+	for i := range records {
+		records[i] = recordAt(v, i)
+	}
+
+	plan, err := t.planUpsert(records, onConflict)
+	if err != nil {
+		return nil, err
+	}
+	return t.runUpsert(plan)
+}
+
+// planUpsert reads the models' values and resolves the columns to update
+func (t *gorTable) planUpsert(models []interface{}, onConflict gor.OnConflict) (*upsertPlan, error) {
+	if len(onConflict.Columns) == 0 {
+		return nil, fmt.Errorf("upsert into %s requires conflict columns", t.name)
+	}
+	if onConflict.DoNothing && len(onConflict.Update) > 0 {
+		return nil, fmt.Errorf("upsert into %s cannot both update and do nothing on conflict", t.name)
+	}
+
+	// IDs are assigned by the database unless they are the conflict key
+	withID := containsString(onConflict.Columns, "id")
+
+	// A conflict must only match rows of the same tenant
+	if field := tenantFieldOf(t.modelType); field != nil && !containsString(onConflict.Columns, field.Column) {
+		return nil, fmt.Errorf("upsert into %s requires the tenant column %s among its conflict columns", t.name, field.Column)
+	}
+
+	plan := &upsertPlan{conflict: onConflict.Columns}
+	for i, model := range models {
+		if err := stampTenant(t.ctx, t.name, model); err != nil {
+			return nil, fmt.Errorf("record at index %d: %w", i, err)
+		}
+		setTimestamps(model, true)
+
+		columns, values := modelValues(model, withID)
+		values, err := encryptValues(t.keys, reflect.TypeOf(model), columns, values)
+		if err != nil {
+			return nil, fmt.Errorf("record at index %d: %w", i, err)
+		}
+		if i == 0 {
+			plan.columns = columns
+		} else if len(columns) != len(plan.columns) {
+			return nil, fmt.Errorf("record at index %d has different columns than the first", i)
+		}
+		plan.rows = append(plan.rows, values)
+	}
+
+	keyIndexes := make([]int, len(onConflict.Columns))
+	for i, column := range onConflict.Columns {
+		keyIndexes[i] = indexOfString(plan.columns, column)
+		if keyIndexes[i] < 0 {
+			return nil, fmt.Errorf("conflict column %s is not a column of %s", column, t.name)
+		}
+	}
+	for _, row := range plan.rows {
+		key := make([]interface{}, len(keyIndexes))
+		for i, index := range keyIndexes {
+			key[i] = row[index]
+		}
+		plan.keys = append(plan.keys, key)
+	}
+
+	switch {
+	case onConflict.DoNothing:
+	case len(onConflict.Update) > 0:
+		plan.updates = onConflict.Update
+	default:
+		for _, column := range plan.columns {
+			if column != "id" && column != "created_at" && !containsString(onConflict.Columns, column) {
+				plan.updates = append(plan.updates, column)
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// runUpsert writes the plan's rows in chunks and returns the IDs written
+func (t *gorTable) runUpsert(plan *upsertPlan) ([]int64, error) {
+	d := dialectFor(t.adapter)
+
+	var ids []int64
+	err := t.inChunks(len(plan.rows), len(plan.columns), func(ex executor, start, end int) error {
+		var args []interface{}
+		for _, row := range plan.rows[start:end] {
+			args = append(args, row...)
+		}
+		query := buildUpsertSQL(d, t.name, plan.columns, end-start, plan.conflict, plan.updates)
+
+		if !d.UpsertReturning() {
+			if _, err := ex.Exec(query, args...); err != nil {
+				return fmt.Errorf("failed to upsert: %w", err)
+			}
+			chunkIDs, err := idsByKey(ex, d, t.name, plan.conflict, plan.keys[start:end])
+			ids = append(ids, chunkIDs...)
+			return err
+		}
+
+		rows, err := ex.Query(query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to upsert: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// idsByKey returns the IDs of the rows whose key columns hold one of keys
+func idsByKey(ex executor, d sqlDialect, table string, columns []string, keys [][]interface{}) ([]int64, error) {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = d.QuoteIdentifier(column)
+	}
+
+	tuple := "(" + inPlaceholders(len(columns)) + ")"
+	tuples := make([]string, len(keys))
+	var args []interface{}
+	for i, key := range keys {
+		tuples[i] = tuple
+		args = append(args, key...)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE (%s) IN (%s)", // #nosec G201 - Identifiers come from model metadata
+		d.QuoteIdentifier("id"), d.QuoteIdentifier(table), strings.Join(quoted, ", "), strings.Join(tuples, ", "))
+
+	rows, err := ex.Query(rebind(d, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// inChunks calls fn for consecutive ranges of rows, each small enough that
+// its values fit the dialect's parameter limit. When there is more than one
+// chunk they run in a transaction.
+func (t *gorTable) inChunks(rows, columns int, fn func(ex executor, start, end int) error) error {
+	size := rows
+	if columns > 0 {
+		size = max(dialectFor(t.adapter).MaxPlaceholders()/columns, 1)
+	}
+	if rows <= size {
+		return fn(t.exec(), 0, rows)
+	}
+
+	return t.transaction(func(t *gorTable) error {
+		for start := 0; start < rows; start += size {
+			if err := fn(t.exec(), start, min(start+size, rows)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// recordAt returns a pointer to the ith model of a slice of structs, so
+// timestamps and IDs can be set on it, or the element itself otherwise
+func recordAt(v reflect.Value, i int) interface{} {
+	elem := v.Index(i)
+	if elem.Kind() == reflect.Struct && elem.CanAddr() {
+		return elem.Addr().Interface()
+	}
+	return elem.Interface()
+}
+
+func containsString(values []string, value string) bool {
+	return indexOfString(values, value) >= 0
+}
+
+func indexOfString(values []string, value string) int {
+	for i, candidate := range values {
+		if candidate == value {
+			return i
+		}
+	}
+	return -1
+}
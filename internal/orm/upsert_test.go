@@ -0,0 +1,121 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+func TestTable_Upsert(t *testing.T) {
+	orm := setupTestORM(t)
+	users := orm.Table("users")
+	byEmail := gor.OnConflict{Columns: []string{"email"}}
+
+	ada := &TestUser{Name: "ada", Email: "ada@example.com", Age: 36}
+	if err := users.Upsert(ada, byEmail); err != nil {
+		t.Fatalf("Upsert() insert error = %v", err)
+	}
+	if ada.ID == 0 {
+		t.Fatal("Upsert() did not set the ID of the inserted row")
+	}
+
+	again := &TestUser{Name: "Ada Lovelace", Email: "ada@example.com", Age: 37}
+	if err := users.Upsert(again, byEmail); err != nil {
+		t.Fatalf("Upsert() update error = %v", err)
+	}
+	if again.ID != ada.ID {
+		t.Errorf("Upsert() update ID = %d, want %d", again.ID, ada.ID)
+	}
+
+	var found TestUser
+	if err := orm.Find(&found, ada.ID); err != nil {
+		t.Fatal(err)
+	}
+	if found.Name != "Ada Lovelace" || found.Age != 37 || !found.CreatedAt.Equal(ada.CreatedAt) {
+		t.Errorf("row after update = %+v, want the new name and age and the original created_at", found)
+	}
+
+	ignored := &TestUser{Name: "ignored", Email: "ada@example.com"}
+	if err := users.Upsert(ignored, gor.OnConflict{Columns: []string{"email"}, DoNothing: true}); err != nil {
+		t.Fatalf("Upsert() do nothing error = %v", err)
+	}
+	if ignored.ID != ada.ID {
+		t.Errorf("Upsert() do nothing ID = %d, want the existing %d", ignored.ID, ada.ID)
+	}
+	if err := orm.Find(&found, ada.ID); err != nil || found.Name != "Ada Lovelace" {
+		t.Errorf("row after do nothing = %+v, %v", found, err)
+	}
+}
+
+func TestTable_BulkUpsert(t *testing.T) {
+	orm := setupTestORM(t)
+	users := orm.Table("users")
+
+	existing := &TestUser{Name: "ada", Email: "ada@example.com", Age: 36}
+	if err := orm.Create(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []TestUser{
+		{Name: "renamed", Email: "ada@example.com", Age: 40},
+		{Name: "bob", Email: "bob@example.com", Age: 20},
+	}
+	ids, err := users.BulkUpsert(rows, gor.OnConflict{Columns: []string{"email"}, Update: []string{"age"}})
+	if err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+	if len(ids) != 2 || ids[0] != existing.ID {
+		t.Errorf("BulkUpsert() IDs = %v, want the existing ID %d and a new one", ids, existing.ID)
+	}
+
+	var all []TestUser
+	if err := orm.Query(&all).Order("email").FindAll(&all); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{fmt.Sprintf("%s %d", all[0].Name, all[0].Age), fmt.Sprintf("%s %d", all[1].Name, all[1].Age)}
+	if !reflect.DeepEqual(got, []string{"ada 40", "bob 20"}) {
+		t.Errorf("rows = %v, want only the age of ada updated", got)
+	}
+
+	if _, err := users.BulkUpsert(rows, gor.OnConflict{}); err == nil {
+		t.Error("BulkUpsert() without conflict columns should fail")
+	}
+	if _, err := users.BulkUpsert(rows, gor.OnConflict{Columns: []string{"handle"}}); err == nil {
+		t.Error("BulkUpsert() on an unknown column should fail")
+	}
+}
+
+func TestTable_BulkWritesAreChunked(t *testing.T) {
+	orm := setupTestORM(t)
+	users := orm.Table("users")
+
+	// More rows than one SQLite statement can bind
+	columns, _ := modelValues(&TestUser{}, false)
+	n := dialectFor(&SQLiteAdapter{}).MaxPlaceholders()/len(columns) + 10
+	rows := make([]TestUser, n)
+	for i := range rows {
+		rows[i] = TestUser{Name: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@example.com", i)}
+	}
+
+	if err := users.BulkInsert(rows); err != nil {
+		t.Fatalf("BulkInsert() error = %v", err)
+	}
+
+	for i := range rows {
+		rows[i].Age = 30
+	}
+	ids, err := users.BulkUpsert(rows, gor.OnConflict{Columns: []string{"email"}, Update: []string{"age"}})
+	if err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+	if len(ids) != n {
+		t.Errorf("BulkUpsert() returned %d IDs, want %d", len(ids), n)
+	}
+
+	count, err := orm.Query(&TestUser{}).Where("age = ?", 30).Count()
+	if err != nil || count != int64(n) {
+		t.Errorf("upserted rows = %d, %v; want %d", count, err, n)
+	}
+}
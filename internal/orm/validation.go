@@ -0,0 +1,515 @@
+package orm
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+// Validator evaluates the rules declared in `validate` struct tags:
+//
+//	Email    string `validate:"required,email,uniqueness=account_id"`
+//	Username string `validate:"required,alphanum,min=3,max=50"`
+//	Status   string `validate:"inclusion=draft|published"`
+//	Zip      string `validate:"format=^[0-9]{5}$"`
+//	Password string `validate:"min=8,confirmation"`
+//
+// Rules are separated by commas; a literal comma inside a parameter is
+// written as "\,". Errors are keyed by the field's column name so they line
+// up with form parameters.
+type Validator struct {
+	exec    executor
+	adapter gor.DatabaseAdapter
+	table   string
+}
+
+// NewValidator creates a validator. The database is only used by uniqueness
+// rules, which are skipped when db is nil.
+func NewValidator(db *sql.DB, adapter gor.DatabaseAdapter) *Validator {
+	v := &Validator{adapter: adapter}
+	if db != nil {
+		v.exec = db
+	}
+	return v
+}
+
+// Validate returns every failed rule of model, in field order. The error
+// is set when a rule could not be checked, such as a uniqueness rule whose
+// query failed; rule failures are only reported in the slice.
+func (v *Validator) Validate(model interface{}) ([]gor.ValidationError, error) {
+	value := reflect.ValueOf(model)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	var errs []gor.ValidationError
+	for _, field := range validatedFieldsOf(value.Type()) {
+		fieldErrs, err := v.validateField(value, field)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, fieldErrs...)
+	}
+	return errs, nil
+}
+
+// validateRecord runs the tag rules and then the model's own Validate
+// method before a record is saved. Failures are returned as
+// gor.ValidationErrors, merged with any the model reports itself; rules
+// that could not be checked fail with their error.
+func validateRecord(ex executor, adapter gor.DatabaseAdapter, table string, model interface{}) error {
+	v := &Validator{exec: ex, adapter: adapter, table: table}
+	tagErrs, err := v.Validate(model)
+	if err != nil {
+		return err
+	}
+	errs := gor.ValidationErrors(tagErrs)
+
+	if validatable, ok := model.(interface{ Validate() error }); ok {
+		if err := validatable.Validate(); err != nil {
+			var modelErrs gor.ValidationErrors
+			var modelErr gor.ValidationError
+			switch {
+			case errors.As(err, &modelErrs):
+				errs = append(errs, modelErrs...)
+			case errors.As(err, &modelErr):
+				errs = append(errs, modelErr)
+			case len(errs) == 0:
+				return err
+			default:
+				errs = append(errs, gor.ValidationError{Field: "base", Tag: "validate", Message: err.Error()})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validationRule is one rule of a validate tag, such as min=3
+type validationRule struct {
+	name  string
+	param string
+}
+
+// validatedField is a struct field carrying a validate tag
+type validatedField struct {
+	name      string
+	key       string
+	column    string
+	index     []int
+	omitEmpty bool
+	rules     []validationRule
+}
+
+var validatedFieldsCache sync.Map // reflect.Type -> []*validatedField
+
+// validatedFieldsOf returns the fields of a struct type that declare
+// validation rules, including those of embedded structs
+func validatedFieldsOf(t reflect.Type) []*validatedField {
+	if cached, ok := validatedFieldsCache.Load(t); ok {
+		return cached.([]*validatedField)
+	}
+
+	fields := collectValidatedFields(t, nil)
+	actual, _ := validatedFieldsCache.LoadOrStore(t, fields)
+	return actual.([]*validatedField)
+}
+
+func collectValidatedFields(t reflect.Type, parentIndex []int) []*validatedField {
+	var fields []*validatedField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		index := make([]int, 0, len(parentIndex)+1)
+		index = append(index, parentIndex...)
+		index = append(index, i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, collectValidatedFields(field.Type, index)...)
+			continue
+		}
+
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok || tag == "" || tag == "-" {
+			continue
+		}
+
+		vf := &validatedField{
+			name:  field.Name,
+			key:   toSnakeCase(field.Name),
+			index: index,
+		}
+
+		// Fields stored in the database are keyed, and checked for
+		// uniqueness, by their column
+		if gorTag := field.Tag.Get("gor"); gorTag != "-" {
+			vf.column = vf.key
+			if column := parseTagOptions(gorTag)["column"]; column != "" {
+				vf.column = column
+				vf.key = column
+			}
+		}
+
+		for _, part := range splitRules(tag) {
+			name, param, _ := strings.Cut(part, "=")
+			if name == "omitempty" {
+				vf.omitEmpty = true
+				continue
+			}
+			vf.rules = append(vf.rules, validationRule{name: name, param: param})
+		}
+
+		fields = append(fields, vf)
+	}
+	return fields
+}
+
+// splitRules splits a validate tag on commas that are not escaped
+func splitRules(tag string) []string {
+	var rules []string
+	var current strings.Builder
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case tag[i] == ',':
+			rules = append(rules, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(tag[i])
+		}
+	}
+	rules = append(rules, strings.TrimSpace(current.String()))
+
+	nonEmpty := rules[:0]
+	for _, rule := range rules {
+		if rule != "" {
+			nonEmpty = append(nonEmpty, rule)
+		}
+	}
+	return nonEmpty
+}
+
+func (v *Validator) validateField(model reflect.Value, field *validatedField) ([]gor.ValidationError, error) {
+	value := model.FieldByIndex(field.index)
+	if field.omitEmpty && value.IsZero() {
+		return nil, nil
+	}
+
+	// A nil pointer has nothing to check beyond presence
+	isNil := value.Kind() == reflect.Ptr && value.IsNil()
+	if !isNil {
+		value = reflect.Indirect(value)
+	}
+
+	var errs []gor.ValidationError
+	fail := func(rule validationRule, format string, args ...interface{}) {
+		var current interface{}
+		if !isNil {
+			current = value.Interface()
+		}
+		errs = append(errs, gor.ValidationError{
+			Field:   field.key,
+			Tag:     rule.name,
+			Message: fmt.Sprintf(format, args...),
+			Value:   current,
+		})
+	}
+
+	for _, rule := range field.rules {
+		if isNil && rule.name != "required" {
+			continue
+		}
+
+		switch rule.name {
+		case "required":
+			if isNil || isBlank(value) {
+				// The remaining rules would only repeat the complaint
+				fail(rule, "can't be blank")
+				return errs, nil
+			}
+		case "min", "max", "len":
+			checkSize(value, rule, fail)
+		case "email":
+			if address, err := mail.ParseAddress(value.String()); err != nil || address.Address != value.String() {
+				fail(rule, "is not a valid email address")
+			}
+		case "url":
+			if u, err := url.ParseRequestURI(value.String()); err != nil || u.Scheme == "" || u.Host == "" {
+				fail(rule, "is not a valid URL")
+			}
+		case "alphanum":
+			if !isAlphanumeric(value.String()) {
+				fail(rule, "may only contain letters and numbers")
+			}
+		case "format":
+			pattern, err := compileFormat(rule.param)
+			if err != nil {
+				fail(rule, "has an invalid format rule: %v", err)
+			} else if !pattern.MatchString(fmt.Sprint(value.Interface())) {
+				fail(rule, "is invalid")
+			}
+		case "inclusion":
+			if !containsOption(rule.param, value) {
+				fail(rule, "is not included in the list")
+			}
+		case "exclusion":
+			if containsOption(rule.param, value) {
+				fail(rule, "is reserved")
+			}
+		case "numericality":
+			checkNumericality(value, rule, fail)
+		case "confirmation":
+			if err := checkConfirmation(model, field, value, rule); err != nil {
+				errs = append(errs, *err)
+			}
+		case "uniqueness":
+			taken, err := v.isTaken(model, field, value, rule)
+			if err != nil {
+				return nil, fmt.Errorf("cannot check the uniqueness of %s: %w", field.key, err)
+			}
+			if taken {
+				fail(rule, "has already been taken")
+			}
+		default:
+			fail(rule, "uses unknown validation rule %q", rule.name)
+		}
+	}
+
+	return errs, nil
+}
+
+// checkSize applies min, max and len: the length of strings and
+// collections, or the value of numbers
+func checkSize(value reflect.Value, rule validationRule, fail func(validationRule, string, ...interface{})) {
+	limit, err := strconv.ParseFloat(rule.param, 64)
+	if err != nil {
+		fail(rule, "has an invalid %s rule %q", rule.name, rule.param)
+		return
+	}
+
+	var size float64
+	var unit string
+	switch value.Kind() {
+	case reflect.String:
+		size, unit = float64(len([]rune(value.String()))), "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, unit = float64(value.Len()), "items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	default:
+		fail(rule, "cannot be checked with %s", rule.name)
+		return
+	}
+
+	switch {
+	case rule.name == "min" && size < limit && unit != "":
+		fail(rule, "is too short (minimum is %s %s)", rule.param, unit)
+	case rule.name == "min" && size < limit:
+		fail(rule, "must be greater than or equal to %s", rule.param)
+	case rule.name == "max" && size > limit && unit != "":
+		fail(rule, "is too long (maximum is %s %s)", rule.param, unit)
+	case rule.name == "max" && size > limit:
+		fail(rule, "must be less than or equal to %s", rule.param)
+	case rule.name == "len" && size != limit && unit != "":
+		fail(rule, "is the wrong length (should be %s %s)", rule.param, unit)
+	case rule.name == "len" && size != limit:
+		fail(rule, "must be equal to %s", rule.param)
+	}
+}
+
+// checkNumericality requires a number; numericality=integer requires a
+// whole number. String fields are parsed.
+func checkNumericality(value reflect.Value, rule validationRule, fail func(validationRule, string, ...interface{})) {
+	integer := rule.param == "integer"
+
+	switch value.Kind() {
+	case reflect.String:
+		text := strings.TrimSpace(value.String())
+		if integer {
+			if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+				fail(rule, "must be an integer")
+			}
+		} else if _, err := strconv.ParseFloat(text, 64); err != nil {
+			fail(rule, "is not a number")
+		}
+	case reflect.Float32, reflect.Float64:
+		if integer && value.Float() != float64(int64(value.Float())) {
+			fail(rule, "must be an integer")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		fail(rule, "is not a number")
+	}
+}
+
+// checkConfirmation compares the field with its confirmation field, named
+// <Field>Confirmation unless given as confirmation=OtherField. A blank
+// confirmation is not checked, so records loaded from the database can be
+// saved without re-entering it.
+func checkConfirmation(model reflect.Value, field *validatedField, value reflect.Value, rule validationRule) *gor.ValidationError {
+	name := rule.param
+	if name == "" {
+		name = field.name + "Confirmation"
+	}
+
+	confirmation := model.FieldByName(name)
+	if !confirmation.IsValid() {
+		return &gor.ValidationError{
+			Field:   field.key,
+			Tag:     rule.name,
+			Message: fmt.Sprintf("has no confirmation field %s", name),
+		}
+	}
+
+	confirmation = reflect.Indirect(confirmation)
+	if !confirmation.IsValid() || confirmation.IsZero() {
+		return nil
+	}
+	if reflect.DeepEqual(confirmation.Interface(), value.Interface()) {
+		return nil
+	}
+
+	return &gor.ValidationError{
+		Field:   toSnakeCase(name),
+		Tag:     rule.name,
+		Message: fmt.Sprintf("doesn't match %s", field.key),
+		Value:   confirmation.Interface(),
+	}
+}
+
+// isTaken reports whether another row already holds the value. The rule's
+// parameter lists scope columns separated by "|", so uniqueness=account_id
+// only compares rows of the same account; tenant models are always scoped
+// to their tenant. Soft-deleted rows are ignored.
+func (v *Validator) isTaken(model reflect.Value, field *validatedField, value reflect.Value, rule validationRule) (bool, error) {
+	if v.exec == nil {
+		return false, nil
+	}
+	if field.column == "" {
+		return false, fmt.Errorf("%s is not stored in a column", field.name)
+	}
+
+	schema := schemaOf(model.Type())
+	table := v.table
+	if table == "" {
+		table = schema.Table
+	}
+
+	d := dialectFor(v.adapter)
+	// Deterministically encrypted values are compared by their ciphertext
+	condition, args, err := encryptCondition(keyringOf(v.exec), model.Type(), d.QuoteIdentifier(field.column)+" = ?", []interface{}{value.Interface()})
+	if err != nil {
+		return false, err
+	}
+	conditions := []string{condition}
+
+	if rule.param != "" {
+		for _, column := range strings.Split(rule.param, "|") {
+			scope := schema.FieldByColumn(column)
+			if scope == nil {
+				return false, fmt.Errorf("unknown scope column %q", column)
+			}
+			conditions = append(conditions, d.QuoteIdentifier(column)+" = ?")
+			args = append(args, model.FieldByIndex(scope.Index).Interface())
+		}
+	}
+
+	// Values of tenant models only need to be unique within their tenant
+	if tenant := schema.Tenant; tenant != nil && !strings.Contains("|"+rule.param+"|", "|"+tenant.Column+"|") {
+		conditions = append(conditions, d.QuoteIdentifier(tenant.Column)+" = ?")
+		args = append(args, model.FieldByIndex(tenant.Index).Interface())
+	}
+
+	// Exclude the record itself when it already exists
+	if id := schema.FieldByColumn("id"); id != nil && !model.FieldByIndex(id.Index).IsZero() {
+		conditions = append(conditions, d.QuoteIdentifier("id")+" <> ?")
+		args = append(args, model.FieldByIndex(id.Index).Interface())
+	}
+
+	if schema.SoftDelete != nil {
+		conditions = append(conditions, deletedCondition(d, table, schema.SoftDelete.Column, excludeDeleted))
+	}
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", d.QuoteIdentifier(table), strings.Join(conditions, " AND ")) // #nosec G201 - Identifiers come from model metadata
+
+	var count int64
+	if err := v.exec.QueryRow(rebind(d, query), args...).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// isBlank reports whether a value is empty: zero, or a string of spaces
+func isBlank(value reflect.Value) bool {
+	if value.Kind() == reflect.String {
+		return strings.TrimSpace(value.String()) == ""
+	}
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Map {
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsOption reports whether value is one of the "|"-separated options
+func containsOption(options string, value reflect.Value) bool {
+	current := fmt.Sprint(value.Interface())
+	for _, option := range strings.Split(options, "|") {
+		if option == current {
+			return true
+		}
+	}
+	return false
+}
+
+var formatCache sync.Map // string -> *regexp.Regexp
+
+func compileFormat(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := formatCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	formatCache.Store(pattern, compiled)
+	return compiled, nil
+}
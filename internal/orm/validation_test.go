@@ -0,0 +1,231 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cuemby/gor/pkg/gor"
+)
+
+type ValidatedMember struct {
+	ID                   int64   `gor:"primary_key;auto_increment"`
+	TeamID               int64   `gor:""`
+	Email                string  `gor:"not_null" validate:"required,email,uniqueness=team_id"`
+	Handle               string  `gor:"" validate:"required,alphanum,min=3,max=12"`
+	Website              *string `gor:"" validate:"url"`
+	Zip                  string  `gor:"" validate:"omitempty,format=^[0-9]{5}$"`
+	Role                 string  `gor:"" validate:"inclusion=admin|member"`
+	Age                  int     `gor:"" validate:"min=18"`
+	Pin                  string  `gor:"" validate:"omitempty,len=4,numericality=integer"`
+	Password             string  `gor:"" validate:"confirmation"`
+	PasswordConfirmation string  `gor:"-"`
+	SoftDeletes
+}
+
+func (m *ValidatedMember) TableName() string { return "validated_members" }
+
+func (m *ValidatedMember) Validate() error {
+	if m.Handle == "admin" {
+		return gor.ValidationError{Field: "handle", Tag: "reserved", Message: "is reserved"}
+	}
+	return nil
+}
+
+func validMember(email string) *ValidatedMember {
+	return &ValidatedMember{TeamID: 1, Email: email, Handle: "ada", Role: "member", Age: 30}
+}
+
+func setupValidationORM(t *testing.T) gor.ORM {
+	config := gor.DatabaseConfig{
+		Driver:          "sqlite3",
+		Database:        filepath.Join(t.TempDir(), "validation.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}
+
+	orm := NewORM(config)
+	if err := orm.Connect(context.Background(), config); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { orm.Close() })
+
+	if err := orm.Register(&ValidatedMember{}); err != nil {
+		t.Fatalf("Failed to register models: %v", err)
+	}
+
+	return orm
+}
+
+// validate runs the tag rules of model without a database
+func validate(t *testing.T, model interface{}) gor.ValidationErrors {
+	t.Helper()
+	errs, err := NewValidator(nil, nil).Validate(model)
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	return errs
+}
+
+func failedRules(errs []gor.ValidationError) map[string][]string {
+	rules := make(map[string][]string)
+	for _, e := range errs {
+		rules[e.Field] = append(rules[e.Field], e.Tag)
+	}
+	return rules
+}
+
+func TestValidator_Rules(t *testing.T) {
+	website := "not a url"
+	member := &ValidatedMember{
+		Email:                "nope",
+		Handle:               "a!",
+		Website:              &website,
+		Zip:                  "123",
+		Role:                 "owner",
+		Age:                  16,
+		Pin:                  "12a4",
+		Password:             "secret",
+		PasswordConfirmation: "secrets",
+	}
+
+	got := failedRules(validate(t, member))
+	want := map[string][]string{
+		"email":                 {"email"},
+		"handle":                {"alphanum", "min"},
+		"website":               {"url"},
+		"zip":                   {"format"},
+		"role":                  {"inclusion"},
+		"age":                   {"min"},
+		"pin":                   {"numericality"},
+		"password_confirmation": {"confirmation"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("failed rules = %v, want %v", got, want)
+	}
+
+	if errs := validate(t, validMember("ada@example.com")); len(errs) != 0 {
+		t.Errorf("Validate() of a valid member = %v, want no errors", errs)
+	}
+}
+
+func TestValidator_RequiredStopsFurtherRules(t *testing.T) {
+	member := validMember("")
+	member.Handle = "  "
+
+	errs := validate(t, member)
+	if got := errs.On("email"); !reflect.DeepEqual(got, []string{"can't be blank"}) {
+		t.Errorf("email errors = %v, want only the blank message", got)
+	}
+	if got := errs.On("handle"); !reflect.DeepEqual(got, []string{"can't be blank"}) {
+		t.Errorf("handle errors = %v, want only the blank message", got)
+	}
+}
+
+func TestValidation_CreateAndUpdate(t *testing.T) {
+	orm := setupValidationORM(t)
+
+	invalid := validMember("nope")
+	err := orm.Create(invalid)
+
+	var errs gor.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Create() error = %v, want ValidationErrors", err)
+	}
+	if got := errs.ByField()["email"]; !reflect.DeepEqual(got, []string{"is not a valid email address"}) {
+		t.Errorf("email errors = %v", got)
+	}
+	if invalid.ID != 0 {
+		t.Error("an invalid record should not be inserted")
+	}
+
+	member := validMember("ada@example.com")
+	if err := orm.Create(member); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// The model's own Validate method runs after the tag rules
+	member.Handle = "admin"
+	err = orm.Update(member)
+	if !errors.As(err, &errs) || !reflect.DeepEqual(errs.On("handle"), []string{"is reserved"}) {
+		t.Errorf("Update() error = %v, want the model's reserved handle error", err)
+	}
+
+	err = orm.Transaction(context.Background(), func(tx gor.Transaction) error {
+		return tx.Create(validMember("bad"))
+	})
+	if !errors.As(err, &errs) {
+		t.Errorf("Transaction Create() error = %v, want ValidationErrors", err)
+	}
+}
+
+func TestValidation_Uniqueness(t *testing.T) {
+	orm := setupValidationORM(t)
+
+	first := validMember("ada@example.com")
+	if err := orm.Create(first); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// Saving the same record again does not conflict with itself
+	if err := orm.Update(first); err != nil {
+		t.Errorf("Update() error = %v", err)
+	}
+
+	err := orm.Table("validated_members").Create(validMember("ada@example.com"))
+	var errs gor.ValidationErrors
+	if !errors.As(err, &errs) || !reflect.DeepEqual(errs.On("email"), []string{"has already been taken"}) {
+		t.Fatalf("duplicate Create() error = %v, want uniqueness error", err)
+	}
+
+	otherTeam := validMember("ada@example.com")
+	otherTeam.TeamID = 2
+	if err := orm.Create(otherTeam); err != nil {
+		t.Errorf("Create() in another team error = %v, want the scope to allow it", err)
+	}
+
+	if err := orm.Delete(first); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := orm.Create(validMember("ada@example.com")); err != nil {
+		t.Errorf("Create() after soft delete error = %v", err)
+	}
+}
+
+func TestValidation_UniquenessQueryFailure(t *testing.T) {
+	orm := setupValidationORM(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := orm.WithContext(ctx).Create(validMember("ada@example.com"))
+
+	var errs gor.ValidationErrors
+	if errors.As(err, &errs) || !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "uniqueness of email") {
+		t.Errorf("Create() with a canceled context error = %v, want the query's error rather than ValidationErrors", err)
+	}
+
+	_, err = NewValidator(orm.DB(), NewSQLiteAdapter()).Validate(&struct {
+		Email string `validate:"uniqueness"`
+	}{Email: "ada@example.com"})
+	if err == nil {
+		t.Error("Validate() of a model without a table should fail")
+	}
+}
+
+func TestValidationErrors_Error(t *testing.T) {
+	err := fmt.Errorf("save: %w", gor.ValidationErrors{
+		{Field: "email", Message: "can't be blank"},
+		{Field: "age", Message: "must be greater than or equal to 18"},
+	})
+
+	want := "save: email can't be blank; age must be greater than or equal to 18"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
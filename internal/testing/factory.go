@@ -6,7 +6,9 @@ import (
 	"time"
 )
 
-// Factory provides a factory pattern for creating test data
+// Factory provides a factory pattern for creating test data. Seeds use the
+// same definitions for the rows of YAML seed files that name a factory,
+// through orm.Seeder.SetFactory.
 type Factory struct {
 	definitions map[string]FactoryDefinition
 	sequences   map[string]int
@@ -45,6 +45,10 @@ func NewTestCase(t *testing.T, app gor.Application) *TestCase {
 	return tc
 }
 
+// SchemaPath is the schema dump test databases are loaded from, written by
+// the migrator after each migration
+var SchemaPath = filepath.Join("db", "schema.sql")
+
 // setupTestDatabase sets up a test database
 func (tc *TestCase) setupTestDatabase() {
 	// Use test database configuration
@@ -61,11 +65,24 @@ func (tc *TestCase) setupTestDatabase() {
 	tc.db = db
 	tc.dbPath = testDBPath
 
-	// Run migrations
-	if orm := tc.app.ORM(); orm != nil {
-		if err := orm.Migrate(context.Background()); err != nil {
-			tc.t.Fatalf("Failed to run migrations: %v", err)
+	orm := tc.app.ORM()
+	if orm == nil {
+		return
+	}
+
+	// Load the schema dump when there is one, it is faster than replaying
+	// every migration
+	if schema, err := os.Open(SchemaPath); err == nil {
+		defer schema.Close()
+		if err := orm.LoadSchema(schema); err != nil {
+			tc.t.Fatalf("Failed to load %s: %v", SchemaPath, err)
 		}
+		return
+	}
+
+	// Run migrations
+	if err := orm.Migrate(context.Background()); err != nil {
+		tc.t.Fatalf("Failed to run migrations: %v", err)
 	}
 }
 
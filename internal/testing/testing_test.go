@@ -77,6 +77,14 @@ func (m *MockORM) DB() *sql.DB {
 	return nil
 }
 
+func (m *MockORM) WithContext(ctx context.Context) gor.ORM {
+	return m
+}
+
+func (m *MockORM) Using(name string) gor.ORM {
+	return m
+}
+
 // Migration management
 func (m *MockORM) Migrate(ctx context.Context) error {
 	if m.migrateFunc != nil {
@@ -93,6 +101,14 @@ func (m *MockORM) MigrationStatus(ctx context.Context) ([]gor.Migration, error)
 	return nil, nil
 }
 
+func (m *MockORM) DumpSchema(w io.Writer) error {
+	return nil
+}
+
+func (m *MockORM) LoadSchema(r io.Reader) error {
+	return nil
+}
+
 // Model operations
 func (m *MockORM) Register(models ...interface{}) error {
 	return nil
@@ -2,6 +2,7 @@ package views
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -279,6 +280,7 @@ func defaultHelpers() template.FuncMap {
 		"submit_tag":   submitTag,
 		"hidden_field": hiddenField,
 		"csrf_tag":     csrfTag,
+		"field_errors": fieldErrors,
 
 		// Date/Time helpers
 		"time_ago":    timeAgo,
@@ -446,6 +448,27 @@ func csrfTag(token string) template.HTML {
 	return template.HTML(fmt.Sprintf(`<input type="hidden" name="csrf_token" value="%s">`, token))
 }
 
+// fieldErrors renders the validation messages recorded for a field. err is
+// typically the error returned by ORM.Create or ORM.Update; anything other
+// than gor.ValidationErrors renders nothing.
+func fieldErrors(err interface{}, field string) template.HTML {
+	validationErr, ok := err.(error)
+	if !ok {
+		return ""
+	}
+
+	var errs gor.ValidationErrors
+	if !errors.As(validationErr, &errs) {
+		return ""
+	}
+
+	var html strings.Builder
+	for _, message := range errs.On(field) {
+		html.WriteString(fmt.Sprintf(`<span class="field-error">%s</span>`, template.HTMLEscapeString(message)))
+	}
+	return template.HTML(html.String()) // #nosec G203 - Messages are escaped above
+}
+
 // Date/Time helpers
 func timeAgo(t interface{}) string {
 	// Implementation would convert time to "2 hours ago" format
@@ -2,6 +2,7 @@ package views
 
 import (
 	"bytes"
+	"fmt"
 	"html/template"
 	"net/http"
 	"net/http/httptest"
@@ -508,6 +509,19 @@ func TestHelperFunctions(t *testing.T) {
 		if !strings.Contains(string(csrf), `value="csrf123"`) {
 			t.Error("csrfTag() should include token value")
 		}
+
+		// Test fieldErrors
+		errs := gor.ValidationErrors{
+			{Field: "email", Tag: "required", Message: "can't be blank"},
+			{Field: "name", Tag: "max", Message: "is too long"},
+		}
+		fieldErr := fieldErrors(fmt.Errorf("save failed: %w", errs), "email")
+		if fieldErr != template.HTML(`<span class="field-error">can&#39;t be blank</span>`) {
+			t.Errorf("fieldErrors() = %s, want the escaped email message", fieldErr)
+		}
+		if fieldErrors(nil, "email") != "" {
+			t.Error("fieldErrors() should render nothing without errors")
+		}
 	})
 
 	t.Run("UtilityHelpers", func(t *testing.T) {
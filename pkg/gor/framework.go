@@ -150,6 +150,35 @@ func (c *Context) App() Application {
 	return c.app
 }
 
+type actorKey struct{}
+
+type requestIDKey struct{}
+
+// WithActor returns a context attributing the work run with it, such as
+// audited changes, to actor. Authentication middleware sets it to the
+// signed-in user.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set with WithActor, or "" when there is none
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// WithRequestID returns a context carrying the ID of the request it serves
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the ID set with WithRequestID, or "" when there is
+// none
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
 // Param returns a route parameter value.
 func (c *Context) Param(key string) string {
 	return c.Params[key]
@@ -241,6 +270,20 @@ type DatabaseConfig struct {
 	MaxOpenConns    int
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
+
+	// Replicas are read-only copies of this database. Reads outside
+	// transactions are spread across them; empty fields default to this
+	// database's driver and pool settings.
+	Replicas []DatabaseConfig
+
+	// Connections are other databases by name, such as "analytics",
+	// reached with ORM.Using.
+	Connections map[string]DatabaseConfig
+
+	// EncryptionKeys is the keyring of this database's encrypted model
+	// attributes, newest first. Each key is a secret of at least 32 bytes;
+	// the first encrypts and all of them decrypt, so keys can be rotated.
+	EncryptionKeys []string
 }
 
 // ServerConfig holds HTTP server configuration.
@@ -23,7 +23,9 @@ package gor
 import (
 	"context"
 	"database/sql"
+	"io"
 	"reflect"
+	"strings"
 	"time"
 )
 
@@ -35,11 +37,23 @@ type ORM interface {
 	Close() error
 	DB() *sql.DB
 
+	// WithContext returns an ORM whose statements run with ctx
+	WithContext(ctx context.Context) ORM
+
+	// Using returns an ORM whose statements run on the named database:
+	// "primary", "replica" or one of DatabaseConfig.Connections
+	Using(name string) ORM
+
 	// Migration management
 	Migrate(ctx context.Context) error
 	Rollback(ctx context.Context, steps int) error
 	MigrationStatus(ctx context.Context) ([]Migration, error)
 
+	// DumpSchema writes the database schema and the applied migration
+	// versions as SQL; LoadSchema replaces the database's tables with a dump
+	DumpSchema(w io.Writer) error
+	LoadSchema(r io.Reader) error
+
 	// Model operations
 	Register(models ...interface{}) error
 	Table(name string) Table
@@ -63,6 +77,22 @@ type QueryBuilder interface {
 	Where(condition string, args ...interface{}) QueryBuilder
 	WhereMap(conditions map[string]interface{}) QueryBuilder
 	Not(condition string, args ...interface{}) QueryBuilder
+	Or(fn func(QueryBuilder) QueryBuilder) QueryBuilder
+
+	// Subqueries
+	WhereIn(column string, subquery QueryBuilder) QueryBuilder
+	WhereExists(subquery QueryBuilder) QueryBuilder
+	WhereNotExists(subquery QueryBuilder) QueryBuilder
+
+	// WhereJSON compares the value at a JSON path, such as $.theme, inside
+	// a JSON column
+	WhereJSON(column, path, operator string, value interface{}) QueryBuilder
+
+	// Projection and grouping
+	Select(columns ...string) QueryBuilder
+	Distinct() QueryBuilder
+	Group(columns ...string) QueryBuilder
+	Having(condition string, args ...interface{}) QueryBuilder
 
 	// Ordering and limiting
 	Order(field string) QueryBuilder
@@ -73,6 +103,14 @@ type QueryBuilder interface {
 	// Pagination
 	Page(page, size int) QueryBuilder
 
+	// Keyset pagination over the Order columns
+	After(cursor string) QueryBuilder
+	Before(cursor string) QueryBuilder
+	FindPage(dest interface{}) (PageCursors, error)
+
+	// Full-text search over the columns tagged searchable
+	Search(query string) QueryBuilder
+
 	// Joins and includes
 	Joins(table string) QueryBuilder
 	LeftJoin(table string) QueryBuilder
@@ -92,14 +130,31 @@ type QueryBuilder interface {
 	Find(dest interface{}) error
 	FindAll(dest interface{}) error
 	Exists() (bool, error)
+	Pluck(column string, dest interface{}) error
 
 	// Batch operations
 	FindInBatches(dest interface{}, batchSize int, fn func(tx Transaction, batch interface{}) error) error
 	UpdateAll(updates map[string]interface{}) (int64, error)
 	DeleteAll() (int64, error)
 
+	// Soft deletes
+	Unscoped() QueryBuilder
+	WithDeleted() QueryBuilder
+	OnlyDeleted() QueryBuilder
+	Restore() (int64, error)
+	HardDelete() (int64, error)
+
+	// Pessimistic locking (within a transaction). SQLite transactions hold
+	// the database write lock from BEGIN IMMEDIATE, so there both are
+	// no-ops: ForUpdate is already in effect and ForShare does nothing.
+	ForUpdate() QueryBuilder
+	ForShare() QueryBuilder
+
 	// Raw SQL
 	Raw(sql string, args ...interface{}) QueryBuilder
+
+	// Context for cancellation and deadlines
+	WithContext(ctx context.Context) QueryBuilder
 }
 
 // Table represents a database table with Active Record-style methods.
@@ -119,11 +174,32 @@ type Table interface {
 	BulkUpdate(models interface{}) error
 	BulkDelete(ids interface{}) error
 
+	// Upserts
+	Upsert(model interface{}, onConflict OnConflict) error
+	BulkUpsert(models interface{}, onConflict OnConflict) ([]int64, error)
+
 	// Schema operations
 	AddColumn(column Column) error
 	DropColumn(name string) error
 	AddIndex(index Index) error
 	DropIndex(name string) error
+
+	// WithContext returns the table with statements run with ctx
+	WithContext(ctx context.Context) Table
+}
+
+// OnConflict says how an upsert treats rows that collide with existing
+// rows on a unique key.
+type OnConflict struct {
+	// Columns is the unique key that rows conflict on
+	Columns []string
+
+	// Update lists the columns overwritten with the new row's values. When
+	// empty, every column except the key, id and created_at is updated.
+	Update []string
+
+	// DoNothing keeps existing rows unchanged
+	DoNothing bool
 }
 
 // Transaction provides transactional database operations.
@@ -138,10 +214,20 @@ type Transaction interface {
 	Delete(model interface{}) error
 	Query(model interface{}) QueryBuilder
 
+	// Nested transactions (savepoints) and completion callbacks, which
+	// run once the outermost transaction finishes
+	Transaction(fn func(tx Transaction) error) error
+	AfterCommit(fn func())
+	AfterRollback(fn func())
+
 	// Raw SQL
 	Exec(sql string, args ...interface{}) (sql.Result, error)
 	QuerySQL(sql string, args ...interface{}) (*sql.Rows, error)
 	QueryRow(sql string, args ...interface{}) *sql.Row
+
+	// WithContext returns a view of the transaction whose statements run
+	// with ctx
+	WithContext(ctx context.Context) Transaction
 }
 
 // Model defines the base interface for all ORM models.
@@ -178,6 +264,69 @@ type BaseModel struct {
 	UpdatedAt time.Time `gor:"updated_at" json:"updated_at"`
 }
 
+// Change is a column's value when the model was loaded and its value now.
+type Change struct {
+	Old interface{}
+	New interface{}
+}
+
+// Trackable is implemented by models that embed Tracked.
+type Trackable interface {
+	DirtyState() (loaded map[string]interface{}, saved map[string]Change)
+	SetDirtyState(loaded map[string]interface{}, saved map[string]Change)
+}
+
+// Tracked records the column values a model was loaded or last saved with,
+// so the ORM can tell which columns changed and update only those. Embed
+// it in a model, next to BaseModel, to opt in. A model embedding it is no
+// longer comparable with ==.
+type Tracked struct {
+	loaded map[string]interface{}
+	saved  map[string]Change
+}
+
+// DirtyState returns the column values the model was loaded or last saved
+// with, and the changes that save wrote.
+func (t *Tracked) DirtyState() (map[string]interface{}, map[string]Change) {
+	return t.loaded, t.saved
+}
+
+// SetDirtyState records the column values the model was loaded or saved
+// with, and the changes the save wrote.
+func (t *Tracked) SetDirtyState(loaded map[string]interface{}, saved map[string]Change) {
+	t.loaded = loaded
+	t.saved = saved
+}
+
+// SearchResult is implemented by models that embed SearchHit.
+type SearchResult interface {
+	SetSearchResult(rank float64, snippet string)
+}
+
+// SearchHit holds how well a row returned by QueryBuilder.Search matched.
+// Embed it in a model to receive the rank and snippet of each result.
+type SearchHit struct {
+	rank    float64
+	snippet string
+}
+
+// SearchRank returns the bm25 rank of the result; lower is a better match.
+func (h *SearchHit) SearchRank() float64 {
+	return h.rank
+}
+
+// SearchSnippet returns an HTML-escaped excerpt of the best matching
+// column with the matched terms wrapped in <mark> tags.
+func (h *SearchHit) SearchSnippet() string {
+	return h.snippet
+}
+
+// SetSearchResult records the rank and snippet of a search result.
+func (h *SearchHit) SetSearchResult(rank float64, snippet string) {
+	h.rank = rank
+	h.snippet = snippet
+}
+
 func (m *BaseModel) GetID() interface{}       { return m.ID }
 func (m *BaseModel) SetID(id interface{})     { m.ID = id.(uint) }
 func (m *BaseModel) GetCreatedAt() time.Time  { return m.CreatedAt }
@@ -257,6 +406,44 @@ func (e ValidationError) Error() string {
 	return e.Message
 }
 
+// ValidationErrors collects every failed rule for a model, in field order
+type ValidationErrors []ValidationError
+
+func (ve ValidationErrors) Error() string {
+	messages := make([]string, len(ve))
+	for i, e := range ve {
+		messages[i] = e.Field + " " + e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// On returns the messages recorded for a field
+func (ve ValidationErrors) On(field string) []string {
+	var messages []string
+	for _, e := range ve {
+		if e.Field == field {
+			messages = append(messages, e.Message)
+		}
+	}
+	return messages
+}
+
+// ByField groups the messages by field, ready to render next to form inputs
+func (ve ValidationErrors) ByField() map[string][]string {
+	fields := make(map[string][]string)
+	for _, e := range ve {
+		fields[e.Field] = append(fields[e.Field], e.Message)
+	}
+	return fields
+}
+
+// PageCursors are the opaque cursors of the pages around a keyset page.
+// A cursor is empty when there is no page in that direction.
+type PageCursors struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
 // Scope allows for reusable query logic
 type Scope func(QueryBuilder) QueryBuilder
 
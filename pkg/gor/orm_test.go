@@ -11,6 +11,12 @@ type TestModel struct {
 	Name string
 }
 
+// BaseModel, and the models embedding it, stay comparable; change tracking
+// is opted into by embedding Tracked.
+var _ = BaseModel{} == BaseModel{}
+var _ = TestModel{} == TestModel{}
+var _ = map[BaseModel]bool{}
+
 func TestBaseModel(t *testing.T) {
 	model := &TestModel{}
 
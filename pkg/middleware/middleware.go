@@ -12,10 +12,6 @@ import (
 	"github.com/cuemby/gor/pkg/gor"
 )
 
-type contextKey string
-
-const requestIDKey contextKey = "request_id"
-
 // Logger middleware logs HTTP requests
 func Logger() gor.MiddlewareFunc {
 	return func(next gor.HandlerFunc) gor.HandlerFunc {
@@ -121,7 +117,7 @@ func RequestID() gor.MiddlewareFunc {
 			requestID := generateRequestID()
 
 			// Add to context
-			ctx.Context = context.WithValue(ctx.Context, requestIDKey, requestID)
+			ctx.Context = gor.WithRequestID(ctx.Context, requestID)
 
 			// Add to response header
 			ctx.Response.Header().Set("X-Request-ID", requestID)
@@ -131,6 +127,12 @@ func RequestID() gor.MiddlewareFunc {
 	}
 }
 
+// RequestIDFrom returns the ID the RequestID middleware gave a request, or
+// "" when there is none
+func RequestIDFrom(ctx context.Context) string {
+	return gor.RequestIDFrom(ctx)
+}
+
 // RateLimit middleware implements rate limiting
 func RateLimit(requests int, duration time.Duration) gor.MiddlewareFunc {
 	// Simple in-memory rate limiter (production should use Redis or similar)
@@ -225,8 +227,9 @@ func BasicAuth(realm string, users map[string]string) gor.MiddlewareFunc {
 				return ctx.Text(http.StatusUnauthorized, "Unauthorized")
 			}
 
-			// Set user in context
+			// Set user in context, and attribute the request's changes to it
 			ctx.User = username
+			ctx.Context = gor.WithActor(ctx.Context, username)
 
 			return next(ctx)
 		}
@@ -208,7 +208,7 @@ func TestRequestID(t *testing.T) {
 
 	var capturedID string
 	handler := func(ctx *gor.Context) error {
-		if id, ok := ctx.Context.Value(contextKey("request_id")).(string); ok {
+		if id := gor.RequestIDFrom(ctx.Context); id != "" {
 			capturedID = id
 		}
 		return nil
@@ -235,6 +235,10 @@ func TestRequestID(t *testing.T) {
 	if headerID != capturedID {
 		t.Error("Request ID in header doesn't match context")
 	}
+
+	if RequestIDFrom(ctx) != capturedID {
+		t.Errorf("RequestIDFrom() = %q, want %q", RequestIDFrom(ctx), capturedID)
+	}
 }
 
 func TestRateLimit(t *testing.T) {
@@ -367,6 +371,9 @@ func TestBasicAuth(t *testing.T) {
 	if ctx2.User != "admin" {
 		t.Errorf("Expected user 'admin', got '%s'", ctx2.User)
 	}
+	if actor := gor.ActorFrom(ctx2); actor != "admin" {
+		t.Errorf("ActorFrom() = %q, want the authenticated user", actor)
+	}
 
 	// Test with invalid credentials
 	ctx3 := createTestContext("GET", "/test")